@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+// configUsage config 命令的用法
+// Usage of the config command
+const configUsage = "Usage: git-sync [-set key=value]... config show|validate\n       git-sync config init [-force]"
+
+// runConfigCommand 执行 config 子命令并返回退出码
+// Runs the config subcommand and returns the exit code
+// 与同步相同，各层配置按优先级合并（含 -set）；这些命令不需要 Git 仓库，也不写日志
+// As for syncing, the config layers are merged by precedence (including -set); these commands need no git repository and write no logs
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("config "+mode, flag.ExitOnError)
+	force := fs.Bool("force", false, "With init: overwrite an existing git_sync.conf")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), configUsage)
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	// 在仓库外运行时以当前目录代替仓库根目录 / Outside a repository the current directory stands in for the repository root
+	root, err := git.GetRepoRoot()
+	if err != nil {
+		if root, err = os.Getwd(); err != nil {
+			root = "."
+		}
+	}
+	opts := config.DefaultLoadOptions(root, configOverrides)
+
+	switch mode {
+	case "show":
+		return runConfigShow(opts)
+	case "validate":
+		return runConfigValidate(opts)
+	case "init":
+		return runConfigInit(root, *force)
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+}
+
+// runConfigShow 打印所有配置项的生效值及其来源（配置文件行号、环境变量、--set 或默认值）
+// Prints the effective value of every option with where it came from (config file line, environment variable, --set or default)
+func runConfigShow(opts config.LoadOptions) int {
+	res, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitFatal
+	}
+	fmt.Println("# 配置层，优先级从低到高 / Config layers, lowest precedence first:")
+	for _, f := range opts.ConfigFiles() {
+		state := "未找到 / not found"
+		for _, read := range res.Files {
+			if read == f {
+				state = "已读取 / read"
+			}
+		}
+		fmt.Printf("#   %s (%s)\n", f, state)
+	}
+	fmt.Printf("#   %s<KEY>, --set key=value\n", config.EnvPrefix)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 1, ' ', 0)
+	for _, opt := range config.Options() {
+		values := opt.Values(res.Config)
+		if opt.Repeatable {
+			// 可重复的键每条一行，各自带来源 / Repeatable keys get one line per entry, each with its own source
+			sources := res.Sources[opt.Key]
+			for i, v := range values {
+				src := config.Source{}
+				if i < len(sources) {
+					src = sources[i]
+				}
+				fmt.Fprintf(w, "%s\t= %s\t# %s\n", opt.Key, v, src)
+			}
+			if len(values) == 0 {
+				fmt.Fprintf(w, "# %s\t(none)\t# %s\n", opt.Key, config.Source{})
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s\t= %s\t# %s\n", opt.Key, values[0], res.Source(opt.Key))
+	}
+	w.Flush()
+
+	if problems := res.Problems(); len(problems) > 0 {
+		fmt.Printf("# 配置有 %d 个问题，详见 config validate / %d config problem(s), see config validate\n", len(problems), len(problems))
+	}
+	return exitNothingToDo
+}
+
+// runConfigValidate 检查配置文件，按行号报告每个问题；有问题时返回 exitFatal
+// Checks the config file and reports every problem with its line number; returns exitFatal when there are problems
+// 验证错误标注设置该值的行，未设置的值标注为 default
+// Validation errors point at the line that set the value, or default when unset
+func runConfigValidate(opts config.LoadOptions) int {
+	res, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitFatal
+	}
+	if len(res.Files) == 0 {
+		fmt.Printf("配置文件未找到，将使用默认配置 / No config file found, defaults will be used: %s\n", res.Path)
+	}
+
+	problems := res.Problems()
+	for _, p := range problems {
+		fmt.Printf("%s: %s\n", p.Source, p.Message)
+	}
+
+	count := len(problems)
+	if count > 0 {
+		fmt.Printf("发现 %d 个问题 / %d problem(s) found\n", count, count)
+		return exitFatal
+	}
+	fmt.Printf("配置有效 / Config is valid: %s\n", strings.Join(res.Files, ", "))
+	return exitNothingToDo
+}
+
+// runConfigInit 在仓库根目录写入全部注释掉的 git_sync.conf，已存在时需要 -force
+// Writes a fully commented git_sync.conf into the repository root; -force is required when it already exists
+func runConfigInit(root string, force bool) int {
+	path := filepath.Join(root, config.ConfigFileName)
+	if _, err := os.Stat(path); err == nil && !force {
+		fmt.Fprintf(os.Stderr, "配置文件已存在，使用 -force 覆盖 / Config file already exists, use -force to overwrite: %s\n", path)
+		return exitFatal
+	}
+	if err := config.GenerateExampleConfig(path); err != nil {
+		fmt.Fprintf(os.Stderr, "写入配置文件失败 / Failed to write config file: %v\n", err)
+		return exitFatal
+	}
+	fmt.Printf("已生成配置文件 / Config file written: %s\n", path)
+	return exitNothingToDo
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/commitmsg"
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/file"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/instance"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/merge"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+	"github.com/find-xposed-magisk/git-sync/internal/subrepo"
+)
+
+// cycleResult 单个同步周期的结果
+// Outcome of a single sync cycle
+type cycleResult int
+
+const (
+	cycleNothingToDo        cycleResult = iota // 无事可做 / Nothing to do
+	cycleSynced                                // 已提交/合并并推送 / Committed or merged and pushed
+	cycleConflictRolledBack                    // 合并冲突已回滚 / Merge conflict rolled back
+	cycleFatal                                 // 致命错误 / Fatal error
+	cycleInterrupted                           // 收到关闭信号，周期提前结束 / Shutdown requested, cycle ended early
+	cycleSecretsBlocked                        // 检测到敏感信息，未提交 / Possible secrets found, nothing committed
+	cycleConflictBranch                        // 合并冲突，本地状态已推送到冲突分支 / Merge conflict, local state pushed to a conflict branch
+)
+
+// errSecretsFound 暂存内容中检测到敏感信息且 secret_scan=block
+// Possible secrets were found in the staged content and secret_scan=block
+var errSecretsFound = errors.New("possible secrets found in staged changes")
+
+// syncer 同步器，持有执行同步周期所需的全部组件
+// Syncer holding every component needed to run a sync cycle
+type syncer struct {
+	ctx          context.Context // 关闭信号取消 / Cancelled on shutdown signal
+	cfg          *config.Config
+	log          *logger.Logger
+	gitOps       *git.GitOps
+	fileProc     *file.FileProcessor
+	subrepoProc  *subrepo.SubrepoProcessor
+	mergeManager *merge.MergeManager
+	commitMsg    *commitmsg.Renderer
+	lastCompact  time.Time       // 上次运行历史压缩的时间 / When history compaction last ran
+	seenSecrets  map[string]bool // 已警告过的敏感信息发现，键为路径和指纹 / Secret findings already warned about, by path and fingerprint
+}
+
+// stagingReport 暂存阶段中需要写入提交信息的文件
+// Files from the staging phase that are mentioned in the commit message
+type stagingReport struct {
+	lfsFiles       []string // 交给 LFS 追踪的文件 / Files handed to LFS
+	ignoredForSize []string // 因大小写入忽略文件的文件 / Files added to the ignore file for their size
+}
+
+// runCycle 执行一个完整的同步周期
+// Runs one complete sync cycle
+func (s *syncer) runCycle() (cycleResult, error) {
+	cfg, log, gitOps := s.cfg, s.log, s.gitOps
+	fileProc, subrepoProc, mergeManager := s.fileProc, s.subrepoProc, s.mergeManager
+
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	log.Timestamp("开始同步周期 / Starting sync cycle")
+
+	// =================== 阶段-1: 全局锁检测 / Phase -1: Global lock check ===================
+	s.checkIndexLock()
+	if err := s.interrupted(); err != nil {
+		return cycleInterrupted, err
+	}
+
+	// =================== 阶段0: 健康检查 / Phase 0: Health check ===================
+	if err := performHealthCheck(gitOps, log); err != nil {
+		log.Error("健康检查失败 / Health check failed: %v", err)
+		// 尝试修复后继续
+		// Continue after attempting repair
+	}
+
+	// =================== 阶段1: 特殊仓库处理 / Phase 1: Special repository processing ===================
+	log.Info("阶段1：处理特殊仓库 / Phase 1: Processing special repositories")
+	if err := subrepoProc.ProcessAllSubrepos(); err != nil {
+		log.Error("Failed to process subrepos: %v", err)
+	}
+	if err := s.interrupted(); err != nil {
+		return cycleInterrupted, err
+	}
+
+	// =================== 阶段1.5: 清理孤儿gitdir / Phase 1.5: Clean orphaned gitdir ===================
+	log.Info("阶段1.5：清理孤儿gitdir目录 / Phase 1.5: Cleaning orphaned gitdir directories")
+	if err := subrepoProc.CleanOrphanedGitdirs(); err != nil {
+		log.Error("Failed to clean orphaned gitdirs: %v", err)
+	}
+
+	// =================== 阶段2: 智能.gitignore清理 / Phase 2: Intelligent .gitignore cleanup ===================
+	log.Info("阶段2：智能清理.gitignore规则变化 / Phase 2: Intelligent cleanup of .gitignore rule changes")
+	if err := cleanIgnoredFiles(cfg, gitOps, fileProc, log); err != nil {
+		log.Error("Failed to clean ignored files: %v", err)
+	}
+	if err := s.interrupted(); err != nil {
+		return cycleInterrupted, err
+	}
+
+	// =================== 阶段3: 常规文件处理 / Phase 3: Regular file processing ===================
+	log.Info("阶段3：处理常规文件变更 / Phase 3: Processing regular file changes")
+
+	// 处理已删除文件
+	// Process deleted files
+	log.Debug("处理已删除文件 / Processing deleted files")
+	if err := processDeletedFiles(cfg, gitOps, fileProc, log); err != nil {
+		log.Error("Failed to process deleted files: %v", err)
+	}
+
+	// 处理修改和新增文件
+	// Process modified and new files
+	log.Debug("处理修改和新增文件 / Processing modified and new files")
+	report := &stagingReport{}
+	if err := processModifiedFiles(cfg, gitOps, fileProc, log, report); err != nil {
+		log.Error("Failed to process modified files: %v", err)
+	}
+
+	// 处理空目录
+	// Process empty directories
+	if err := fileProc.HandleEmptyDirectories(); err != nil {
+		log.Error("Failed to handle empty directories: %v", err)
+	}
+	if err := s.interrupted(); err != nil {
+		return cycleInterrupted, err
+	}
+
+	// =================== 阶段3.5: 敏感信息扫描 / Phase 3.5: Secret scanning ===================
+	// 已暂存的内容在提交前扫描；block 模式下直接结束周期，避免合并阶段提交暂存的内容
+	// Staged content is scanned before committing; block mode ends the cycle right here so the merge phase cannot commit it
+	if cfg.SecretScan != config.SecretScanOff {
+		log.Info("阶段3.5：扫描敏感信息 / Phase 3.5: Scanning for secrets")
+		blocked, err := s.scanStagedSecrets()
+		if err != nil {
+			log.Error("敏感信息扫描失败，本周期不提交 / Secret scan failed, not committing in this cycle: %v", err)
+			return cycleFatal, err
+		}
+		if blocked {
+			return cycleSecretsBlocked, errSecretsFound
+		}
+	}
+
+	// =================== 统一提交阶段 / Unified commit phase ===================
+	// 【核心改进】学习Shell版本的统一提交点设计
+	// [Core Improvement] Learn from Shell version's unified commit point design
+	log.Info("统一提交阶段：提交所有暂存变更 / Unified commit phase: Committing all staged changes")
+	committed := false
+	hasChanges, err := gitOps.HasStagedChanges()
+	if err != nil {
+		log.Error("Failed to check staged changes: %v", err)
+	}
+	// 演练模式下索引未被修改，改为检查计划中的暂存动作
+	// In dry-run mode the index is untouched, so check the planned staging actions instead
+	if gitOps.Plan().Has(plan.ActionStage, plan.ActionUntrack, plan.ActionIndexUpdate) {
+		hasChanges = true
+	}
+
+	if hasChanges {
+		log.Info("提交所有阶段的暂存变更 / Committing staged changes from all phases")
+		commitMsg := s.commitMessage(timestamp, report)
+		if err := gitOps.Commit(commitMsg); err != nil {
+			log.Error("Failed to commit: %v", err)
+		} else {
+			committed = true
+			// 【核心改进】提交后立即推送，避免时序竞态
+			// [Core Improvement] Push immediately after commit to avoid race condition
+			log.Info("立即推送当前提交 / Pushing current commit immediately")
+			if err := gitOps.Push(); err != nil {
+				log.Warn("推送失败，将在合并后重试 / Push failed, will retry after merge: %v", err)
+			}
+		}
+	} else {
+		log.Info("无新变更需要提交 / No new changes to commit")
+	}
+
+	// =================== 阶段4: 远程同步 / Phase 4: Remote sync ===================
+	log.Info("")
+	log.Info("阶段4：与远程同步（智能三路合并）/ Phase 4: Syncing with remote (Intelligent three-way merge)")
+	
+	// 演练模式同样执行 fetch，但获取到私有命名空间，用于预测合并结果
+	// Dry-run still fetches, into a private namespace, so the merge can be predicted
+
+	if err := s.interrupted(); err != nil {
+		return cycleInterrupted, err
+	}
+	if err := gitOps.Fetch(); err != nil {
+		if ierr := s.interrupted(); ierr != nil {
+			return cycleInterrupted, ierr
+		}
+		log.Error("Failed to fetch: %v", err)
+		return cycleFatal, err
+	}
+
+	mergeResult, err := mergeManager.SmartThreeWayMerge()
+	if err != nil {
+		log.Warn("[警告] 智能合并未完全成功 / [WARNING] Intelligent merge not fully successful: %v", err)
+		if mergeResult == merge.MergeConflict && errors.Is(err, merge.ErrMergeConflict) {
+			return cycleConflictRolledBack, err
+		}
+		if mergeResult == merge.MergeInterrupted {
+			return cycleInterrupted, err
+		}
+		return cycleFatal, err
+	}
+
+	// 按计划压缩自动同步提交 / Compact auto-sync commits on schedule
+	if cfg.CompactInterval > 0 && time.Since(s.lastCompact) >= cfg.CompactInterval {
+		s.lastCompact = time.Now()
+		if _, err := mergeManager.CompactHistory(s.lastCompact); err != nil {
+			log.Warn("历史压缩失败 / History compaction failed: %v", err)
+		}
+	}
+
+	// 定期清理旧备份分支 / Periodically clean old backup branches
+	if err := mergeManager.CleanupOldBackups(cfg.MaxBackupBranches); err != nil {
+		log.Warn("Failed to cleanup old backups: %v", err)
+	}
+
+	// force-push 已用本地状态覆盖远程，按已同步处理；conflict-branch 的同步分支仍未合并
+	// force-push replaced the remote with the local state, so it counts as synced; with conflict-branch the sync branch is still unmerged
+	if mergeResult == merge.MergeConflictBranch {
+		return cycleConflictBranch, nil
+	}
+	if committed || mergeResult != merge.MergeUpToDate {
+		return cycleSynced, nil
+	}
+	return cycleNothingToDo, nil
+}
+
+// commitMessage 根据暂存变更生成提交信息，失败时退回到简单的带时间戳信息
+// Builds the commit message from the staged changes, falling back to the plain timestamped message on failure
+func (s *syncer) commitMessage(timestamp string, report *stagingReport) string {
+	fallback := fmt.Sprintf("%s All changes at %s", s.cfg.CommitMsgPrefix, timestamp)
+	
+	changes, err := s.gitOps.StagedChanges()
+	if err != nil {
+		s.log.Warn("读取暂存变更失败，使用默认提交信息 / Failed to read staged changes, using plain commit message: %v", err)
+		return fallback
+	}
+	summary := commitmsg.NewSummary(s.cfg.CommitMsgPrefix, timestamp, changes)
+	summary.LFSFiles = report.lfsFiles
+	summary.IgnoredForSize = report.ignoredForSize
+	
+	msg, err := s.commitMsg.Render(summary)
+	if err != nil {
+		s.log.Warn("生成提交信息失败，使用默认提交信息 / Failed to render commit message, using plain commit message: %v", err)
+		return fallback
+	}
+	return msg
+}
+
+// checkIndexLock 在每个周期开始前检测并清理过期的 index.lock 文件
+// Checks and cleans a stale index.lock before each cycle
+func (s *syncer) checkIndexLock() {
+	cfg, log := s.cfg, s.log
+
+	lockPath := filepath.Join(cfg.RepoRoot, ".git", "index.lock")
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		return
+	}
+
+	lockAge := time.Since(info.ModTime())
+	log.Debug("[全局LOCK检测] index.lock 存在，年龄: %v / index.lock exists, age: %v", lockAge, lockAge)
+
+	// 持有者（或其他 git-autosync 实例）仍存活时即使超时也不删除
+	// Never remove the lock while its holder (or another git-autosync instance) is alive, however old it is
+	holder, holderAlive := instance.IndexLockInUse(cfg.RepoRoot)
+	
+	// 如果 lock 文件超过配置时间，认为是残留文件
+	// If lock file is older than configured time, consider it stale
+	if lockAge > cfg.LockFileMaxAge && holderAlive {
+		log.Warn("[全局LOCK检测] index.lock 已存在 %v，但持有者 %s 仍在运行，不清理 / index.lock is %v old but its holder %s is still running, not removing", lockAge, holder, lockAge, holder)
+		select {
+		case <-time.After(cfg.LockWaitTime):
+		case <-s.ctx.Done():
+		}
+	} else if lockAge > cfg.LockFileMaxAge && s.gitOps.DryRun() {
+		s.gitOps.Plan().Record(plan.ActionRemoveLock, lockPath, fmt.Sprintf("age %v", lockAge.Round(time.Second)))
+	} else if lockAge > cfg.LockFileMaxAge {
+		log.Warn("[全局LOCK清理] 发现过期 index.lock (年龄: %v)，尝试清理... / Found stale index.lock (age: %v), cleaning...", lockAge, lockAge)
+		if err := os.Remove(lockPath); err != nil {
+			log.Error("[全局LOCK清理] 清理失败 / Cleanup failed: %v", err)
+		} else {
+			log.Info("[全局LOCK清理] ✓ 过期 lock 文件已清理 / Stale lock file cleaned")
+		}
+	} else {
+		// lock 文件较新，可能是 CNB 平台的 git notes 操作，等待释放
+		// Lock file is recent, might be CNB platform git notes operation, wait for release
+		log.Info("[全局LOCK等待] lock 文件较新 (年龄: %v)，等待 %v 后继续... / Lock file is recent (age: %v), waiting %v...", lockAge, cfg.LockWaitTime, lockAge, cfg.LockWaitTime)
+		select {
+		case <-time.After(cfg.LockWaitTime):
+		case <-s.ctx.Done():
+		}
+	}
+}
+
+// interrupted 在阶段之间检查关闭信号，当前阶段已完成后才停止
+// Checks for shutdown between phases, so the current phase always completes first
+func (s *syncer) interrupted() error {
+	if err := s.ctx.Err(); err != nil {
+		s.log.Warn("收到关闭信号，结束当前周期 / Shutdown requested, ending current cycle")
+		return fmt.Errorf("sync cycle interrupted: %w", err)
+	}
+	return nil
+}
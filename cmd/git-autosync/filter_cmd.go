@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/find-xposed-magisk/git-sync/internal/crypt"
+)
+
+// filterUsage filter 命令的用法
+// Usage of the filter command
+const filterUsage = "Usage: git-sync filter clean|smudge -key FILE\n       git-sync filter keygen [-key FILE]"
+
+// runFilterCommand 执行 filter 子命令并返回退出码
+// Runs the filter subcommand and returns the exit code
+// clean/smudge 由 git 调用：从 stdin 读取内容，把结果写到 stdout，因此不输出任何日志
+// clean/smudge are invoked by git: content is read from stdin and the result written to stdout, so nothing is logged
+func runFilterCommand(args []string, debugMode bool) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, filterUsage)
+		return 2
+	}
+	mode := args[0]
+
+	fs := flag.NewFlagSet("filter "+mode, flag.ExitOnError)
+	keyFile := fs.String("key", "", "Key file (keygen defaults to encrypt_key_file from git_sync.conf)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), filterUsage)
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	switch mode {
+	case "clean", "smudge":
+		if *keyFile == "" {
+			fmt.Fprintln(os.Stderr, filterUsage)
+			return 2
+		}
+		if err := runFilter(mode, *keyFile, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "git-autosync filter %s: %v\n", mode, err)
+			return exitFatal
+		}
+		return exitNothingToDo
+	case "keygen":
+		return runKeygen(*keyFile, debugMode)
+	default:
+		fmt.Fprintln(os.Stderr, filterUsage)
+		return 2
+	}
+}
+
+// runFilter 对一个文件的内容执行 clean（加密）或 smudge（解密）
+// Runs clean (encrypt) or smudge (decrypt) over one file's content
+// smudge 无法解密时（例如没有密钥的克隆）原样输出密文，检出不会因此失败；clean 没有密钥时失败，明文不会被暂存
+// When smudge cannot decrypt (e.g. a clone without the key) the ciphertext is written unchanged so checkouts still
+// succeed; clean fails without the key so the plaintext is never staged
+func runFilter(mode, keyFile string, in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	keyPath, err := crypt.ExpandPath(keyFile)
+	if err != nil {
+		return err
+	}
+	c, err := crypt.LoadKey(keyPath)
+
+	if mode == "clean" {
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(c.Encrypt(data))
+		return err
+	}
+
+	plain := data
+	if err == nil {
+		plain, err = c.Decrypt(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "git-autosync filter smudge: %v, leaving content encrypted\n", err)
+		plain = data
+	}
+	_, err = out.Write(plain)
+	return err
+}
+
+// runKeygen 生成加密密钥文件，未指定 -key 时使用配置中的 encrypt_key_file
+// Generates the encryption key file, using encrypt_key_file from the config when -key is not given
+func runKeygen(keyFile string, debugMode bool) int {
+	if keyFile == "" {
+		cfg, _, cleanup, err := setupEnvironment(debugMode)
+		if err != nil {
+			return exitFatal
+		}
+		cleanup()
+		keyFile = cfg.EncryptKeyFile
+	}
+
+	keyPath, err := crypt.ExpandPath(keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无效路径 / Invalid path: %s: %v\n", keyFile, err)
+		return exitFatal
+	}
+	if err := crypt.GenerateKey(keyPath); err != nil {
+		fmt.Fprintf(os.Stderr, "生成密钥失败 / Failed to generate key: %v\n", err)
+		return exitFatal
+	}
+	fmt.Printf("已生成密钥 / Key generated: %s\n", keyPath)
+	fmt.Println("请另行备份此文件，丢失后无法解密 / Back this file up separately; encrypted files cannot be recovered without it")
+	return exitNothingToDo
+}
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/find-xposed-magisk/git-sync/internal/batch"
+	"github.com/find-xposed-magisk/git-sync/internal/commitmsg"
 	"github.com/find-xposed-magisk/git-sync/internal/config"
 	"github.com/find-xposed-magisk/git-sync/internal/file"
 	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/instance"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
 	"github.com/find-xposed-magisk/git-sync/internal/merge"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 	"github.com/find-xposed-magisk/git-sync/internal/subrepo"
+	"github.com/find-xposed-magisk/git-sync/internal/watcher"
 )
 
 // Version information injected by GoReleaser via ldflags
@@ -25,11 +34,31 @@ var (
 	date    = "unknown" // Build date / 构建日期
 )
 
+// 单次同步(once)的退出码
+// Exit codes of a single sync cycle (once)
+// 2 保留给 flag 包的参数错误 / 2 is reserved for flag parsing errors
+const (
+	exitNothingToDo        = 0 // 无事可做 / Nothing to do
+	exitFatal              = 1 // 致命错误 / Fatal error
+	exitSynced             = 3 // 已提交并推送 / Committed and pushed
+	exitConflictRolledBack = 4 // 合并冲突已回滚 / Merge conflict rolled back
+	exitSecretsBlocked     = 5 // 检测到敏感信息，未提交 / Possible secrets found, nothing committed
+	exitConflictBranch     = 6 // 合并冲突，本地状态已推送到冲突分支 / Merge conflict, local state pushed to a conflict branch
+)
+
+// dryRunListLimit 文本计划中每类动作最多列出的条目数
+// Maximum number of entries listed per action kind in the text plan
+const dryRunListLimit = 50
+
 func main() {
 	// 解析命令行参数
 	// Parse command line arguments
 	debugMode := flag.Bool("debug", false, "Enable debug mode (verbose logging)")
 	showVersion := flag.Bool("version", false, "Show version information and exit")
+	dryRun := flag.Bool("dry-run", false, "Run one cycle without changing the index, working tree or remote, and print the plan")
+	jsonOutput := flag.Bool("json", false, "With -dry-run: print the plan as JSON on stdout (logs go to stderr)")
+	flag.Var(&configOverrides, "set", "Override a config value for this run, key=value (repeatable, highest precedence)")
+	flag.Usage = usage
 	flag.Parse()
 
 	// 显示版本信息后退出
@@ -41,21 +70,240 @@ func main() {
 		os.Exit(0)
 	}
 	
+	// 子命令分发
+	// Subcommand dispatch
+	command := flag.Arg(0)
+	switch command {
+	case "", "once", "compact":
+	case "subrepo":
+		if *dryRun || *jsonOutput {
+			fmt.Fprintln(os.Stderr, "subrepo 命令不支持 -dry-run / The subrepo command does not support -dry-run")
+			os.Exit(2)
+		}
+		os.Exit(runSubrepoCommand(flag.Args()[1:], *debugMode))
+	case "filter":
+		if *dryRun || *jsonOutput {
+			fmt.Fprintln(os.Stderr, "filter 命令不支持 -dry-run / The filter command does not support -dry-run")
+			os.Exit(2)
+		}
+		os.Exit(runFilterCommand(flag.Args()[1:], *debugMode))
+	case "config":
+		if *dryRun || *jsonOutput {
+			fmt.Fprintln(os.Stderr, "config 命令不支持 -dry-run / The config command does not support -dry-run")
+			os.Exit(2)
+		}
+		os.Exit(runConfigCommand(flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令 / Unknown command: %s\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+	
+	if *jsonOutput && !*dryRun {
+		fmt.Fprintln(os.Stderr, "-json 需要与 -dry-run 一起使用 / -json requires -dry-run")
+		os.Exit(2)
+	}
+	
+	// 演练模式：JSON 输出独占 stdout，日志写到 stderr
+	// Dry-run mode: JSON output owns stdout, logs are written to stderr
+	var dryRunPlan *plan.Plan
+	planOut := os.Stdout
+	if *dryRun {
+		dryRunPlan = plan.New()
+		if *jsonOutput {
+			logOutput = os.Stderr
+		}
+	}
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	s, cleanup, err := newSyncer(ctx, *debugMode, dryRunPlan)
+	if err != nil {
+		os.Exit(exitFatal)
+	}
+	handleShutdownSignals(cancel, s.log)
+	
+	if command == "compact" {
+		code := runCompact(s, *jsonOutput, planOut)
+		cleanup()
+		os.Exit(code)
+	}
+	
+	if *dryRun {
+		code := runDryRun(s, *jsonOutput, planOut)
+		cleanup()
+		os.Exit(code)
+	}
+	
+	if command == "once" {
+		code := runOnce(s)
+		cleanup()
+		os.Exit(code)
+	}
+	
+	defer cleanup()
+	runDaemon(s, *debugMode)
+}
+
+// configOverrides -set 给出的配置覆盖，优先级最高
+// Config overrides given with -set, highest precedence
+var configOverrides overrideFlags
+
+// logOutput 终端日志和配置加载信息的输出位置
+// Where terminal logs and config load messages are written
+var logOutput io.Writer = os.Stdout
+
+// overrideFlags 可重复的 -set key=value 参数
+// Repeatable -set key=value flag
+type overrideFlags []string
+
+// String 实现 flag.Value
+// Implements flag.Value
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, ", ")
+}
+
+// Set 实现 flag.Value
+// Implements flag.Value
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
+// usage 打印命令行帮助
+// Prints command line help
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: git-sync [flags] [command]\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	fmt.Fprintf(out, "  (none)    持续同步（守护进程）/ Sync continuously (daemon)\n")
+	fmt.Fprintf(out, "            配置文件变化或收到 SIGHUP 时在周期之间重新加载 / Reloads the config between cycles when it changes or on SIGHUP\n")
+	fmt.Fprintf(out, "  once      执行一个同步周期后退出 / Run exactly one sync cycle and exit\n")
+	fmt.Fprintf(out, "            退出码 / Exit codes: %d=nothing to do, %d=fatal error, %d=committed and pushed, %d=merge conflict rolled back,\n",
+		exitNothingToDo, exitFatal, exitSynced, exitConflictRolledBack)
+	fmt.Fprintf(out, "            %d=possible secrets found, nothing committed, %d=merge conflict pushed to a conflict branch\n",
+		exitSecretsBlocked, exitConflictBranch)
+	fmt.Fprintf(out, "  compact   立即压缩自动同步提交后退出 / Compact auto-sync commits now and exit\n")
+	fmt.Fprintf(out, "            退出码 / Exit codes: %d=nothing to compact, %d=fatal error, %d=compacted\n",
+		exitNothingToDo, exitFatal, exitSynced)
+	fmt.Fprintf(out, "  subrepo restore [-force] [-ref REF] [path...]\n")
+	fmt.Fprintf(out, "            从已提交的 gitdir 恢复子仓库的 .git / Restore sub-repository .git dirs from the committed gitdir\n")
+	fmt.Fprintf(out, "  filter keygen [-key FILE]\n")
+	fmt.Fprintf(out, "            生成 encrypt_patterns 使用的密钥 / Generate the key used by encrypt_patterns\n")
+	fmt.Fprintf(out, "  filter clean|smudge -key FILE\n")
+	fmt.Fprintf(out, "            由 git 调用的加密过滤器 / Encryption filter invoked by git\n")
+	fmt.Fprintf(out, "  config show|validate\n")
+	fmt.Fprintf(out, "            显示生效的配置及来源，或按行号检查配置文件 / Show the effective config with sources, or check the config file by line\n")
+	fmt.Fprintf(out, "  config init [-force]\n")
+	fmt.Fprintf(out, "            生成带说明的 git_sync.conf / Write a documented git_sync.conf\n\n")
+	fmt.Fprintf(out, "Config precedence / 配置优先级 (lowest first):\n")
+	fmt.Fprintf(out, "  defaults, %s/%s, $XDG_CONFIG_HOME/git-autosync/%s, <repo>/%s, <repo>/.git/%s,\n",
+		config.SystemConfigDir, config.ConfigFileName, config.ConfigFileName, config.ConfigFileName, config.ConfigFileName)
+	fmt.Fprintf(out, "  %s<KEY> environment variables, -set key=value\n\n", config.EnvPrefix)
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+// newSyncer 加载配置、初始化日志和所有处理器
+// Loads config, initializes logging and all processors
+// 返回的 cleanup 用于关闭日志文件 / The returned cleanup closes log files
+// dryRunPlan 非 nil 时所有写操作只记录到计划中 / When dryRunPlan is non-nil every mutation is only recorded
+func newSyncer(ctx context.Context, debugMode bool, dryRunPlan *plan.Plan) (*syncer, func(), error) {
+	cfg, log, cleanup, err := setupEnvironment(debugMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	// 单实例保护：同一仓库只允许一个实例修改（演练模式只读，不需要）
+	// Single-instance guard: only one instance may modify a repository (read-only dry-run does not need it)
+	if dryRunPlan == nil {
+		release, err := acquireInstanceLock(cfg.RepoRoot, log)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		closeLogs := cleanup
+		cleanup = func() {
+			release()
+			closeLogs()
+		}
+	}
+	
+	// 创建Git操作实例
+	// Create Git operations instance
+	gitOps := git.NewGitOps(cfg, log).WithContext(ctx)
+	if dryRunPlan != nil {
+		gitOps.SetPlan(dryRunPlan)
+		log.Info("演练模式：不会修改索引、工作区和远程 / Dry-run mode: index, working tree and remote will not be modified")
+	}
+	
+	// 确保依赖已安装
+	// Ensure dependencies are installed
+	if err := gitOps.EnsureDependencies(); err != nil {
+		log.Error("Failed to ensure dependencies: %v", err)
+		cleanup()
+		return nil, nil, err
+	}
+	
+	// 创建各个处理器
+	// Create processors
+	subrepoProc := subrepo.NewSubrepoProcessor(cfg, gitOps, log)
+	subrepoProc.LoadHashCache()
+	
+	commitMsg, err := commitmsg.NewRenderer(cfg)
+	if err != nil {
+		log.Error("Failed to load commit message template: %v", err)
+		cleanup()
+		return nil, nil, err
+	}
+	
+	return &syncer{
+		ctx:          ctx,
+		cfg:          cfg,
+		log:          log,
+		gitOps:       gitOps,
+		fileProc:     file.NewFileProcessor(cfg, gitOps, log),
+		subrepoProc:  subrepoProc,
+		mergeManager: merge.NewMergeManager(cfg, gitOps, log),
+		commitMsg:    commitMsg,
+		seenSecrets:  make(map[string]bool),
+	}, cleanup, nil
+}
+
+// setupEnvironment 创建日志记录器、加载配置并定位仓库根目录
+// Creates the logger, loads the config and locates the repository root
+// 返回的 cleanup 用于关闭日志文件 / The returned cleanup closes log files
+func setupEnvironment(debugMode bool) (*config.Config, *logger.Logger, func(), error) {
+	cleanup := func() {}
+	
 	// 创建日志记录器
 	// Create logger
 	log := logger.NewLogger(true)
+	log.SetOutput(logOutput)
 
-	// 获取工作目录用于加载配置文件
-	// Get working directory for loading config file
-	workDir, err := os.Getwd()
+	// 获取仓库根目录，配置文件相对它查找，因此在子目录中运行也能读到
+	// Get repository root directory; config files are looked up relative to it, so running from a subdirectory finds them too
+	repoRoot, err := git.GetRepoRoot()
 	if err != nil {
-		workDir = "."
+		log.Error("Failed to get repository root: %v", err)
+		return nil, nil, nil, err
 	}
 
-	// 加载配置（从文件或使用默认值）
-	// Load configuration (from file or use defaults)
-	cfg, err := config.LoadConfigFromFile(workDir)
-	if err != nil {
+	// 分层加载配置（系统、用户、仓库、.git/、环境变量、-set）
+	// Load the config layers (system, user, repository, .git/, environment, -set)
+	opts := config.DefaultLoadOptions(repoRoot, configOverrides)
+	opts.Output = logOutput
+	cfg, err := config.LoadConfig(opts)
+	var loadErr *config.LoadError
+	if errors.As(err, &loadErr) {
+		// 严格模式：配置有任何问题都拒绝启动 / Strict mode: refuse to start on any config problem
+		log.Error("严格模式下配置有 %d 个问题，拒绝启动 / Refusing to start, strict mode found %d config problem(s):", len(loadErr.Problems), len(loadErr.Problems))
+		for _, p := range loadErr.Problems {
+			log.Error("  %v", p)
+		}
+		return nil, nil, nil, err
+	} else if err != nil {
 		log.Warn("配置加载警告 / Config load warning: %v", err)
 		cfg = config.DefaultConfig()
 	}
@@ -66,7 +314,7 @@ func main() {
 
 	// 命令行参数可以覆盖配置
 	// Command line parameter can override config
-	if *debugMode {
+	if debugMode {
 		logLevel = logger.DEBUG
 		log.Info("⚙️ DEBUG模式已启用 / DEBUG mode enabled")
 	}
@@ -79,11 +327,11 @@ func main() {
 	if err != nil {
 		// 如果创建失败，只输出到终端
 		// If creation fails, only output to terminal
-		fmt.Printf("Warning: Failed to create multi-level log writer: %v\n", err)
-		fmt.Println("Logs will only be output to terminal.")
+		fmt.Fprintf(logOutput, "Warning: Failed to create multi-level log writer: %v\n", err)
+		fmt.Fprintln(logOutput, "Logs will only be output to terminal.")
 	} else {
 		log.SetMultiLevelWriter(multiWriter)
-		defer multiWriter.Close()
+		cleanup = func() { multiWriter.Close() }
 	}
 	
 	log.Info("=================================================================================")
@@ -91,193 +339,248 @@ func main() {
 	log.Info("  v12.2 智能合并与虚拟环境过滤 / Intelligent Merge & Virtual Env Filter")
 	log.Info("=================================================================================")
 	
-	// 获取仓库根目录
-	// Get repository root directory
-	repoRoot, err := git.GetRepoRoot()
-	if err != nil {
-		log.Error("Failed to get repository root: %v", err)
-		os.Exit(1)
-	}
-	
-	// 配置已在上面加载
-	// Config already loaded above
+	// 仓库根目录已在上面获取
+	// Repository root obtained above
 	cfg.RepoRoot = repoRoot
 	
 	log.Info("仓库根目录 / Repository root: %s", repoRoot)
 	
-	// 创建Git操作实例
-	// Create Git operations instance
-	gitOps := git.NewGitOps(cfg, log)
+	return cfg, log, cleanup, nil
+}
+
+// acquireInstanceLock 获取单实例锁，返回释放函数
+// Acquires the single-instance lock and returns its release function
+func acquireInstanceLock(repoRoot string, log *logger.Logger) (func(), error) {
+	lock, err := instance.Acquire(repoRoot)
+	if err != nil {
+		var held *instance.HeldError
+		if errors.As(err, &held) {
+			log.Error("已有实例在运行，拒绝启动 / Another instance is already running, refusing to start: %s", held.Holder)
+			log.Error("锁文件 / Lock file: %s", held.Path)
+		} else {
+			log.Error("获取实例锁失败 / Failed to acquire instance lock: %v", err)
+		}
+		return nil, err
+	}
+	log.Debug("已获取实例锁 / Instance lock acquired: %s", lock.Info())
+	return func() { lock.Release() }, nil
+}
+
+// runOnce 执行一个同步周期并返回退出码
+// Runs exactly one sync cycle and returns the exit code
+func runOnce(s *syncer) int {
+	result, err := s.runCycle()
+	switch result {
+	case cycleNothingToDo:
+		s.log.Info("单次同步完成：无事可做 / Single cycle complete: nothing to do")
+		return exitNothingToDo
+	case cycleSynced:
+		s.log.Info("单次同步完成：已提交并推送 / Single cycle complete: committed and pushed")
+		return exitSynced
+	case cycleConflictRolledBack:
+		s.log.Warn("单次同步完成：合并冲突已回滚 / Single cycle complete: merge conflict rolled back")
+		return exitConflictRolledBack
+	case cycleSecretsBlocked:
+		s.log.Warn("单次同步完成：检测到敏感信息，未提交 / Single cycle complete: possible secrets found, nothing committed")
+		return exitSecretsBlocked
+	case cycleConflictBranch:
+		s.log.Warn("单次同步完成：合并冲突，本地状态已推送到冲突分支 / Single cycle complete: merge conflict, local state pushed to a conflict branch")
+		return exitConflictBranch
+	case cycleInterrupted:
+		s.log.Warn("单次同步被关闭信号中断 / Single cycle interrupted by shutdown")
+		return exitFatal
+	default:
+		s.log.Error("单次同步失败 / Single cycle failed: %v", err)
+		return exitFatal
+	}
+}
+
+// runCompact 获取远程后立即运行一次历史压缩，不受 compact_interval 限制；演练模式下输出计划
+// Fetches and then runs history compaction once, regardless of compact_interval; prints the plan in dry-run mode
+func runCompact(s *syncer, jsonOutput bool, out io.Writer) int {
+	if err := s.gitOps.Fetch(); err != nil {
+		s.log.Error("Failed to fetch: %v", err)
+		return exitFatal
+	}
+	removed, err := s.mergeManager.CompactHistory(time.Now())
+	if s.gitOps.DryRun() {
+		p := s.gitOps.Plan()
+		if jsonOutput {
+			if werr := p.WriteJSON(out); werr != nil {
+				s.log.Error("输出计划失败 / Failed to write plan: %v", werr)
+				return exitFatal
+			}
+		} else {
+			p.WriteText(out, dryRunListLimit)
+		}
+	}
+	if err != nil {
+		s.log.Error("历史压缩失败 / History compaction failed: %v", err)
+		return exitFatal
+	}
+	if removed == 0 {
+		return exitNothingToDo
+	}
+	return exitSynced
+}
+
+// runDryRun 执行一个演练周期，输出计划并返回与 once 相同语义的退出码
+// Runs one dry-run cycle, prints the plan and returns exit codes with the same meaning as once
+func runDryRun(s *syncer, jsonOutput bool, out io.Writer) int {
+	result, err := s.runCycle()
 	
-	// 确保依赖已安装
-	// Ensure dependencies are installed
-	if err := gitOps.EnsureDependencies(); err != nil {
-		log.Error("Failed to ensure dependencies: %v", err)
-		os.Exit(1)
+	p := s.gitOps.Plan()
+	if jsonOutput {
+		if werr := p.WriteJSON(out); werr != nil {
+			s.log.Error("输出计划失败 / Failed to write plan: %v", werr)
+			return exitFatal
+		}
+	} else {
+		p.WriteText(out, dryRunListLimit)
 	}
 	
-	// 创建各个处理器
-	// Create processors
-	fileProc := file.NewFileProcessor(cfg, gitOps, log)
-	subrepoProc := subrepo.NewSubrepoProcessor(cfg, gitOps, log)
-	mergeManager := merge.NewMergeManager(cfg, gitOps, log)
+	switch result {
+	case cycleNothingToDo:
+		return exitNothingToDo
+	case cycleSynced:
+		return exitSynced
+	case cycleConflictRolledBack:
+		s.log.Warn("演练预测到无法自动解决的合并冲突 / Dry-run predicts unresolvable merge conflicts")
+		return exitConflictRolledBack
+	case cycleSecretsBlocked:
+		s.log.Warn("演练预测到敏感信息，将不会提交 / Dry-run predicts possible secrets, nothing would be committed")
+		return exitSecretsBlocked
+	case cycleConflictBranch:
+		s.log.Warn("演练预测到合并冲突，本地状态将推送到冲突分支 / Dry-run predicts merge conflicts, the local state would go to a conflict branch")
+		return exitConflictBranch
+	default:
+		s.log.Error("演练周期失败 / Dry-run cycle failed: %v", err)
+		return exitFatal
+	}
+}
+
+// runDaemon 持续运行同步周期
+// Runs sync cycles continuously
+// 每个周期开始前检查配置是否需要重新加载（配置文件变化或 SIGHUP）
+// Before each cycle checks whether the config needs reloading (config file changed or SIGHUP)
+func runDaemon(s *syncer, debugMode bool) {
+	cfg, log := s.cfg, s.log
+	
+	// 配置热加载 / Config hot reload
+	reload := newReloader(cfg, config.DefaultLoadOptions(cfg.RepoRoot, configOverrides), debugMode)
+	defer reload.stop()
+	
+	// 文件监听模式：仅在文件变化时触发同步
+	// Watch mode: only trigger sync when files change
+	var fsWatcher *watcher.Watcher
+	if cfg.WatchMode == "inotify" {
+		w, err := watcher.NewWatcher(cfg, s.gitOps, log)
+		if err != nil {
+			log.Warn("文件监听不可用，回退到轮询模式 / File watcher unavailable, falling back to polling: %v", err)
+		} else {
+			fsWatcher = w
+			defer fsWatcher.Close()
+		}
+	}
 	
 	// 主循环
 	// Main loop
 	log.Info("开始主循环，同步间隔: %v / Starting main loop, sync interval: %v", cfg.SleepInterval, cfg.SleepInterval)
 	
-	// 失败计数器 / Failure counter
+	// 失败计数器，重新加载配置时保留 / Failure counter, kept across config reloads
 	consecutiveFailures := 0
-	maxConsecutiveFailures := cfg.MaxConsecutiveFailures
 	
 	for {
-		timestamp := time.Now().Format("2006-01-02 15:04:05")
-		log.Timestamp("开始同步周期 / Starting sync cycle")
-		
-		// =================== 阶段-1: 全局锁检测 / Phase -1: Global lock check ===================
-		// 在每个周期开始前检测并清理过期的 index.lock 文件
-		// Check and clean stale index.lock before each cycle
-		lockPath := filepath.Join(repoRoot, ".git", "index.lock")
-		if info, err := os.Stat(lockPath); err == nil {
-			lockAge := time.Since(info.ModTime())
-			log.Debug("[全局LOCK检测] index.lock 存在，年龄: %v / index.lock exists, age: %v", lockAge, lockAge)
-			
-			// 如果 lock 文件超过配置时间，认为是残留文件
-			// If lock file is older than configured time, consider it stale
-			if lockAge > cfg.LockFileMaxAge {
-				log.Warn("[全局LOCK清理] 发现过期 index.lock (年龄: %v)，尝试清理... / Found stale index.lock (age: %v), cleaning...", lockAge, lockAge)
-				if err := os.Remove(lockPath); err != nil {
-					log.Error("[全局LOCK清理] 清理失败 / Cleanup failed: %v", err)
-				} else {
-					log.Info("[全局LOCK清理] ✓ 过期 lock 文件已清理 / Stale lock file cleaned")
-				}
-			} else {
-				// lock 文件较新，可能是 CNB 平台的 git notes 操作，等待释放
-				// Lock file is recent, might be CNB platform git notes operation, wait for release
-				log.Info("[全局LOCK等待] lock 文件较新 (年龄: %v)，等待 %v 后继续... / Lock file is recent (age: %v), waiting %v...", lockAge, cfg.LockWaitTime, lockAge, cfg.LockWaitTime)
-				time.Sleep(cfg.LockWaitTime)
-			}
-		}
-		
-		// =================== 阶段0: 健康检查 / Phase 0: Health check ===================
-		if err := performHealthCheck(gitOps, log); err != nil {
-			log.Error("健康检查失败 / Health check failed: %v", err)
-			// 尝试修复后继续
-			// Continue after attempting repair
-		}
-		
-		// =================== 阶段1: 特殊仓库处理 / Phase 1: Special repository processing ===================
-		log.Info("阶段1：处理特殊仓库 / Phase 1: Processing special repositories")
-		if err := subrepoProc.ProcessAllSubrepos(); err != nil {
-			log.Error("Failed to process subrepos: %v", err)
-		}
+		reload.check(cfg, log)
+		maxConsecutiveFailures := cfg.MaxConsecutiveFailures
 		
-		// =================== 阶段1.5: 清理孤儿gitdir / Phase 1.5: Clean orphaned gitdir ===================
-		log.Info("阶段1.5：清理孤儿gitdir目录 / Phase 1.5: Cleaning orphaned gitdir directories")
-		if err := subrepoProc.CleanOrphanedGitdirs(); err != nil {
-			log.Error("Failed to clean orphaned gitdirs: %v", err)
+		result, _ := s.runCycle()
+		if s.ctx.Err() != nil {
+			log.Info("已安全停止 / Stopped cleanly")
+			return
 		}
 		
-		// =================== 阶段2: 智能.gitignore清理 / Phase 2: Intelligent .gitignore cleanup ===================
-		log.Info("阶段2：智能清理.gitignore规则变化 / Phase 2: Intelligent cleanup of .gitignore rule changes")
-		if err := cleanIgnoredFiles(cfg, gitOps, fileProc, log); err != nil {
-			log.Error("Failed to clean ignored files: %v", err)
-		}
-		
-		// =================== 阶段3: 常规文件处理 / Phase 3: Regular file processing ===================
-		log.Info("阶段3：处理常规文件变更 / Phase 3: Processing regular file changes")
-		
-		// 处理已删除文件
-		// Process deleted files
-		log.Debug("处理已删除文件 / Processing deleted files")
-		if err := processDeletedFiles(cfg, gitOps, fileProc, log); err != nil {
-			log.Error("Failed to process deleted files: %v", err)
-		}
-		
-		// 处理修改和新增文件
-		// Process modified and new files
-		log.Debug("处理修改和新增文件 / Processing modified and new files")
-		if err := processModifiedFiles(cfg, gitOps, fileProc, log); err != nil {
-			log.Error("Failed to process modified files: %v", err)
-		}
-		
-		// 处理空目录
-		// Process empty directories
-		if err := fileProc.HandleEmptyDirectories(); err != nil {
-			log.Error("Failed to handle empty directories: %v", err)
-		}
-		
-		// =================== 统一提交阶段 / Unified commit phase ===================
-		// 【核心改进】学习Shell版本的统一提交点设计
-		// [Core Improvement] Learn from Shell version's unified commit point design
-		log.Info("统一提交阶段：提交所有暂存变更 / Unified commit phase: Committing all staged changes")
-		hasChanges, err := gitOps.HasStagedChanges()
-		if err != nil {
-			log.Error("Failed to check staged changes: %v", err)
-		}
-		
-		if hasChanges {
-			log.Info("提交所有阶段的暂存变更 / Committing staged changes from all phases")
-			commitMsg := fmt.Sprintf("%s All changes at %s", cfg.CommitMsgPrefix, timestamp)
-			if err := gitOps.Commit(commitMsg); err != nil {
-				log.Error("Failed to commit: %v", err)
-			} else {
-				// 【核心改进】提交后立即推送，避免时序竞态
-				// [Core Improvement] Push immediately after commit to avoid race condition
-				log.Info("立即推送当前提交 / Pushing current commit immediately")
-				if err := gitOps.Push(); err != nil {
-					log.Warn("推送失败，将在合并后重试 / Push failed, will retry after merge: %v", err)
-				}
+		if result == cycleFatal || result == cycleConflictRolledBack || result == cycleSecretsBlocked {
+			consecutiveFailures++
+			log.Warn("[警告] 同步未完全成功 (%d/%d) / [WARNING] Sync not fully successful (%d/%d)", 
+				consecutiveFailures, maxConsecutiveFailures, consecutiveFailures, maxConsecutiveFailures)
+			
+			// 失败保护机制 / Failure protection mechanism
+			if consecutiveFailures >= maxConsecutiveFailures {
+				log.Error("连续失败 %d 次，进入安全模式 / Consecutive failures %d times, entering safe mode", 
+					maxConsecutiveFailures, maxConsecutiveFailures)
+				safeSleep := cfg.SleepInterval * time.Duration(cfg.SafeModeMultiplier)
+				log.Info("延长等待时间至 %v / Extending wait time to %v", safeSleep, safeSleep)
+				wait, stop := reload.wakeOnHangup(s.ctx)
+				sleepContext(wait, safeSleep)
+				stop()
+				consecutiveFailures = 0 // 重置计数器 / Reset counter
+				continue
 			}
-		} else {
-			log.Info("无新变更需要提交 / No new changes to commit")
+		} else if consecutiveFailures > 0 && result != cycleConflictBranch {
+			// 成功后重置失败计数器；冲突分支既不算失败也不算成功 / Reset failure counter on success; a conflict branch counts as neither
+			log.Info("同步成功，重置失败计数器 / Sync successful, resetting failure counter")
+			consecutiveFailures = 0
 		}
 		
-		// =================== 阶段4: 远程同步 / Phase 4: Remote sync ===================
-		log.Info("")
-		log.Info("阶段4：与远程同步（智能三路合并）/ Phase 4: Syncing with remote (Intelligent three-way merge)")
-		
-		if err := gitOps.Fetch(); err != nil {
-			log.Error("Failed to fetch: %v", err)
-			consecutiveFailures++
-		} else {
-			if err := mergeManager.SmartThreeWayMerge(); err != nil {
-				consecutiveFailures++
-				log.Warn("[警告] 智能合并未完全成功 (%d/%d) / [WARNING] Intelligent merge not fully successful (%d/%d)", 
-					consecutiveFailures, maxConsecutiveFailures, consecutiveFailures, maxConsecutiveFailures)
-				
-				// 失败保护机制 / Failure protection mechanism
-				if consecutiveFailures >= maxConsecutiveFailures {
-					log.Error("连续失败 %d 次，进入安全模式 / Consecutive failures %d times, entering safe mode", 
-						maxConsecutiveFailures, maxConsecutiveFailures)
-					safeSleep := cfg.SleepInterval * time.Duration(cfg.SafeModeMultiplier)
-					log.Info("延长等待时间至 %v / Extending wait time to %v", safeSleep, safeSleep)
-					time.Sleep(safeSleep)
-					consecutiveFailures = 0 // 重置计数器 / Reset counter
-					continue
-				}
-			} else {
-				// 成功后重置失败计数器 / Reset failure counter on success
-				if consecutiveFailures > 0 {
-					log.Info("合并成功，重置失败计数器 / Merge successful, resetting failure counter")
-					consecutiveFailures = 0
-				}
-				
-				// 定期清理旧备份分支 / Periodically clean old backup branches
-				if err := mergeManager.CleanupOldBackups(cfg.MaxBackupBranches); err != nil {
-					log.Warn("Failed to cleanup old backups: %v", err)
-				}
-			}
+		// 等待下一个周期，SIGHUP 提前结束等待
+		// Wait for next cycle, SIGHUP ends the wait early
+		wait, stop := reload.wakeOnHangup(s.ctx)
+		waitForNextCycle(wait, cfg, fsWatcher, log)
+		stop()
+		if s.ctx.Err() != nil {
+			log.Info("已安全停止 / Stopped cleanly")
+			return
 		}
+	}
+}
+
+// handleShutdownSignals 第一次 SIGINT/SIGTERM 取消 context，让当前阶段完成或中止后退出；第二次立即退出
+// The first SIGINT/SIGTERM cancels the context so the current phase finishes or aborts before exiting; a second one exits immediately
+func handleShutdownSignals(cancel context.CancelFunc, log *logger.Logger) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	
+	go func() {
+		sig := <-sigCh
+		log.Warn("收到信号 %v，正在安全停止（再次发送将强制退出）/ Received %v, shutting down cleanly (send again to force exit)", sig, sig)
+		cancel()
 		
-		// 等待下一个周期
-		// Wait for next cycle
+		sig = <-sigCh
+		log.Error("再次收到信号 %v，强制退出 / Received %v again, forcing exit", sig, sig)
+		os.Exit(exitFatal)
+	}()
+}
+
+// sleepContext 等待 d 或直到 ctx 取消
+// Sleeps for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// waitForNextCycle 等待下一个同步周期
+// Waits for the next sync cycle
+// 监听模式下文件变化立即触发，SleepInterval 作为最大空闲间隔（用于拉取远程变更）
+// In watch mode file changes trigger immediately, SleepInterval is the max idle interval (to pull remote changes)
+func waitForNextCycle(ctx context.Context, cfg *config.Config, fsWatcher *watcher.Watcher, log *logger.Logger) {
+	if fsWatcher == nil {
 		log.Info("--- 周期完成，等待 %v / Cycle complete. Waiting for %v ---", cfg.SleepInterval, cfg.SleepInterval)
 		log.Info("")
-		time.Sleep(cfg.SleepInterval)
+		sleepContext(ctx, cfg.SleepInterval)
+		return
+	}
+	
+	log.Info("--- 周期完成，等待文件变更（最长 %v）/ Cycle complete. Waiting for file changes (max %v) ---", cfg.SleepInterval, cfg.SleepInterval)
+	log.Info("")
+	if !fsWatcher.WaitForChanges(ctx, cfg.SleepInterval) {
+		log.Debug("达到最大空闲时间，执行周期性同步 / Max idle reached, running periodic sync")
 	}
 }
 
+
 // performHealthCheck 执行仓库健康检查
 // Performs repository health check
 func performHealthCheck(gitOps *git.GitOps, log *logger.Logger) error {
@@ -393,6 +696,9 @@ func cleanIgnoredFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file.Fi
 			EnableMetrics:       true,
 			RetryMaxAttempts:    cfg.BatchRetryMaxAttempts,
 			RetryBaseDelay:      cfg.BatchRetryBaseDelay,
+			Plan:                gitOps.Plan(),
+			Context:             gitOps.Context(),
+			Runner:              gitOps.Runner(),
 		}
 		batchProcessor := batch.NewGitBatchProcessorWithConfig(cfg.RepoRoot, log, batchConfig)
 		if err := batchProcessor.BatchRemove(filesToUntrack); err != nil {
@@ -463,9 +769,9 @@ func processDeletedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file.
 	return nil
 }
 
-// processModifiedFiles 处理修改和新增的文件
-// Processes modified and new files
-func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file.FileProcessor, log *logger.Logger) error {
+// processModifiedFiles 处理修改和新增的文件，交给 LFS 和因大小忽略的文件记录到 report 中
+// Processes modified and new files, recording the files handed to LFS or ignored for size in report
+func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file.FileProcessor, log *logger.Logger, report *stagingReport) error {
 	startTime := time.Now()
 	
 	// 获取修改和新增的文件列表
@@ -505,6 +811,7 @@ func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file
 			// Exceeds ignore threshold
 			if fileSize > cfg.IgnoreSizeThresholdBytes {
 				log.Warn("忽略大文件 / Ignoring large file: %s (%d bytes) -> 添加到 %s", filePath, fileSize, cfg.IgnoreFileName)
+				report.ignoredForSize = append(report.ignoredForSize, filePath)
 				
 				// 将路径写入 .gitignore_nopush（如果不存在则追加）
 				// Append path to .gitignore_nopush if not already present
@@ -527,7 +834,9 @@ func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file
 				
 				// 如果不存在则追加
 				// Append if not exists
-				if !alreadyExists {
+				if !alreadyExists && gitOps.DryRun() {
+					gitOps.Plan().Record(plan.ActionIgnoreAppend, filePath, cfg.IgnoreFileName)
+				} else if !alreadyExists {
 					f, err := os.OpenFile(ignoreFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 					if err == nil {
 						f.WriteString(filePath + "\n")
@@ -550,9 +859,16 @@ func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file
 			// 超过LFS阈值
 			// Exceeds LFS threshold
 			if fileSize > cfg.LFSSizeThresholdBytes {
-				log.Warn("LFS追踪 / LFS tracking: %s (%d bytes)", filePath, fileSize)
-				gitOps.LFSTrack(filePath)
-				gitOps.Add(".gitattributes")
+				if err := gitOps.LFSTrack(filePath); errors.Is(err, git.ErrEncrypted) {
+					// 加密的文件以密文暂存，不交给 LFS / Encrypted files are staged as ciphertext instead of going to LFS
+					log.Warn("'%s' 已加密，不使用 LFS 追踪 / '%s' is encrypted, not tracking it with LFS", filePath, filePath)
+				} else if err != nil {
+					log.Warn("LFS 追踪 '%s' 失败 / Failed to track '%s' with LFS: %v", filePath, filePath, err)
+				} else {
+					log.Warn("LFS追踪 / LFS tracking: %s (%d bytes)", filePath, fileSize)
+					gitOps.Add(".gitattributes")
+					report.lfsFiles = append(report.lfsFiles, filePath)
+				}
 			}
 		}
 		
@@ -573,6 +889,9 @@ func processModifiedFiles(cfg *config.Config, gitOps *git.GitOps, fileProc *file
 			EnableMetrics:       true,
 			RetryMaxAttempts:    cfg.BatchRetryMaxAttempts,
 			RetryBaseDelay:      cfg.BatchRetryBaseDelay,
+			Plan:                gitOps.Plan(),
+			Context:             gitOps.Context(),
+			Runner:              gitOps.Runner(),
 		}
 		batchProcessor := batch.NewGitBatchProcessorWithConfig(cfg.RepoRoot, log, batchConfig)
 		if err := batchProcessor.BatchAdd(filesToStage); err != nil {
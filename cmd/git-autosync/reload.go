@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+// reloader 守护进程的配置热加载：配置文件变化或收到 SIGHUP 后，在两个周期之间重新读取并验证配置
+// Hot reload for the daemon: after a config file changes or SIGHUP arrives the config is re-read and validated between cycles
+// 可以在运行中生效的配置项（Option.Live）直接写入共享的 *config.Config，其余变化只记录，重启后生效；
+// 因此 HashCache、失败计数和安全模式状态都得以保留
+// Options that can be applied while running (Option.Live) are written into the shared *config.Config, other changes are
+// only logged and take effect after a restart; the HashCache, failure counter and safe mode state are kept
+type reloader struct {
+	opts     config.LoadOptions
+	debug    bool                 // -debug 固定日志级别 / -debug pins the log level
+	accepted *config.Config       // 上次接受的配置文件内容 / Config files as last accepted
+	stamps   map[string]fileStamp // 各层配置文件上次的状态 / Last seen state of each layer's config file
+	hup      chan os.Signal
+	hangup   atomic.Bool // 收到 SIGHUP 尚未处理 / SIGHUP received and not handled yet
+}
+
+// fileStamp 用于检测配置文件变化的修改时间和大小，文件不存在时为零值
+// Modification time and size used to detect config file changes; zero when the file does not exist
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newReloader 记录启动时的配置和配置文件的状态并开始接收 SIGHUP
+// Records the startup config and the state of the config files and starts receiving SIGHUP
+func newReloader(cfg *config.Config, opts config.LoadOptions, debug bool) *reloader {
+	// 副本不受之后 ApplyLive 的影响 / The copy is not affected by later ApplyLive calls
+	accepted := *cfg
+	r := &reloader{opts: opts, debug: debug, accepted: &accepted, hup: make(chan os.Signal, 1)}
+	r.filesChanged()
+	signal.Notify(r.hup, syscall.SIGHUP)
+	return r
+}
+
+// stop 停止接收 SIGHUP
+// Stops receiving SIGHUP
+func (r *reloader) stop() {
+	signal.Stop(r.hup)
+}
+
+// wakeOnHangup 返回收到 SIGHUP 时取消的 context，用它等待可以让 SIGHUP 立即结束周期之间的等待
+// Returns a context that is cancelled when SIGHUP arrives; waiting on it lets SIGHUP end the wait between cycles at once
+// 周期运行中收到的 SIGHUP 保留在通道中，下一次等待立即结束
+// A SIGHUP received while a cycle runs stays in the channel and ends the next wait immediately
+func (r *reloader) wakeOnHangup(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-r.hup:
+			r.hangup.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// filesChanged 检查各层配置文件自上次检查以来是否被修改、创建或删除
+// Checks whether any layer's config file was modified, created or removed since the last check
+func (r *reloader) filesChanged() bool {
+	stamps := make(map[string]fileStamp)
+	changed := false
+	for _, path := range r.opts.ConfigFiles() {
+		var stamp fileStamp
+		if info, err := os.Stat(path); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps[path] = stamp
+		if old, ok := r.stamps[path]; ok && (!old.modTime.Equal(stamp.modTime) || old.size != stamp.size) {
+			changed = true
+		}
+	}
+	r.stamps = stamps
+	return changed
+}
+
+// check 在两个周期之间调用，收到 SIGHUP 或配置文件变化时重新加载
+// Called between cycles; reloads when SIGHUP was received or a config file changed
+func (r *reloader) check(cfg *config.Config, log *logger.Logger) {
+	changed := r.filesChanged()
+	switch {
+	case r.hangup.Swap(false):
+		r.reload(cfg, log, "收到 SIGHUP / SIGHUP received")
+	case changed:
+		r.reload(cfg, log, "配置文件已修改 / config file changed")
+	}
+}
+
+// reload 重新读取并验证配置，把可以在运行中生效的变化写入 cfg 并记录差异
+// Re-reads and validates the config, writes the changes that can be applied while running into cfg and logs the diff
+// 差异相对于上次接受的配置计算，需要重启的变化只在第一次出现时警告
+// The diff is taken against the last accepted config, so a change that needs a restart is only warned about once
+// 新配置有任何问题时拒绝整个重新加载，cfg 保持不变
+// The whole reload is rejected and cfg left untouched when the new config has any problem
+func (r *reloader) reload(cfg *config.Config, log *logger.Logger, reason string) {
+	log.Info("重新加载配置 / Reloading config: %s", reason)
+
+	res, err := config.Load(r.opts)
+	if err != nil {
+		log.Error("重新加载配置失败，保留当前配置 / Config reload failed, keeping the current config: %v", err)
+		return
+	}
+	if problems := res.Problems(); len(problems) > 0 {
+		log.Error("新配置有 %d 个问题，保留当前配置 / New config has %d problem(s), keeping the current config:", len(problems), len(problems))
+		for _, p := range problems {
+			log.Error("  %v", p)
+		}
+		return
+	}
+
+	changes := config.Diff(r.accepted, res.Config)
+	if len(changes) == 0 {
+		log.Info("配置没有变化 / Config unchanged")
+		return
+	}
+	// 与运行中的值仍然不同、需要重启的配置项 / Options that still differ from the running value and need a restart
+	pending := make(map[string]bool)
+	for _, c := range config.Diff(cfg, res.Config) {
+		pending[c.Key] = !c.Live
+	}
+	for _, c := range changes {
+		from, to := strings.Join(c.Old, "; "), strings.Join(c.New, "; ")
+		switch {
+		case c.Live:
+			log.Info("  %s: '%s' -> '%s'", c.Key, from, to)
+		case pending[c.Key]:
+			log.Warn("  %s: '%s' -> '%s' 需要重启才能生效 / takes effect after a restart", c.Key, from, to)
+		default:
+			log.Info("  %s: '%s' -> '%s' 与运行中的值相同 / matches the running value", c.Key, from, to)
+		}
+	}
+
+	config.ApplyLive(cfg, res.Config)
+	r.accepted = res.Config
+	if !r.debug {
+		log.SetLevel(parseLogLevel(cfg.LogLevel))
+	}
+	log.Info("配置已重新加载 / Config reloaded")
+}
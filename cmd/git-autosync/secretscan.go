@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+	"github.com/find-xposed-magisk/git-sync/internal/secrets"
+)
+
+// scanStagedSecrets 扫描已暂存的内容，按 secret_scan 取消暂存问题文件，或返回 true 表示本周期不应提交
+// Scans the staged content and either unstages offending files according to secret_scan, or returns true when the
+// cycle must not commit
+// 日志只包含脱敏后的发现 / Only redacted findings are logged
+func (s *syncer) scanStagedSecrets() (bool, error) {
+	cfg, log, gitOps := s.cfg, s.log, s.gitOps
+
+	allow, err := secrets.LoadAllowlist(filepath.Join(cfg.RepoRoot, cfg.SecretAllowlistFile))
+	if err != nil {
+		return false, fmt.Errorf("failed to read secret allowlist: %w", err)
+	}
+
+	var findings []secrets.Finding
+	if gitOps.DryRun() {
+		findings = s.scanPlannedFiles(allow)
+	} else if findings, err = s.scanIndex(allow); err != nil {
+		return false, err
+	}
+	if len(findings) == 0 {
+		log.Debug("未发现敏感信息 / No secrets found")
+		return false, nil
+	}
+
+	// 每个发现只警告一次：取消暂存的文件下个周期会被重新暂存和扫描
+	// Each finding is warned about once: an unstaged file is staged and scanned again in the next cycle
+	var files []string
+	seen, fresh := map[string]bool{}, map[string]bool{}
+	for _, f := range findings {
+		gitOps.Plan().Record(plan.ActionSecret, f.Path, fmt.Sprintf("line %d %s %s", f.Line, f.Rule, f.Redacted))
+		if key := f.Path + "\x00" + f.Fingerprint; s.seenSecrets[key] {
+			log.Debug("已报告过的疑似敏感信息 / Possible secret already reported: %s", f)
+		} else {
+			s.seenSecrets[key] = true
+			fresh[f.Path] = true
+			log.Warn("检测到疑似敏感信息 / Possible secret: %s", f)
+		}
+		if !seen[f.Path] {
+			seen[f.Path] = true
+			files = append(files, f.Path)
+		}
+	}
+	if len(fresh) > 0 {
+		log.Warn("误报可将指纹或路径写入 %s / For false positives add the fingerprint or path to %s", cfg.SecretAllowlistFile, cfg.SecretAllowlistFile)
+	}
+
+	if cfg.SecretScan == config.SecretScanBlock {
+		log.Error("secret_scan=block：%d 个文件包含疑似敏感信息，本周期不提交也不推送 / %d files contain possible secrets, nothing is committed or pushed in this cycle",
+			len(files), len(files))
+		return true, nil
+	}
+
+	for _, file := range files {
+		if err := gitOps.Unstage(file); err != nil {
+			return false, fmt.Errorf("failed to unstage %s: %w", file, err)
+		}
+		if err := s.fileProc.IgnorePath(file); err != nil {
+			log.Warn("写入 %s 失败 / Failed to add to %s: %v", cfg.IgnoreFileName, cfg.IgnoreFileName, err)
+		}
+		if fresh[file] {
+			log.Warn("已取消暂存并写入 %s / Unstaged and added to %s: %s", cfg.IgnoreFileName, cfg.IgnoreFileName, file)
+		} else {
+			log.Debug("已取消暂存 / Unstaged: %s", file)
+		}
+	}
+	return false, nil
+}
+
+// scanIndex 扫描索引中新增或修改的 blob
+// Scans the added or modified blobs in the index
+func (s *syncer) scanIndex(allow *secrets.Allowlist) ([]secrets.Finding, error) {
+	changes, err := s.gitOps.StagedChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []string
+	for _, c := range changes {
+		if c.Status == 'D' || allow.AllowsPath(c.Path) {
+			continue
+		}
+		objects = append(objects, ":"+c.Path)
+	}
+
+	var findings []secrets.Finding
+	err = s.gitOps.CatFileBatch(objects, func(object string, size int64, r io.Reader) error {
+		if size > secrets.MaxScanBytes {
+			return nil
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, allow.Scan(strings.TrimPrefix(object, ":"), content)...)
+		return nil
+	})
+	return findings, err
+}
+
+// scanPlannedFiles 演练模式下索引未被修改，改为扫描计划暂存的工作区文件
+// In dry-run mode the index is untouched, so the working tree files planned for staging are scanned instead
+func (s *syncer) scanPlannedFiles(allow *secrets.Allowlist) []secrets.Finding {
+	var findings []secrets.Finding
+	for _, a := range s.gitOps.Plan().Actions() {
+		if a.Kind != plan.ActionStage || allow.AllowsPath(a.Target) {
+			continue
+		}
+		full := filepath.Join(s.cfg.RepoRoot, a.Target)
+		info, err := os.Stat(full)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > secrets.MaxScanBytes {
+			continue
+		}
+		content, err := os.ReadFile(full)
+		if err != nil {
+			continue
+		}
+		findings = append(findings, allow.Scan(filepath.ToSlash(a.Target), content)...)
+	}
+	return findings
+}
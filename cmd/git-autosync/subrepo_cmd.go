@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/subrepo"
+)
+
+// subrepoUsage subrepo 命令的用法
+// Usage of the subrepo command
+const subrepoUsage = "Usage: git-sync [flags] subrepo restore [-force] [-ref REF] [path...]"
+
+// runSubrepoCommand 执行 subrepo 子命令并返回退出码
+// Runs the subrepo subcommand and returns the exit code
+func runSubrepoCommand(args []string, debugMode bool) int {
+	if len(args) == 0 || args[0] != "restore" {
+		fmt.Fprintln(os.Stderr, subrepoUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("subrepo restore", flag.ExitOnError)
+	force := fs.Bool("force", false, "Overwrite an existing .git even if it is newer than the committed gitdir")
+	ref := fs.String("ref", "HEAD", "Commit to read the gitdir from")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), subrepoUsage)
+		fmt.Fprintln(fs.Output(), "\n不指定路径时恢复所有已提交 gitdir 的子仓库 / Without paths every sub-repository with a committed gitdir is restored\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	cfg, log, cleanup, err := setupEnvironment(debugMode)
+	if err != nil {
+		return exitFatal
+	}
+	defer cleanup()
+
+	// 恢复会修改工作区，与守护进程互斥
+	// Restoring modifies the working tree, so it is mutually exclusive with the daemon
+	release, err := acquireInstanceLock(cfg.RepoRoot, log)
+	if err != nil {
+		return exitFatal
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handleShutdownSignals(cancel, log)
+
+	gitOps := git.NewGitOps(cfg, log).WithContext(ctx)
+	proc := subrepo.NewSubrepoProcessor(cfg, gitOps, log)
+
+	var targets []string
+	if fs.NArg() == 0 {
+		targets, err = proc.CommittedSubrepos(*ref)
+		if err != nil {
+			log.Error("列出子仓库失败 / Failed to list sub-repositories: %v", err)
+			return exitFatal
+		}
+		if len(targets) == 0 {
+			log.Info("%s 中没有已提交的 gitdir / No committed gitdir in %s", *ref, *ref)
+			return exitNothingToDo
+		}
+	} else {
+		for _, arg := range fs.Args() {
+			target, err := resolveSubrepoPath(cfg.RepoRoot, arg)
+			if err != nil {
+				log.Error("无效路径 / Invalid path: %s: %v", arg, err)
+				return exitFatal
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	failed := 0
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			log.Warn("恢复被关闭信号中断 / Restore interrupted by shutdown")
+			return exitFatal
+		}
+		err := proc.Restore(target, subrepo.RestoreOptions{Ref: *ref, Force: *force})
+		if err != nil {
+			failed++
+			log.Error("恢复失败 / Restore failed: %s: %v", target, err)
+			if errors.Is(err, subrepo.ErrGitDirNewer) {
+				log.Warn("如需覆盖请使用 -force / Use -force to overwrite it")
+			}
+		}
+	}
+
+	if failed > 0 {
+		log.Error("%d/%d 个子仓库恢复失败 / %d/%d sub-repositories failed to restore", failed, len(targets), failed, len(targets))
+		return exitFatal
+	}
+	return exitNothingToDo
+}
+
+// resolveSubrepoPath 将命令行路径（相对当前目录）转换为相对仓库根目录的子仓库路径
+// Converts a command line path (relative to the current directory) to a sub-repository path relative to the repository root
+// 也接受直接指向 .git、gitdir 或 gitdir.tar 的路径 / Paths pointing at .git, gitdir or gitdir.tar are accepted too
+func resolveSubrepoPath(repoRoot, arg string) (string, error) {
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	rel, err := filepath.Rel(repoRoot, abs)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("outside the repository")
+	}
+
+	rel = filepath.ToSlash(rel)
+	switch path.Base(rel) {
+	case ".git", "gitdir", "gitdir.tar":
+		rel = path.Dir(rel)
+	}
+	if rel == "." {
+		return "", fmt.Errorf("the repository root is not a sub-repository")
+	}
+	return rel, nil
+}
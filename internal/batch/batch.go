@@ -1,15 +1,16 @@
 package batch
 
 import (
-	"bytes"
+	"context"
 	"math"
 	"os"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/find-xposed-magisk/git-sync/internal/git"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 )
 
 // FileClassification File classification by size / 按大小分类文件
@@ -60,6 +61,12 @@ type BatchConfig struct {
 	// 重试配置 / Retry configuration
 	RetryMaxAttempts int           // 最大重试次数 / Max retry attempts
 	RetryBaseDelay   time.Duration // 重试基础延迟 / Base delay for retry
+	// 演练计划，非 nil 时只记录不执行 / Dry-run plan; record instead of execute when non-nil
+	Plan *plan.Plan
+	// 取消后不再启动新批次 / No new batch is started once cancelled (nil = never cancelled)
+	Context context.Context
+	// 执行 git 命令 / Executes git commands (nil = git.ExecRunner)
+	Runner git.GitRunner
 }
 
 // DefaultBatchConfig Default batch configuration / 默认批量配置
@@ -453,14 +460,9 @@ func (p *GitBatchProcessor) executeGitCommand(operation string, files []string)
 		return false
 	}
 
-	cmd := exec.Command("git", args...)
-	cmd.Dir = p.repoRoot
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		p.logger.Warn("Git %s failed (ignored): %v, stderr: %s", operation, err, stderr.String())
+	res, err := p.runner().Run(p.context(), git.Command{Args: args, Dir: p.repoRoot})
+	if err != nil {
+		p.logger.Warn("Git %s failed (ignored): %v, stderr: %s", operation, err, res.Stderr)
 		return false
 	}
 
@@ -484,6 +486,18 @@ func (p *GitBatchProcessor) executeGitCommandWithRetry(operation string, files [
 		return false
 	}
 
+	// 演练模式：只记录 / Dry-run mode: record only
+	if p.config.Plan != nil {
+		kind := plan.ActionStage
+		if operation == "rm" {
+			kind = plan.ActionUntrack
+		}
+		for _, f := range files {
+			p.config.Plan.Record(kind, f, "")
+		}
+		return true
+	}
+
 	// 使用配置的重试参数 / Use configured retry parameters
 	maxRetries := p.config.RetryMaxAttempts
 	baseDelay := p.config.RetryBaseDelay
@@ -495,15 +509,14 @@ func (p *GitBatchProcessor) executeGitCommandWithRetry(operation string, files [
 	}
 
 	for i := 0; i < maxRetries; i++ {
-		// Create a new command object for each attempt / 每次尝试都创建新的命令对象
-		cmd := exec.Command("git", args...)
-		cmd.Dir = p.repoRoot
-
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-
 		// Execute the command / 执行命令
-		err := cmd.Run()
+		res, err := p.runner().Run(p.context(), git.Command{Args: args, Dir: p.repoRoot})
+
+		// Shutdown requested: stop without retrying / 收到关闭信号：不再重试
+		if p.context().Err() != nil {
+			p.logger.Debug("Git %s cancelled by shutdown / Git %s 因关闭而取消", operation, operation)
+			return false
+		}
 
 		// Success case / 成功情况
 		if err == nil {
@@ -514,7 +527,7 @@ func (p *GitBatchProcessor) executeGitCommandWithRetry(operation string, files [
 		}
 
 		// Failure case: Check if it's a retryable lock error / 失败情况：检查是否为可重试的锁错误
-		stderrStr := stderr.String()
+		stderrStr := res.Stderr
 		if strings.Contains(stderrStr, "index.lock") {
 			// This is the error we want to retry on / 这是我们想要重试的错误
 			delay := time.Duration(float64(baseDelay) * math.Pow(2, float64(i)))
@@ -529,7 +542,11 @@ func (p *GitBatchProcessor) executeGitCommandWithRetry(operation string, files [
 				i+1,
 				maxRetries,
 			)
-			time.Sleep(delay)
+			select {
+			case <-time.After(delay):
+			case <-p.context().Done():
+				return false
+			}
 			continue // Go to the next iteration / 进入下一次迭代
 		}
 
@@ -548,6 +565,24 @@ func (p *GitBatchProcessor) executeGitCommandWithRetry(operation string, files [
 	return false
 }
 
+// context Return the cancellation context / 返回取消上下文
+// context 返回取消上下文
+func (p *GitBatchProcessor) context() context.Context {
+	if p.config.Context == nil {
+		return context.Background()
+	}
+	return p.config.Context
+}
+
+// runner Return the git command runner / 返回git命令执行器
+// runner 返回git命令执行器
+func (p *GitBatchProcessor) runner() git.GitRunner {
+	if p.config.Runner == nil {
+		return git.ExecRunner{}
+	}
+	return p.config.Runner
+}
+
 // splitIntoBatches Split files into batches / 将文件分批
 // splitIntoBatches 将文件分批
 func (p *GitBatchProcessor) splitIntoBatches(files []string, batchSize int) [][]string {
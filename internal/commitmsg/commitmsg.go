@@ -0,0 +1,285 @@
+// Package commitmsg / 提交信息包
+// Module: Commit Message Renderer / 提交信息生成器
+// Function: Renders the auto-sync commit message from a text/template over a summary of the staged diff
+//           用 text/template 根据暂存变更的摘要生成自动同步提交信息
+// Author: git-autosync contributors
+// Dependencies: bytes, fmt, os, path/filepath, sort, strings, text/template, config, git
+
+package commitmsg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+// DefaultTemplate 默认提交信息模板
+// Default commit message template
+// 主题行以 commit_msg_prefix 开头，历史压缩依靠它识别自动同步提交
+// The subject starts with commit_msg_prefix, which history compaction relies on to recognise auto-sync commits
+const DefaultTemplate = `{{.Prefix}} {{.Counts}}{{if .Dirs}} in {{joinMax .Dirs 3}}{{end}} at {{.Timestamp}}
+
+{{if .Subrepos}}Subrepos updated / 子仓库更新: {{joinMax .Subrepos 10}}
+{{end}}{{if .LFSFiles}}LFS files added / 新增 LFS 文件: {{joinMax .LFSFiles 10}}
+{{end}}{{if .IgnoredForSize}}Ignored for size / 因大小忽略: {{joinMax .IgnoredForSize 10}}
+{{end}}
+{{.Stat}}
+`
+
+// statWidth 统计图中 +/- 条的最大宽度
+// Maximum width of the +/- bar in the stat graph
+const statWidth = 40
+
+// statNameWidth 统计图中路径列的最大宽度，更长的路径从左侧截断
+// Maximum width of the path column in the stat graph; longer paths are cut from the left
+const statNameWidth = 50
+
+// Summary 暂存变更的摘要，作为模板的数据
+// Summary of the staged changes, used as the template data
+type Summary struct {
+	Prefix    string // commit_msg_prefix
+	Timestamp string // 周期开始时间 / Cycle start time
+
+	Added    int // 新增文件数（含复制）/ Files added (including copies)
+	Modified int // 修改文件数（含类型变化）/ Files modified (including type changes)
+	Deleted  int // 删除文件数 / Files deleted
+	Renamed  int // 重命名文件数 / Files renamed
+
+	Insertions int // 新增行数 / Lines inserted
+	Deletions  int // 删除行数 / Lines deleted
+
+	Files          []git.StagedChange // 全部变更 / All changes
+	Dirs           []string           // 涉及的顶层目录，根目录下的文件记为 "." / Top-level directories touched, "." for files at the root
+	Subrepos       []string           // 更新的子仓库 / Sub-repositories updated
+	LFSFiles       []string           // 本周期新交给 LFS 追踪的文件 / Files newly tracked with LFS in this cycle
+	IgnoredForSize []string           // 因超过大小阈值写入忽略文件的文件 / Files added to the ignore file for exceeding the size threshold
+
+	Stat string // 类似 --stat 的统计，按 commit_msg_stat_lines 截断 / A --stat-like body truncated to commit_msg_stat_lines
+}
+
+// NewSummary 根据暂存变更创建摘要
+// Builds a summary from the staged changes
+func NewSummary(prefix, timestamp string, changes []git.StagedChange) *Summary {
+	s := &Summary{Prefix: prefix, Timestamp: timestamp, Files: changes}
+
+	dirs := map[string]bool{}
+	subrepos := map[string]bool{}
+	for _, c := range changes {
+		switch c.Status {
+		case 'A', 'C':
+			s.Added++
+		case 'D':
+			s.Deleted++
+		case 'R':
+			s.Renamed++
+		default:
+			s.Modified++
+		}
+		s.Insertions += c.Added
+		s.Deletions += c.Deleted
+
+		dir := "."
+		if i := strings.Index(c.Path, "/"); i > 0 {
+			dir = c.Path[:i]
+		}
+		dirs[dir] = true
+		if root := subrepoRoot(c.Path); root != "" {
+			subrepos[root] = true
+		}
+	}
+	s.Dirs = sortedKeys(dirs)
+	s.Subrepos = sortedKeys(subrepos)
+	return s
+}
+
+// Total 变更的文件总数
+// Total number of changed files
+func (s *Summary) Total() int {
+	return len(s.Files)
+}
+
+// Counts 按类型列出非零的文件数，例如 "3 added, 1 modified"
+// Lists the non-zero file counts by kind, e.g. "3 added, 1 modified"
+func (s *Summary) Counts() string {
+	var parts []string
+	for _, c := range []struct {
+		n    int
+		name string
+	}{{s.Added, "added"}, {s.Modified, "modified"}, {s.Deleted, "deleted"}, {s.Renamed, "renamed"}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "no file changes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Renderer 提交信息生成器
+// Commit message renderer
+type Renderer struct {
+	tmpl      *template.Template
+	statLines int
+}
+
+// NewRenderer 加载 commit_msg_template 指定的模板，未设置时使用 DefaultTemplate
+// Loads the template named by commit_msg_template, falling back to DefaultTemplate when unset
+// 相对路径相对于仓库根目录 / Relative paths are relative to the repository root
+func NewRenderer(cfg *config.Config) (*Renderer, error) {
+	text := DefaultTemplate
+	if cfg.CommitMsgTemplate != "" {
+		path := cfg.CommitMsgTemplate
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.RepoRoot, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit message template: %w", err)
+		}
+		text = string(data)
+	}
+	return Parse(text, cfg.CommitStatLines)
+}
+
+// Parse 解析模板文本；statLines 为统计部分最多列出的文件数，0 表示不生成统计
+// Parses template text; statLines is the number of files listed in the stat body at most, 0 omits the stat
+func Parse(text string, statLines int) (*Renderer, error) {
+	tmpl, err := template.New("commit").Option("missingkey=error").Funcs(template.FuncMap{
+		"join":    strings.Join,
+		"joinMax": joinMax,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %w", err)
+	}
+	return &Renderer{tmpl: tmpl, statLines: statLines}, nil
+}
+
+// Render 生成提交信息：填充统计部分、执行模板，并去掉多余的空行
+// Renders the commit message: fills in the stat body, executes the template and drops redundant blank lines
+func (r *Renderer) Render(s *Summary) (string, error) {
+	s.Stat = stat(s, r.statLines)
+
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, s); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %w", err)
+	}
+	return tidy(buf.String()), nil
+}
+
+// stat 生成类似 git diff --stat 的统计，最多列出 maxLines 个文件
+// Builds a git diff --stat style summary listing at most maxLines files
+func stat(s *Summary, maxLines int) string {
+	if maxLines <= 0 || len(s.Files) == 0 {
+		return ""
+	}
+
+	shown := s.Files
+	if len(shown) > maxLines {
+		shown = shown[:maxLines]
+	}
+
+	names := make([]string, len(shown))
+	nameWidth, maxChanged := 0, 0
+	for i, c := range shown {
+		names[i] = c.Path
+		if c.OldPath != "" {
+			names[i] = c.OldPath + " => " + c.Path
+		}
+		if len(names[i]) > statNameWidth {
+			names[i] = "..." + names[i][len(names[i])-statNameWidth+3:]
+		}
+		if len(names[i]) > nameWidth {
+			nameWidth = len(names[i])
+		}
+		if c.Added+c.Deleted > maxChanged {
+			maxChanged = c.Added + c.Deleted
+		}
+	}
+	numWidth := len(fmt.Sprint(maxChanged))
+
+	var b strings.Builder
+	for i, c := range shown {
+		if c.Binary {
+			fmt.Fprintf(&b, " %-*s | %*s\n", nameWidth, names[i], numWidth, "Bin")
+			continue
+		}
+		plus, minus := c.Added, c.Deleted
+		if maxChanged > statWidth {
+			plus = scale(plus, maxChanged)
+			minus = scale(minus, maxChanged)
+		}
+		fmt.Fprintf(&b, " %-*s | %*d %s%s\n", nameWidth, names[i], numWidth, c.Added+c.Deleted,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+	if hidden := len(s.Files) - len(shown); hidden > 0 {
+		fmt.Fprintf(&b, " ... and %d more files / 另有 %d 个文件\n", hidden, hidden)
+	}
+	fmt.Fprintf(&b, " %d files changed, %d insertions(+), %d deletions(-)", len(s.Files), s.Insertions, s.Deletions)
+	return b.String()
+}
+
+// scale 把行数按比例缩放到 statWidth，非零的数至少保留一个字符
+// Scales a line count down to statWidth, keeping at least one character for non-zero counts
+func scale(n, max int) int {
+	if n == 0 {
+		return 0
+	}
+	if scaled := n * statWidth / max; scaled > 0 {
+		return scaled
+	}
+	return 1
+}
+
+// joinMax 用逗号连接最多 n 个元素，其余的以 "+N more" 表示
+// Joins at most n items with commas and summarises the rest as "+N more"
+func joinMax(items []string, n int) string {
+	if len(items) <= n {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s, +%d more", strings.Join(items[:n], ", "), len(items)-n)
+}
+
+// subrepoRoot 返回路径所属子仓库的目录（路径位于 gitdir/ 下或是 gitdir.tar），否则返回空字符串
+// Returns the sub-repository directory a path belongs to (the path is under gitdir/ or is gitdir.tar), or "" otherwise
+func subrepoRoot(path string) string {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == "gitdir" && i < len(parts)-1 || parts[i] == "gitdir.tar" && i == len(parts)-1 {
+			return strings.Join(parts[:i], "/")
+		}
+	}
+	return ""
+}
+
+// tidy 去掉行尾空白、合并连续空行并保证以单个换行结尾
+// Strips trailing whitespace, collapses consecutive blank lines and ends with a single newline
+func tidy(msg string) string {
+	var lines []string
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// sortedKeys 返回排序后的键
+// Returns the keys in sorted order
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
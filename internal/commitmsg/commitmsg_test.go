@@ -0,0 +1,117 @@
+// commitmsg_test.go - Commit message rendering unit tests / 提交信息生成单元测试
+//
+// Module: commitmsg
+// Description: Tests the staged-diff summary, the default template and stat truncation
+// Author: git-autosync contributors
+// Dependencies: strings, testing, git
+
+package commitmsg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+func testChanges() []git.StagedChange {
+	return []git.StagedChange{
+		{Status: 'A', Path: "docs/new.md", Added: 10},
+		{Status: 'M', Path: "src/main.go", Added: 3, Deleted: 2},
+		{Status: 'D', Path: "README.old", Deleted: 7},
+		{Status: 'R', Path: "src/b.go", OldPath: "src/a.go"},
+		{Status: 'A', Path: "tools/x/gitdir/HEAD", Added: 1},
+		{Status: 'M', Path: "assets/big.bin", Binary: true},
+	}
+}
+
+// TestNewSummary tests counts, top-level directories and subrepo detection
+// 测试文件计数、顶层目录和子仓库识别
+func TestNewSummary(t *testing.T) {
+	s := NewSummary("Auto-sync:", "2025-12-07 10:00:00", testChanges())
+
+	if s.Added != 2 || s.Modified != 2 || s.Deleted != 1 || s.Renamed != 1 {
+		t.Errorf("Unexpected counts: %+v", s)
+	}
+	if s.Insertions != 14 || s.Deletions != 9 {
+		t.Errorf("Expected 14/9 lines, got %d/%d", s.Insertions, s.Deletions)
+	}
+	if got := strings.Join(s.Dirs, ","); got != ".,assets,docs,src,tools" {
+		t.Errorf("Unexpected dirs: %s", got)
+	}
+	if len(s.Subrepos) != 1 || s.Subrepos[0] != "tools/x" {
+		t.Errorf("Expected subrepo tools/x, got %v", s.Subrepos)
+	}
+	if got := s.Counts(); got != "2 added, 2 modified, 1 deleted, 1 renamed" {
+		t.Errorf("Unexpected counts string: %s", got)
+	}
+}
+
+// TestRenderDefault tests that the default template keeps the prefix and lists the extra sections
+// 测试默认模板保留前缀并列出附加信息
+func TestRenderDefault(t *testing.T) {
+	r, err := Parse(DefaultTemplate, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSummary("Auto-sync:", "2025-12-07 10:00:00", testChanges())
+	s.LFSFiles = []string{"assets/big.bin"}
+	msg, err := r.Render(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := strings.SplitN(msg, "\n", 2)[0]
+	want := "Auto-sync: 2 added, 2 modified, 1 deleted, 1 renamed in ., assets, docs, +2 more at 2025-12-07 10:00:00"
+	if subject != want {
+		t.Errorf("Unexpected subject:\n got: %s\nwant: %s", subject, want)
+	}
+	for _, s := range []string{
+		"Subrepos updated / 子仓库更新: tools/x",
+		"LFS files added / 新增 LFS 文件: assets/big.bin",
+		" src/main.go |  5 +++--",
+		"... and 3 more files",
+		" 6 files changed, 14 insertions(+), 9 deletions(-)",
+	} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Expected message to contain %q:\n%s", s, msg)
+		}
+	}
+	if strings.Contains(msg, "Ignored for size") {
+		t.Error("Empty sections should be omitted")
+	}
+	if strings.Contains(msg, "\n\n\n") || !strings.HasSuffix(msg, "\n") || strings.HasSuffix(msg, "\n\n") {
+		t.Errorf("Message should have no repeated blank lines and end with one newline:\n%q", msg)
+	}
+}
+
+// TestRenderNoStat tests that commit_stat_lines = 0 omits the stat body
+// 测试 commit_stat_lines = 0 时不生成统计部分
+func TestRenderNoStat(t *testing.T) {
+	r, err := Parse("{{.Prefix}} {{.Total}} files\n\n{{.Stat}}", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := r.Render(NewSummary("P:", "now", testChanges()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg != "P: 6 files\n" {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+}
+
+// TestParseInvalid tests that template syntax and field errors are reported
+// 测试模板语法错误和字段错误会被报告
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse("{{.Prefix", 10); err == nil {
+		t.Error("Expected parse error")
+	}
+	r, err := Parse("{{.NoSuchField}}", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Render(NewSummary("P:", "now", nil)); err == nil {
+		t.Error("Expected render error for unknown field")
+	}
+}
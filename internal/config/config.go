@@ -14,6 +14,10 @@ type Config struct {
 	// 同步配置 / Sync configuration
 	SleepInterval   time.Duration
 	CommitMsgPrefix string
+	// 提交信息模板文件（text/template，相对仓库根目录），为空时使用内置模板
+	// Commit message template file (text/template, relative to the repository root); the built-in template is used when empty
+	CommitMsgTemplate string
+	CommitStatLines   int // 提交信息中统计部分最多列出的文件数，0 表示不列出 / Max files listed in the commit message stat, 0 omits it
 
 	// 重试配置 / Retry configuration
 	MaxAddAttempts int
@@ -21,6 +25,10 @@ type Config struct {
 
 	// 特殊仓库配置 / Special repository configuration
 	SubrepoBaseDirs []string
+	// 以 gitdir.tar 归档存储 .git 的子仓库（相对仓库根目录的 glob 模式）
+	// Sub-repositories whose .git is stored as a gitdir.tar archive (glob patterns relative to the repository root)
+	SubrepoArchiveDirs []string
+	SubrepoArchiveLFS  bool // 用 LFS 追踪 gitdir.tar / Track gitdir.tar with LFS
 
 	// LFS配置 / LFS configuration
 	LFSSizeThresholdBytes int64
@@ -45,10 +53,21 @@ type Config struct {
 	LogMaxBackups int    // 最大备份数量 / Max number of backups
 	LogLevel      string // 日志级别: DEBUG/INFO/WARN/ERROR
 
+	// 分叉同步模式 / Sync mode for diverged branches
+	// "merge": 生成三路合并提交（默认）
+	// "merge": create a three-way merge commit (default)
+	// "rebase": 把本地的自动同步提交变基到远程分支之上，保持线性历史
+	// "rebase": rebase local auto-sync commits onto the remote branch, keeping history linear
+	SyncMode string // "merge" or "rebase"
+
 	// 合并失败策略 / Merge failure strategy
 	// "force-push": 强制推送本地状态到远程（默认，适合CNB环境）
 	// "rollback": 仅回滚本地，保留备份分支（适合多人协作）
-	MergeFailureStrategy string // "force-push" or "rollback"
+	// "keep-both": 本地版本保留在原路径，远程版本另存为冲突副本，一起提交并推送（不丢数据）
+	// "keep-both": keep the local version at the original path, save the remote one as a conflict copy, commit both and push (no data loss)
+	// "conflict-branch": 回滚本地，把本地状态推送到远程 autosync-conflict/<主机>/<时间> 分支，同步分支不变，下个周期重试合并
+	// "conflict-branch": roll back locally, push the local state to autosync-conflict/<host>/<time> on the remote, leave the sync branch untouched and retry next cycle
+	MergeFailureStrategy string // "force-push", "rollback", "keep-both" or "conflict-branch"
 
 	// ============================================================
 	// 以下为新增配置字段 (v2.0)
@@ -80,9 +99,41 @@ type Config struct {
 	// 合并配置 / Merge configuration
 	MergeLogLines      int  // 合并日志显示行数 / Lines to show in merge log
 	MaxBackupBranches  int  // 最大备份分支数量 / Max backup branches to keep
+	MaxRemoteBackups   int  // 远程 refs/autosync-backup/* 最大保留数量 / Max refs/autosync-backup/* refs to keep on the remote
+	// 冲突解决规则，按顺序匹配，第一条匹配的规则生效
+	// Conflict resolution rules, evaluated in order; the first matching rule wins
+	ConflictRules []ConflictRule
 
 	// 远程引用修复配置 / Remote reference repair configuration
 	AutoFixCorruptRefs bool // 自动修复远程损坏引用 / Auto-fix corrupt remote references
+
+	// 文件监听配置 / File watcher configuration
+	// "poll": 每个 SleepInterval 全量扫描（默认）/ Full rescan every SleepInterval (default)
+	// "inotify": 仅在文件变化时触发同步，SleepInterval 作为最大空闲间隔 / Sync only on file changes, SleepInterval as max idle
+	WatchMode     string        // "poll" or "inotify"
+	WatchDebounce time.Duration // 变更去抖时间 / Debounce window for bursts of changes
+
+	// 历史压缩配置 / History compaction configuration
+	// 把连续的自动同步提交按小时或按天压缩为一个提交；人工提交和合并提交不会被重写
+	// Squashes consecutive auto-sync commits into hourly or daily commits; human commits and merge commits are never rewritten
+	CompactInterval     time.Duration // 压缩任务运行间隔，0 表示禁用；在推送之后运行 / How often compaction runs, 0 disables it; runs after the push
+	CompactGranularity  string        // "hourly" or "daily"
+	CompactPushedWindow time.Duration // 允许重写（强制推送）的已推送历史窗口，0 表示只压缩未推送的提交 / Window of pushed history that may be rewritten (force pushed), 0 compacts unpushed commits only
+
+	// 敏感信息扫描配置 / Secret scanning configuration
+	// 提交前扫描已暂存的内容，检测私钥、云服务凭据、令牌和高熵密钥
+	// Staged content is scanned before committing for private keys, cloud credentials, tokens and high-entropy secrets
+	SecretScan          string // "off", "unstage" or "block"
+	SecretAllowlistFile string // 白名单文件（相对仓库根目录）/ Allowlist file (relative to the repository root)
+
+	// 透明加密配置 / Transparent encryption configuration
+	// 匹配的路径通过 clean/smudge 过滤器以 AES-GCM 密文提交，工作区中保持明文
+	// Matching paths are committed as AES-GCM ciphertext through a clean/smudge filter and stay plaintext in the working tree
+	EncryptPatterns []string // .gitattributes 模式 / .gitattributes patterns
+	EncryptKeyFile  string   // 密钥文件，必须位于仓库之外 / Key file, must be outside the repository
+
+	// 配置检查 / Config checking
+	Strict bool // 配置有任何问题时拒绝启动 / Refuse to start on any config problem
 }
 
 // DefaultConfig 返回默认配置
@@ -96,13 +147,16 @@ func DefaultConfig() *Config {
 		// 同步配置 / Sync configuration
 		SleepInterval:   60 * time.Second,
 		CommitMsgPrefix: "Auto-sync / 自动同步:",
+		CommitStatLines: 20,
 
 		// 重试配置 / Retry configuration
 		MaxAddAttempts: 3,
 		AddRetryDelay:  2 * time.Second,
 
 		// 特殊仓库配置 / Special repository configuration
-		SubrepoBaseDirs: []string{"debian/data/git", "debian/data/.oh-my-zsh"},
+		SubrepoBaseDirs:    []string{"debian/data/git", "debian/data/.oh-my-zsh"},
+		SubrepoArchiveDirs: []string{}, // 默认全部逐文件存储 / By default every .git is stored file by file
+		SubrepoArchiveLFS:  false,
 
 		// LFS配置 / LFS configuration
 		LFSSizeThresholdBytes: 255 * 1024 * 1024, // 255MB
@@ -124,10 +178,13 @@ func DefaultConfig() *Config {
 		LogMaxBackups: 10,
 		LogLevel:      "INFO",
 
+		// 分叉时默认生成合并提交 / Diverged branches are merged by default
+		SyncMode: SyncModeMerge,
+
 		// 合并失败策略 / Merge failure strategy
 		// 默认使用 force-push 策略，适合 CNB 临时环境
 		// Default to force-push strategy, suitable for CNB ephemeral environment
-		MergeFailureStrategy: "force-push",
+		MergeFailureStrategy: MergeFailureForcePush,
 
 		// ============================================================
 		// 新增配置默认值 (v2.0)
@@ -159,9 +216,31 @@ func DefaultConfig() *Config {
 		// 合并配置 / Merge configuration
 		MergeLogLines:     10, // 显示10行合并日志
 		MaxBackupBranches: 5,  // 最多保留5个备份分支
+		MaxRemoteBackups:  5,  // 远程最多保留5个强制推送前的备份引用
+		ConflictRules:     []ConflictRule{}, // 未匹配时仅锁文件自动解决 / Without a match only lock files are auto-resolved
 
 		// 远程引用修复配置 / Remote reference repair configuration
 		AutoFixCorruptRefs: true, // 默认启用自动修复 / Default enabled
+
+		// 文件监听配置 / File watcher configuration
+		WatchMode:     "poll",          // 默认轮询，保持原有行为 / Default polling, keeps original behavior
+		WatchDebounce: 2 * time.Second, // 最后一次变更后静默2秒再同步 / Sync after 2s of quiet
+
+		// 历史压缩配置 / History compaction configuration
+		CompactInterval:     0, // 默认禁用 / Disabled by default
+		CompactGranularity:  CompactDaily,
+		CompactPushedWindow: 0, // 默认不重写已推送的历史 / Pushed history is not rewritten by default
+
+		// 敏感信息扫描配置 / Secret scanning configuration
+		SecretScan:          SecretScanOff, // 默认关闭，升级后不会悄悄停止同步文件 / Off by default so an upgrade never silently stops syncing files
+		SecretAllowlistFile: ".gitsecrets_allow",
+
+		// 透明加密配置 / Transparent encryption configuration
+		EncryptPatterns: []string{}, // 默认不加密 / Nothing is encrypted by default
+		EncryptKeyFile:  "~/.config/git-autosync/encrypt.key",
+
+		// 配置检查 / Config checking
+		Strict: false, // 默认只警告 / Only warn by default
 	}
 }
 
@@ -190,3 +269,62 @@ var LockFilePatterns = []string{
 	"go.sum",             // Go modules
 	"Cargo.lock",         // Rust cargo
 }
+
+// ConflictRule 冲突解决规则：匹配 Pattern 的冲突文件使用 Strategy 解决
+// Conflict resolution rule: conflicted files matching Pattern are resolved with Strategy
+// Pattern 不含 / 时匹配文件名，否则匹配相对仓库根目录的路径；以 /** 结尾时匹配目录下所有文件
+// A Pattern without / matches the file name, otherwise the path relative to the repository root; a trailing /** matches everything below a directory
+type ConflictRule struct {
+	Pattern  string
+	Strategy string
+}
+
+// 历史压缩粒度 / History compaction granularities
+const (
+	CompactHourly = "hourly" // 每小时一个提交 / One commit per hour
+	CompactDaily  = "daily"  // 每天一个提交 / One commit per day
+)
+
+// 敏感信息扫描模式 / Secret scanning modes
+const (
+	SecretScanOff     = "off"     // 不扫描 / No scanning
+	SecretScanUnstage = "unstage" // 取消暂存并写入忽略文件 / Unstage and add to the ignore file
+	SecretScanBlock   = "block"   // 不提交也不推送，等待人工处理 / Neither commit nor push until resolved by hand
+)
+
+// 合并失败策略 / Merge failure strategies
+const (
+	MergeFailureForcePush      = "force-push"      // 强制推送本地状态 / Force push the local state
+	MergeFailureRollback       = "rollback"        // 仅回滚本地，保留备份分支 / Roll back locally, keeping a backup branch
+	MergeFailureKeepBoth       = "keep-both"       // 远程版本另存为冲突副本后提交 / Commit the remote version as a conflict copy
+	MergeFailureConflictBranch = "conflict-branch" // 本地状态推送到冲突分支 / Push the local state to a conflict branch
+)
+
+// 分叉同步模式 / Sync modes for diverged branches
+const (
+	SyncModeMerge  = "merge"  // 三路合并提交 / Three-way merge commit
+	SyncModeRebase = "rebase" // 本地提交变基到远程之上 / Rebase local commits onto the remote
+)
+
+// 冲突解决策略 / Conflict resolution strategies
+const (
+	StrategyOurs        = "ours"                  // 保留本地版本 / Keep the local version
+	StrategyTheirs      = "theirs"                // 使用远程版本 / Take the remote version
+	StrategyUnion       = "union"                 // 合并双方的行（适合日志）/ Keep the lines of both sides (suits logs)
+	StrategyNewestMtime = "newest-mtime"          // 使用最近提交修改的一方 / Take the side that was committed most recently
+	StrategyKeepBoth    = "keep-both-with-suffix" // 保留本地版本，远程版本另存为冲突副本 / Keep ours, save theirs as a conflict copy
+	StrategyStructured  = "structured"            // JSON/YAML 键级三路合并 / Key-level three-way merge of JSON/YAML
+	StrategyFail        = "fail"                  // 不自动解决 / Do not resolve automatically
+)
+
+// ConflictStrategies 所有有效的冲突解决策略
+// All valid conflict resolution strategies
+var ConflictStrategies = []string{
+	StrategyOurs,
+	StrategyTheirs,
+	StrategyUnion,
+	StrategyNewestMtime,
+	StrategyKeepBoth,
+	StrategyStructured,
+	StrategyFail,
+}
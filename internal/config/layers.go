@@ -0,0 +1,151 @@
+// Package config / 配置包
+// Module: Layered Configuration / 分层配置
+// Function: Merge defaults, system, user and repository config files, environment variables and -set flags
+//           合并默认值、系统、用户和仓库配置文件、环境变量以及 -set 参数
+// Author: git-autosync contributors
+// Dependencies: io, os, path/filepath, sort, strings
+
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SystemConfigDir 系统级配置目录
+// System-wide config directory
+const SystemConfigDir = "/etc/git-autosync"
+
+// EnvPrefix 配置环境变量的前缀，GIT_AUTOSYNC_SLEEP_INTERVAL 设置 sleep_interval
+// Prefix of config environment variables; GIT_AUTOSYNC_SLEEP_INTERVAL sets sleep_interval
+const EnvPrefix = "GIT_AUTOSYNC_"
+
+// LoadOptions 分层加载配置的输入，为空的字段对应的层被跳过
+// Inputs of layered config loading; layers whose field is empty are skipped
+// 优先级从低到高 / Precedence, lowest first:
+//
+//	内置默认值 / built-in defaults
+//	SystemDir/git_sync.conf       (/etc/git-autosync)
+//	UserDir/git_sync.conf         ($XDG_CONFIG_HOME/git-autosync)
+//	RepoRoot/git_sync.conf
+//	RepoRoot/.git/git_sync.conf   (本地，不提交 / local, never committed)
+//	GIT_AUTOSYNC_<KEY> 环境变量 / environment variables
+//	-set key=value
+//
+// 高优先级层中的值覆盖低优先级层；可重复的 conflict_rule 在某一层出现时整体替换低优先级层的规则
+// Values in higher layers override lower ones; the repeatable conflict_rule replaces all rules of lower layers
+// when it appears in a layer
+type LoadOptions struct {
+	SystemDir string
+	UserDir   string
+	RepoRoot  string
+	Env       []string // KEY=VALUE 形式，通常为 os.Environ() / KEY=VALUE pairs, usually os.Environ()
+	Overrides []string // -set 给出的 key=value / key=value pairs given with -set
+	// LoadConfig 打印加载信息和警告的位置，为 nil 时使用 stdout
+	// Where LoadConfig prints load information and warnings, stdout when nil
+	Output io.Writer
+}
+
+// DefaultLoadOptions 返回读取所有层的加载选项
+// Returns load options that read every layer
+// 用户配置目录为 $XDG_CONFIG_HOME/git-autosync（未设置时为 ~/.config/git-autosync，macOS 和 Windows 使用系统的配置目录）
+// The user config directory is $XDG_CONFIG_HOME/git-autosync (~/.config/git-autosync when unset; macOS and Windows use
+// their platform config directory)
+func DefaultLoadOptions(repoRoot string, overrides []string) LoadOptions {
+	opts := LoadOptions{
+		SystemDir: SystemConfigDir,
+		RepoRoot:  repoRoot,
+		Env:       os.Environ(),
+		Overrides: overrides,
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		opts.UserDir = filepath.Join(dir, "git-autosync")
+	}
+	return opts
+}
+
+// ConfigFiles 按优先级从低到高返回各层配置文件的路径，不论文件是否存在
+// Returns the config file path of each layer, lowest precedence first, whether or not the file exists
+func (o LoadOptions) ConfigFiles() []string {
+	var files []string
+	if o.SystemDir != "" {
+		files = append(files, filepath.Join(o.SystemDir, ConfigFileName))
+	}
+	if o.UserDir != "" {
+		files = append(files, filepath.Join(o.UserDir, ConfigFileName))
+	}
+	if o.RepoRoot != "" {
+		files = append(files, filepath.Join(o.RepoRoot, ConfigFileName), filepath.Join(o.RepoRoot, ".git", ConfigFileName))
+	}
+	return files
+}
+
+// Load 按优先级依次应用各层配置并记录每个值的来源，不生成示例也不验证
+// Applies the config layers in order of precedence and records where each value came from, without generating an
+// example or validating
+// 解析问题记录在 Errors 中，不打印 / Parse problems go to Errors and are not printed
+func Load(opts LoadOptions) (*LoadResult, error) {
+	res := &LoadResult{
+		Config:  DefaultConfig(),
+		Path:    filepath.Join(opts.RepoRoot, ConfigFileName),
+		Sources: make(map[string][]Source),
+	}
+
+	for _, path := range opts.ConfigFiles() {
+		if err := res.parseFile(path); err != nil {
+			return nil, err
+		}
+	}
+	res.applyEnv(opts.Env)
+	res.applyOverrides(opts.Overrides)
+
+	return res, nil
+}
+
+// applyEnv 应用 GIT_AUTOSYNC_<KEY> 环境变量，可重复的键用分号分隔多个值
+// Applies GIT_AUTOSYNC_<KEY> environment variables; repeatable keys take several values separated by semicolons
+func (r *LoadResult) applyEnv(env []string) {
+	var vars []string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, EnvPrefix) {
+			vars = append(vars, kv)
+		}
+	}
+	sort.Strings(vars)
+
+	seen := make(map[string]Source)
+	for _, kv := range vars {
+		name, value, _ := strings.Cut(kv, "=")
+		key := strings.ToLower(strings.TrimPrefix(name, EnvPrefix))
+		src := Source{Origin: "env " + name}
+
+		if opt, ok := LookupOption(key); ok && opt.Repeatable {
+			for _, v := range strings.Split(value, ";") {
+				if v = strings.TrimSpace(v); v != "" {
+					r.set(seen, key, v, src)
+				}
+			}
+			continue
+		}
+		r.set(seen, key, strings.TrimSpace(value), src)
+	}
+}
+
+// applyOverrides 应用 -set key=value 参数
+// Applies -set key=value flags
+func (r *LoadResult) applyOverrides(overrides []string) {
+	seen := make(map[string]Source)
+	for _, kv := range overrides {
+		key, value, ok := strings.Cut(kv, "=")
+		src := Source{Origin: "--set"}
+		if !ok {
+			r.Errors = append(r.Errors, FieldError{Source: src,
+				Message: "格式无效，应为 key=value / invalid format, expected key=value: " + kv})
+			continue
+		}
+		r.set(seen, strings.TrimSpace(key), strings.TrimSpace(value), src)
+	}
+}
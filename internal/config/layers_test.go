@@ -0,0 +1,125 @@
+// layers_test.go - Layered configuration unit tests / 分层配置单元测试
+//
+// Module: config
+// Description: Tests the precedence of config files, environment variables and -set flags, and the recorded sources
+// Author: git-autosync contributors
+// Dependencies: os, path/filepath, testing, time
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeLayer 在 dir 下写入配置文件并返回其路径
+// Writes a config file into dir and returns its path
+func writeLayer(t *testing.T, dir, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ConfigFileName)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoad_Precedence tests that each layer overrides the ones below it
+// 测试每一层覆盖优先级更低的层
+func TestLoad_Precedence(t *testing.T) {
+	root := t.TempDir()
+	opts := LoadOptions{
+		SystemDir: filepath.Join(root, "etc"),
+		UserDir:   filepath.Join(root, "xdg"),
+		RepoRoot:  filepath.Join(root, "repo"),
+		Env: []string{
+			"HOME=/home/me",
+			"GIT_AUTOSYNC_BATCH_SIZE=70",
+			"GIT_AUTOSYNC_LOG_LEVEL=warn",
+		},
+		Overrides: []string{"log_level=error"},
+	}
+	system := writeLayer(t, opts.SystemDir, "sleep_interval = 10s\nbranch_name = sys\nmax_add_attempts = 7\nconflict_rule = *.log union\n")
+	user := writeLayer(t, opts.UserDir, "sleep_interval = 20s\nbranch_name = user\n")
+	repo := writeLayer(t, opts.RepoRoot, "sleep_interval = 30s\nbatch_size = 60\nconflict_rule = *.txt ours\nconflict_rule = *.md theirs\n")
+	local := writeLayer(t, filepath.Join(opts.RepoRoot, ".git"), "sleep_interval = 40s\n")
+
+	res, err := Load(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %v", res.Errors)
+	}
+	if len(res.Files) != 4 || res.Files[0] != system || res.Files[3] != local {
+		t.Errorf("Expected files in precedence order, got %v", res.Files)
+	}
+
+	cfg := res.Config
+	tests := []struct {
+		key    string
+		got    interface{}
+		want   interface{}
+		source string
+	}{
+		{"max_add_attempts", cfg.MaxAddAttempts, 7, system + ":3"},
+		{"branch_name", cfg.BranchName, "user", user + ":2"},
+		{"sleep_interval", cfg.SleepInterval, 40 * time.Second, local + ":1"},
+		{"batch_size", cfg.BatchSize, 70, "env GIT_AUTOSYNC_BATCH_SIZE"},
+		{"log_level", cfg.LogLevel, "ERROR", "--set"},
+		{"remote_name", cfg.RemoteName, "origin", "default"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.key, tt.want, tt.got)
+		}
+		if got := res.Source(tt.key).String(); got != tt.source {
+			t.Errorf("%s: expected source %s, got %s", tt.key, tt.source, got)
+		}
+	}
+
+	// 仓库层的规则整体替换系统层的规则 / The repository rules replace the system rules entirely
+	if len(cfg.ConflictRules) != 2 || cfg.ConflictRules[0].Pattern != "*.txt" {
+		t.Errorf("Expected the repository rules only, got %v", cfg.ConflictRules)
+	}
+	if src := res.Sources["conflict_rule"]; len(src) != 2 || src[1].String() != repo+":4" {
+		t.Errorf("Expected the rule sources from the repository file, got %v", src)
+	}
+}
+
+// TestLoad_EnvAndOverrideErrors tests that bad environment variables and -set flags are reported with their origin
+// 测试错误的环境变量和 -set 参数带来源报告
+func TestLoad_EnvAndOverrideErrors(t *testing.T) {
+	res, err := Load(LoadOptions{
+		Env:       []string{"GIT_AUTOSYNC_NO_SUCH_KEY=1", "GIT_AUTOSYNC_CONFLICT_RULE=*.log union; *.lock theirs"},
+		Overrides: []string{"sleep_interval", "max_parallel_workers=500", "watch_mode=inotify", "watch_mode=poll"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Config.ConflictRules) != 2 || res.Config.ConflictRules[1].Strategy != "theirs" {
+		t.Errorf("Expected two rules from the environment, got %v", res.Config.ConflictRules)
+	}
+	expected := []string{
+		"env GIT_AUTOSYNC_NO_SUCH_KEY", // 未知键 / Unknown key
+		"--set",                        // 缺少 = / Missing =
+		"--set",                        // 超出范围 / Out of range
+		"--set",                        // 重复 / Duplicate
+	}
+	if len(res.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), res.Errors)
+	}
+	for i, want := range expected {
+		if got := res.Errors[i].Source.String(); got != want {
+			t.Errorf("Error %d: expected origin %s, got %s (%v)", i, want, got, res.Errors[i])
+		}
+	}
+	if res.Config.MaxParallelWorkers != 16 || res.Config.WatchMode != "poll" {
+		t.Errorf("Expected the default workers and the last watch_mode, got %d/%s", res.Config.MaxParallelWorkers, res.Config.WatchMode)
+	}
+}
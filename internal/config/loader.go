@@ -3,7 +3,7 @@
 // Function: Load configuration from file and generate example config
 //           从文件加载配置并生成示例配置
 // Author: git-autosync contributors
-// Dependencies: bufio, fmt, os, strconv, strings, time
+// Dependencies: bufio, fmt, os, path/filepath, strings
 
 package config
 
@@ -11,9 +11,8 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
-	"time"
 )
 
 // ConfigFileName 配置文件名
@@ -24,42 +23,200 @@ const ConfigFileName = "git_sync.conf"
 // Example configuration file name
 const ExampleConfigFileName = "git_sync.conf.example"
 
-// LoadConfigFromFile 从指定路径加载配置文件
-// Loads configuration from the specified path
-// 如果文件不存在，返回默认配置并生成示例文件
-// If file does not exist, returns default config and generates example file
+// Source 配置值的来源
+// Where a config value came from
+type Source struct {
+	// 配置文件路径、"env GIT_AUTOSYNC_<KEY>" 或 "--set"，为空表示内置默认值
+	// Config file path, "env GIT_AUTOSYNC_<KEY>" or "--set"; empty for the built-in default
+	Origin string
+	Line   int // 配置文件中的行号，其他来源为 0 / Line in the config file, 0 for other origins
+}
+
+// String 返回 "文件:行号"、环境变量或 --set，默认值返回 "default"
+// Returns "file:line", the environment variable or --set, or "default" for the built-in default
+func (s Source) String() string {
+	switch {
+	case s.Origin == "":
+		return "default"
+	case s.Line > 0:
+		return fmt.Sprintf("%s:%d", s.Origin, s.Line)
+	default:
+		return s.Origin
+	}
+}
+
+// FieldError 配置问题：格式无效的行、未知键、无效值、重复键或验证错误
+// A config problem: an invalid line, unknown key, invalid value, duplicate key or validation error
+type FieldError struct {
+	Key     string   // 出错的配置项，格式无效的行为空 / Offending option, empty for an invalid line
+	Entry   int      // 可重复的配置项中出错条目的序号 / Index of the offending entry of a repeatable option
+	Related []string // 配置项之间的约束涉及的其他配置项 / Other options involved in a constraint between options
+	Source  Source   // 出错的位置 / Where the problem is
+	Message string
+}
+
+// Error 实现 error，带文件和行号前缀
+// Implements error, prefixed with the file and line
+func (e FieldError) Error() string {
+	if e.Source.Origin == "" {
+		return e.Message
+	}
+	return e.Source.String() + ": " + e.Message
+}
+
+// LoadError 严格模式下配置有问题时返回的错误
+// Error returned when the config has problems in strict mode
+type LoadError struct {
+	Path     string
+	Problems []FieldError
+}
+
+// Error 实现 error
+// Implements error
+func (e *LoadError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Error()
+	}
+	return fmt.Sprintf("严格模式：配置有 %d 个问题 / strict mode: %d config problem(s) in %s:\n  - %s",
+		len(e.Problems), len(e.Problems), e.Path, strings.Join(messages, "\n  - "))
+}
+
+// LoadResult 分层加载配置的结果
+// Result of loading the config layers
+type LoadResult struct {
+	Config  *Config
+	Path    string   // 仓库根目录下的配置文件路径 / Path of the config file in the repository root
+	Files   []string // 读取到的配置文件，优先级从低到高 / Config files that were read, lowest precedence first
+	Applied int      // 成功应用的值的数量 / Number of values applied
+	// 成功设置的键，每次出现一个来源（可重复的键按出现顺序）
+	// Keys successfully set, one source per occurrence (in order of appearance for repeatable keys)
+	Sources map[string][]Source
+	// 解析时发现的问题；被拒绝的值保持之前的值
+	// Problems found while parsing; rejected values keep their previous value
+	Errors []FieldError
+}
+
+// Source 返回键当前值的来源；多次出现时最后一次生效
+// Returns where the key's current value came from; when it appears several times the last one wins
+func (r *LoadResult) Source(key string) Source {
+	sources := r.Sources[key]
+	if len(sources) == 0 {
+		return Source{}
+	}
+	return sources[len(sources)-1]
+}
+
+// SourceOf 返回验证错误所指的值的来源，可重复的键按条目序号对应
+// Returns where the value a validation error refers to came from, matching repeatable keys by entry index
+func (r *LoadResult) SourceOf(e FieldError) Source {
+	if opt, ok := LookupOption(e.Key); ok && opt.Repeatable {
+		if sources := r.Sources[e.Key]; e.Entry < len(sources) {
+			return sources[e.Entry]
+		}
+	}
+	return r.Source(e.Key)
+}
+
+// Problems 返回解析错误和验证错误，验证错误标注设置该值的位置
+// Returns the parse errors and validation errors, the latter pointing at where the value was set
+// 配置项之间的约束在 Key 使用默认值时归到实际设置的相关配置项
+// A constraint between options whose Key has its default value is attributed to the related option that was set
+func (r *LoadResult) Problems() []FieldError {
+	problems := append([]FieldError(nil), r.Errors...)
+	for _, p := range ValidateFields(r.Config) {
+		p.Source = r.SourceOf(p)
+		for _, key := range p.Related {
+			if p.Source.Origin != "" {
+				break
+			}
+			if src := r.Source(key); src.Origin != "" {
+				p.Key, p.Source = key, src
+			}
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// LoadConfigFromFile 从指定目录的配置文件（及其 .git/ 下的本地配置）加载配置
+// Loads configuration from the config file in the specified directory (and the local one under its .git/)
+// 不读取系统、用户配置和环境变量，参见 LoadConfig
+// System and user config and environment variables are not read, see LoadConfig
 func LoadConfigFromFile(workDir string) (*Config, error) {
-	cfg := DefaultConfig()
-	configPath := workDir + "/" + ConfigFileName
-	examplePath := workDir + "/" + ExampleConfigFileName
+	return LoadConfig(LoadOptions{RepoRoot: workDir})
+}
 
+// LoadConfig 分层加载配置
+// Loads the config layers
+// 仓库根目录下没有配置文件时生成示例文件；配置有问题时打印警告，启用 strict 时改为返回 *LoadError
+// An example file is generated when the repository root has no config file; config problems are printed as warnings,
+// and with strict enabled a *LoadError is returned instead
+func LoadConfig(opts LoadOptions) (*Config, error) {
+	res, err := Load(opts)
+	if err != nil {
+		return nil, err
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if _, err := os.Stat(res.Path); os.IsNotExist(err) {
+		// 仓库配置文件不存在，生成示例文件 / Repository config not found, generate example
+		examplePath := filepath.Join(opts.RepoRoot, ExampleConfigFileName)
+		if genErr := GenerateExampleConfig(examplePath); genErr != nil {
+			fmt.Fprintf(out, "[WARN] 生成示例配置失败 / Failed to generate example config: %v\n", genErr)
+		} else {
+			fmt.Fprintf(out, "[INFO] 已生成示例配置 / Generated example config: %s\n", examplePath)
+		}
+	}
+
+	if len(res.Files) == 0 {
+		fmt.Fprintf(out, "[INFO] 配置文件未找到，使用默认配置 / Config file not found, using defaults: %s\n", res.Path)
+	}
+	for _, f := range res.Files {
+		fmt.Fprintf(out, "[INFO] 已加载配置文件 / Loaded config file: %s\n", f)
+	}
+	if res.Applied > 0 {
+		fmt.Fprintf(out, "[INFO] 已加载 %d 个配置项 / Loaded %d config items\n", res.Applied, res.Applied)
+	}
+
+	// 验证配置 / Validate config
+	problems := res.Problems()
+	if len(problems) > 0 && res.Config.Strict {
+		return nil, &LoadError{Path: res.Path, Problems: problems}
+	}
+	for _, p := range problems {
+		fmt.Fprintf(out, "[WARN] 配置问题 / Config problem: %v\n", p)
+	}
+
+	return res.Config, nil
+}
+
+// parseFile 解析一个配置文件并应用到结果中，文件不存在时跳过
+// Parses one config file into the result, skipping it when it does not exist
+func (r *LoadResult) parseFile(path string) error {
 	// 检查配置文件是否存在 / Check if config file exists
-	file, err := os.Open(configPath)
+	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// 配置文件不存在，生成示例文件 / Config not found, generate example
-			fmt.Printf("[INFO] 配置文件未找到，使用默认配置 / Config file not found, using defaults: %s\n", configPath)
-			if genErr := GenerateExampleConfig(examplePath); genErr != nil {
-				fmt.Printf("[WARN] 生成示例配置失败 / Failed to generate example config: %v\n", genErr)
-			} else {
-				fmt.Printf("[INFO] 已生成示例配置 / Generated example config: %s\n", examplePath)
-			}
-			return cfg, nil
+			return nil
 		}
-		return nil, fmt.Errorf("无法打开配置文件 / failed to open config file: %w", err)
+		return fmt.Errorf("无法打开配置文件 / failed to open config file: %w", err)
 	}
 	defer file.Close()
-
-	fmt.Printf("[INFO] 正在加载配置文件 / Loading config file: %s\n", configPath)
+	r.Files = append(r.Files, path)
 
 	// 逐行解析配置 / Parse config line by line
 	scanner := bufio.NewScanner(file)
+	seen := make(map[string]Source)
 	lineNum := 0
-	loadedCount := 0
 
 	for scanner.Scan() {
 		lineNum++
 		line := strings.TrimSpace(scanner.Text())
+		src := Source{Origin: path, Line: lineNum}
 
 		// 跳过空行和注释 / Skip empty lines and comments
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -69,7 +226,8 @@ func LoadConfigFromFile(workDir string) (*Config, error) {
 		// 解析 key=value / Parse key=value
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			fmt.Printf("[WARN] 第%d行格式无效 / Invalid format at line %d: %s\n", lineNum, lineNum, line)
+			r.Errors = append(r.Errors, FieldError{Source: src,
+				Message: fmt.Sprintf("格式无效，应为 key = value / invalid format, expected key = value: %s", line)})
 			continue
 		}
 
@@ -81,263 +239,59 @@ func LoadConfigFromFile(workDir string) (*Config, error) {
 			value = strings.TrimSpace(value[:idx])
 		}
 
-		// 应用配置值 / Apply config value
-		if applyConfigValue(cfg, key, value, lineNum) {
-			loadedCount++
-		}
+		r.set(seen, key, value, src)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("读取配置文件出错 / error reading config file: %w", err)
-	}
-
-	fmt.Printf("[INFO] 已加载 %d 个配置项 / Loaded %d config items\n", loadedCount, loadedCount)
-
-	// 验证配置 / Validate config
-	if err := ValidateConfig(cfg); err != nil {
-		fmt.Printf("[WARN] 配置验证警告 / Config validation warning: %v\n", err)
+		return fmt.Errorf("读取配置文件出错 / error reading config file: %w", err)
 	}
-
-	return cfg, nil
+	return nil
 }
 
-// applyConfigValue 应用单个配置值到配置结构
-// Applies a single config value to the config struct
-// 返回 true 如果成功应用 / Returns true if successfully applied
-func applyConfigValue(cfg *Config, key, value string, lineNum int) bool {
-	switch key {
-	// Git配置 / Git configuration
-	case "remote_name":
-		cfg.RemoteName = value
-	case "branch_name":
-		cfg.BranchName = value
-
-	// 同步配置 / Sync configuration
-	case "sleep_interval":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.SleepInterval = d
-		} else {
-			logParseError(key, value, lineNum, cfg.SleepInterval)
-			return false
-		}
-	case "commit_msg_prefix":
-		cfg.CommitMsgPrefix = value
-
-	// 重试配置 / Retry configuration
-	case "max_add_attempts":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.MaxAddAttempts = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MaxAddAttempts)
-			return false
-		}
-	case "add_retry_delay":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.AddRetryDelay = d
-		} else {
-			logParseError(key, value, lineNum, cfg.AddRetryDelay)
-			return false
-		}
-
-	// 特殊仓库配置 / Special repository configuration
-	case "subrepo_base_dirs":
-		cfg.SubrepoBaseDirs = parseStringSlice(value)
-
-	// LFS配置 / LFS configuration
-	case "lfs_size_threshold_bytes":
-		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-			cfg.LFSSizeThresholdBytes = v
-		} else {
-			logParseError(key, value, lineNum, cfg.LFSSizeThresholdBytes)
-			return false
-		}
-
-	// 文件忽略配置 / File ignore configuration
-	case "ignore_size_threshold_bytes":
-		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-			cfg.IgnoreSizeThresholdBytes = v
-		} else {
-			logParseError(key, value, lineNum, cfg.IgnoreSizeThresholdBytes)
-			return false
-		}
-	case "ignore_file_name":
-		cfg.IgnoreFileName = value
-
-	// 空目录占位文件 / Empty directory placeholder
-	case "empty_dir_placeholder_file":
-		cfg.EmptyDirPlaceholderFile = value
-
-	// 并发配置 / Concurrency configuration
-	case "max_parallel_workers":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.MaxParallelWorkers = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MaxParallelWorkers)
-			return false
-		}
-
-	// 日志配置 / Log configuration
-	case "log_dir":
-		cfg.LogDir = value
-	case "log_max_size_mb":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.LogMaxSizeMB = v
-		} else {
-			logParseError(key, value, lineNum, cfg.LogMaxSizeMB)
-			return false
-		}
-	case "log_max_backups":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.LogMaxBackups = v
-		} else {
-			logParseError(key, value, lineNum, cfg.LogMaxBackups)
-			return false
-		}
-	case "log_level":
-		cfg.LogLevel = strings.ToUpper(value)
-
-	// 合并失败策略 / Merge failure strategy
-	case "merge_failure_strategy":
-		cfg.MergeFailureStrategy = value
-
-	// ============================================================
-	// 新增配置字段 (v2.0)
-	// New configuration fields (v2.0)
-	// ============================================================
-
-	// 失败处理配置 / Failure handling configuration
-	case "max_consecutive_failures":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.MaxConsecutiveFailures = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MaxConsecutiveFailures)
-			return false
-		}
-	case "safe_mode_multiplier":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.SafeModeMultiplier = v
-		} else {
-			logParseError(key, value, lineNum, cfg.SafeModeMultiplier)
-			return false
-		}
-
-	// 锁文件处理配置 / Lock file handling configuration
-	case "lock_file_max_age":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.LockFileMaxAge = d
-		} else {
-			logParseError(key, value, lineNum, cfg.LockFileMaxAge)
-			return false
-		}
-	case "lock_wait_time":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.LockWaitTime = d
-		} else {
-			logParseError(key, value, lineNum, cfg.LockWaitTime)
-			return false
-		}
-
-	// 批量处理配置 / Batch processing configuration
-	case "small_file_threshold":
-		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-			cfg.SmallFileThreshold = v
-		} else {
-			logParseError(key, value, lineNum, cfg.SmallFileThreshold)
-			return false
-		}
-	case "medium_file_threshold":
-		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-			cfg.MediumFileThreshold = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MediumFileThreshold)
-			return false
-		}
-	case "batch_size":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.BatchSize = v
-		} else {
-			logParseError(key, value, lineNum, cfg.BatchSize)
-			return false
-		}
-	case "small_batch_size":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.SmallBatchSize = v
-		} else {
-			logParseError(key, value, lineNum, cfg.SmallBatchSize)
-			return false
-		}
-
-	// 索引更新重试配置 / Index update retry configuration
-	case "index_update_max_retries":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.IndexUpdateMaxRetries = v
-		} else {
-			logParseError(key, value, lineNum, cfg.IndexUpdateMaxRetries)
-			return false
-		}
-	case "index_update_retry_delay":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.IndexUpdateRetryDelay = d
-		} else {
-			logParseError(key, value, lineNum, cfg.IndexUpdateRetryDelay)
-			return false
-		}
-
-	// 批量操作重试配置 / Batch operation retry configuration
-	case "batch_retry_max_attempts":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.BatchRetryMaxAttempts = v
-		} else {
-			logParseError(key, value, lineNum, cfg.BatchRetryMaxAttempts)
-			return false
-		}
-	case "batch_retry_base_delay":
-		if d, err := time.ParseDuration(value); err == nil {
-			cfg.BatchRetryBaseDelay = d
-		} else {
-			logParseError(key, value, lineNum, cfg.BatchRetryBaseDelay)
-			return false
-		}
-
-	// 合并配置 / Merge configuration
-	case "merge_log_lines":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.MergeLogLines = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MergeLogLines)
-			return false
-		}
-	case "max_backup_branches":
-		if v, err := strconv.Atoi(value); err == nil {
-			cfg.MaxBackupBranches = v
-		} else {
-			logParseError(key, value, lineNum, cfg.MaxBackupBranches)
-			return false
-		}
-
-	// 远程引用修复配置 / Remote reference repair configuration
-	case "auto_fix_corrupt_refs":
-		if v, err := strconv.ParseBool(value); err == nil {
-			cfg.AutoFixCorruptRefs = v
-		} else {
-			logParseError(key, value, lineNum, cfg.AutoFixCorruptRefs)
-			return false
-		}
-
-	default:
-		fmt.Printf("[WARN] 未知配置项 / Unknown config key at line %d: %s\n", lineNum, key)
-		return false
+// set 在一个配置层中应用一个值并记录来源
+// Applies one value within a config layer and records its source
+// seen 记录本层已设置的键：同一层中重复的键报告为问题（仍以最后一次为准），
+// 可重复的键在本层第一次出现时替换低优先级层的值
+// seen holds the keys already set in this layer: a key repeated within a layer is reported (the last one still wins),
+// and a repeatable key replaces the values of lower layers the first time it appears in a layer
+func (r *LoadResult) set(seen map[string]Source, key, value string, src Source) {
+	opt, known := LookupOption(key)
+	prev, inLayer := seen[key]
+	if known && !opt.Repeatable && inLayer {
+		r.Errors = append(r.Errors, FieldError{Key: key, Source: src,
+			Message: fmt.Sprintf("%s 重复，已在 %s 设置 / duplicate key %s, already set at %s", key, prev, key, prev)})
+	}
+	if known && opt.Repeatable && !inLayer && len(r.Sources[key]) > 0 {
+		opt.reset(r.Config)
+		r.Sources[key] = nil
 	}
 
-	return true
+	// 应用配置值 / Apply config value
+	if err := applyConfigValue(r.Config, key, value); err != nil {
+		err.Source = src
+		err.Entry = len(r.Sources[key])
+		r.Errors = append(r.Errors, *err)
+		return
+	}
+	if !inLayer {
+		seen[key] = src
+	}
+	r.Applied++
+	r.Sources[key] = append(r.Sources[key], src)
 }
 
-// logParseError 记录解析错误并使用默认值
-// Logs parse error and uses default value
-func logParseError(key, value string, lineNum int, defaultVal interface{}) {
-	fmt.Printf("[WARN] 第%d行 '%s' 值无效: '%s', 使用默认值: %v / "+
-		"Invalid value for '%s' at line %d: '%s', using default: %v\n",
-		lineNum, key, value, defaultVal, key, lineNum, value, defaultVal)
+// applyConfigValue 按 Schema 解析并应用单个配置值
+// Parses and applies a single config value according to Schema
+// 未知键或无效值返回错误，配置保持不变 / Unknown keys and invalid values return an error and leave the config unchanged
+func applyConfigValue(cfg *Config, key, value string) *FieldError {
+	opt, ok := LookupOption(key)
+	if !ok {
+		return &FieldError{Key: key, Message: fmt.Sprintf("未知配置项 / unknown config key: %s", key)}
+	}
+	if err := opt.set(cfg, value); err != nil {
+		return &FieldError{Key: key, Message: fmt.Sprintf("%s 值无效 / invalid value for %s: '%s': %v", key, key, value, err)}
+	}
+	return nil
 }
 
 // parseStringSlice 解析逗号分隔的字符串列表
@@ -353,3 +307,17 @@ func parseStringSlice(value string) []string {
 	}
 	return result
 }
+
+// parseConflictRule 解析 "<pattern> <strategy>" 格式的冲突规则，策略为最后一个字段
+// Parses a "<pattern> <strategy>" conflict rule; the strategy is the last field
+func parseConflictRule(value string) (ConflictRule, bool) {
+	idx := strings.LastIndexAny(value, " \t")
+	if idx <= 0 {
+		return ConflictRule{}, false
+	}
+	pattern := strings.TrimSpace(value[:idx])
+	if pattern == "" {
+		return ConflictRule{}, false
+	}
+	return ConflictRule{Pattern: pattern, Strategy: strings.ToLower(value[idx+1:])}, true
+}
@@ -3,13 +3,15 @@
 // Module: config
 // Description: Tests for config file loading, parsing, and validation
 // Author: git-autosync contributors
-// Dependencies: testing, os, path/filepath, time
+// Dependencies: testing, errors, os, path/filepath, strings, time
 
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -286,6 +288,100 @@ func TestValidateConfig(t *testing.T) {
 		}
 	})
 
+	t.Run("Keep-both merge strategy", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.MergeFailureStrategy = "keep-both"
+		// Should be accepted / 应被接受
+		if err := ValidateConfig(cfg); err != nil {
+			t.Errorf("Expected keep-both to be valid, got: %v", err)
+		}
+	})
+
+	t.Run("Conflict-branch merge strategy", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.MergeFailureStrategy = "conflict-branch"
+		// Should be accepted / 应被接受
+		if err := ValidateConfig(cfg); err != nil {
+			t.Errorf("Expected conflict-branch to be valid, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid compact granularity", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.CompactGranularity = "weekly"
+		// Should return validation error / 应返回验证错误
+		if err := ValidateConfig(cfg); err == nil {
+			t.Error("Expected validation error for invalid compact granularity")
+		}
+	})
+
+	t.Run("Negative commit stat lines", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.CommitStatLines = -1
+		// Should return validation error / 应返回验证错误
+		if err := ValidateConfig(cfg); err == nil {
+			t.Error("Expected validation error for negative commit_stat_lines")
+		}
+	})
+
+	t.Run("Invalid secret scan mode", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.SecretScan = "warn"
+		// Should return validation error / 应返回验证错误
+		if err := ValidateConfig(cfg); err == nil {
+			t.Error("Expected validation error for invalid secret scan mode")
+		}
+	})
+
+	t.Run("Encryption without key file", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.EncryptPatterns = []string{"secrets/**"}
+		cfg.EncryptKeyFile = ""
+		// Should return validation error / 应返回验证错误
+		if err := ValidateConfig(cfg); err == nil {
+			t.Error("Expected validation error for encrypt_patterns without encrypt_key_file")
+		}
+	})
+
+	t.Run("Invalid sync mode", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.SyncMode = "squash"
+		// Should return validation error / 应返回验证错误
+		if err := ValidateConfig(cfg); err == nil {
+			t.Error("Expected validation error for invalid sync mode")
+		}
+	})
+
+	t.Run("Invalid watch mode", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.WatchMode = "fanotify"
+		err := ValidateConfig(cfg)
+		// Should return validation error / 应返回验证错误
+		if err == nil {
+			t.Error("Expected validation error for invalid watch mode")
+		}
+	})
+
+	t.Run("Invalid archive pattern", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.SubrepoArchiveDirs = []string{"data/["}
+		err := ValidateConfig(cfg)
+		// Should return validation error / 应返回验证错误
+		if err == nil {
+			t.Error("Expected validation error for invalid archive pattern")
+		}
+	})
+
+	t.Run("Invalid conflict strategy", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.ConflictRules = []ConflictRule{{Pattern: "*.log", Strategy: "mine"}}
+		err := ValidateConfig(cfg)
+		// Should return validation error / 应返回验证错误
+		if err == nil {
+			t.Error("Expected validation error for invalid conflict strategy")
+		}
+	})
+
 	t.Run("Invalid log level", func(t *testing.T) {
 		cfg := DefaultConfig()
 		cfg.LogLevel = "INVALID"
@@ -340,6 +436,174 @@ func TestGenerateExampleConfig(t *testing.T) {
 	}
 }
 
+// TestSchemaMatchesLoader tests that every schema option is understood by the loader and round-trips its value
+// 测试 Schema 中的每个配置项都能被加载器识别，且值可以原样往返
+func TestSchemaMatchesLoader(t *testing.T) {
+	defaults := DefaultConfig()
+	for _, opt := range Options() {
+		values := opt.Values(defaults)
+		if len(opt.Examples) > 0 {
+			values = opt.Examples
+		}
+		cfg := DefaultConfig()
+		for _, v := range values {
+			if err := applyConfigValue(cfg, opt.Key, v); err != nil {
+				t.Errorf("%s: loader rejected %q: %v", opt.Key, v, err)
+			}
+		}
+		if got := opt.Values(cfg); strings.Join(got, "|") != strings.Join(values, "|") {
+			t.Errorf("%s: expected %v after loading, got %v", opt.Key, values, got)
+		}
+	}
+
+	// 示例中的每一行取消注释后都应能加载 / Every line of the example loads once uncommented
+	var uncommented []string
+	for _, line := range strings.Split(ExampleConfig(), "\n") {
+		if key := strings.Fields(strings.TrimPrefix(line, "# ")); len(key) > 1 && key[1] == "=" {
+			if _, ok := LookupOption(key[0]); ok {
+				uncommented = append(uncommented, strings.TrimPrefix(line, "# "))
+			}
+		}
+	}
+	if len(uncommented) < len(Options()) {
+		t.Errorf("Expected an example line for each of the %d options, got %d", len(Options()), len(uncommented))
+	}
+}
+
+// TestLoad_Sources tests that the source line of every value and every problem is recorded
+// 测试记录每个值和每个问题的行号
+func TestLoad_Sources(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `# comment
+sleep_interval = 30s
+bogus_key = 1
+conflict_rule = *.log union
+conflict_rule = *.tmp mine
+sleep_interval = 45s
+not a key value pair
+small_file_threshold = 200000000
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Load(LoadOptions{RepoRoot: tmpDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Files) != 1 || res.Applied != 4 {
+		t.Errorf("Expected one file with 4 applied lines, got %v/%d", res.Files, res.Applied)
+	}
+	if src := res.Source("sleep_interval"); src.Line != 6 || res.Config.SleepInterval != 45*time.Second {
+		t.Errorf("Expected the last sleep_interval (line 6) to win, got %v/%v", src, res.Config.SleepInterval)
+	}
+	if src := res.Source("log_level"); src.String() != "default" {
+		t.Errorf("Expected unset keys to come from the default, got %v", src)
+	}
+	if len(res.Config.ConflictRules) != 1 {
+		t.Errorf("Expected the invalid rule to be rejected, got %v", res.Config.ConflictRules)
+	}
+
+	// 解析错误：未知键、无效值、重复键、格式无效；验证错误：中文件阈值不大于小文件阈值
+	// Parse errors: unknown key, invalid value, duplicate key, invalid line; validation error: medium threshold not above small
+	// 中文件阈值使用默认值，验证错误归到设置了的小文件阈值 / Medium is left at its default, so the error points at the small threshold that was set
+	expected := []struct {
+		line int
+		key  string
+	}{{3, "bogus_key"}, {5, "conflict_rule"}, {6, "sleep_interval"}, {7, ""}, {8, "small_file_threshold"}}
+	problems := res.Problems()
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, want := range expected {
+		if p := problems[i]; p.Source.Line != want.line || p.Key != want.key {
+			t.Errorf("Problem %d: expected %s at line %d, got %s at %v", i, want.key, want.line, p.Key, p.Source)
+		}
+	}
+	if got := problems[0].Error(); !strings.HasPrefix(got, res.Path+":3: ") {
+		t.Errorf("Expected the error to start with the file and line, got %q", got)
+	}
+}
+
+// TestProblems_Related tests that a constraint between options points at whichever of the options was set
+// 测试配置项之间的约束指向实际设置了的配置项
+func TestProblems_Related(t *testing.T) {
+	tests := []struct {
+		name, content string
+		key           string
+		line          int
+	}{
+		{"small set", "log_level = INFO\nsmall_file_threshold = 200000000\n", "small_file_threshold", 2},
+		{"medium set", "medium_file_threshold = 1\n", "medium_file_threshold", 1},
+		{"both set", "small_file_threshold = 10\nmedium_file_threshold = 5\n", "medium_file_threshold", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res, err := Load(LoadOptions{RepoRoot: tmpDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			problems := res.Problems()
+			if len(problems) != 1 || problems[0].Key != tt.key || problems[0].Source.Line != tt.line {
+				t.Errorf("Expected one problem for %s at line %d, got %v", tt.key, tt.line, problems)
+			}
+		})
+	}
+}
+
+// TestLoadConfigFromFile_Strict tests that strict mode refuses any config problem
+// 测试严格模式拒绝任何配置问题
+func TestLoadConfigFromFile_Strict(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		tmpDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return tmpDir
+	}
+
+	t.Run("Typo keeps the default without strict", func(t *testing.T) {
+		cfg, err := LoadConfigFromFile(write(t, "merge_failure_strategy = rolback\n"))
+		if err != nil {
+			t.Fatalf("Expected only a warning, got: %v", err)
+		}
+		if cfg.MergeFailureStrategy != "force-push" {
+			t.Errorf("Expected the default strategy to be kept, got %s", cfg.MergeFailureStrategy)
+		}
+	})
+
+	t.Run("Typo refused in strict mode", func(t *testing.T) {
+		_, err := LoadConfigFromFile(write(t, "strict = true\nmerge_failure_strategy = rolback\n"))
+		var loadErr *LoadError
+		if !errors.As(err, &loadErr) {
+			t.Fatalf("Expected a *LoadError, got: %v", err)
+		}
+		if len(loadErr.Problems) != 1 || loadErr.Problems[0].Key != "merge_failure_strategy" || loadErr.Problems[0].Source.Line != 2 {
+			t.Errorf("Expected one problem for merge_failure_strategy at line 2, got %v", loadErr.Problems)
+		}
+	})
+
+	t.Run("Duplicate key refused in strict mode", func(t *testing.T) {
+		_, err := LoadConfigFromFile(write(t, "strict = true\nbranch_name = main\nbranch_name = dev\nconflict_rule = *.log union\nconflict_rule = *.txt ours\n"))
+		var loadErr *LoadError
+		if !errors.As(err, &loadErr) || len(loadErr.Problems) != 1 || loadErr.Problems[0].Source.Line != 3 {
+			t.Errorf("Expected only the duplicate branch_name at line 3 to be reported, got: %v", err)
+		}
+	})
+
+	t.Run("Clean config accepted in strict mode", func(t *testing.T) {
+		cfg, err := LoadConfigFromFile(write(t, "strict = true\nsleep_interval = 10s\n"))
+		if err != nil || !cfg.Strict || cfg.SleepInterval != 10*time.Second {
+			t.Errorf("Expected the config to load, got %v, %v", cfg, err)
+		}
+	})
+}
+
 // TestAllConfigKeys tests that all config keys are recognized
 // 测试所有配置键都被识别
 func TestAllConfigKeys(t *testing.T) {
@@ -351,6 +615,8 @@ func TestAllConfigKeys(t *testing.T) {
 branch_name = main
 sleep_interval = 60s
 commit_msg_prefix = Test:
+commit_msg_template = .git/commit.tmpl
+commit_stat_lines = 5
 max_add_attempts = 5
 add_retry_delay = 3s
 lfs_size_threshold_bytes = 100000000
@@ -362,6 +628,7 @@ log_dir = /tmp/logs
 log_max_size_mb = 20
 log_max_backups = 5
 log_level = WARN
+sync_mode = Rebase
 merge_failure_strategy = rollback
 max_consecutive_failures = 20
 safe_mode_multiplier = 5
@@ -377,6 +644,22 @@ batch_retry_max_attempts = 5
 batch_retry_base_delay = 2s
 merge_log_lines = 20
 max_backup_branches = 10
+max_remote_backups = 3
+watch_mode = inotify
+watch_debounce = 5s
+compact_interval = 1h
+compact_granularity = Hourly
+compact_pushed_window = 168h
+secret_scan = Block
+secret_allowlist_file = .allow
+encrypt_patterns = secrets/**, *.credentials
+encrypt_key_file = /keys/repo.key
+subrepo_archive_dirs = data/git/*, data/zsh
+subrepo_archive_lfs = true
+auto_fix_corrupt_refs = false
+strict = true
+conflict_rule = *.log union
+conflict_rule = my notes/** Keep-Both-With-Suffix
 `
 	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
 		t.Fatal(err)
@@ -392,9 +675,15 @@ max_backup_branches = 10
 	if cfg.RemoteName != "origin" {
 		t.Errorf("RemoteName: expected 'origin', got '%s'", cfg.RemoteName)
 	}
+	if cfg.CommitMsgTemplate != ".git/commit.tmpl" || cfg.CommitStatLines != 5 {
+		t.Errorf("Commit message: expected .git/commit.tmpl/5, got %s/%d", cfg.CommitMsgTemplate, cfg.CommitStatLines)
+	}
 	if cfg.MaxParallelWorkers != 8 {
 		t.Errorf("MaxParallelWorkers: expected 8, got %d", cfg.MaxParallelWorkers)
 	}
+	if cfg.SyncMode != "rebase" {
+		t.Errorf("SyncMode: expected 'rebase', got '%s'", cfg.SyncMode)
+	}
 	if cfg.MergeFailureStrategy != "rollback" {
 		t.Errorf("MergeFailureStrategy: expected 'rollback', got '%s'", cfg.MergeFailureStrategy)
 	}
@@ -410,6 +699,42 @@ max_backup_branches = 10
 	if cfg.MergeLogLines != 20 {
 		t.Errorf("MergeLogLines: expected 20, got %d", cfg.MergeLogLines)
 	}
+	if cfg.MaxRemoteBackups != 3 {
+		t.Errorf("MaxRemoteBackups: expected 3, got %d", cfg.MaxRemoteBackups)
+	}
+	if cfg.WatchMode != "inotify" {
+		t.Errorf("WatchMode: expected 'inotify', got '%s'", cfg.WatchMode)
+	}
+	if cfg.WatchDebounce != 5*time.Second {
+		t.Errorf("WatchDebounce: expected 5s, got %v", cfg.WatchDebounce)
+	}
+	if cfg.CompactInterval != time.Hour || cfg.CompactGranularity != "hourly" || cfg.CompactPushedWindow != 168*time.Hour {
+		t.Errorf("Compaction: expected 1h/hourly/168h, got %v/%s/%v", cfg.CompactInterval, cfg.CompactGranularity, cfg.CompactPushedWindow)
+	}
+	if cfg.SecretScan != "block" || cfg.SecretAllowlistFile != ".allow" {
+		t.Errorf("Secret scan: expected block/.allow, got %s/%s", cfg.SecretScan, cfg.SecretAllowlistFile)
+	}
+	if len(cfg.EncryptPatterns) != 2 || cfg.EncryptPatterns[1] != "*.credentials" || cfg.EncryptKeyFile != "/keys/repo.key" {
+		t.Errorf("Encryption: expected [secrets/** *.credentials]//keys/repo.key, got %v/%s", cfg.EncryptPatterns, cfg.EncryptKeyFile)
+	}
+	if len(cfg.SubrepoArchiveDirs) != 2 || cfg.SubrepoArchiveDirs[1] != "data/zsh" {
+		t.Errorf("SubrepoArchiveDirs: expected [data/git/* data/zsh], got %v", cfg.SubrepoArchiveDirs)
+	}
+	if !cfg.SubrepoArchiveLFS {
+		t.Error("SubrepoArchiveLFS: expected true")
+	}
+	if cfg.AutoFixCorruptRefs || !cfg.Strict {
+		t.Errorf("AutoFixCorruptRefs/Strict: expected false/true, got %v/%v", cfg.AutoFixCorruptRefs, cfg.Strict)
+	}
+	expectedRules := []ConflictRule{{"*.log", "union"}, {"my notes/**", "keep-both-with-suffix"}}
+	if len(cfg.ConflictRules) != len(expectedRules) {
+		t.Fatalf("ConflictRules: expected %v, got %v", expectedRules, cfg.ConflictRules)
+	}
+	for i, rule := range expectedRules {
+		if cfg.ConflictRules[i] != rule {
+			t.Errorf("ConflictRules[%d]: expected %v, got %v", i, rule, cfg.ConflictRules[i])
+		}
+	}
 }
 
 // Helper function / 辅助函数
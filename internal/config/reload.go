@@ -0,0 +1,82 @@
+// Package config / 配置包
+// Module: Config Reload / 配置重新加载
+// Function: Compare two configs and copy the options that can change while the daemon runs
+//           比较两份配置，复制守护进程运行中可以修改的配置项
+// Author: git-autosync contributors
+// Dependencies: time
+
+package config
+
+import (
+	"time"
+)
+
+// Change 重新加载前后一个配置项的变化，值以配置文件语法表示
+// One option that differs between the old and the reloaded config, values in config file syntax
+type Change struct {
+	Key  string
+	Old  []string
+	New  []string
+	Live bool // 可以在运行中生效，否则需要重启 / Can be applied while running, otherwise needs a restart
+}
+
+// Diff 按 Schema 顺序返回 from 和 to 中值不同的配置项
+// Returns the options whose values differ between from and to, in Schema order
+func Diff(from, to *Config) []Change {
+	var changes []Change
+	for _, opt := range Options() {
+		before, after := opt.Values(from), opt.Values(to)
+		if equalValues(before, after) {
+			continue
+		}
+		changes = append(changes, Change{Key: opt.Key, Old: before, New: after, Live: opt.Live})
+	}
+	return changes
+}
+
+// ApplyLive 把 src 中可以在运行中生效的配置项复制到 dst，其余字段保持不变
+// Copies the options that can be applied while running from src to dst, leaving every other field untouched
+// dst 被各个处理器共享，调用方需保证此时没有同步周期在运行
+// dst is shared by the processors; the caller must make sure no sync cycle is running
+func ApplyLive(dst, src *Config) {
+	for _, opt := range Options() {
+		if opt.Live {
+			opt.copy(dst, src)
+		}
+	}
+}
+
+// copy 把 src 中的字段值复制到 dst
+// Copies the field value from src to dst
+func (o Option) copy(dst, src *Config) {
+	switch p := o.field(dst).(type) {
+	case *string:
+		*p = *o.field(src).(*string)
+	case *int:
+		*p = *o.field(src).(*int)
+	case *int64:
+		*p = *o.field(src).(*int64)
+	case *bool:
+		*p = *o.field(src).(*bool)
+	case *time.Duration:
+		*p = *o.field(src).(*time.Duration)
+	case *[]string:
+		*p = append([]string(nil), *o.field(src).(*[]string)...)
+	case *[]ConflictRule:
+		*p = append([]ConflictRule{}, *o.field(src).(*[]ConflictRule)...)
+	}
+}
+
+// equalValues 两组格式化后的值是否相同
+// Whether two lists of formatted values are equal
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
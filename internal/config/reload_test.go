@@ -0,0 +1,94 @@
+// reload_test.go - Config reload unit tests / 配置重新加载单元测试
+//
+// Module: config
+// Description: Tests the diff between two configs and that only live options are applied to a running config
+// Author: git-autosync contributors
+// Dependencies: testing, time
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDiff tests that changed options are reported in schema order with their formatted values
+// 测试变化的配置项按 Schema 顺序报告，并带有格式化后的值
+func TestDiff(t *testing.T) {
+	from, to := DefaultConfig(), DefaultConfig()
+	if changes := Diff(from, to); len(changes) != 0 {
+		t.Fatalf("Expected no changes between two default configs, got %+v", changes)
+	}
+
+	to.SleepInterval = 2 * time.Minute
+	to.SyncMode = SyncModeRebase
+	to.ConflictRules = append(to.ConflictRules, ConflictRule{Pattern: "*.log", Strategy: "union"})
+
+	changes := Diff(from, to)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %+v", changes)
+	}
+
+	want := []struct {
+		key      string
+		old, new string
+		live     bool
+	}{
+		{"sleep_interval", formatDuration(from.SleepInterval), "120s", true},
+		{"sync_mode", SyncModeMerge, SyncModeRebase, false},
+		{"conflict_rule", "", "*.log union", false},
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Key != w.key || c.Live != w.live {
+			t.Errorf("Change %d: expected %s (live %v), got %s (live %v)", i, w.key, w.live, c.Key, c.Live)
+		}
+		if got := c.New[len(c.New)-1]; got != w.new {
+			t.Errorf("%s: expected new value %q, got %q", w.key, w.new, got)
+		}
+		if w.old != "" && c.Old[0] != w.old {
+			t.Errorf("%s: expected old value %q, got %q", w.key, w.old, c.Old[0])
+		}
+	}
+}
+
+// TestApplyLive tests that live options are copied and everything else keeps its running value
+// 测试可在运行中生效的配置项被复制，其余配置项保持运行中的值
+func TestApplyLive(t *testing.T) {
+	running, reloaded := DefaultConfig(), DefaultConfig()
+	running.RepoRoot = "/repo"
+
+	reloaded.SleepInterval = 5 * time.Minute
+	reloaded.LogLevel = "DEBUG"
+	reloaded.MergeFailureStrategy = "rollback"
+	reloaded.BatchRetryMaxAttempts = 7
+	reloaded.LFSSizeThresholdBytes = 1 << 20
+	reloaded.RemoteName = "upstream"
+	reloaded.WatchMode = "inotify"
+	reloaded.ConflictRules = []ConflictRule{{Pattern: "*.md", Strategy: "ours"}}
+
+	ApplyLive(running, reloaded)
+
+	if running.SleepInterval != 5*time.Minute || running.LogLevel != "DEBUG" || running.MergeFailureStrategy != "rollback" {
+		t.Errorf("Expected the interval, log level and merge strategy to be applied, got %v %s %s",
+			running.SleepInterval, running.LogLevel, running.MergeFailureStrategy)
+	}
+	if running.BatchRetryMaxAttempts != 7 || running.LFSSizeThresholdBytes != 1<<20 {
+		t.Errorf("Expected the retry and threshold settings to be applied, got %d %d",
+			running.BatchRetryMaxAttempts, running.LFSSizeThresholdBytes)
+	}
+	if running.RemoteName != "origin" || running.WatchMode != "poll" || len(running.ConflictRules) != 0 {
+		t.Errorf("Expected options that need a restart to keep their running values, got %s %s %v",
+			running.RemoteName, running.WatchMode, running.ConflictRules)
+	}
+	if running.RepoRoot != "/repo" {
+		t.Errorf("Expected RepoRoot to be kept, got %q", running.RepoRoot)
+	}
+
+	// 之后的 Diff 只剩需要重启的配置项 / A later diff only lists the options that need a restart
+	for _, c := range Diff(running, reloaded) {
+		if c.Live {
+			t.Errorf("Expected %s to be applied already", c.Key)
+		}
+	}
+}
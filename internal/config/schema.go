@@ -0,0 +1,631 @@
+// Package config / 配置包
+// Module: Configuration Schema / 配置项描述
+// Function: Describe every config key (struct field, type, description) in one place
+//           在一处描述所有配置项（结构字段、类型、说明）
+// Author: git-autosync contributors
+// Dependencies: fmt, path, strconv, strings, time
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option 一个配置项：键名、对应的 Config 字段、解析和验证规则以及中英双语说明
+// A config option: its key, the Config field it sets, how it is parsed and validated, and a bilingual description
+// 类型和默认值由字段推导，示例配置、config show 和加载器共用同一份描述
+// The type and default are derived from the field; the example config, config show and the loader share this description
+type Option struct {
+	Key        string
+	Doc        []string // 说明，每行一条注释 / Description, one comment line each
+	Examples   []string // 示例中展示的值，为空时展示默认值 / Values shown in the example, the default when empty
+	Repeatable bool     // 可出现多次，按顺序追加 / May appear several times, appended in order
+	Live       bool     // 守护进程重新加载配置时立即生效 / Applied to a running daemon when the config is reloaded
+
+	// field 返回 Config 中对应字段的指针，值按字段类型解析
+	// field returns a pointer to the corresponding Config field; values are parsed according to the field type
+	field func(c *Config) interface{}
+	// normalize 在解析前规范化字符串值（例如转小写）
+	// normalize canonicalises the raw string before parsing (e.g. lower-casing it)
+	normalize func(string) string
+	// validate 验证解析后的值（可重复的配置项逐条验证）
+	// validate checks the parsed value (entry by entry for repeatable options)
+	validate validator
+}
+
+// validator 验证解析后的值，错误信息不含键名
+// Checks a parsed value; the error message does not include the key
+type validator func(v interface{}) error
+
+// Section 示例配置中的一节
+// A section of the example config
+type Section struct {
+	Title   string
+	Options []Option
+}
+
+// Schema 所有配置项，按示例配置中的顺序分节
+// Every config option, grouped into sections in example config order
+var Schema = []Section{
+	{Title: "配置检查 / Config Checking", Options: []Option{
+		{Key: "strict", Doc: []string{
+			"严格模式：配置有任何问题（格式无效、未知键、无效值、重复键或验证失败）时拒绝启动",
+			"Strict mode: refuse to start on any config problem (invalid line, unknown key, invalid value, duplicate key or failed validation)",
+			"关闭时这些问题只记录警告，出错的值保持默认 / When off the problems are only logged as warnings and the affected values keep their defaults",
+		}, field: func(c *Config) interface{} { return &c.Strict }},
+	}},
+	{Title: "Git 配置 / Git Configuration", Options: []Option{
+		{Key: "remote_name", Doc: []string{"远程仓库名称 / Remote repository name"},
+			field: func(c *Config) interface{} { return &c.RemoteName }},
+		{Key: "branch_name", Doc: []string{"分支名称 / Branch name"},
+			field: func(c *Config) interface{} { return &c.BranchName }},
+	}},
+	{Title: "同步配置 / Sync Configuration", Options: []Option{
+		{Key: "sleep_interval", Live: true, Doc: []string{
+			"同步间隔 / Sync interval",
+			"格式: 数字+单位(s/m/h) / Format: number+unit(s/m/h)",
+		}, validate: positive,
+			field: func(c *Config) interface{} { return &c.SleepInterval }},
+		{Key: "commit_msg_prefix", Doc: []string{"提交消息前缀 / Commit message prefix"},
+			field: func(c *Config) interface{} { return &c.CommitMsgPrefix }},
+		{Key: "commit_msg_template", Doc: []string{
+			"提交信息模板文件 / Commit message template file",
+			"Go text/template 格式，相对路径相对于仓库根目录；为空时使用内置模板",
+			"Go text/template syntax, relative paths are relative to the repository root; the built-in template is used when empty",
+			"可用字段 / Available fields: .Prefix .Timestamp .Counts .Total .Added .Modified .Deleted .Renamed",
+			"  .Insertions .Deletions .Files .Dirs .Subrepos .LFSFiles .IgnoredForSize .Stat",
+			"可用函数 / Available functions: join, joinMax",
+			"主题行应以 commit_msg_prefix 开头，否则历史压缩无法识别自动同步提交",
+			"The subject should start with commit_msg_prefix, otherwise history compaction cannot recognise auto-sync commits",
+		}, field: func(c *Config) interface{} { return &c.CommitMsgTemplate }},
+		{Key: "commit_stat_lines", Doc: []string{
+			"提交信息中 --stat 统计最多列出的文件数 (0 = 不列出) / Max files listed in the commit message --stat (0 = omit)",
+		}, validate: nonNegative,
+			field: func(c *Config) interface{} { return &c.CommitStatLines }},
+	}},
+	{Title: "重试配置 / Retry Configuration", Options: []Option{
+		{Key: "max_add_attempts", Live: true, Doc: []string{"git add 最大重试次数 / Max retry attempts for git add"},
+			field: func(c *Config) interface{} { return &c.MaxAddAttempts }},
+		{Key: "add_retry_delay", Live: true, Doc: []string{"git add 重试延迟 / Retry delay for git add"},
+			field: func(c *Config) interface{} { return &c.AddRetryDelay }},
+	}},
+	{Title: "特殊仓库配置 / Special Repository Configuration", Options: []Option{
+		{Key: "subrepo_base_dirs", Doc: []string{"特殊仓库基础目录（逗号分隔）/ Special repo base directories (comma-separated)"},
+			field: func(c *Config) interface{} { return &c.SubrepoBaseDirs }},
+		{Key: "subrepo_archive_dirs", Doc: []string{
+			"以单个 gitdir.tar 归档存储 .git 的子仓库（逗号分隔的 glob，相对仓库根目录）",
+			"Sub-repositories whose .git is stored as a single gitdir.tar archive (comma-separated globs relative to the repo root)",
+			"归档是确定性的：未变化的仓库产生相同的 blob / The archive is deterministic: an unchanged repo yields the same blob",
+		}, Examples: []string{"debian/data/git/*"},
+			validate: globs,
+			field:    func(c *Config) interface{} { return &c.SubrepoArchiveDirs }},
+		{Key: "subrepo_archive_lfs", Doc: []string{"用 Git LFS 追踪 gitdir.tar / Track gitdir.tar with Git LFS"},
+			field: func(c *Config) interface{} { return &c.SubrepoArchiveLFS }},
+	}},
+	{Title: "LFS 配置 / LFS Configuration", Options: []Option{
+		{Key: "lfs_size_threshold_bytes", Live: true, Doc: []string{"LFS 文件大小阈值（字节）/ LFS file size threshold (bytes)"},
+			field: func(c *Config) interface{} { return &c.LFSSizeThresholdBytes }},
+	}},
+	{Title: "文件忽略配置 / File Ignore Configuration", Options: []Option{
+		{Key: "ignore_size_threshold_bytes", Live: true, Doc: []string{"忽略文件大小阈值（字节）/ Ignore file size threshold (bytes)"},
+			field: func(c *Config) interface{} { return &c.IgnoreSizeThresholdBytes }},
+		{Key: "ignore_file_name", Doc: []string{"忽略文件名 / Ignore file name"},
+			field: func(c *Config) interface{} { return &c.IgnoreFileName }},
+	}},
+	{Title: "空目录配置 / Empty Directory Configuration", Options: []Option{
+		{Key: "empty_dir_placeholder_file", Doc: []string{"空目录占位文件名 / Empty directory placeholder file name"},
+			field: func(c *Config) interface{} { return &c.EmptyDirPlaceholderFile }},
+	}},
+	{Title: "并发配置 / Concurrency Configuration", Options: []Option{
+		{Key: "max_parallel_workers", Doc: []string{
+			"最大并行工作线程数 / Max parallel workers",
+			"范围: 1-100 / Range: 1-100",
+		}, validate: intRange(1, 100),
+			field: func(c *Config) interface{} { return &c.MaxParallelWorkers }},
+	}},
+	{Title: "日志配置 / Log Configuration", Options: []Option{
+		{Key: "log_dir", Doc: []string{"日志目录 / Log directory"},
+			field: func(c *Config) interface{} { return &c.LogDir }},
+		{Key: "log_max_size_mb", Doc: []string{"单个日志文件最大大小(MB) / Max size per log file (MB)"},
+			field: func(c *Config) interface{} { return &c.LogMaxSizeMB }},
+		{Key: "log_max_backups", Doc: []string{"最大日志备份数量 / Max number of log backups"},
+			field: func(c *Config) interface{} { return &c.LogMaxBackups }},
+		{Key: "log_level", Live: true, Doc: []string{
+			"日志级别 / Log level",
+			"可选: DEBUG, INFO, WARN, ERROR",
+		}, normalize: strings.ToUpper, validate: oneOf("DEBUG", "INFO", "WARN", "ERROR"),
+			field: func(c *Config) interface{} { return &c.LogLevel }},
+	}},
+	{Title: "分叉同步模式 / Sync Mode", Options: []Option{
+		{Key: "sync_mode", Doc: []string{
+			"本地与远程分叉时的同步方式 / How diverged local and remote branches are synced",
+			"merge: 生成三路合并提交 / create a three-way merge commit",
+			"rebase: 把本地的自动同步提交逐个变基到远程分支之上，历史保持线性",
+			"        replay local auto-sync commits one by one on top of the remote branch, keeping history linear",
+			"        每个提交的冲突同样按 conflict_rule 解决，失败时中止变基并回滚到备份分支",
+			"        conflicts in each commit go through conflict_rule too; on failure the rebase is aborted and rolled back to the backup branch",
+			"        本地有人工提交或合并提交时改用三路合并，不改写它们",
+			"        falls back to the three-way merge when local has human or merge commits, so they are never rewritten",
+		}, normalize: strings.ToLower, validate: oneOf(SyncModeMerge, SyncModeRebase),
+			field: func(c *Config) interface{} { return &c.SyncMode }},
+	}},
+	{Title: "合并失败策略 / Merge Failure Strategy", Options: []Option{
+		{Key: "merge_failure_strategy", Live: true, Doc: []string{
+			"合并失败时的处理策略 / Strategy when merge fails",
+			"force-push: 强制推送本地状态到远程（适合CNB临时环境）",
+			"rollback: 仅回滚本地，保留备份分支（适合多人协作）",
+			"keep-both: 本地版本保留在原路径，远程版本另存为 name.conflict-<主机>-<时间>.ext，一起提交并推送（不丢数据）",
+			"           keep ours at the original path, save theirs as name.conflict-<host>-<time>.ext, commit both and push (no data loss)",
+			"conflict-branch: 回滚本地，把本地状态推送到远程 autosync-conflict/<主机>/<时间> 分支（提交信息列出冲突文件），",
+			"                 同步分支保持不变，之后的周期继续尝试合并",
+			"                 roll back locally and push the local state to autosync-conflict/<host>/<time> on the remote (the commit",
+			"                 message lists the conflicted files); the sync branch is left untouched and later cycles keep retrying the merge",
+		}, validate: oneOf(MergeFailureForcePush, MergeFailureRollback, MergeFailureKeepBoth, MergeFailureConflictBranch),
+			field: func(c *Config) interface{} { return &c.MergeFailureStrategy }},
+	}},
+	{Title: "失败处理配置 / Failure Handling Configuration", Options: []Option{
+		{Key: "max_consecutive_failures", Live: true, Doc: []string{"最大连续失败次数（超过后进入安全模式）/ Max consecutive failures before safe mode"},
+			validate: positive,
+			field:    func(c *Config) interface{} { return &c.MaxConsecutiveFailures }},
+		{Key: "safe_mode_multiplier", Live: true, Doc: []string{
+			"安全模式休眠倍数 / Safe mode sleep multiplier",
+			"安全模式下: 实际休眠 = sleep_interval * safe_mode_multiplier",
+		}, validate: positive,
+			field: func(c *Config) interface{} { return &c.SafeModeMultiplier }},
+	}},
+	{Title: "锁文件处理配置 / Lock File Handling Configuration", Options: []Option{
+		{Key: "lock_file_max_age", Live: true, Doc: []string{"锁文件最大存活时间（超过认为是残留）/ Max age for stale lock file"},
+			validate: positive,
+			field:    func(c *Config) interface{} { return &c.LockFileMaxAge }},
+		{Key: "lock_wait_time", Live: true, Doc: []string{"锁文件等待时间 / Wait time when lock exists"},
+			field: func(c *Config) interface{} { return &c.LockWaitTime }},
+	}},
+	{Title: "批量处理配置 / Batch Processing Configuration", Options: []Option{
+		{Key: "small_file_threshold", Live: true, Doc: []string{"小文件阈值（字节）/ Small file threshold (bytes)"},
+			validate: positive,
+			field:    func(c *Config) interface{} { return &c.SmallFileThreshold }},
+		{Key: "medium_file_threshold", Live: true, Doc: []string{"中文件阈值（字节）/ Medium file threshold (bytes)"},
+			field: func(c *Config) interface{} { return &c.MediumFileThreshold }},
+		{Key: "batch_size", Live: true, Doc: []string{"批处理大小 / Batch size for file operations"},
+			field: func(c *Config) interface{} { return &c.BatchSize }},
+		{Key: "small_batch_size", Live: true, Doc: []string{"小批次大小 / Small batch size"},
+			field: func(c *Config) interface{} { return &c.SmallBatchSize }},
+	}},
+	{Title: "索引更新重试配置 / Index Update Retry Configuration", Options: []Option{
+		{Key: "index_update_max_retries", Live: true, Doc: []string{"索引更新最大重试次数 / Max retries for index update"},
+			field: func(c *Config) interface{} { return &c.IndexUpdateMaxRetries }},
+		{Key: "index_update_retry_delay", Live: true, Doc: []string{"索引更新重试延迟 / Retry delay for index update"},
+			field: func(c *Config) interface{} { return &c.IndexUpdateRetryDelay }},
+	}},
+	{Title: "批量操作重试配置 / Batch Operation Retry Configuration", Options: []Option{
+		{Key: "batch_retry_max_attempts", Live: true, Doc: []string{"批量操作最大重试次数 / Max retry attempts for batch operations"},
+			field: func(c *Config) interface{} { return &c.BatchRetryMaxAttempts }},
+		{Key: "batch_retry_base_delay", Live: true, Doc: []string{"批量操作重试基础延迟 / Base delay for batch retry"},
+			field: func(c *Config) interface{} { return &c.BatchRetryBaseDelay }},
+	}},
+	{Title: "合并配置 / Merge Configuration", Options: []Option{
+		{Key: "merge_log_lines", Live: true, Doc: []string{"合并日志显示行数 / Lines to show in merge log"},
+			field: func(c *Config) interface{} { return &c.MergeLogLines }},
+		{Key: "max_backup_branches", Live: true, Doc: []string{"最大备份分支数量 / Max backup branches to keep"},
+			field: func(c *Config) interface{} { return &c.MaxBackupBranches }},
+		{Key: "max_remote_backups", Live: true, Doc: []string{
+			"远程备份引用最大保留数量 / Max remote backup refs to keep",
+			"强制推送前，远程分支原来的提交先推送到 refs/autosync-backup/<时间>，超出数量的旧引用在强制推送后删除",
+			"Before a force push the old remote tip is pushed to refs/autosync-backup/<time>; older refs beyond this count are deleted after the force push",
+		}, validate: nonNegative,
+			field: func(c *Config) interface{} { return &c.MaxRemoteBackups }},
+		{Key: "conflict_rule", Repeatable: true, Doc: []string{
+			"冲突解决规则 / Conflict resolution rules",
+			"格式: conflict_rule = <glob> <策略>，可重复，按顺序匹配，第一条匹配的规则生效",
+			"Format: conflict_rule = <glob> <strategy>; repeatable, evaluated in order, the first match wins",
+			"不含 / 的模式匹配文件名，否则匹配相对仓库根目录的路径，dir/** 匹配目录下所有文件",
+			"Patterns without / match the file name, otherwise the repo-relative path; dir/** matches everything below dir",
+			"策略 / Strategies:",
+			"  ours                  保留本地版本 / keep the local version",
+			"  theirs                使用远程版本 / take the remote version",
+			"  union                 合并双方的行 / keep the lines of both sides",
+			"  newest-mtime          使用最近提交修改的一方 / take the side committed most recently",
+			"  keep-both-with-suffix 保留本地版本，远程版本另存为 name.conflict-<主机>-<时间>.ext",
+			"                        keep ours, save theirs as name.conflict-<host>-<time>.ext",
+			"  structured            JSON/YAML 键级三路合并，同一个键双方改法不同时不解决",
+			"                        key-level three-way merge of JSON/YAML; unresolved when the same key changed differently",
+			"  fail                  不自动解决 / do not resolve automatically",
+			"未匹配任何规则时，锁文件（package-lock.json 等）使用远程版本，.json/.yaml/.yml 使用 structured，其余文件不自动解决",
+			"Without a matching rule lock files (package-lock.json etc.) take the remote version, .json/.yaml/.yml use structured",
+			"and other files are not resolved",
+		}, Examples: []string{"*.log union", "config/*.local ours", "notes/** keep-both-with-suffix"},
+			validate: validRule,
+			field:    func(c *Config) interface{} { return &c.ConflictRules }},
+	}},
+	{Title: "远程引用修复配置 / Remote Reference Repair Configuration", Options: []Option{
+		{Key: "auto_fix_corrupt_refs", Doc: []string{
+			"推送遇到损坏的远程引用时自动删除它们并重试 / Delete corrupt remote refs and retry when a push runs into them",
+		}, field: func(c *Config) interface{} { return &c.AutoFixCorruptRefs }},
+	}},
+	{Title: "文件监听配置 / File Watcher Configuration", Options: []Option{
+		{Key: "watch_mode", Doc: []string{
+			"监听模式 / Watch mode",
+			"poll: 每个 sleep_interval 全量扫描 / Full rescan every sleep_interval",
+			"inotify: 仅在文件变化时同步（仅Linux），sleep_interval 作为最大空闲间隔",
+			"         Sync only when files change (Linux only), sleep_interval is the max idle interval",
+		}, normalize: strings.ToLower, validate: oneOf("poll", "inotify"),
+			field: func(c *Config) interface{} { return &c.WatchMode }},
+		{Key: "watch_debounce", Live: true, Doc: []string{"变更去抖时间（最后一次写入后等待的静默时间）/ Debounce window after the last write"},
+			validate: positive,
+			field:    func(c *Config) interface{} { return &c.WatchDebounce }},
+	}},
+	{Title: "历史压缩配置 / History Compaction Configuration", Options: []Option{
+		{Key: "compact_interval", Live: true, Doc: []string{
+			"压缩任务运行间隔，0 表示禁用；也可以用 git-autosync compact 手动运行",
+			"How often compaction runs, 0 disables it; it can also be run by hand with git-autosync compact",
+			"连续的自动同步提交按小时或按天压缩为一个提交，只处理已经结束的小时/天；",
+			"人工提交、合并提交以及它们之前的历史不会被重写，压缩前创建 backup-before-compact-<时间> 备份分支",
+			"Consecutive auto-sync commits are squashed per finished hour/day; human commits, merge commits and everything",
+			"before them are never rewritten, and a backup-before-compact-<time> branch is created first",
+			"压缩在推送之后运行；compact_pushed_window 为 0 时只压缩未推送的提交，而正常运行的守护进程每个周期都会推送，",
+			"因此只会压缩无法推送时积累的提交，需要同时设置 compact_pushed_window",
+			"Compaction runs after the push; with compact_pushed_window = 0 only unpushed commits are compacted, and a healthy",
+			"daemon pushes every cycle, so only commits piled up while pushing failed are compacted; set compact_pushed_window too",
+		}, validate: nonNegative,
+			field: func(c *Config) interface{} { return &c.CompactInterval }},
+		{Key: "compact_granularity", Doc: []string{
+			"压缩粒度 / Compaction granularity",
+			"可选: hourly, daily",
+		}, normalize: strings.ToLower, validate: oneOf(CompactHourly, CompactDaily),
+			field: func(c *Config) interface{} { return &c.CompactGranularity }},
+		{Key: "compact_pushed_window", Doc: []string{
+			"允许重写的已推送历史窗口（提交时间在窗口内的已推送提交也会被压缩并强制推送）",
+			"0 表示只压缩尚未推送的提交；被窗口截断的小时/天保持不变",
+			"Window of pushed history that may be rewritten (pushed commits committed within the window are squashed too and force pushed)",
+			"0 compacts unpushed commits only; an hour/day cut by the window is left alone",
+		}, validate: nonNegative,
+			field: func(c *Config) interface{} { return &c.CompactPushedWindow }},
+	}},
+	{Title: "敏感信息扫描配置 / Secret Scanning Configuration", Options: []Option{
+		{Key: "secret_scan", Doc: []string{
+			"提交前扫描已暂存的内容（私钥、AWS 密钥、GitHub/GitLab/Slack 等令牌、高熵的 password/token/api_key 赋值）",
+			"Staged content is scanned before committing (private keys, AWS keys, GitHub/GitLab/Slack tokens, high-entropy",
+			"password/token/api_key assignments)",
+			"可选 / Options:",
+			"  off:     不扫描（默认）/ No scanning (default)",
+			"  unstage: 取消暂存并写入 .gitignore_nopush，其余变更照常提交；文件每个周期都会被重新暂存和取消暂存，",
+			"           每个发现只警告一次",
+			"           Unstage the file and add it to .gitignore_nopush, other changes are committed as usual; the file is",
+			"           staged and unstaged again every cycle, each finding is warned about once",
+			"  block:   本周期不提交也不推送，直到文件被修改或加入白名单",
+			"           Neither commit nor push in this cycle until the file is fixed or allowlisted",
+		}, normalize: strings.ToLower, validate: oneOf(SecretScanOff, SecretScanUnstage, SecretScanBlock),
+			field: func(c *Config) interface{} { return &c.SecretScan }},
+		{Key: "secret_allowlist_file", Doc: []string{
+			"白名单文件 / Allowlist file",
+			"每行一个路径模式（语法同 conflict_rule），或日志中打印的发现指纹 sha256:<hex>",
+			"One path pattern per line (same syntax as conflict_rule), or a finding fingerprint sha256:<hex> as printed in the log",
+		}, field: func(c *Config) interface{} { return &c.SecretAllowlistFile }},
+	}},
+	{Title: "透明加密配置 / Transparent Encryption Configuration", Options: []Option{
+		{Key: "encrypt_patterns", Doc: []string{
+			"需要加密的路径（.gitattributes 模式，逗号分隔）/ Paths to encrypt (.gitattributes patterns, comma separated)",
+			"启动时注册 git clean/smudge 过滤器（git-autosync filter clean|smudge）并写入 .gitattributes；",
+			"仓库中存储确定性 AES-256-GCM 密文，工作区中保持明文，内容不变时不会产生新的 blob",
+			"The git clean/smudge filter (git-autosync filter clean|smudge) is registered on startup and written to .gitattributes;",
+			"the repository stores deterministic AES-256-GCM ciphertext while the working tree stays plaintext, and unchanged",
+			"content never produces new blobs",
+		}, Examples: []string{"secrets/**, *.credentials"},
+			field: func(c *Config) interface{} { return &c.EncryptPatterns }},
+		{Key: "encrypt_key_file", Doc: []string{
+			"密钥文件，必须位于仓库之外；用 git-autosync filter keygen 生成，请另行备份",
+			"Key file, must be outside the repository; create it with git-autosync filter keygen and back it up separately",
+		}, field: func(c *Config) interface{} { return &c.EncryptKeyFile }},
+	}},
+}
+
+// LookupOption 按键名查找配置项
+// Looks up a config option by key
+func LookupOption(key string) (Option, bool) {
+	for _, section := range Schema {
+		for _, opt := range section.Options {
+			if opt.Key == key {
+				return opt, true
+			}
+		}
+	}
+	return Option{}, false
+}
+
+// Options 按顺序返回所有配置项
+// Returns every config option in order
+func Options() []Option {
+	var opts []Option
+	for _, section := range Schema {
+		opts = append(opts, section.Options...)
+	}
+	return opts
+}
+
+// Type 值类型：string、int、bytes、bool、duration、list 或 rule
+// Value type: string, int, bytes, bool, duration, list or rule
+func (o Option) Type() string {
+	switch o.field(&Config{}).(type) {
+	case *int:
+		return "int"
+	case *int64:
+		return "bytes"
+	case *bool:
+		return "bool"
+	case *time.Duration:
+		return "duration"
+	case *[]string:
+		return "list"
+	case *[]ConflictRule:
+		return "rule"
+	default:
+		return "string"
+	}
+}
+
+// Values 以配置文件语法格式化 cfg 中的值；可重复的配置项每条一个值
+// Formats the value in cfg using config file syntax; repeatable options yield one value per entry
+func (o Option) Values(cfg *Config) []string {
+	switch v := o.field(cfg).(type) {
+	case *string:
+		return []string{*v}
+	case *int:
+		return []string{strconv.Itoa(*v)}
+	case *int64:
+		return []string{strconv.FormatInt(*v, 10)}
+	case *bool:
+		return []string{strconv.FormatBool(*v)}
+	case *time.Duration:
+		return []string{formatDuration(*v)}
+	case *[]string:
+		return []string{strings.Join(*v, ", ")}
+	case *[]ConflictRule:
+		values := make([]string, len(*v))
+		for i, rule := range *v {
+			values[i] = rule.Pattern + " " + rule.Strategy
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// formatDuration 以配置文件中常用的写法格式化时长（60s、168h），而不是 time.Duration 的 1m0s
+// Formats a duration the way config files usually spell it (60s, 168h) rather than time.Duration's 1m0s
+func formatDuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "0"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return d.String()
+	}
+}
+
+// formatSize 把字节数格式化为整数个 GB/MB/KB，无法整除时返回空字符串
+// Formats a byte count as a whole number of GB/MB/KB, or an empty string when it does not divide evenly
+func formatSize(n int64) string {
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.name)
+		}
+	}
+	return ""
+}
+
+// positive 值应大于 0（int、int64 或 time.Duration）
+// The value must be greater than 0 (int, int64 or time.Duration)
+func positive(v interface{}) error {
+	if sign(v) <= 0 {
+		return fmt.Errorf("应大于 0 / should be > 0, got %v", v)
+	}
+	return nil
+}
+
+// nonNegative 值应大于等于 0（int、int64 或 time.Duration）
+// The value must not be negative (int, int64 or time.Duration)
+func nonNegative(v interface{}) error {
+	if sign(v) < 0 {
+		return fmt.Errorf("应大于等于 0 / should be >= 0, got %v", v)
+	}
+	return nil
+}
+
+// sign 返回数值的符号
+// Returns the sign of a numeric value
+func sign(v interface{}) int {
+	var n int64
+	switch v := v.(type) {
+	case int:
+		n = int64(v)
+	case int64:
+		n = v
+	case time.Duration:
+		n = int64(v)
+	}
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
+
+// intRange 整数值应在 [min, max] 之间
+// The integer value must be within [min, max]
+func intRange(min, max int) validator {
+	return func(v interface{}) error {
+		if n := v.(int); n < min || n > max {
+			return fmt.Errorf("应在 %d-%d 之间 / should be %d-%d, got %d", min, max, min, max, n)
+		}
+		return nil
+	}
+}
+
+// oneOf 字符串值应为 allowed 之一
+// The string value must be one of allowed
+func oneOf(allowed ...string) validator {
+	quoted := make([]string, len(allowed))
+	for i, a := range allowed {
+		quoted[i] = "'" + a + "'"
+	}
+	last := len(quoted) - 1
+	zh := strings.Join(quoted[:last], "、") + " 或 " + quoted[last]
+	en := strings.Join(quoted[:last], ", ") + " or " + quoted[last]
+
+	return func(v interface{}) error {
+		for _, a := range allowed {
+			if v.(string) == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("应为 %s / should be %s, got '%s'", zh, en, v)
+	}
+}
+
+// globs 列表中的每一项应为有效的 glob 模式
+// Every entry of the list must be a valid glob pattern
+func globs(v interface{}) error {
+	for _, pattern := range v.([]string) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("模式无效 / invalid pattern: '%s'", pattern)
+		}
+	}
+	return nil
+}
+
+// validRule 冲突规则的模式和策略应有效
+// The conflict rule's pattern and strategy must be valid
+func validRule(v interface{}) error {
+	rule := v.(ConflictRule)
+	if _, err := path.Match(strings.TrimSuffix(rule.Pattern, "/**"), ""); err != nil {
+		return fmt.Errorf("模式无效 / invalid pattern: '%s'", rule.Pattern)
+	}
+	if !validConflictStrategy(rule.Strategy) {
+		return fmt.Errorf("策略无效 / invalid strategy for '%s': '%s' (%s)",
+			rule.Pattern, rule.Strategy, strings.Join(ConflictStrategies, "/"))
+	}
+	return nil
+}
+
+// entries 返回 cfg 中的值供验证；可重复的配置项每条一个
+// Returns the value in cfg for validation; repeatable options yield one value per entry
+func (o Option) entries(cfg *Config) []interface{} {
+	switch p := o.field(cfg).(type) {
+	case *string:
+		return []interface{}{*p}
+	case *int:
+		return []interface{}{*p}
+	case *int64:
+		return []interface{}{*p}
+	case *bool:
+		return []interface{}{*p}
+	case *time.Duration:
+		return []interface{}{*p}
+	case *[]string:
+		return []interface{}{*p}
+	case *[]ConflictRule:
+		values := make([]interface{}, len(*p))
+		for i, rule := range *p {
+			values[i] = rule
+		}
+		return values
+	}
+	return nil
+}
+
+// set 解析并验证 raw，成功时写入 cfg；失败时 cfg 不变
+// Parses and validates raw and stores it in cfg on success; cfg is unchanged on failure
+// 可重复的配置项追加到已有的值之后 / Repeatable options are appended to the existing values
+func (o Option) set(cfg *Config, raw string) error {
+	if o.normalize != nil {
+		raw = o.normalize(raw)
+	}
+
+	var v interface{}
+	var err error
+	switch o.field(cfg).(type) {
+	case *string:
+		v = raw
+	case *int:
+		v, err = strconv.Atoi(raw)
+	case *int64:
+		v, err = strconv.ParseInt(raw, 10, 64)
+	case *bool:
+		v, err = strconv.ParseBool(raw)
+	case *time.Duration:
+		v, err = time.ParseDuration(raw)
+	case *[]string:
+		v = parseStringSlice(raw)
+	case *[]ConflictRule:
+		rule, ok := parseConflictRule(raw)
+		if !ok {
+			return o.typeError()
+		}
+		v = rule
+	}
+	if err != nil {
+		return o.typeError()
+	}
+	if o.validate != nil {
+		if err := o.validate(v); err != nil {
+			return err
+		}
+	}
+
+	switch p := o.field(cfg).(type) {
+	case *string:
+		*p = v.(string)
+	case *int:
+		*p = v.(int)
+	case *int64:
+		*p = v.(int64)
+	case *bool:
+		*p = v.(bool)
+	case *time.Duration:
+		*p = v.(time.Duration)
+	case *[]string:
+		*p = v.([]string)
+	case *[]ConflictRule:
+		*p = append(*p, v.(ConflictRule))
+	}
+	return nil
+}
+
+// typeError 值无法按类型解析时的错误
+// Error for a value that cannot be parsed as the option's type
+func (o Option) typeError() error {
+	name := typeNames[o.Type()]
+	return fmt.Errorf("应为%s / expected %s", name[0], name[1])
+}
+
+// typeNames 各类型的中英文描述，用于解析错误
+// Chinese and English description of each type, used in parse errors
+var typeNames = map[string][2]string{
+	"string":   {"字符串", "a string"},
+	"int":      {"整数", "an integer"},
+	"bytes":    {"字节数", "a number of bytes"},
+	"bool":     {" true 或 false", "true or false"},
+	"duration": {"时长（如 60s、2m、1h30m）", "a duration such as 60s, 2m or 1h30m"},
+	"list":     {"逗号分隔的列表", "a comma-separated list"},
+	"rule":     {" <模式> <策略>", "<pattern> <strategy>"},
+}
+
+// reset 清空可重复配置项的值，供高优先级的配置层整体替换
+// Clears the value of a repeatable option so a higher config layer can replace it entirely
+func (o Option) reset(cfg *Config) {
+	if p, ok := o.field(cfg).(*[]ConflictRule); ok {
+		*p = []ConflictRule{}
+	}
+}
@@ -0,0 +1,159 @@
+// Package crypt / 透明加密包
+// Module: Clean/Smudge Encryption / clean/smudge 透明加密
+// Function: Deterministic AES-256-GCM encryption used by the git clean/smudge filter for selected paths
+//           供 git clean/smudge 过滤器对选定路径使用的确定性 AES-256-GCM 加密
+// Author: git-autosync contributors
+// Dependencies: bytes, crypto/aes, crypto/cipher, crypto/hmac, crypto/rand, crypto/sha256, encoding/hex, errors, fmt, os,
+//               path/filepath, strings
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilterName 在 .gitattributes 和 git config 中注册的过滤器名称
+// Name of the filter registered in .gitattributes and git config
+const FilterName = "autosync-crypt"
+
+// magic 加密内容的文件头；开头的 NUL 让 git 把密文当作二进制文件
+// Header of encrypted content; the leading NUL makes git treat the ciphertext as binary
+const magic = "\x00GASENC1"
+
+// nonceSize AES-GCM 随机数长度
+// AES-GCM nonce length
+const nonceSize = 12
+
+// ErrWrongKey 密文无法用当前密钥解密
+// The ciphertext cannot be decrypted with the current key
+var ErrWrongKey = errors.New("decryption failed: wrong key or corrupted data")
+
+// Cipher 由密钥文件派生的加密器
+// Cipher derived from a key file
+type Cipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// GenerateKey 生成新的 32 字节随机密钥并以十六进制写入 path（权限 0600），已存在时拒绝覆盖
+// Generates a new random 32-byte key and writes it hex-encoded to path (mode 0600), refusing to overwrite an existing file
+func GenerateKey(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadKey 读取十六进制密钥文件并创建加密器
+// Reads a hex key file and creates the cipher
+func LoadKey(path string) (*Cipher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("key file %s must contain 64 hex characters", path)
+	}
+	return NewCipher(key)
+}
+
+// NewCipher 从 32 字节主密钥派生加密密钥和随机数密钥
+// Derives the encryption key and the nonce key from a 32-byte master key
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(derive(key, "git-autosync encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead, nonceKey: derive(key, "git-autosync nonce")}, nil
+}
+
+// Encrypt 确定性加密：随机数取自明文的 HMAC，相同内容总是得到相同密文，未修改的文件不会产生新的 blob
+// Deterministic encryption: the nonce is an HMAC of the plaintext, so the same content always yields the same
+// ciphertext and unchanged files never produce new blobs
+// 已加密的内容原样返回 / Content that is already encrypted is returned unchanged
+func (c *Cipher) Encrypt(plain []byte) []byte {
+	if IsEncrypted(plain) {
+		return plain
+	}
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write(plain)
+	nonce := mac.Sum(nil)[:nonceSize]
+
+	out := make([]byte, 0, len(magic)+nonceSize+len(plain)+c.aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, plain, []byte(magic))
+}
+
+// Decrypt 解密 Encrypt 的输出；未加密的内容（例如启用加密前提交的文件）原样返回
+// Decrypts the output of Encrypt; content that is not encrypted (e.g. committed before encryption was enabled) is
+// returned unchanged
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if len(data) < len(magic)+nonceSize+c.aead.Overhead() {
+		return nil, ErrWrongKey
+	}
+	nonce := data[len(magic) : len(magic)+nonceSize]
+	plain, err := c.aead.Open(nil, nonce, data[len(magic)+nonceSize:], []byte(magic))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+// IsEncrypted 内容是否带有加密文件头
+// Whether the content carries the encryption header
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// ExpandPath 展开开头的 ~/ 并返回绝对路径
+// Expands a leading ~/ and returns an absolute path
+func ExpandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return filepath.Abs(path)
+}
+
+// derive 用 HMAC-SHA256 从主密钥派生用途不同的子密钥
+// Derives purpose-specific subkeys from the master key with HMAC-SHA256
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
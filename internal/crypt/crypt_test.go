@@ -0,0 +1,110 @@
+// crypt_test.go - Transparent encryption unit tests / 透明加密单元测试
+//
+// Module: crypt
+// Description: Tests deterministic round trips, passthrough of plaintext, wrong keys and key generation
+// Author: git-autosync contributors
+// Dependencies: bytes, os, path/filepath, runtime, testing
+
+package crypt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// newTestCipher creates a cipher from a generated key file
+// 从生成的密钥文件创建加密器
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+	keyFile := filepath.Join(t.TempDir(), "keys", "encrypt.key")
+	if err := GenerateKey(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestEncryptRoundTrip tests that encryption is deterministic and decrypts back to the plaintext
+// 测试加密是确定性的并且能解密回明文
+func TestEncryptRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+	plain := []byte("db password hunter2\n")
+
+	first := c.Encrypt(plain)
+	if !IsEncrypted(first) || bytes.Contains(first, plain) {
+		t.Fatalf("Expected ciphertext with header, got %q", first)
+	}
+	if second := c.Encrypt(plain); !bytes.Equal(first, second) {
+		t.Error("Expected the same plaintext to produce the same ciphertext")
+	}
+	if other := c.Encrypt([]byte("db password hunter3\n")); bytes.Equal(first, other) {
+		t.Error("Expected different plaintexts to produce different ciphertexts")
+	}
+	if again := c.Encrypt(first); !bytes.Equal(first, again) {
+		t.Error("Expected already encrypted content to pass through unchanged")
+	}
+
+	got, err := c.Decrypt(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("Expected %q, got %q", plain, got)
+	}
+
+	// 启用加密前提交的明文原样返回 / Plaintext committed before encryption was enabled passes through
+	if got, err := c.Decrypt(plain); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("Expected plaintext to pass through, got %q, %v", got, err)
+	}
+}
+
+// TestDecryptWrongKey tests that a different key or tampered data is rejected
+// 测试不同的密钥或被篡改的数据被拒绝
+func TestDecryptWrongKey(t *testing.T) {
+	data := newTestCipher(t).Encrypt([]byte("secret"))
+
+	if _, err := newTestCipher(t).Decrypt(data); err != ErrWrongKey {
+		t.Errorf("Expected ErrWrongKey for a different key, got %v", err)
+	}
+
+	c := newTestCipher(t)
+	tampered := c.Encrypt([]byte("secret"))
+	tampered[len(tampered)-1] ^= 1
+	if _, err := c.Decrypt(tampered); err != ErrWrongKey {
+		t.Errorf("Expected ErrWrongKey for tampered data, got %v", err)
+	}
+}
+
+// TestGenerateKey tests the key file permissions and that existing keys are never overwritten
+// 测试密钥文件权限以及不会覆盖已有密钥
+func TestGenerateKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "encrypt.key")
+	if err := GenerateKey(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(keyFile)
+
+	if err := GenerateKey(keyFile); err == nil {
+		t.Error("Expected an error when the key file already exists")
+	}
+	if after, _ := os.ReadFile(keyFile); !bytes.Equal(before, after) {
+		t.Error("Expected the existing key to be left unchanged")
+	}
+
+	// Windows 不支持 Unix 权限位 / Windows has no Unix permission bits
+	if info, err := os.Stat(keyFile); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		t.Errorf("Expected key file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.key")
+	os.WriteFile(bad, []byte("not hex"), 0600)
+	if _, err := LoadKey(bad); err == nil {
+		t.Error("Expected an error for an invalid key file")
+	}
+}
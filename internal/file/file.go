@@ -2,6 +2,7 @@ package file
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"github.com/find-xposed-magisk/git-sync/internal/config"
 	"github.com/find-xposed-magisk/git-sync/internal/git"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 )
 
 // FileProcessor 文件处理器
@@ -75,9 +77,11 @@ func (fp *FileProcessor) StageFile(filePath string) error {
 		fp.logger.Warn("LFS 检测 (大小 > %dB) / LFS DETECTED (size > %dB): 使用 Git LFS 追踪 '%s' / Tracking '%s' with Git LFS",
 			fp.cfg.LFSSizeThresholdBytes, fp.cfg.LFSSizeThresholdBytes, filePath, filePath)
 		
-		// 使用LFS追踪
-		// Track with LFS
-		if err := fp.gitOps.LFSTrack(filePath); err != nil {
+		// 使用LFS追踪；加密的文件不交给 LFS，以密文暂存
+		// Track with LFS; encrypted files are not handed to LFS and are staged as ciphertext
+		if err := fp.gitOps.LFSTrack(filePath); errors.Is(err, git.ErrEncrypted) {
+			fp.logger.Warn("'%s' 已加密，不使用 LFS 追踪 / '%s' is encrypted, not tracking it with LFS", filePath, filePath)
+		} else if err != nil {
 			fp.logger.Warn("Failed to track with LFS: %v", err)
 		}
 		
@@ -107,6 +111,18 @@ func (fp *FileProcessor) StageFile(filePath string) error {
 	return nil
 }
 
+// IgnorePath 把相对路径写入忽略文件并暂存忽略文件
+// Adds a relative path to the ignore file and stages the ignore file
+func (fp *FileProcessor) IgnorePath(relPath string) error {
+	if err := fp.addToIgnoreFile(relPath); err != nil {
+		return err
+	}
+	if err := fp.gitOps.Add(fp.cfg.IgnoreFileName); err != nil {
+		fp.logger.Warn("Failed to stage ignore file: %v", err)
+	}
+	return nil
+}
+
 // addToIgnoreFile 添加文件路径到忽略文件
 // Adds file path to ignore file
 func (fp *FileProcessor) addToIgnoreFile(filePath string) error {
@@ -121,6 +137,12 @@ func (fp *FileProcessor) addToIgnoreFile(filePath string) error {
 		return nil // 已存在，跳过 / Already exists, skip
 	}
 	
+	// 演练模式：只记录 / Dry-run mode: record only
+	if fp.gitOps.DryRun() {
+		fp.gitOps.Plan().Record(plan.ActionIgnoreAppend, filePath, fp.cfg.IgnoreFileName)
+		return nil
+	}
+	
 	// 追加到文件
 	// Append to file
 	f, err := os.OpenFile(fp.ignoreFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -203,6 +225,12 @@ func (fp *FileProcessor) HandleEmptyDirectories() error {
 			placeholderPath := filepath.Join(path, fp.cfg.EmptyDirPlaceholderFile)
 			fp.logger.Debug("在空目录中创建占位文件 / Creating placeholder in empty directory: %s", placeholderPath)
 			
+			if fp.gitOps.DryRun() {
+				fp.gitOps.Plan().Record(plan.ActionWriteFile, placeholderPath, "placeholder")
+				fp.gitOps.Add(placeholderPath)
+				return nil
+			}
+			
 			if err := os.WriteFile(placeholderPath, []byte{}, 0644); err != nil {
 				fp.logger.Warn("Failed to create placeholder: %v", err)
 				return nil
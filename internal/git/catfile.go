@@ -0,0 +1,114 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CatFileBatch 通过单个 git cat-file --batch 进程按顺序读取多个对象
+// Reads several objects in order through a single git cat-file --batch process
+// objects 可以是对象 hash 或任意 rev 表达式（如 HEAD:path）
+// objects may be object hashes or any rev expression (e.g. HEAD:path)
+// fn 收到的 Reader 只在回调期间有效，未读完的内容会被丢弃
+// The reader passed to fn is only valid during the callback; unread content is discarded
+func (g *GitOps) CatFileBatch(objects []string, fn func(object string, size int64, r io.Reader) error) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	if err := g.ctx.Err(); err != nil {
+		return fmt.Errorf("not started: %w", err)
+	}
+
+	proc, err := g.start("cat-file", "--batch")
+	if err != nil {
+		return fmt.Errorf("git cat-file --batch failed to start: %w", err)
+	}
+	stdin := proc.Stdin()
+
+	// 请求在独立的 goroutine 中写入，避免与读取互相阻塞
+	// Requests are written from a separate goroutine so writing and reading cannot block each other
+	go func() {
+		w := bufio.NewWriter(stdin)
+		for _, object := range objects {
+			if _, err := w.WriteString(object + "\n"); err != nil {
+				break
+			}
+		}
+		w.Flush()
+		stdin.Close()
+	}()
+
+	fail := func(err error) error {
+		proc.Kill()
+		return err
+	}
+
+	reader := bufio.NewReaderSize(proc.Stdout(), 64*1024)
+	for _, object := range objects {
+		if err := g.ctx.Err(); err != nil {
+			return fail(fmt.Errorf("interrupted: %w", err))
+		}
+
+		// 响应头: <hash> SP <type> SP <size> LF，或 <object> SP missing LF
+		// Header: <hash> SP <type> SP <size> LF, or <object> SP missing LF
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return fail(fmt.Errorf("git cat-file --batch: reading header for %s: %w, stderr: %s", object, err, proc.Stderr()))
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fail(fmt.Errorf("git cat-file --batch: object %s: %s", object, strings.TrimSpace(header)))
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fail(fmt.Errorf("git cat-file --batch: bad header %q: %w", strings.TrimSpace(header), err))
+		}
+
+		body := io.LimitReader(reader, size)
+		if err := fn(object, size, body); err != nil {
+			return fail(err)
+		}
+
+		// 丢弃回调未读完的内容和结尾的换行
+		// Discard whatever the callback left unread plus the trailing newline
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return fail(err)
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := proc.Wait(); err != nil {
+		return fmt.Errorf("git cat-file --batch failed: %w, stderr: %s", err, proc.Stderr())
+	}
+	return nil
+}
+
+// MissingObjects 返回对象库中不存在的 hash
+// Returns the hashes that are missing from the object database
+// 通过单个 git cat-file --batch-check 进程检查 / Checked through a single git cat-file --batch-check process
+func (g *GitOps) MissingObjects(hashes []string) (map[string]bool, error) {
+	missing := make(map[string]bool)
+	if len(hashes) == 0 {
+		return missing, nil
+	}
+
+	output, _, err := g.execGitCommandWithInput(strings.Join(hashes, "\n")+"\n", "cat-file", "--batch-check")
+	if err != nil {
+		return nil, err
+	}
+
+	// 不存在的对象输出为 "<hash> missing"
+	// Missing objects are reported as "<hash> missing"
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "missing" {
+			missing[fields[0]] = true
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,119 @@
+// catfile_test.go - Long-lived git process unit tests / 长期运行的 git 进程单元测试
+//
+// Module: git
+// Description: Tests CatFileBatch and the ObjectWriterPool against processes scripted by a FakeRunner
+// Author: git-autosync contributors
+// Dependencies: fmt, io, strings, testing
+
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestCatFileBatch_Fake tests that objects are requested and read back through the runner
+// 测试对象通过 runner 启动的进程请求并读回
+func TestCatFileBatch_Fake(t *testing.T) {
+	g, fake := newFakeGitOps(t, false)
+	blobs := map[string]string{"aaa": "hello", "bbb": "line one\nline two\n"}
+	fake.On("cat-file", "--batch").Serve(func(object string) string {
+		return fmt.Sprintf("%s blob %d\n%s\n", object, len(blobs[object]), blobs[object])
+	})
+
+	var got []string
+	err := g.CatFileBatch([]string{"aaa", "bbb", "aaa"}, func(object string, size int64, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != size {
+			t.Errorf("%s: expected %d bytes, got %d", object, size, len(data))
+		}
+		got = append(got, object+"="+string(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "aaa=hello|bbb=line one\nline two\n|aaa=hello"
+	if strings.Join(got, "|") != want {
+		t.Errorf("Expected %q, got %q", want, strings.Join(got, "|"))
+	}
+	if c := fake.Commands(); len(c) != 1 || c[0].Dir != g.cfg.RepoRoot {
+		t.Errorf("Expected one process in the repository root, got %v", c)
+	}
+}
+
+// TestCatFileBatch_FakeErrors tests missing objects, callback errors and a failing process
+// 测试对象不存在、回调出错和进程失败
+func TestCatFileBatch_FakeErrors(t *testing.T) {
+	noop := func(string, int64, io.Reader) error { return nil }
+
+	t.Run("missing object", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, false)
+		fake.On("cat-file", "--batch").Serve(func(object string) string {
+			return object + " missing\n"
+		})
+		err := g.CatFileBatch([]string{"ccc"}, noop)
+		if err == nil || !strings.Contains(err.Error(), "ccc missing") {
+			t.Errorf("Expected a missing object error, got %v", err)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, false)
+		fake.On("cat-file", "--batch").Serve(func(object string) string {
+			return object + " blob 1\nx\n"
+		})
+		calls := 0
+		err := g.CatFileBatch([]string{"aaa", "bbb"}, func(string, int64, io.Reader) error {
+			calls++
+			return fmt.Errorf("stop")
+		})
+		if err == nil || err.Error() != "stop" || calls != 1 {
+			t.Errorf("Expected the callback error after one object, got %v after %d calls", err, calls)
+		}
+	})
+
+	t.Run("process fails", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, false)
+		fake.On("cat-file", "--batch").Fail(128, "fatal: not a git repository")
+		err := g.CatFileBatch([]string{"aaa"}, noop)
+		if err == nil || !strings.Contains(err.Error(), "not a git repository") {
+			t.Errorf("Expected stderr in the error, got %v", err)
+		}
+	})
+}
+
+// TestObjectWriterPool_Fake tests that the pool reuses a writer and replaces one that failed
+// 测试进程池复用写入进程，并替换出错的进程
+func TestObjectWriterPool_Fake(t *testing.T) {
+	g, fake := newFakeGitOps(t, false)
+	fake.On("hash-object", "-w", "--stdin-paths").Serve(func(path string) string {
+		return "hash-of-" + path + "\n"
+	})
+	// 第一个进程读到请求后立即退出 / The first process exits as soon as it reads a request
+	fake.On("hash-object", "-w", "--stdin-paths").Once().Fail(128, "fatal: unable to write object")
+
+	pool := g.NewObjectWriterPool(1)
+	defer pool.Close()
+
+	if _, err := pool.Write("a.bin"); err == nil || !strings.Contains(err.Error(), "unable to write object") {
+		t.Errorf("Expected the first write to fail with stderr, got %v", err)
+	}
+	for _, path := range []string{"a.bin", "b.bin"} {
+		hash, err := pool.Write(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != "hash-of-"+path {
+			t.Errorf("%s: expected hash-of-%s, got %s", path, path, hash)
+		}
+	}
+	if n := fake.Count("hash-object"); n != 2 {
+		t.Errorf("Expected the broken writer to be replaced once, got %d starts", n)
+	}
+}
@@ -0,0 +1,51 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// interruptGracePeriod 发送中断信号后等待 git 自行退出的时间
+// How long git is given to exit on its own after the interrupt signal
+const interruptGracePeriod = 5 * time.Second
+
+// Run 运行命令，ctx 取消后不再启动新命令
+// Runs a command; no new command is started once ctx is cancelled
+// 正在运行的命令先收到中断信号（git 会删除自己持有的 .lock 文件），超时后才被强制结束
+// A running command first receives an interrupt (git removes the .lock files it holds) and is only killed after a grace period
+func Run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("not started: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Windows 不支持 os.Interrupt，直接结束进程
+	// Windows does not support os.Interrupt, so the process is killed directly
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+
+	grace := time.NewTimer(interruptGracePeriod)
+	defer grace.Stop()
+	select {
+	case <-done:
+	case <-grace.C:
+		cmd.Process.Kill()
+		<-done
+	}
+	return fmt.Errorf("interrupted: %w", ctx.Err())
+}
@@ -0,0 +1,273 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// FakeRunner 按脚本应答 git 命令的 GitRunner，供单元测试使用
+// GitRunner that answers git commands from a script, for unit tests
+// 每条命令由最后注册的、参数前缀相同且仍有剩余次数的规则应答，因此后注册的规则覆盖先注册的默认应答；
+// 没有匹配规则的命令成功且无输出。所有调用都被记录，测试据此断言执行了哪些命令
+// Each command is answered by the most recently registered rule whose argument prefix matches and that has uses left,
+// so later rules override earlier defaults; commands without a matching rule succeed with no output. Every call is
+// recorded so tests can assert what ran
+type FakeRunner struct {
+	mu    sync.Mutex
+	rules []*FakeReply
+	calls []Command
+}
+
+// FakeReply FakeRunner 中的一条应答规则
+// An answer rule of a FakeRunner
+type FakeReply struct {
+	prefix []string
+	result Result
+	times  int // 剩余次数，-1 为不限 / Uses left, -1 for unlimited
+	hook   func(c Command)
+	serve  func(request string) string
+}
+
+// NewFakeRunner 创建空脚本的 FakeRunner
+// Creates a FakeRunner with an empty script
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{}
+}
+
+// On 为以 args 开头的命令注册应答，默认成功、无输出、不限次数
+// Registers an answer for commands starting with args; by default it succeeds with no output and never runs out
+func (f *FakeRunner) On(args ...string) *FakeReply {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := &FakeReply{prefix: args, times: -1}
+	f.rules = append(f.rules, r)
+	return r
+}
+
+// Stdout 设置命令的标准输出
+// Sets the command's standard output
+func (r *FakeReply) Stdout(out string) *FakeReply {
+	r.result.Stdout = []byte(out)
+	return r
+}
+
+// Fail 让命令以 exitCode 和 stderr 失败
+// Makes the command fail with exitCode and stderr
+func (r *FakeReply) Fail(exitCode int, stderr string) *FakeReply {
+	r.result.ExitCode = exitCode
+	r.result.Stderr = stderr
+	return r
+}
+
+// Times 规则只应答 n 次，之后由先注册的规则应答
+// The rule answers only n times, after which earlier rules answer
+func (r *FakeReply) Times(n int) *FakeReply {
+	r.times = n
+	return r
+}
+
+// Once 等同于 Times(1)
+// Same as Times(1)
+func (r *FakeReply) Once() *FakeReply {
+	return r.Times(1)
+}
+
+// Do 应答前调用 fn，用于模拟命令的副作用（例如取消 context）
+// Calls fn before answering, to simulate a command's side effects (e.g. cancelling the context)
+func (r *FakeReply) Do(fn func(c Command)) *FakeReply {
+	r.hook = fn
+	return r
+}
+
+// Serve 让 Start 启动的进程逐行读取标准输入，并把 fn 对每一行的返回值写到标准输出
+// Makes a process launched by Start read its standard input line by line and write fn's answer to each line to standard output
+// 没有 Serve 时进程输出 Stdout 设置的内容后，成功的进程读完标准输入再退出，失败的进程立即退出
+// Without Serve the process writes the output set by Stdout, then exits once its standard input is drained when it
+// succeeds, or at once when it fails
+func (r *FakeReply) Serve(fn func(request string) string) *FakeReply {
+	r.serve = fn
+	return r
+}
+
+// Run 实现 GitRunner
+// Implements GitRunner
+func (f *FakeRunner) Run(ctx context.Context, c Command) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{ExitCode: -1}, fmt.Errorf("not started: %w", err)
+	}
+
+	reply := f.answer(c)
+	if reply == nil {
+		return Result{}, nil
+	}
+	res := reply.result
+	res.Stdout = append([]byte(nil), res.Stdout...)
+	if res.ExitCode != 0 {
+		return res, fmt.Errorf("exit status %d", res.ExitCode)
+	}
+	return res, nil
+}
+
+// Start 实现 GitRunner，返回按规则应答的 Process
+// Implements GitRunner, returning a Process answered by the matching rule
+func (f *FakeRunner) Start(ctx context.Context, c Command) (Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("not started: %w", err)
+	}
+
+	reply := f.answer(c)
+	if reply == nil {
+		reply = &FakeReply{}
+	}
+	p := &fakeProcess{result: reply.result, done: make(chan struct{})}
+	p.stdinR, p.stdin = io.Pipe()
+	p.stdoutR, p.stdout = io.Pipe()
+	go p.serve(reply.serve)
+	return p, nil
+}
+
+// answer 记录调用并返回应答它的规则，没有匹配规则时返回 nil
+// Records the call and returns the rule that answers it, or nil when no rule matches
+func (f *FakeRunner) answer(c Command) *FakeReply {
+	f.mu.Lock()
+	f.calls = append(f.calls, c)
+	var reply *FakeReply
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		r := f.rules[i]
+		if r.times != 0 && hasArgsPrefix(c.Args, r.prefix) {
+			if r.times > 0 {
+				r.times--
+			}
+			reply = r
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if reply != nil && reply.hook != nil {
+		reply.hook(c)
+	}
+	return reply
+}
+
+// fakeProcess FakeRunner.Start 返回的 Process，标准输入输出为内存管道
+// The Process returned by FakeRunner.Start, with in-memory pipes for standard input and output
+type fakeProcess struct {
+	result  Result
+	stdin   *io.PipeWriter
+	stdinR  *io.PipeReader
+	stdout  *io.PipeWriter
+	stdoutR *io.PipeReader
+	done    chan struct{}
+}
+
+// serve 进程主体：输出 Stdout，逐行应答标准输入，退出时关闭标准输出
+// The process body: writes Stdout, answers standard input line by line and closes standard output when it exits
+func (p *fakeProcess) serve(fn func(request string) string) {
+	defer close(p.done)
+	defer p.stdout.Close()
+
+	if len(p.result.Stdout) > 0 {
+		if _, err := p.stdout.Write(p.result.Stdout); err != nil {
+			p.stdinR.CloseWithError(err)
+			return
+		}
+	}
+	// 没有 Serve 的失败进程不读取标准输入，立即退出 / A failing process without Serve exits at once without reading its input
+	if fn == nil && p.result.ExitCode != 0 {
+		p.stdinR.CloseWithError(io.ErrClosedPipe)
+		return
+	}
+	scanner := bufio.NewScanner(p.stdinR)
+	for scanner.Scan() {
+		if fn == nil {
+			continue
+		}
+		if _, err := io.WriteString(p.stdout, fn(scanner.Text())); err != nil {
+			p.stdinR.CloseWithError(err)
+			return
+		}
+	}
+}
+
+// Stdin 实现 Process
+// Implements Process
+func (p *fakeProcess) Stdin() io.WriteCloser { return p.stdin }
+
+// Stdout 实现 Process
+// Implements Process
+func (p *fakeProcess) Stdout() io.Reader { return p.stdoutR }
+
+// Stderr 实现 Process
+// Implements Process
+func (p *fakeProcess) Stderr() string { return p.result.Stderr }
+
+// Wait 实现 Process，等待进程退出并按规则的退出码返回
+// Implements Process; waits for the process to exit and returns per the rule's exit code
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	if p.result.ExitCode != 0 {
+		return fmt.Errorf("exit status %d", p.result.ExitCode)
+	}
+	return nil
+}
+
+// Kill 实现 Process，关闭两个管道并等待进程结束
+// Implements Process; closes both pipes and waits for the process to end
+func (p *fakeProcess) Kill() {
+	p.stdinR.CloseWithError(io.ErrClosedPipe)
+	p.stdoutR.CloseWithError(io.ErrClosedPipe)
+	<-p.done
+}
+
+// Calls 返回所有调用的参数，每条以空格连接
+// Returns the arguments of every call, each joined with spaces
+func (f *FakeRunner) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([]string, len(f.calls))
+	for i, c := range f.calls {
+		calls[i] = strings.Join(c.Args, " ")
+	}
+	return calls
+}
+
+// Commands 返回所有调用的完整命令
+// Returns the full command of every call
+func (f *FakeRunner) Commands() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.calls...)
+}
+
+// Count 以 args 开头的调用次数
+// Number of calls starting with args
+func (f *FakeRunner) Count(args ...string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if hasArgsPrefix(c.Args, args) {
+			n++
+		}
+	}
+	return n
+}
+
+// hasArgsPrefix args 是否以 prefix 开头
+// Whether args starts with prefix
+func hasArgsPrefix(args, prefix []string) bool {
+	if len(prefix) > len(args) {
+		return false
+	}
+	for i, p := range prefix {
+		if args[i] != p {
+			return false
+		}
+	}
+	return true
+}
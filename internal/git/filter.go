@@ -0,0 +1,167 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/crypt"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+)
+
+// ErrEncrypted 路径由加密过滤器处理，不能交给 LFS
+// The path is handled by the encryption filter and must not be handed to LFS
+var ErrEncrypted = errors.New("path is encrypted, not tracking it with LFS")
+
+// ensureEncryptionFilter 注册 clean/smudge 加密过滤器，并把 encrypt_patterns 写入 .gitattributes
+// Registers the clean/smudge encryption filter and writes encrypt_patterns to .gitattributes
+// 新增的模式会重新规范化已追踪的匹配文件，使它们在下一次提交中以密文存储
+// Newly added patterns renormalize the matching tracked files so they are stored encrypted from the next commit on
+func (g *GitOps) ensureEncryptionFilter() error {
+	keyPath, err := g.encryptionKeyPath()
+	if err != nil {
+		return err
+	}
+	if _, err := crypt.LoadKey(keyPath); err != nil {
+		return fmt.Errorf("failed to load encryption key (create one with 'git-autosync filter keygen'): %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate git-autosync binary: %w", err)
+	}
+	for _, mode := range []string{"clean", "smudge"} {
+		command := fmt.Sprintf("%s filter %s -key %s", shellQuote(exe), mode, shellQuote(keyPath))
+		if _, err := g.execGitCommand("config", "filter."+crypt.FilterName+"."+mode, command); err != nil {
+			return err
+		}
+	}
+	// clean 失败时 git add 必须失败，否则明文会被提交
+	// git add must fail when clean fails, otherwise the plaintext would be committed
+	if _, err := g.execGitCommand("config", "filter."+crypt.FilterName+".required", "true"); err != nil {
+		return err
+	}
+
+	content, changed, added := g.encryptionAttributes()
+	if !changed {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(g.cfg.RepoRoot, ".gitattributes"), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write .gitattributes: %w", err)
+	}
+	if len(added) > 0 {
+		g.logger.Info("已为加密模式注册 .gitattributes / Registered encryption patterns in .gitattributes: %s", strings.Join(added, ", "))
+	} else {
+		g.logger.Warn("加密属性已移到 .gitattributes 末尾，之后的行不能再覆盖它们 / Moved the encryption attributes to the end of .gitattributes so later lines cannot override them")
+	}
+	if _, err := g.execGitCommand("add", ".gitattributes"); err != nil {
+		g.logger.Warn("Failed to stage .gitattributes: %v", err)
+	}
+
+	// 已追踪的文件按新属性重新暂存为密文（历史中的明文不受影响）
+	// Tracked files are restaged as ciphertext under the new attributes (plaintext already in history is unaffected)
+	files, err := g.ListFiles("-z", "--", fmt.Sprintf(":(attr:filter=%s)", crypt.FilterName))
+	if err != nil {
+		return err
+	}
+	var tracked []string
+	for _, f := range files {
+		if f != "" {
+			tracked = append(tracked, f)
+		}
+	}
+	if len(tracked) > 0 {
+		g.logger.Warn("重新加密 %d 个已追踪的文件，之前的历史中仍是明文 / Re-encrypting %d tracked files; earlier history still holds plaintext",
+			len(tracked), len(tracked))
+		if _, err := g.execGitCommand(append([]string{"add", "--renormalize", "--"}, tracked...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planEncryptionFilter 演练模式下记录加密过滤器注册将做的修改
+// Records the changes registering the encryption filter would make in dry-run mode
+func (g *GitOps) planEncryptionFilter() {
+	g.plan.Record(plan.ActionGitConfig, "filter."+crypt.FilterName, "clean/smudge")
+	_, changed, added := g.encryptionAttributes()
+	for _, line := range added {
+		g.plan.Record(plan.ActionWriteFile, ".gitattributes", line)
+	}
+	if changed && len(added) == 0 {
+		g.plan.Record(plan.ActionWriteFile, ".gitattributes", "move encryption attributes last")
+	}
+}
+
+// encryptionKeyPath 返回密钥文件的绝对路径，并拒绝位于仓库内的密钥
+// Returns the absolute key file path and rejects keys inside the repository
+func (g *GitOps) encryptionKeyPath() (string, error) {
+	keyPath, err := crypt.ExpandPath(g.cfg.EncryptKeyFile)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(g.cfg.RepoRoot, keyPath); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("encryption key file %s must be outside the repository", keyPath)
+	}
+	return keyPath, nil
+}
+
+// encryptionAttributes 返回加密属性行全部位于末尾的 .gitattributes 内容、内容是否变化以及新增的行
+// Returns the .gitattributes content with every encryption attribute line at the end, whether it changed, and the
+// lines that were added
+// .gitattributes 中后出现的行优先：加密行之后追加的 filter=lfs 行（lfs_track_patterns 或 git lfs track）会覆盖加密过滤器，
+// 使明文进入 LFS，因此加密行总是移到文件末尾
+// Later lines in .gitattributes win: a filter=lfs line appended after the encryption lines (lfs_track_patterns or
+// git lfs track) would override the encryption filter and send the plaintext to LFS, so the encryption lines are
+// always moved to the end
+func (g *GitOps) encryptionAttributes() (content string, changed bool, added []string) {
+	existing, _ := os.ReadFile(filepath.Join(g.cfg.RepoRoot, ".gitattributes"))
+
+	var want []string
+	wanted := map[string]bool{}
+	for _, pattern := range g.cfg.EncryptPatterns {
+		line := fmt.Sprintf("%s filter=%s", pattern, crypt.FilterName)
+		if !wanted[line] {
+			wanted[line] = true
+			want = append(want, line)
+		}
+	}
+
+	var kept []string
+	present := map[string]bool{}
+	if trimmed := strings.TrimRight(string(existing), "\n"); trimmed != "" {
+		for _, line := range strings.Split(trimmed, "\n") {
+			if wanted[strings.TrimSpace(line)] {
+				present[strings.TrimSpace(line)] = true
+				continue
+			}
+			kept = append(kept, line)
+		}
+	}
+	for _, line := range want {
+		if !present[line] {
+			added = append(added, line)
+		}
+	}
+
+	content = strings.Join(append(kept, want...), "\n") + "\n"
+	return content, content != string(existing), added
+}
+
+// Encrypted 路径是否由加密过滤器处理（按当前的 .gitattributes）
+// Whether the path is handled by the encryption filter (according to the current .gitattributes)
+func (g *GitOps) Encrypted(path string) bool {
+	if len(g.cfg.EncryptPatterns) == 0 {
+		return false
+	}
+	out, err := g.execGitCommand("check-attr", "filter", "--", path)
+	return err == nil && strings.HasSuffix(out, ": filter: "+crypt.FilterName)
+}
+
+// shellQuote 为 git 通过 shell 执行的过滤器命令加单引号
+// Single-quotes an argument of a filter command, which git runs through the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
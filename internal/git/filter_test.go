@@ -0,0 +1,88 @@
+// filter_test.go - Encryption filter unit tests / 加密过滤器单元测试
+//
+// Module: git
+// Description: Tests that the encryption attributes are kept at the end of .gitattributes and that encrypted paths
+//              are never tracked with LFS
+// Author: git-autosync contributors
+// Dependencies: errors, os, path/filepath, testing, crypt
+
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/find-xposed-magisk/git-sync/internal/crypt"
+)
+
+// TestEncryptionAttributes tests that missing encryption lines are added and existing ones are moved after any
+// later filter=lfs line
+// 测试缺少的加密行被添加，已有的加密行被移到之后的 filter=lfs 行后面
+func TestEncryptionAttributes(t *testing.T) {
+	const (
+		crypted = "secret/** filter=" + crypt.FilterName
+		lfs     = "secret/** filter=lfs diff=lfs merge=lfs -text"
+	)
+	tests := []struct {
+		name, existing string
+		want           string
+		changed        bool
+		added          int
+	}{
+		{"empty", "", crypted + "\n", true, 1},
+		{"appended", "*.psd filter=lfs diff=lfs merge=lfs -text", "*.psd filter=lfs diff=lfs merge=lfs -text\n" + crypted + "\n", true, 1},
+		{"overridden by lfs", crypted + "\n" + lfs + "\n", lfs + "\n" + crypted + "\n", true, 0},
+		{"already last", lfs + "\n" + crypted + "\n", lfs + "\n" + crypted + "\n", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := newFakeGitOps(t, false)
+			g.cfg.EncryptPatterns = []string{"secret/**"}
+			if tt.existing != "" {
+				writeAttributes(t, g, tt.existing)
+			}
+
+			content, changed, added := g.encryptionAttributes()
+			if content != tt.want {
+				t.Errorf("Expected content %q, got %q", tt.want, content)
+			}
+			if changed != tt.changed || len(added) != tt.added {
+				t.Errorf("Expected changed %v with %d added lines, got %v with %v", tt.changed, tt.added, changed, added)
+			}
+		})
+	}
+}
+
+// TestLFSTrack_Encrypted tests that an encrypted path is refused before git lfs track runs
+// 测试加密的路径在运行 git lfs track 之前被拒绝
+func TestLFSTrack_Encrypted(t *testing.T) {
+	g, fake := newFakeGitOps(t, false)
+	g.cfg.EncryptPatterns = []string{"secret/**"}
+
+	fake.On("check-attr", "filter", "--", "secret/big.bin").Stdout("secret/big.bin: filter: " + crypt.FilterName + "\n")
+	if err := g.LFSTrack("secret/big.bin"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Expected ErrEncrypted, got %v", err)
+	}
+	if fake.Count("lfs", "track") != 0 {
+		t.Errorf("Expected git lfs track not to run, calls: %v", fake.Calls())
+	}
+
+	fake.On("check-attr", "filter", "--", "public/big.bin").Stdout("public/big.bin: filter: unspecified\n")
+	if err := g.LFSTrack("public/big.bin"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if fake.Count("lfs", "track", "public/big.bin") != 1 {
+		t.Errorf("Expected git lfs track to run for the plain file, calls: %v", fake.Calls())
+	}
+}
+
+// writeAttributes 写入仓库的 .gitattributes / Writes the repository's .gitattributes
+func writeAttributes(t *testing.T, g *GitOps, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(g.cfg.RepoRoot, ".gitattributes"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
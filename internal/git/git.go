@@ -1,16 +1,19 @@
 package git
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/find-xposed-magisk/git-sync/internal/config"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 )
 
 // GitOps Git操作封装
@@ -18,34 +21,121 @@ import (
 type GitOps struct {
 	cfg    *config.Config
 	logger *logger.Logger
+	plan   *plan.Plan // 非 nil 时为演练模式 / Dry-run mode when non-nil
+	ctx    context.Context
+	runner GitRunner
 }
 
 // NewGitOps 创建Git操作实例
 // Creates a new GitOps instance
 func NewGitOps(cfg *config.Config, log *logger.Logger) *GitOps {
+	return NewGitOpsWithRunner(cfg, log, ExecRunner{})
+}
+
+// NewGitOpsWithRunner 创建通过指定 GitRunner 执行命令的Git操作实例
+// Creates a new GitOps instance that runs its commands through the given GitRunner
+func NewGitOpsWithRunner(cfg *config.Config, log *logger.Logger, runner GitRunner) *GitOps {
 	return &GitOps{
 		cfg:    cfg,
 		logger: log,
+		ctx:    context.Background(),
+		runner: runner,
+	}
+}
+
+// Runner 返回执行命令的 GitRunner
+// Returns the GitRunner commands are executed with
+func (g *GitOps) Runner() GitRunner {
+	return g.runner
+}
+
+// WithContext 返回使用指定 context 的副本
+// Returns a copy that runs commands under the given context
+// 关闭时的清理操作（merge --abort 等）应使用未取消的 context
+// Cleanup during shutdown (merge --abort etc.) should use a context that is not cancelled
+func (g *GitOps) WithContext(ctx context.Context) *GitOps {
+	c := *g
+	c.ctx = ctx
+	return &c
+}
+
+// Context 返回命令使用的 context
+// Returns the context commands run under
+func (g *GitOps) Context() context.Context {
+	return g.ctx
+}
+
+// SetPlan 启用演练模式，写操作只记录到计划中
+// Enables dry-run mode; mutating operations are only recorded in the plan
+func (g *GitOps) SetPlan(p *plan.Plan) {
+	g.plan = p
+}
+
+// Plan 返回演练计划，未启用演练模式时为 nil
+// Returns the dry-run plan, nil when dry-run is disabled
+func (g *GitOps) Plan() *plan.Plan {
+	return g.plan
+}
+
+// DryRun 是否处于演练模式
+// Whether dry-run mode is enabled
+func (g *GitOps) DryRun() bool {
+	return g.plan != nil
+}
+
+// record 演练模式下记录动作并返回 true，否则返回 false
+// Records an action and returns true in dry-run mode, false otherwise
+func (g *GitOps) record(kind, target, detail string) bool {
+	if g.plan == nil {
+		return false
 	}
+	g.plan.Record(kind, target, detail)
+	return true
+}
+
+// run 在仓库根目录通过 GitRunner 执行命令
+// Runs a command through the GitRunner in the repository root
+func (g *GitOps) run(c Command) (Result, error) {
+	if c.Dir == "" {
+		c.Dir = g.cfg.RepoRoot
+	}
+	return g.runner.Run(g.ctx, c)
+}
+
+// start 在仓库根目录通过 GitRunner 启动长期运行的 git 进程
+// Starts a long-lived git process through the GitRunner in the repository root
+func (g *GitOps) start(args ...string) (Process, error) {
+	return g.runner.Start(g.ctx, Command{Args: args, Dir: g.cfg.RepoRoot})
 }
 
 // execGitCommand 执行Git命令
 // Executes a git command
 func (g *GitOps) execGitCommand(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = g.cfg.RepoRoot
-	
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	res, err := g.run(Command{Args: args})
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w, stderr: %s", 
+			strings.Join(args, " "), err, res.Stderr)
+	}
 	
-	err := cmd.Run()
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// execGitCommandWithInput 执行Git命令并通过标准输入传递数据
+// Executes a git command feeding data through stdin
+// 返回 stdout 原文（不裁剪，-z 输出需要保留分隔符）和退出码
+// Returns raw stdout (untrimmed, -z output keeps its separators) and the exit code
+func (g *GitOps) execGitCommandWithInput(input string, args ...string) (string, int, error) {
+	res, err := g.run(Command{Args: args, Stdin: input})
 	if err != nil {
-		return "", fmt.Errorf("git %s failed: %v, stderr: %s", 
-			strings.Join(args, " "), err, stderr.String())
+		if res.ExitCode > 0 {
+			return string(res.Stdout), res.ExitCode, fmt.Errorf("git %s failed: %v, stderr: %s",
+				strings.Join(args, " "), err, res.Stderr)
+		}
+		return "", -1, fmt.Errorf("git %s failed: %w, stderr: %s",
+			strings.Join(args, " "), err, res.Stderr)
 	}
 	
-	return strings.TrimSpace(stdout.String()), nil
+	return string(res.Stdout), 0, nil
 }
 
 // EnsureDependencies 确保依赖已安装
@@ -70,6 +160,10 @@ func (g *GitOps) EnsureDependencies() error {
 	
 	g.logger.Info("所有依赖已满足 / All dependencies are satisfied")
 	
+	if g.DryRun() {
+		return g.planDependencies()
+	}
+	
 	// 初始化Git LFS
 	// Initialize Git LFS
 	if _, err := g.execGitCommand("lfs", "install"); err != nil {
@@ -101,7 +195,9 @@ func (g *GitOps) EnsureDependencies() error {
 	
 	// 检查文件是否已被追踪
 	// Check if file is already tracked
-	if _, err := g.execGitCommand("ls-files", "--error-unmatch", ignoreFilePath); err != nil {
+	// 已列在 .gitignore 中时跳过，否则每次启动（以及每次 once）都会追加一行并产生提交
+	// Skipped when already listed in .gitignore, otherwise every start (and every once run) appends a line and commits it
+	if _, err := g.execGitCommand("ls-files", "--error-unmatch", ignoreFilePath); err != nil && !g.ignoreFileListed() {
 		// 文件未被追踪，添加到.gitignore并暂存
 		// File not tracked, add to .gitignore and stage
 		gitignorePath := filepath.Join(g.cfg.RepoRoot, ".gitignore")
@@ -120,6 +216,14 @@ func (g *GitOps) EnsureDependencies() error {
 		}
 	}
 	
+	// 注册透明加密过滤器
+	// Register the transparent encryption filter
+	if len(g.cfg.EncryptPatterns) > 0 {
+		if err := g.ensureEncryptionFilter(); err != nil {
+			return err
+		}
+	}
+	
 	// 设置diff3冲突样式 (显示共同祖先)
 	// Set diff3 conflict style (shows common ancestor)
 	if _, err := g.execGitCommand("config", "merge.conflictstyle", "diff3"); err != nil {
@@ -132,22 +236,66 @@ func (g *GitOps) EnsureDependencies() error {
 	return nil
 }
 
+// planDependencies 演练模式下记录依赖初始化将做的修改
+// Records the changes dependency initialization would make in dry-run mode
+func (g *GitOps) planDependencies() error {
+	for _, pattern := range g.cfg.LFSTrackPatterns {
+		g.plan.Record(plan.ActionLFSTrack, pattern, "predefined")
+	}
+	if len(g.cfg.EncryptPatterns) > 0 {
+		g.planEncryptionFilter()
+	}
+	
+	if !g.ignoreFileListed() {
+		g.plan.Record(plan.ActionIgnoreAppend, g.cfg.IgnoreFileName, ".gitignore")
+	}
+	return nil
+}
+
+// ignoreFileListed .gitignore 中是否已有忽略文件名这一行
+// Whether .gitignore already has a line with the ignore file name
+func (g *GitOps) ignoreFileListed() bool {
+	existing, _ := os.ReadFile(filepath.Join(g.cfg.RepoRoot, ".gitignore"))
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == g.cfg.IgnoreFileName {
+			return true
+		}
+	}
+	return false
+}
+
 // HashObject 计算文件的Git对象哈希
 // Computes the git object hash for a file
+// 演练模式下只计算哈希，不写入对象库 / In dry-run mode the hash is computed without writing the object
 func (g *GitOps) HashObject(filePath string) (string, error) {
+	if g.DryRun() {
+		return g.execGitCommand("hash-object", filePath)
+	}
 	return g.execGitCommand("hash-object", "-w", filePath)
 }
 
 // UpdateIndex 更新Git索引
 // Updates the git index
 func (g *GitOps) UpdateIndex(mode, hash, path string) error {
+	if g.record(plan.ActionIndexUpdate, path, mode+" "+hash) {
+		return nil
+	}
 	_, err := g.execGitCommand("update-index", "--add", "--cacheinfo", mode, hash, path)
 	return err
 }
 
 // LFSTrack 追踪LFS文件
 // Tracks a file with LFS
+// 加密的路径返回 ErrEncrypted：追加的 filter=lfs 行会覆盖加密过滤器，明文会进入 LFS
+// Encrypted paths return ErrEncrypted: the appended filter=lfs line would override the encryption filter and send the
+// plaintext to LFS
 func (g *GitOps) LFSTrack(filePath string) error {
+	if g.Encrypted(filePath) {
+		return ErrEncrypted
+	}
+	if g.record(plan.ActionLFSTrack, filePath, "") {
+		return nil
+	}
 	_, err := g.execGitCommand("lfs", "track", filePath)
 	return err
 }
@@ -155,6 +303,9 @@ func (g *GitOps) LFSTrack(filePath string) error {
 // Add 添加文件到暂存区
 // Adds a file to the staging area
 func (g *GitOps) Add(filePath string) error {
+	if g.record(plan.ActionStage, filePath, "") {
+		return nil
+	}
 	_, err := g.execGitCommand("add", "--", filePath)
 	return err
 }
@@ -162,6 +313,9 @@ func (g *GitOps) Add(filePath string) error {
 // AddAll 添加所有变更到暂存区
 // Adds all changes to the staging area
 func (g *GitOps) AddAll() error {
+	if g.record(plan.ActionStage, "-A", "all changes") {
+		return nil
+	}
 	_, err := g.execGitCommand("add", "-A")
 	return err
 }
@@ -169,13 +323,29 @@ func (g *GitOps) AddAll() error {
 // Remove 从索引中删除文件
 // Removes a file from the index
 func (g *GitOps) Remove(filePath string) error {
+	if g.record(plan.ActionUntrack, filePath, "") {
+		return nil
+	}
 	_, err := g.execGitCommand("rm", "--cached", "--ignore-unmatch", "--", filePath)
 	return err
 }
 
+// Unstage 把文件的索引条目恢复为 HEAD 中的版本（新文件则从索引中移除）
+// Restores a file's index entry to its HEAD version (new files are removed from the index)
+func (g *GitOps) Unstage(filePath string) error {
+	if g.record(plan.ActionUntrack, filePath, "unstage") {
+		return nil
+	}
+	_, err := g.execGitCommand("reset", "-q", "--", filePath)
+	return err
+}
+
 // Commit 提交变更
 // Commits changes
 func (g *GitOps) Commit(message string) error {
+	if g.record(plan.ActionCommit, "", message) {
+		return nil
+	}
 	_, err := g.execGitCommand("commit", "-m", message)
 	return err
 }
@@ -195,14 +365,103 @@ func (g *GitOps) HasStagedChanges() (bool, error) {
 	return output != "", nil
 }
 
+// StagedChange 索引相对 HEAD 的一个文件变更
+// One file change of the index relative to HEAD
+type StagedChange struct {
+	Status  byte   // A/M/D/R/C/T，取自 --name-status / Taken from --name-status
+	Path    string // 变更后的路径 / Path after the change
+	OldPath string // 重命名/复制前的路径 / Path before a rename or copy
+	Added   int    // 新增行数 / Lines added
+	Deleted int    // 删除行数 / Lines deleted
+	Binary  bool   // 二进制文件没有行数 / Binary files have no line counts
+}
+
+// StagedChanges 列出已暂存的变更（检测重命名），用于生成提交信息
+// Lists the staged changes (with rename detection), used to build the commit message
+func (g *GitOps) StagedChanges() ([]StagedChange, error) {
+	output, _, err := g.execGitCommandWithInput("", "diff", "--cached", "-z", "-M", "--name-status")
+	if err != nil {
+		return nil, err
+	}
+	
+	changes := []StagedChange{}
+	index := map[string]int{}
+	fields := strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" || i+1 >= len(fields) {
+			continue
+		}
+		c := StagedChange{Status: status[0], Path: fields[i+1]}
+		i++
+		if (c.Status == 'R' || c.Status == 'C') && i+1 < len(fields) {
+			c.OldPath, c.Path = c.Path, fields[i+1]
+			i++
+		}
+		index[c.Path] = len(changes)
+		changes = append(changes, c)
+	}
+	
+	// --numstat -z 中重命名的路径为空，随后是旧路径和新路径
+	// With --numstat -z a rename has an empty path followed by the old and the new path
+	output, _, err = g.execGitCommandWithInput("", "diff", "--cached", "-z", "-M", "--numstat")
+	if err != nil {
+		return nil, err
+	}
+	fields = strings.Split(output, "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(strings.TrimLeft(fields[i], "\n"), "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		path := parts[2]
+		if path == "" && i+2 < len(fields) {
+			path = fields[i+2]
+			i += 2
+		}
+		n, ok := index[path]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			changes[n].Binary = true
+			continue
+		}
+		changes[n].Added, _ = strconv.Atoi(parts[0])
+		changes[n].Deleted, _ = strconv.Atoi(parts[1])
+	}
+	return changes, nil
+}
+
+// DryRunRefPrefix 演练模式获取远程分支的私有命名空间
+// Private namespace the remote branch is fetched into in dry-run mode
+const DryRunRefPrefix = "refs/autosync-dryrun/"
+
 // Fetch 从远程获取更新
 // Fetches updates from remote
+// 演练模式只把同步分支获取到 DryRunRefPrefix 下，远程追踪分支和 FETCH_HEAD 保持不变
+// In dry-run mode only the sync branch is fetched, into DryRunRefPrefix; remote-tracking refs and FETCH_HEAD are left alone
 func (g *GitOps) Fetch() error {
 	g.logger.Debug("正在从远程获取更新 / Fetching updates from remote")
+	if g.DryRun() {
+		// 空的 --refmap 阻止 git 顺带更新远程追踪分支 / An empty --refmap stops git from updating the remote-tracking ref as well
+		_, err := g.execGitCommand("fetch", "--no-write-fetch-head", "--refmap=", g.cfg.RemoteName,
+			"+refs/heads/"+g.cfg.BranchName+":"+DryRunRefPrefix+g.cfg.BranchName)
+		return err
+	}
 	_, err := g.execGitCommand("fetch", g.cfg.RemoteName)
 	return err
 }
 
+// RemoteBranchRef 与本地分支比较的远程分支：通常为 <remote>/<branch>，演练模式下为 Fetch 获取的私有副本
+// The remote branch compared with the local one: normally <remote>/<branch>, in dry-run mode the private copy made by Fetch
+func (g *GitOps) RemoteBranchRef() string {
+	if g.DryRun() {
+		return DryRunRefPrefix + g.cfg.BranchName
+	}
+	return g.cfg.RemoteName + "/" + g.cfg.BranchName
+}
+
 // parseCorruptRefError 解析损坏引用错误，返回损坏的引用路径列表
 // Parses corrupt reference error, returns list of corrupt ref paths
 func parseCorruptRefError(errMsg string) []string {
@@ -220,6 +479,9 @@ func parseCorruptRefError(errMsg string) []string {
 // Pushes to remote (with auto-fix for corrupt references)
 func (g *GitOps) Push() error {
 	g.logger.Debug("正在推送到远程 / Pushing to remote")
+	if g.record(plan.ActionPush, g.cfg.RemoteName+"/"+g.cfg.BranchName, "") {
+		return nil
+	}
 	_, err := g.execGitCommand("push", g.cfg.RemoteName, g.cfg.BranchName)
 	if err == nil || !g.cfg.AutoFixCorruptRefs {
 		return err
@@ -248,18 +510,96 @@ func (g *GitOps) Push() error {
 	return err
 }
 
+// RemoteBackupPrefix 强制推送前远程旧提交的备份引用前缀，完整名称为 refs/autosync-backup/<timestamp>
+// Prefix of the remote backup refs taken before a force push; the full name is refs/autosync-backup/<timestamp>
+const RemoteBackupPrefix = "refs/autosync-backup/"
+
 // ForcePush 强制推送到远程
 // Force pushes to remote
+// 使用 --force-with-lease 限定为上次 fetch 看到的远程提交，远程之后又有新提交时推送失败而不是覆盖它们；
+// 覆盖前先把远程原来的提交推送到 refs/autosync-backup/<timestamp>，备份失败时不强制推送
+// Uses --force-with-lease pinned to the remote commit seen by the last fetch, so newer remote commits make the push fail
+// instead of being overwritten; the old remote tip is first pushed to refs/autosync-backup/<timestamp>, and no force
+// push happens if that backup fails
 func (g *GitOps) ForcePush() error {
+	if g.record(plan.ActionPush, g.cfg.RemoteName+" "+RemoteBackupPrefix+"<timestamp>", "old remote tip") {
+		g.record(plan.ActionForcePush, g.cfg.RemoteName+"/"+g.cfg.BranchName, "--force-with-lease")
+		return nil
+	}
+	
+	// 远程追踪分支不存在时租约要求远程分支也不存在 / Without a remote-tracking branch the lease requires the remote branch to be absent
+	expected, _ := g.execGitCommand("rev-parse", "--verify", "--quiet",
+		fmt.Sprintf("refs/remotes/%s/%s^{commit}", g.cfg.RemoteName, g.cfg.BranchName))
+	
+	if expected != "" {
+		backupRef := RemoteBackupPrefix + time.Now().Format("20060102-150405")
+		g.logger.Info("备份远程提交 %s 到 %s / Backing up remote commit %s to %s", expected[:7], backupRef, expected[:7], backupRef)
+		if _, err := g.execGitCommand("push", g.cfg.RemoteName, expected+":"+backupRef); err != nil {
+			return fmt.Errorf("remote backup failed, not force pushing: %w", err)
+		}
+	}
+	
 	g.logger.Warn("⚠️ 正在强制推送到远程 / Force pushing to remote")
-	_, err := g.execGitCommand("push", "--force", g.cfg.RemoteName, g.cfg.BranchName)
+	lease := fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", g.cfg.BranchName, expected)
+	_, err := g.execGitCommand("push", lease, g.cfg.RemoteName, g.cfg.BranchName)
+	return err
+}
+
+// ListRemoteRefs 列出远程中以 prefix 开头的引用，返回引用名到提交哈希的映射
+// Lists the refs on the remote starting with prefix, returning a map from ref name to commit hash
+func (g *GitOps) ListRemoteRefs(prefix string) (map[string]string, error) {
+	output, err := g.execGitCommand("ls-remote", g.cfg.RemoteName, prefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	
+	refs := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.HasPrefix(fields[1], prefix) {
+			refs[fields[1]] = fields[0]
+		}
+	}
+	return refs, nil
+}
+
+// DeleteRemoteRef 删除远程引用
+// Deletes a ref on the remote
+func (g *GitOps) DeleteRemoteRef(ref string) error {
+	if g.record(plan.ActionPush, g.cfg.RemoteName+" "+ref, "delete") {
+		return nil
+	}
+	_, err := g.execGitCommand("push", g.cfg.RemoteName, ":"+ref)
 	return err
 }
 
+// PushRef 把本地提交推送到远程的指定引用（不影响同步分支）
+// Pushes a local commit to the given ref on the remote (the sync branch is not touched)
+func (g *GitOps) PushRef(src, dst string) error {
+	if g.record(plan.ActionPush, g.cfg.RemoteName+" "+dst, src) {
+		return nil
+	}
+	_, err := g.execGitCommand("push", g.cfg.RemoteName, src+":"+dst)
+	return err
+}
+
+// CommitTree 用 ref 的树创建一个以 ref 为父提交的新提交，不移动任何分支，返回新提交的哈希
+// Creates a new commit with ref's tree and ref as its parent without moving any branch, returning the new commit's hash
+func (g *GitOps) CommitTree(ref, message string) (string, error) {
+	output, _, err := g.execGitCommandWithInput(message, "commit-tree", ref+"^{tree}", "-p", ref, "-F", "-")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
 // Pull 从远程拉取
 // Pulls from remote
 func (g *GitOps) Pull() error {
 	g.logger.Debug("正在从远程拉取 / Pulling from remote")
+	if g.record(plan.ActionFastForward, g.cfg.RemoteName+"/"+g.cfg.BranchName, "pull --rebase") {
+		return nil
+	}
 	_, err := g.execGitCommand("pull", "--rebase", g.cfg.RemoteName, g.cfg.BranchName)
 	return err
 }
@@ -299,6 +639,9 @@ func (g *GitOps) HasUnstagedChanges() (bool, error) {
 // Merge 合并分支
 // Merges a branch
 func (g *GitOps) Merge(branch, message string) error {
+	if g.record(plan.ActionMerge, branch, message) {
+		return nil
+	}
 	_, err := g.execGitCommand("merge", branch, "--no-edit", "-m", message)
 	return err
 }
@@ -306,6 +649,9 @@ func (g *GitOps) Merge(branch, message string) error {
 // MergeWithLog 合并分支并显示提交日志
 // Merges a branch with commit log
 func (g *GitOps) MergeWithLog(branch, message string, logLines int) error {
+	if g.record(plan.ActionMerge, branch, message) {
+		return nil
+	}
 	args := []string{"merge", branch, "--no-edit", "-m", message}
 	if logLines > 0 {
 		args = append(args, fmt.Sprintf("--log=%d", logLines))
@@ -317,13 +663,80 @@ func (g *GitOps) MergeWithLog(branch, message string, logLines int) error {
 // MergeAbort 中止合并
 // Aborts merge
 func (g *GitOps) MergeAbort() error {
+	if g.record(plan.ActionReset, "", "merge --abort") {
+		return nil
+	}
 	_, err := g.execGitCommand("merge", "--abort")
 	return err
 }
 
+// RebaseAbort 中止变基
+// Aborts rebase
+func (g *GitOps) RebaseAbort() error {
+	if g.record(plan.ActionReset, "", "rebase --abort") {
+		return nil
+	}
+	_, err := g.execGitCommand("rebase", "--abort")
+	return err
+}
+
+// Rebase 把当前分支变基到 upstream 之上
+// Rebases the current branch onto upstream
+// 子仓库的 gitdir 文件常留有未暂存的变更，--autostash 在变基前后自动保存和恢复它们
+// Subrepo gitdir files often carry unstaged changes; --autostash saves and restores them around the rebase
+func (g *GitOps) Rebase(upstream string) error {
+	if g.record(plan.ActionRebase, upstream, "rebase") {
+		return nil
+	}
+	_, err := g.execGitCommand("rebase", "--autostash", upstream)
+	return err
+}
+
+// RebaseContinue 冲突解决后继续变基，沿用原提交信息
+// Continues a rebase after conflicts were resolved, keeping the original commit message
+func (g *GitOps) RebaseContinue() error {
+	if g.record(plan.ActionRebase, "", "rebase --continue") {
+		return nil
+	}
+	// core.editor=true 让 git 直接接受原提交信息 / core.editor=true makes git accept the original message as is
+	_, err := g.execGitCommand("-c", "core.editor=true", "rebase", "--continue")
+	return err
+}
+
+// RebaseSkip 跳过当前提交（解决冲突后已无变更时）
+// Skips the current commit (when nothing is left to commit after resolving conflicts)
+func (g *GitOps) RebaseSkip() error {
+	if g.record(plan.ActionRebase, "", "rebase --skip") {
+		return nil
+	}
+	_, err := g.execGitCommand("rebase", "--skip")
+	return err
+}
+
+// RebaseInProgress 是否有进行中的变基
+// Whether a rebase is in progress
+func (g *GitOps) RebaseInProgress() bool {
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		p, err := g.execGitCommand("rev-parse", "--git-path", dir)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(g.cfg.RepoRoot, p)
+		}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateBranch 创建分支
 // Creates a branch
 func (g *GitOps) CreateBranch(branchName string) error {
+	if g.record(plan.ActionBranch, branchName, "create") {
+		return nil
+	}
 	_, err := g.execGitCommand("branch", branchName)
 	return err
 }
@@ -331,6 +744,9 @@ func (g *GitOps) CreateBranch(branchName string) error {
 // DeleteBranch 删除分支
 // Deletes a branch
 func (g *GitOps) DeleteBranch(branchName string) error {
+	if g.record(plan.ActionBranch, branchName, "delete") {
+		return nil
+	}
 	_, err := g.execGitCommand("branch", "-D", branchName)
 	return err
 }
@@ -343,6 +759,9 @@ func (g *GitOps) Reset(ref string, hard bool) error {
 		args = append(args, "--hard")
 	}
 	args = append(args, ref)
+	if g.record(plan.ActionReset, ref, strings.Join(args, " ")) {
+		return nil
+	}
 	_, err := g.execGitCommand(args...)
 	return err
 }
@@ -362,9 +781,37 @@ func (g *GitOps) GetConflictedFiles() ([]string, error) {
 	return strings.Split(output, "\n"), nil
 }
 
+// PredictMergeConflicts 在不修改工作区和索引的情况下预测合并冲突文件
+// Predicts conflicting files of a merge without touching the working tree or index
+// 需要 git 2.38+ 的 merge-tree --write-tree / Requires git 2.38+ merge-tree --write-tree
+func (g *GitOps) PredictMergeConflicts(branch string) ([]string, error) {
+	output, code, err := g.execGitCommandWithInput("", "merge-tree", "--write-tree", "--name-only", "-z", "HEAD", branch)
+	if err != nil && code != 1 {
+		return nil, err
+	}
+	
+	// 输出：树对象ID，随后是冲突文件列表，空段后为提示信息
+	// Output: tree OID, then conflicted file names, then an empty field before messages
+	conflicts := []string{}
+	if code != 1 {
+		return conflicts, nil
+	}
+	fields := strings.Split(output, "\x00")
+	for _, f := range fields[1:] {
+		if f == "" {
+			break
+		}
+		conflicts = append(conflicts, f)
+	}
+	return conflicts, nil
+}
+
 // CheckoutTheirs 使用远程版本解决冲突
 // Resolves conflict using remote version
 func (g *GitOps) CheckoutTheirs(filePath string) error {
+	if g.record(plan.ActionResolve, filePath, "theirs") {
+		return nil
+	}
 	_, err := g.execGitCommand("checkout", "--theirs", filePath)
 	return err
 }
@@ -372,10 +819,91 @@ func (g *GitOps) CheckoutTheirs(filePath string) error {
 // CheckoutOurs 使用本地版本解决冲突
 // Resolves conflict using local version
 func (g *GitOps) CheckoutOurs(filePath string) error {
+	if g.record(plan.ActionResolve, filePath, "ours") {
+		return nil
+	}
 	_, err := g.execGitCommand("checkout", "--ours", filePath)
 	return err
 }
 
+// 冲突文件的索引阶段 / Index stages of a conflicted file
+const (
+	StageBase   = 1 // 共同祖先 / Common ancestor
+	StageOurs   = 2 // 本地版本 / Local version
+	StageTheirs = 3 // 合入的版本 / Version being merged in
+)
+
+// ConflictStages 返回冲突文件存在的索引阶段（阶段 → blob hash）
+// Returns the index stages present for a conflicted file (stage → blob hash)
+// 缺少某个阶段表示该侧删除了文件（或祖先中不存在）
+// A missing stage means that side deleted the file (or it did not exist in the ancestor)
+func (g *GitOps) ConflictStages(filePath string) (map[int]string, error) {
+	output, _, err := g.execGitCommandWithInput("", "ls-files", "-u", "-z", "--", filePath)
+	if err != nil {
+		return nil, err
+	}
+	
+	stages := make(map[int]string, 3)
+	for _, entry := range strings.Split(output, "\x00") {
+		// 格式: mode hash stage\tpath / Format: mode hash stage\tpath
+		meta, _, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		stage, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		stages[stage] = fields[1]
+	}
+	return stages, nil
+}
+
+// ReadBlob 读取 blob 内容，并按 path 应用 smudge 过滤器（与检出到工作区的内容一致）
+// Reads a blob's content, applying smudge filters for path (the same content a checkout would write)
+func (g *GitOps) ReadBlob(hash, path string) ([]byte, error) {
+	output, _, err := g.execGitCommandWithInput("", "cat-file", "--filters", "--path="+path, hash)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// MergeFileUnion 用 git merge-file --union 合并三个版本，冲突部分保留双方的行
+// Merges three versions with git merge-file --union, keeping the lines of both sides where they conflict
+func (g *GitOps) MergeFileUnion(base, ours, theirs []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "git-autosync-union-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	
+	names := []string{"ours", "base", "theirs"}
+	for i, content := range [][]byte{ours, base, theirs} {
+		if err := os.WriteFile(filepath.Join(dir, names[i]), content, 0600); err != nil {
+			return nil, err
+		}
+	}
+	
+	res, err := g.run(Command{Args: []string{"merge-file", "-p", "--union",
+		filepath.Join(dir, "ours"), filepath.Join(dir, "base"), filepath.Join(dir, "theirs")}})
+	if err != nil {
+		return nil, fmt.Errorf("git merge-file --union failed: %w, stderr: %s", err, res.Stderr)
+	}
+	return res.Stdout, nil
+}
+
+// RemoveConflicted 从索引和工作区删除冲突文件（接受删除的一方）
+// Removes a conflicted file from the index and working tree (accepting the deleting side)
+func (g *GitOps) RemoveConflicted(filePath string) error {
+	if g.record(plan.ActionResolve, filePath, "delete") {
+		return nil
+	}
+	_, err := g.execGitCommand("rm", "--quiet", "--", filePath)
+	return err
+}
+
 // ListFiles 列出文件
 // Lists files
 func (g *GitOps) ListFiles(args ...string) ([]string, error) {
@@ -404,6 +932,228 @@ func (g *GitOps) ListFiles(args ...string) ([]string, error) {
 	return strings.Split(output, "\n"), nil
 }
 
+// TreeEntry git ls-tree 的一条记录
+// A single git ls-tree entry
+type TreeEntry struct {
+	Mode string // 例如 100644 / e.g. 100644
+	Type string // blob / tree / commit
+	Hash string
+	Path string
+}
+
+// ListTree 列出 ref 中指定路径下的树条目
+// Lists the tree entries of ref under the given paths
+func (g *GitOps) ListTree(ref string, recursive bool, paths ...string) ([]TreeEntry, error) {
+	args := []string{"ls-tree", "-z"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, ref, "--")
+	args = append(args, paths...)
+	
+	output, err := g.execGitCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	
+	entries := []TreeEntry{}
+	for _, record := range strings.Split(output, "\x00") {
+		// 格式: <mode> SP <type> SP <hash> TAB <path>
+		// Format: <mode> SP <type> SP <hash> TAB <path>
+		meta, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, TreeEntry{Mode: fields[0], Type: fields[1], Hash: fields[2], Path: path})
+	}
+	return entries, nil
+}
+
+// LastCommitTime 返回 ref 历史中最后一次修改 path 的提交的作者时间
+// Returns the author time of the last commit in ref's history that touched path
+// 使用作者时间而非提交者时间：变基会重写提交者时间，但保留作者时间
+// Author time rather than committer time is used: a rebase rewrites the committer time but keeps the author time
+func (g *GitOps) LastCommitTime(ref, path string) (time.Time, error) {
+	output, err := g.execGitCommand("log", "-1", "--format=%at", ref, "--", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if output == "" {
+		return time.Time{}, fmt.Errorf("no commit in %s touches %s", ref, path)
+	}
+	
+	sec, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected commit time %q: %w", output, err)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// CountCommits 统计 from..to 范围内的提交数
+// Counts the commits in the range from..to
+func (g *GitOps) CountCommits(from, to string) (int, error) {
+	output, err := g.execGitCommand("rev-list", "--count", from+".."+to)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output)
+}
+
+// DescribeCommit 返回提交的短哈希和标题，用于日志
+// Returns a commit's short hash and subject, for logging
+func (g *GitOps) DescribeCommit(ref string) string {
+	output, err := g.execGitCommand("log", "-1", "--format=%h %s", ref)
+	if err != nil {
+		return ref
+	}
+	return output
+}
+
+// CommitInfo 提交的元数据
+// Metadata of a commit
+type CommitInfo struct {
+	Hash        string
+	Tree        string
+	Parents     []string
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  string    // git 原始格式 "<unix> <时区>"，用于原样重建 / Raw git format "<unix> <tz>", for recreating it as is
+	AuthorTime  time.Time
+	CommitTime  time.Time
+	Message     string // 完整提交信息 / Full commit message
+}
+
+// FirstParentLog 沿第一父提交从新到旧列出 ref 的历史，最多 limit 个
+// Lists ref's history along first parents from newest to oldest, at most limit commits
+func (g *GitOps) FirstParentLog(ref string, limit int) ([]CommitInfo, error) {
+	output, err := g.execGitCommand("log", "-z", "--first-parent", "--date=raw", fmt.Sprintf("-n%d", limit),
+		"--format=%H%x1f%T%x1f%P%x1f%an%x1f%ae%x1f%ad%x1f%ct%x1f%B", ref)
+	if err != nil {
+		return nil, err
+	}
+	
+	commits := []CommitInfo{}
+	for _, record := range strings.Split(output, "\x00") {
+		fields := strings.SplitN(strings.TrimLeft(record, "\n"), "\x1f", 8)
+		if len(fields) != 8 {
+			continue
+		}
+		c := CommitInfo{
+			Hash:        fields[0],
+			Tree:        fields[1],
+			Parents:     strings.Fields(fields[2]),
+			AuthorName:  fields[3],
+			AuthorEmail: fields[4],
+			AuthorDate:  fields[5],
+			Message:     strings.TrimSpace(fields[7]),
+		}
+		unix, _, _ := strings.Cut(fields[5], " ")
+		if sec, err := strconv.ParseInt(unix, 10, 64); err == nil {
+			c.AuthorTime = time.Unix(sec, 0)
+		}
+		if sec, err := strconv.ParseInt(fields[6], 10, 64); err == nil {
+			c.CommitTime = time.Unix(sec, 0)
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// CreateCommit 用给定的树、父提交和作者创建提交，不移动任何分支，返回新提交的哈希
+// Creates a commit from the given tree, parent and author without moving any branch, returning the new commit's hash
+func (g *GitOps) CreateCommit(tree, parent string, author CommitInfo, message string) (string, error) {
+	args := []string{"commit-tree", tree}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	args = append(args, "-F", "-")
+	
+	res, err := g.run(Command{
+		Args:  args,
+		Stdin: message,
+		Env: []string{
+			"GIT_AUTHOR_NAME=" + author.AuthorName,
+			"GIT_AUTHOR_EMAIL=" + author.AuthorEmail,
+			"GIT_AUTHOR_DATE=" + author.AuthorDate,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("git commit-tree failed: %w, stderr: %s", err, res.Stderr)
+	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// UpdateRef 仅当 ref 仍指向 oldHash 时把它移动到 newHash，不修改索引和工作区
+// Moves ref to newHash only while it still points at oldHash, leaving the index and working tree alone
+func (g *GitOps) UpdateRef(ref, newHash, oldHash, reason string) error {
+	if g.record(plan.ActionReset, ref, "update-ref "+reason) {
+		return nil
+	}
+	_, err := g.execGitCommand("update-ref", "-m", reason, ref, newHash, oldHash)
+	return err
+}
+
+// FsckGitDir 对指定的 git 目录运行 git fsck
+// Runs git fsck against the given git directory
+// 用于在替换前校验恢复出来的 .git / Used to validate a restored .git before swapping it in
+func (g *GitOps) FsckGitDir(gitDir string) error {
+	res, err := g.run(Command{Args: []string{"--git-dir", gitDir, "fsck", "--no-progress", "--no-dangling"}, Dir: gitDir})
+	if err != nil {
+		output := strings.TrimSpace(string(res.Stdout) + res.Stderr)
+		return fmt.Errorf("git fsck failed: %w, output: %s", err, output)
+	}
+	return nil
+}
+
+// CheckIgnored 返回给定路径中被 .gitignore 规则忽略的路径
+// Returns the subset of paths that are ignored by .gitignore rules
+// 已追踪的文件不会被报告为忽略 / Tracked files are never reported as ignored
+func (g *GitOps) CheckIgnored(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return []string{}, nil
+	}
+	
+	input := strings.Join(paths, "\x00") + "\x00"
+	output, code, err := g.execGitCommandWithInput(input, "check-ignore", "-z", "--stdin")
+	if err != nil {
+		// 退出码1表示没有路径被忽略
+		// Exit code 1 means no path is ignored
+		if code == 1 {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	
+	ignored := []string{}
+	for _, p := range strings.Split(output, "\x00") {
+		if p != "" {
+			ignored = append(ignored, p)
+		}
+	}
+	return ignored, nil
+}
+
+// ListIgnoredDirectories 列出被 .gitignore 完全忽略的未追踪目录
+// Lists untracked directories that are entirely ignored by .gitignore
+func (g *GitOps) ListIgnoredDirectories() ([]string, error) {
+	entries, err := g.ListFiles("-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return nil, err
+	}
+	
+	dirs := []string{}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			dirs = append(dirs, strings.TrimSuffix(entry, "/"))
+		}
+	}
+	return dirs, nil
+}
+
 // ListBranches 获取所有分支列表
 // Gets list of all branches
 func (g *GitOps) ListBranches() ([]string, error) {
@@ -432,6 +1182,37 @@ func (g *GitOps) ListBranches() ([]string, error) {
 	return branches, nil
 }
 
+// RefEntry git for-each-ref 的一条记录
+// A single git for-each-ref entry
+type RefEntry struct {
+	Name   string // 完整引用名 / Full ref name
+	Hash   string
+	Parent string // 第一个父提交，非提交对象时为空 / First parent, empty for non-commit objects
+}
+
+// ListRefs 列出以 prefix 开头的本地引用
+// Lists the local refs starting with prefix
+func (g *GitOps) ListRefs(prefix string) ([]RefEntry, error) {
+	output, err := g.execGitCommand("for-each-ref", "--format=%(refname) %(objectname) %(parent)", prefix)
+	if err != nil {
+		return nil, err
+	}
+	
+	refs := []RefEntry{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		entry := RefEntry{Name: fields[0], Hash: fields[1]}
+		if len(fields) > 2 {
+			entry.Parent = fields[2]
+		}
+		refs = append(refs, entry)
+	}
+	return refs, nil
+}
+
 // GetRepoRoot 获取仓库根目录
 // Gets repository root directory
 func GetRepoRoot() (string, error) {
@@ -0,0 +1,128 @@
+// git_test.go - Git operations unit tests / Git 操作单元测试
+//
+// Module: git
+// Description: Tests Push's automatic repair of corrupt remote refs against a scripted FakeRunner
+// Author: git-autosync contributors
+// Dependencies: strings, testing, config, logger
+
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+// corruptRefStderr push 遇到损坏的远程引用时 git 的输出
+// What git prints when a push runs into corrupt remote refs
+const corruptRefStderr = `error: refs/remotes/origin/old-feature does not point to a valid object!
+remote: fatal: bad object refs/heads/old-feature
+remote: fatal: bad object refs/tags/broken
+error: failed to push some refs to 'origin'`
+
+// newFakeGitOps 创建通过 FakeRunner 执行命令的 GitOps
+// Creates a GitOps that runs its commands through a FakeRunner
+func newFakeGitOps(t *testing.T, autoFix bool) (*GitOps, *FakeRunner) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RepoRoot = t.TempDir()
+	cfg.AutoFixCorruptRefs = autoFix
+	fake := NewFakeRunner()
+	return NewGitOpsWithRunner(cfg, logger.NewLogger(false), fake), fake
+}
+
+// TestParseCorruptRefError tests extracting the corrupt refs from a push error
+// 测试从推送错误中提取损坏的引用
+func TestParseCorruptRefError(t *testing.T) {
+	got := parseCorruptRefError(corruptRefStderr)
+	if strings.Join(got, ",") != "refs/heads/old-feature,refs/tags/broken" {
+		t.Errorf("Expected [refs/heads/old-feature refs/tags/broken], got %v", got)
+	}
+	if got := parseCorruptRefError("error: failed to push some refs"); len(got) != 0 {
+		t.Errorf("Expected no refs, got %v", got)
+	}
+}
+
+// TestPush_RepairsCorruptRefs tests that corrupt remote refs are deleted and the push retried
+// 测试删除损坏的远程引用后重试推送
+func TestPush_RepairsCorruptRefs(t *testing.T) {
+	g, fake := newFakeGitOps(t, true)
+	fake.On("push", "origin", "main").Fail(1, corruptRefStderr).Once()
+
+	if err := g.Push(); err != nil {
+		t.Fatalf("Expected the retried push to succeed, got %v", err)
+	}
+	want := []string{
+		"push origin main",
+		"push origin :refs/heads/old-feature",
+		"push origin :refs/tags/broken",
+		"push origin main",
+	}
+	if got := fake.Calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected calls %v, got %v", want, got)
+	}
+}
+
+// TestPush_RepairFailures tests the cases where no repair or retry happens
+// 测试不修复或不重试的情况
+func TestPush_RepairFailures(t *testing.T) {
+	t.Run("auto fix disabled", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, false)
+		fake.On("push").Fail(1, corruptRefStderr)
+
+		if err := g.Push(); err == nil {
+			t.Error("Expected the push error to be returned")
+		}
+		if fake.Count("push") != 1 {
+			t.Errorf("Expected a single push, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("unrelated error", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, true)
+		fake.On("push").Fail(1, "! [rejected] main -> main (fetch first)")
+
+		if err := g.Push(); err == nil || !strings.Contains(err.Error(), "fetch first") {
+			t.Errorf("Expected the rejection to be returned, got %v", err)
+		}
+		if fake.Count("push") != 1 {
+			t.Errorf("Expected no repair attempt, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("ref deletion fails", func(t *testing.T) {
+		g, fake := newFakeGitOps(t, true)
+		fake.On("push").Fail(1, corruptRefStderr)
+
+		if err := g.Push(); err == nil {
+			t.Error("Expected the original push error to be returned")
+		}
+		// 两次删除尝试均失败，不重试推送 / Both deletions fail, so the push is not retried
+		if fake.Count("push", "origin", "main") != 1 || fake.Count("push") != 3 {
+			t.Errorf("Expected one push and two deletion attempts, calls: %v", fake.Calls())
+		}
+	})
+}
+
+// TestExecGitCommand_ErrorIncludesStderr tests that failures carry the command and its stderr
+// 测试失败信息包含命令和 stderr
+func TestExecGitCommand_ErrorIncludesStderr(t *testing.T) {
+	g, fake := newFakeGitOps(t, true)
+	fake.On("rev-parse", "@").Stdout("abc123\n")
+	fake.On("merge-base").Fail(128, "fatal: no merge base")
+
+	if rev, err := g.GetRevision("@"); err != nil || rev != "abc123" {
+		t.Errorf("Expected trimmed output abc123, got %q, %v", rev, err)
+	}
+	_, err := g.GetMergeBase("@", "origin/main")
+	if err == nil || !strings.Contains(err.Error(), "git merge-base @ origin/main failed") || !strings.Contains(err.Error(), "no merge base") {
+		t.Errorf("Expected command and stderr in the error, got %v", err)
+	}
+	for _, c := range fake.Commands() {
+		if c.Dir != g.cfg.RepoRoot {
+			t.Errorf("Expected commands to run in the repository root, got %q", c.Dir)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HashBlob 在进程内计算 git blob 的 SHA-1（与不经过过滤器的 git hash-object 相同）
+// Computes the git blob SHA-1 in process (the same as git hash-object without filters)
+// 内容以流方式读取，size 必须与内容长度一致 / The content is streamed and size must match its length
+func HashBlob(r io.Reader, size int64) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("blob size changed while hashing: expected %d bytes, read %d", size, n)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashBlobFile 在进程内计算文件的 git blob SHA-1
+// Computes the git blob SHA-1 of a file in process
+// 注意：不应用 clean/autocrlf 等过滤器，结果只能用来与已知的 hash 比较
+// Note: clean/autocrlf filters are not applied, so the result is only fit for comparison with a known hash
+func HashBlobFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return HashBlob(bufio.NewReaderSize(f, 64*1024), info.Size())
+}
+
+// ObjectWriter 长期运行的 git hash-object -w --stdin-paths 进程
+// A long-lived git hash-object -w --stdin-paths process
+// 每个路径只需一次管道往返，不再为每个文件启动子进程；git 会按路径应用过滤器
+// Each path costs one pipe round trip instead of one subprocess per file; git applies filters by path
+// 不能并发使用 / Not safe for concurrent use
+type ObjectWriter struct {
+	proc   Process
+	stdout *bufio.Reader
+	broken bool
+}
+
+// NewObjectWriter 启动对象写入进程
+// Starts an object writer process
+func (g *GitOps) NewObjectWriter() (*ObjectWriter, error) {
+	proc, err := g.start("hash-object", "-w", "--stdin-paths")
+	if err != nil {
+		return nil, fmt.Errorf("git hash-object --stdin-paths failed to start: %w", err)
+	}
+	return &ObjectWriter{proc: proc, stdout: bufio.NewReader(proc.Stdout())}, nil
+}
+
+// Write 把文件写入对象库并返回其 hash
+// Writes the file into the object database and returns its hash
+// 路径中含换行符时无法通过管道传递，返回错误 / Paths containing a newline cannot go through the pipe and yield an error
+func (w *ObjectWriter) Write(path string) (string, error) {
+	if w.broken {
+		return "", fmt.Errorf("object writer is broken")
+	}
+	if strings.ContainsAny(path, "\n\r") {
+		return "", fmt.Errorf("path contains a newline: %q", path)
+	}
+
+	if _, err := io.WriteString(w.proc.Stdin(), path+"\n"); err != nil {
+		w.broken = true
+		return "", fmt.Errorf("git hash-object --stdin-paths: %w, stderr: %s", err, w.proc.Stderr())
+	}
+	line, err := w.stdout.ReadString('\n')
+	if err != nil {
+		w.broken = true
+		return "", fmt.Errorf("git hash-object --stdin-paths: %s: %w, stderr: %s", path, err, w.proc.Stderr())
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Close 关闭标准输入并等待进程退出
+// Closes stdin and waits for the process to exit
+func (w *ObjectWriter) Close() error {
+	w.proc.Stdin().Close()
+	return w.proc.Wait()
+}
+
+// ObjectWriterPool 按需启动、最多 size 个 ObjectWriter 的池
+// A pool of at most size ObjectWriters, started on demand
+// 每个并发 worker 借用一个写入进程，用完归还 / Each concurrent worker borrows a writer and returns it when done
+type ObjectWriterPool struct {
+	g     *GitOps
+	slots chan struct{}
+
+	mu      sync.Mutex
+	idle    []*ObjectWriter
+	started []*ObjectWriter
+}
+
+// NewObjectWriterPool 创建写入进程池，进程在第一次使用时才启动
+// Creates a writer pool; processes are only started on first use
+func (g *GitOps) NewObjectWriterPool(size int) *ObjectWriterPool {
+	if size < 1 {
+		size = 1
+	}
+	return &ObjectWriterPool{g: g, slots: make(chan struct{}, size)}
+}
+
+// Write 借用一个写入进程把文件写入对象库
+// Borrows a writer to write the file into the object database
+// 写入进程出错后会被丢弃，下次使用时重新启动 / A writer that failed is discarded and replaced on next use
+func (p *ObjectWriterPool) Write(path string) (string, error) {
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+
+	w, err := p.acquire()
+	if err != nil {
+		return "", err
+	}
+	hash, err := w.Write(path)
+	p.release(w)
+	return hash, err
+}
+
+// acquire 取出空闲写入进程，没有时启动新进程
+// Takes an idle writer or starts a new one
+func (p *ObjectWriterPool) acquire() (*ObjectWriter, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.idle); n > 0 {
+		w := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		return w, nil
+	}
+	w, err := p.g.NewObjectWriter()
+	if err != nil {
+		return nil, err
+	}
+	p.started = append(p.started, w)
+	return w, nil
+}
+
+// release 归还写入进程，出错的进程不再复用
+// Returns a writer to the pool; broken writers are not reused
+func (p *ObjectWriterPool) release(w *ObjectWriter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !w.broken {
+		p.idle = append(p.idle, w)
+	}
+}
+
+// Close 关闭所有已启动的写入进程
+// Closes every writer that was started
+func (p *ObjectWriterPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, w := range p.started {
+		w.Close()
+	}
+	p.started, p.idle = nil, nil
+}
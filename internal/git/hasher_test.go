@@ -0,0 +1,157 @@
+// hasher_test.go - Blob hashing unit tests and benchmarks / blob 哈希单元测试与基准测试
+//
+// Module: git
+// Description: Tests in-process blob hashing and the hash-object pipe against git, and benchmarks
+//              them against one git hash-object subprocess per file
+// Author: git-autosync contributors
+// Dependencies: fmt, os, os/exec, path/filepath, strings, testing
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+// newTestRepo 创建包含 n 个文件的临时仓库
+// Creates a temporary repository containing n files
+func newTestRepo(tb testing.TB, n int) (*GitOps, []string) {
+	tb.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		tb.Skip("git not available")
+	}
+
+	root := tb.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		tb.Fatalf("git init: %v: %s", err, out)
+	}
+
+	files := make([]string, n)
+	for i := range files {
+		files[i] = filepath.Join(root, fmt.Sprintf("file-%04d.txt", i))
+		content := strings.Repeat(fmt.Sprintf("line %d of file %d\n", i%7, i), 50+i%100)
+		if err := os.WriteFile(files[i], []byte(content), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.RepoRoot = root
+	return NewGitOps(cfg, logger.NewLogger(false)), files
+}
+
+// TestHashBlobFile_MatchesGit tests that the in-process hash equals git hash-object
+// 测试进程内计算的 hash 与 git hash-object 一致
+func TestHashBlobFile_MatchesGit(t *testing.T) {
+	g, files := newTestRepo(t, 3)
+
+	empty := filepath.Join(g.cfg.RepoRoot, "empty")
+	os.WriteFile(empty, nil, 0644)
+
+	for _, f := range append(files, empty) {
+		want, err := g.HashObject(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := HashBlobFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", filepath.Base(f), want, got)
+		}
+	}
+}
+
+// TestObjectWriterPool_Write tests that pooled writes store objects and return git's hash
+// 测试通过进程池写入的对象已存入对象库且 hash 与 git 一致
+func TestObjectWriterPool_Write(t *testing.T) {
+	g, files := newTestRepo(t, 5)
+
+	pool := g.NewObjectWriterPool(2)
+	defer pool.Close()
+
+	for _, f := range files {
+		hash, err := pool.Write(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := HashBlobFile(f)
+		if hash != want {
+			t.Errorf("%s: expected %s, got %s", filepath.Base(f), want, hash)
+		}
+	}
+
+	hashes := make([]string, len(files))
+	for i, f := range files {
+		hashes[i], _ = HashBlobFile(f)
+	}
+	missing, err := g.MissingObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Expected every object to be written, missing %d", len(missing))
+	}
+
+	if _, err := pool.Write("bad\nname"); err == nil {
+		t.Error("Expected an error for a path containing a newline")
+	}
+	// 出错后池仍可继续使用 / The pool keeps working after an error
+	if _, err := pool.Write(files[0]); err != nil {
+		t.Errorf("Expected the pool to recover, got %v", err)
+	}
+}
+
+const benchFiles = 200
+
+// BenchmarkHashObjectPerFile 每个文件启动一个 git hash-object -w 子进程（旧做法）
+// One git hash-object -w subprocess per file (the previous approach)
+func BenchmarkHashObjectPerFile(b *testing.B) {
+	g, files := newTestRepo(b, benchFiles)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range files {
+			if _, err := g.HashObject(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkObjectWriterPipe 通过长期运行的 hash-object --stdin-paths 进程写入
+// Writes through a long-lived hash-object --stdin-paths process
+func BenchmarkObjectWriterPipe(b *testing.B) {
+	g, files := newTestRepo(b, benchFiles)
+	pool := g.NewObjectWriterPool(1)
+	defer pool.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range files {
+			if _, err := pool.Write(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkHashBlobInProcess 进程内计算 SHA-1（与索引比较时的路径）
+// Computes the SHA-1 in process (the path taken when comparing against the index)
+func BenchmarkHashBlobInProcess(b *testing.B) {
+	_, files := newTestRepo(b, benchFiles)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range files {
+			if _, err := HashBlobFile(f); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Command 一次 git 调用
+// A single git invocation
+type Command struct {
+	Args  []string // git 之后的参数 / Arguments after git
+	Dir   string   // 工作目录 / Working directory
+	Stdin string   // 标准输入，为空时不连接 / Standard input, not connected when empty
+	Env   []string // 追加到当前进程环境的变量 / Variables appended to the current process environment
+}
+
+// Result git 调用的输出
+// Output of a git invocation
+type Result struct {
+	Stdout   []byte // 原始输出，未裁剪 / Raw output, untrimmed
+	Stderr   string
+	ExitCode int // 未能运行或被中断时为 -1 / -1 when git could not run or was interrupted
+}
+
+// GitRunner 执行 git 命令的接口，GitOps、GitBatchProcessor 和 SubrepoProcessor 的命令都通过它执行
+// Interface that executes git commands; GitOps, GitBatchProcessor and SubrepoProcessor run their commands through it
+// 退出码非 0 时返回错误，Result 中仍包含输出；单元测试用 FakeRunner 代替真实的 git
+// A non-zero exit code returns an error while Result still holds the output; unit tests use FakeRunner instead of real git
+type GitRunner interface {
+	Run(ctx context.Context, c Command) (Result, error)
+	// Start 启动长期运行的 git 进程，通过管道逐条交换请求和应答（cat-file --batch、hash-object --stdin-paths）
+	// Starts a long-lived git process that exchanges requests and answers through pipes (cat-file --batch,
+	// hash-object --stdin-paths)
+	// c.Stdin 被忽略，改用 Process.Stdin / c.Stdin is ignored in favour of Process.Stdin
+	Start(ctx context.Context, c Command) (Process, error)
+}
+
+// Process 通过 GitRunner.Start 启动的 git 进程
+// A git process started through GitRunner.Start
+type Process interface {
+	Stdin() io.WriteCloser // 关闭后进程处理完剩余的请求并退出 / Once closed the process answers the remaining requests and exits
+	Stdout() io.Reader
+	Stderr() string // 到目前为止的标准错误输出 / Standard error so far
+	Wait() error    // 等待进程退出，退出码非 0 时返回错误 / Waits for the process to exit, an error for a non-zero exit code
+	Kill()          // 立即结束进程 / Ends the process at once
+}
+
+// ExecRunner 运行真实 git 进程的 GitRunner
+// GitRunner that runs real git processes
+type ExecRunner struct{}
+
+// Run 运行 git 并收集输出，ctx 取消时按 Run 的方式中断
+// Runs git and collects its output, interrupting it as Run does when ctx is cancelled
+func (ExecRunner) Run(ctx context.Context, c Command) (Result, error) {
+	cmd := exec.Command("git", c.Args...)
+	cmd.Dir = c.Dir
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := Run(ctx, cmd)
+	res := Result{Stdout: stdout.Bytes(), Stderr: stderr.String()}
+	if err != nil {
+		res.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			res.ExitCode = exitErr.ExitCode()
+		}
+	}
+	return res, err
+}
+
+// Start 启动 git 进程并连接标准输入输出；ctx 只在启动前检查，调用方在请求之间检查 ctx 并用 Kill 结束进程
+// Starts git with its standard input and output connected; ctx is only checked before starting, callers check it
+// between requests and end the process with Kill
+func (ExecRunner) Start(ctx context.Context, c Command) (Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("not started: %w", err)
+	}
+
+	p := &execProcess{cmd: exec.Command("git", c.Args...)}
+	p.cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		p.cmd.Env = append(os.Environ(), c.Env...)
+	}
+	p.cmd.Stderr = &p.stderr
+
+	var err error
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if p.stdout, err = p.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// execProcess ExecRunner 启动的真实 git 进程
+// A real git process started by ExecRunner
+type execProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	stderr lockedBuffer
+}
+
+// Stdin、Stdout、Stderr、Wait 和 Kill 实现 Process
+// Stdin, Stdout, Stderr, Wait and Kill implement Process
+func (p *execProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *execProcess) Stdout() io.Reader     { return p.stdout }
+func (p *execProcess) Stderr() string        { return p.stderr.String() }
+func (p *execProcess) Wait() error           { return p.cmd.Wait() }
+
+func (p *execProcess) Kill() {
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+// lockedBuffer 可以在进程写入时读取的缓冲区
+// A buffer that may be read while the process writes to it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write 实现 io.Writer / Implements io.Writer
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String 返回已写入的内容 / Returns what has been written
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
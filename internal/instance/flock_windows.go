@@ -0,0 +1,36 @@
+//go:build windows
+
+package instance
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation ERROR_SHARING_VIOLATION
+const errorSharingViolation syscall.Errno = 32
+
+// openExclusive 以只允许共享读取的方式打开锁文件，其他实例无法再以写方式打开
+// Opens the lock file sharing read access only, so another instance cannot open it for writing
+func openExclusive(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(name,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		syscall.FILE_SHARE_READ,
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, errHeld
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
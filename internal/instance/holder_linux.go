@@ -0,0 +1,86 @@
+//go:build linux
+
+package instance
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FindLockHolder 查找可能持有指定锁文件（如 .git/index.lock）的存活进程
+// Finds a live process that may hold the given lock file (e.g. .git/index.lock)
+// 扫描 /proc/*/fd 查找打开了锁文件的进程；git 在运行钩子和编辑器前会关闭锁文件但不删除它，
+// 因此工作目录位于该仓库内的 git 进程也视为持有者（本进程启动的子进程除外）；只能看到当前用户有权限读取的进程
+// Scans /proc/*/fd for a process that has the lock file open; git closes the lock file (without removing it) around
+// hooks and editors, so a git process whose working directory is inside the repository also counts as the holder
+// (children of this process excepted); only processes the current user may inspect are visible
+// 返回 (pid, true) 表示找到存活持有者；(0, false) 表示未找到
+// Returns (pid, true) when a live holder was found, (0, false) otherwise
+func FindLockHolder(lockPath string) (int, bool) {
+	target, err := filepath.Abs(lockPath)
+	if err != nil {
+		return 0, false
+	}
+	// 锁文件位于 <仓库>/.git/ 下 / The lock file lives in <repo>/.git/
+	worktree := filepath.Dir(filepath.Dir(target))
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, false
+	}
+
+	self := os.Getpid()
+	gitPID := 0
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err == nil && link == target {
+				return pid, true
+			}
+		}
+
+		if gitPID == 0 && isGitIn(p.Name(), worktree, self) {
+			gitPID = pid
+		}
+	}
+	return gitPID, gitPID != 0
+}
+
+// isGitIn 进程是否为工作目录位于 worktree 内、且不是 self 子进程的 git
+// Whether the process is a git whose working directory is inside worktree and whose parent is not self
+func isGitIn(pid, worktree string, self int) bool {
+	comm, err := os.ReadFile(filepath.Join("/proc", pid, "comm"))
+	if err != nil || strings.TrimSpace(string(comm)) != "git" {
+		return false
+	}
+
+	cwd, err := os.Readlink(filepath.Join("/proc", pid, "cwd"))
+	if err != nil || (cwd != worktree && !strings.HasPrefix(cwd, worktree+string(filepath.Separator))) {
+		return false
+	}
+
+	// /proc/<pid>/stat: pid (comm) state ppid ...
+	stat, err := os.ReadFile(filepath.Join("/proc", pid, "stat"))
+	if err != nil {
+		return false
+	}
+	_, rest, ok := strings.Cut(string(stat), ") ")
+	fields := strings.Fields(rest)
+	if !ok || len(fields) < 2 {
+		return false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid != self
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package instance
+
+// FindLockHolder 非 Linux 平台无法可靠地查找锁文件持有者，总是返回 (0, false)
+// The lock file holder cannot be found reliably outside Linux, so this always returns (0, false)
+// 此时只有 IndexLockInUse 检查的实例锁能保护其他 git-autosync 实例的锁；
+// Windows 上被打开的文件本身无法删除，其他平台上请让 lock_file_max_age 大于最长的 git 操作
+// Only the instance lock checked by IndexLockInUse then protects the locks of other git-autosync instances;
+// on Windows a file that is open cannot be removed, elsewhere keep lock_file_max_age above the longest git operation
+func FindLockHolder(lockPath string) (int, bool) {
+	return 0, false
+}
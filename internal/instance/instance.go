@@ -0,0 +1,167 @@
+// Package instance / 单实例保护包
+// Module: Single-Instance Guard / 单实例保护
+// Function: Holds an advisory lock inside .git so only one git-autosync runs per repository,
+//           and finds live holders of git's own lock files
+//           在 .git 内持有建议锁，保证每个仓库只运行一个 git-autosync，并查找 git 锁文件的存活持有者
+// Author: git-autosync contributors
+// Dependencies: encoding/json, errors, fmt, os, path/filepath, time
+
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LockFileName .git 目录中的实例锁文件名
+// Name of the instance lock file inside the .git directory
+const LockFileName = "git-autosync.lock"
+
+// errHeld 锁已被其他进程持有（平台实现内部使用）
+// The lock is held by another process (used by platform implementations)
+var errHeld = errors.New("lock is held by another process")
+
+// Info 锁持有者信息
+// Lock holder information
+type Info struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// String 返回可读的持有者描述
+// Returns a readable description of the holder
+func (i Info) String() string {
+	if i.PID == 0 {
+		return "unknown holder"
+	}
+	return fmt.Sprintf("pid %d on %s, started %s", i.PID, i.Host, i.Started.Format("2006-01-02 15:04:05"))
+}
+
+// HeldError 另一个实例正在运行
+// Another instance is already running
+type HeldError struct {
+	Path   string
+	Holder Info
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("another git-autosync instance holds %s (%s)", e.Path, e.Holder)
+}
+
+// Lock 已获取的实例锁
+// An acquired instance lock
+type Lock struct {
+	file *os.File
+	path string
+	info Info
+}
+
+// Acquire 获取仓库的实例锁，已被持有时返回 *HeldError
+// Acquires the repository's instance lock, returning *HeldError when it is already held
+// 锁随进程退出由操作系统自动释放，锁文件本身会保留
+// The OS releases the lock when the process exits; the lock file itself is left in place
+func Acquire(repoRoot string) (*Lock, error) {
+	path := filepath.Join(repoRoot, ".git", LockFileName)
+
+	f, err := openExclusive(path)
+	if err != nil {
+		if errors.Is(err, errHeld) {
+			return nil, &HeldError{Path: path, Holder: readInfo(path)}
+		}
+		return nil, fmt.Errorf("failed to open instance lock %s: %w", path, err)
+	}
+
+	host, _ := os.Hostname()
+	info := Info{PID: os.Getpid(), Host: host, Started: time.Now()}
+	data, _ := json.Marshal(info)
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write instance lock %s: %w", path, err)
+	}
+	if _, err := f.WriteAt(append(data, '\n'), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write instance lock %s: %w", path, err)
+	}
+
+	return &Lock{file: f, path: path, info: info}, nil
+}
+
+// Info 返回本实例记录的持有者信息
+// Returns the holder information recorded by this instance
+func (l *Lock) Info() Info {
+	return l.info
+}
+
+// Release 释放实例锁
+// Releases the instance lock
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	// 先清空内容，避免读者看到过期的持有者 / Clear contents first so readers never see a stale holder
+	l.file.Truncate(0)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// readInfo 读取锁文件中记录的持有者信息
+// Reads the holder information recorded in the lock file
+func readInfo(path string) Info {
+	var info Info
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info
+	}
+	json.Unmarshal(data, &info)
+	return info
+}
+
+// FindInstanceHolder 查找持有仓库实例锁的其他存活进程
+// Finds another live process holding the repository's instance lock
+// 实例锁随持有进程退出由操作系统释放，因此锁仍被持有即说明持有者存活；本进程持有时返回 false
+// The OS releases the instance lock when its holder exits, so a lock that is still held means a live holder;
+// returns false when this process holds it
+func FindInstanceHolder(repoRoot string) (Info, bool) {
+	path := filepath.Join(repoRoot, ".git", LockFileName)
+	if _, err := os.Stat(path); err != nil {
+		return Info{}, false
+	}
+
+	f, err := openExclusive(path)
+	if err == nil {
+		f.Close()
+		return Info{}, false
+	}
+	if !errors.Is(err, errHeld) {
+		return Info{}, false
+	}
+
+	info := readInfo(path)
+	host, _ := os.Hostname()
+	if info.PID == os.Getpid() && info.Host == host {
+		return info, false
+	}
+	return info, true
+}
+
+// IndexLockInUse 判断仓库的 index.lock 是否可能仍被存活进程使用，清理过期锁之前调用
+// Reports whether the repository's index.lock may still be in use by a live process; call before removing a stale lock
+// 其他 git-autosync 实例持有实例锁，或 FindLockHolder 找到了持有者时返回持有者描述和 true
+// Returns a description of the holder and true when another git-autosync instance holds the instance lock or
+// FindLockHolder finds a holder
+func IndexLockInUse(repoRoot string) (string, bool) {
+	if info, held := FindInstanceHolder(repoRoot); held {
+		return "git-autosync " + info.String(), true
+	}
+	if pid, held := FindLockHolder(filepath.Join(repoRoot, ".git", "index.lock")); held {
+		return fmt.Sprintf("pid %d", pid), true
+	}
+	return "", false
+}
@@ -0,0 +1,217 @@
+// compact_test.go - History compaction scenarios / 历史压缩场景
+//
+// Module: integration
+// Description: Runs git-autosync compact against real histories: the human and merge commit stop, the pushed-window
+//              cutoff, the tree-preserving replay, the backup branch, the force push with a remote backup, and the
+//              restore after a rejected force push
+// Author: git-autosync contributors
+// Dependencies: fmt, os, os/exec, path/filepath, runtime, strings, testing, time
+
+package integration
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// autoSyncPrefix 默认的自动同步提交信息前缀 / The default auto-sync commit message prefix
+const autoSyncPrefix = "Auto-sync / 自动同步:"
+
+// commitAt 写入文件并以给定的作者时间和提交时间提交，返回提交哈希
+// Writes a file and commits it with the given author and committer time, returning the commit hash
+func (c *clone) commitAt(path, message string, author, committer time.Time) string {
+	c.e.t.Helper()
+	c.write(path, message+"\n")
+	c.git("add", "--", path)
+
+	cmd := exec.Command("git", "commit", "-q", "-m", message)
+	cmd.Dir = c.dir
+	cmd.Env = append(c.e.environ(),
+		fmt.Sprintf("GIT_AUTHOR_DATE=@%d +0000", author.Unix()),
+		fmt.Sprintf("GIT_COMMITTER_DATE=@%d +0000", committer.Unix()))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		c.e.t.Fatalf("%s: git commit: %v\n%s", c.name, err, out)
+	}
+	return c.head()
+}
+
+// autoCommits 以自动同步信息提交，作者时间依次为 day 当天的各个 "15:04"，提交时间为 committer
+// Makes auto-sync commits authored at each "15:04" of day, committed at committer
+func (c *clone) autoCommits(day time.Time, committer time.Time, clocks ...string) []string {
+	c.e.t.Helper()
+	var hashes []string
+	for _, clock := range clocks {
+		at, err := time.ParseInLocation("2006-01-02 15:04", day.Format("2006-01-02")+" "+clock, time.Local)
+		if err != nil {
+			c.e.t.Fatal(err)
+		}
+		name := strings.ReplaceAll(clock, ":", "")
+		hashes = append(hashes, c.commitAt("auto/"+name+".txt", autoSyncPrefix+" "+clock, at, committer))
+	}
+	return hashes
+}
+
+// subjects HEAD 之上 n 个提交的标题，从新到旧 / Subjects of the n commits up to HEAD, newest first
+func (c *clone) subjects(n int) []string {
+	c.e.t.Helper()
+	return strings.Split(c.git("log", "--first-parent", fmt.Sprintf("-n%d", n), "--format=%s"), "\n")
+}
+
+// backupBranch 唯一的 backup-before-compact-* 分支指向的提交
+// Commit of the single backup-before-compact-* branch
+func (c *clone) backupBranch() string {
+	c.e.t.Helper()
+	refs := strings.Fields(c.git("for-each-ref", "--format=%(objectname)", "refs/heads/backup-before-compact-*"))
+	if len(refs) != 1 {
+		c.e.t.Fatalf("%s: expected one backup-before-compact branch, got %v", c.name, refs)
+	}
+	return refs[0]
+}
+
+// TestCompactStopsAtHumanAndMergeCommits tests that compaction rewrites only the auto-sync commits after the last
+// human or merge commit, keeps the tree, creates a backup branch and pushes the unpushed result normally
+// 测试压缩只重写最后一个人工提交或合并提交之后的自动同步提交，树保持不变，创建备份分支并正常推送未推送的结果
+func TestCompactStopsAtHumanAndMergeCommits(t *testing.T) {
+	day := time.Now().AddDate(0, 0, -2)
+
+	for _, boundary := range []string{"human", "merge"} {
+		t.Run(boundary, func(t *testing.T) {
+			e := newEnv(t)
+			a := e.clone("a", "compact_granularity = hourly")
+
+			// 边界之前的自动同步提交属于同一小时，但不能被压缩
+			// The auto-sync commits before the boundary share an hour but must not be squashed
+			a.autoCommits(day, day, "09:05", "09:20")
+			switch boundary {
+			case "human":
+				a.commitAt("notes.txt", "Edit notes", day, day)
+			case "merge":
+				a.git("checkout", "-q", "-b", "side", "HEAD~1")
+				a.commitAt("side.txt", "Side work", day, day)
+				a.git("checkout", "-q", "main")
+				a.git("merge", "-q", "--no-ff", "-m", "Merge side", "side")
+			}
+			stop := a.head()
+			a.autoCommits(day, day, "10:05", "10:10", "10:40", "11:05")
+
+			oldHead, oldTree := a.head(), a.git("rev-parse", "HEAD^{tree}")
+			a.run("", nil, exitSynced, "compact")
+
+			want := []string{autoSyncPrefix + " 11:05", autoSyncPrefix + " Compacted 3 commits of " + day.Format("2006-01-02") + " 10:00"}
+			if got := a.subjects(2); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+			if got := a.git("rev-parse", "HEAD~2"); got != stop {
+				t.Errorf("Expected the history to be kept from the %s commit %s, got %s", boundary, stop, got)
+			}
+			if got := a.git("rev-parse", "HEAD^{tree}"); got != oldTree {
+				t.Errorf("Expected the tree to be kept, got %s instead of %s", got, oldTree)
+			}
+			if got := a.backupBranch(); got != oldHead {
+				t.Errorf("Expected the backup branch at the old head %s, got %s", oldHead, got)
+			}
+			if out := a.git("status", "--porcelain"); out != "" {
+				t.Errorf("Expected a clean working tree, got %q", out)
+			}
+			if a.head() != e.remoteHead() {
+				t.Errorf("Expected the compacted history to be pushed, remote at %s, local at %s", e.remoteHead(), a.head())
+			}
+
+			a.run("", nil, exitNothingToDo, "compact")
+		})
+	}
+}
+
+// TestCompactPushedWindow tests that pushed commits are only rewritten within compact_pushed_window, that the
+// rewrite is force pushed after backing up the old remote tip, and that a rejected force push restores the history
+// 测试已推送的提交只在 compact_pushed_window 内被重写，重写后先备份远程原提交再强制推送，强制推送被拒绝时恢复原历史
+func TestCompactPushedWindow(t *testing.T) {
+	now := time.Now()
+	day := now.AddDate(0, 0, -2)
+
+	// setup 在同一天先做两个窗口外的已推送提交（9 点），再做两个窗口内的已推送提交和一个未推送提交（10 点）
+	// setup makes two pushed commits outside the window (at 9), then two pushed commits inside it and one unpushed
+	// commit (at 10), all on the same day
+	setup := func(t *testing.T, granularity string, conf ...string) (*env, *clone, []string) {
+		e := newEnv(t)
+		a := e.clone("a", append([]string{"compact_granularity = " + granularity}, conf...)...)
+		old := a.autoCommits(day, now.Add(-72*time.Hour), "09:01", "09:02")
+		recent := a.autoCommits(day, now.Add(-time.Hour), "10:03", "10:04")
+		a.git("push", "-q", "origin", "main")
+		a.autoCommits(day, now, "10:05")
+		return e, a, append(old, recent...)
+	}
+
+	t.Run("unpushed only", func(t *testing.T) {
+		_, a, _ := setup(t, "hourly")
+		a.run("", nil, exitNothingToDo, "compact")
+	})
+
+	// 窗口把当天分成两段：窗口内的提交单独压缩后，这一天会永远分成两个提交，因此整天保持不变
+	// The window splits the day: squashing only the commits inside it would leave the day split for good, so the whole
+	// day is left alone
+	t.Run("window splits a day", func(t *testing.T) {
+		_, a, _ := setup(t, "daily", "compact_pushed_window = 24h")
+		oldHead := a.head()
+		a.run("", nil, exitNothingToDo, "compact")
+		if a.head() != oldHead {
+			t.Errorf("Expected HEAD to stay at %s, got %s", oldHead, a.head())
+		}
+	})
+
+	t.Run("within window", func(t *testing.T) {
+		e, a, pushed := setup(t, "hourly", "compact_pushed_window = 24h")
+		oldRemote, oldTree := e.remoteHead(), a.git("rev-parse", "HEAD^{tree}")
+		a.run("", nil, exitSynced, "compact")
+
+		if got := a.git("rev-parse", "HEAD~1"); got != pushed[1] {
+			t.Errorf("Expected commits outside the window to be kept, HEAD~1 is %s instead of %s", got, pushed[1])
+		}
+		if got := a.subjects(1)[0]; !strings.Contains(got, "Compacted 3 commits") {
+			t.Errorf("Expected the last three commits to be squashed, got %q", got)
+		}
+		if got := a.git("rev-parse", "HEAD^{tree}"); got != oldTree {
+			t.Errorf("Expected the tree to be kept, got %s instead of %s", got, oldTree)
+		}
+		if a.head() != e.remoteHead() {
+			t.Errorf("Expected the rewrite to be force pushed, remote at %s, local at %s", e.remoteHead(), a.head())
+		}
+		backups := e.git(e.remote, "for-each-ref", "--format=%(objectname)", "refs/autosync-backup/")
+		if backups != oldRemote {
+			t.Errorf("Expected the old remote tip %s to be backed up, got %q", oldRemote, backups)
+		}
+	})
+
+	t.Run("force push rejected", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("shell hooks are not used on Windows")
+		}
+		e, a, _ := setup(t, "hourly", "compact_pushed_window = 24h")
+		hook := filepath.Join(e.remote, "hooks", "pre-receive")
+		writeFile(t, hook, "#!/bin/sh\nwhile read old new ref; do [ \"$ref\" = refs/heads/main ] && exit 1; done\nexit 0\n")
+		if err := os.Chmod(hook, 0755); err != nil {
+			t.Fatal(err)
+		}
+		oldHead, oldRemote := a.head(), e.remoteHead()
+
+		out := a.run("", nil, exitFatal, "compact")
+		if !strings.Contains(out, "restoring original history") {
+			t.Errorf("Expected the restore to be reported, got:\n%s", out)
+		}
+		if a.head() != oldHead {
+			t.Errorf("Expected HEAD to be restored to %s, got %s", oldHead, a.head())
+		}
+		if e.remoteHead() != oldRemote {
+			t.Errorf("Expected the remote to be unchanged at %s, got %s", oldRemote, e.remoteHead())
+		}
+		if got := a.backupBranch(); got != oldHead {
+			t.Errorf("Expected the backup branch at the old head %s, got %s", oldHead, got)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+// daemon_test.go - Daemon scenarios / 守护进程场景
+//
+// Module: integration
+// Description: Runs git-autosync as a daemon, reloads its config through a config file change and SIGHUP, checks
+//              that a stale index.lock is kept while the daemon holds the instance lock, that an unstaged secret is
+//              only warned about once, and that watch_mode=inotify syncs file changes as they happen
+// Author: git-autosync contributors
+// Dependencies: os, path/filepath, runtime, strings, syscall, testing, time
+
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestConfigReload tests that the daemon applies a changed config file between cycles, reports options that need a
+// restart only once, and keeps the running config when a reload triggered by SIGHUP is invalid
+// 测试守护进程在周期之间应用修改后的配置文件，需要重启的配置项只报告一次，SIGHUP 触发的无效重新加载保留运行中的配置
+func TestConfigReload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SIGHUP is not available on Windows")
+	}
+	e := newEnv(t)
+	a := e.clone("a", "sleep_interval = 1s")
+	local := filepath.Join(a.dir, ".git", "git_sync.conf")
+
+	d := a.start()
+	d.waitFor("Waiting for 1s", 1)
+
+	// 配置文件变化在下一个周期之前生效 / A config file change applies before the next cycle
+	writeFile(t, local, "sleep_interval = 1h\nsync_mode = rebase\n")
+	d.waitFor("sleep_interval: '1s' -> '1h'", 1)
+	d.waitFor("Waiting for 1h0m0s", 1)
+	if !strings.Contains(d.out.String(), "sync_mode: 'merge' -> 'rebase' 需要重启才能生效 / takes effect after a restart") {
+		t.Errorf("Expected sync_mode to be reported as needing a restart, got:\n%s", d.out)
+	}
+
+	// SIGHUP 结束等待；已报告过的重启项不再警告 / SIGHUP ends the wait; a restart already reported is not warned about again
+	writeFile(t, local, "sleep_interval = 2h\nsync_mode = rebase\n")
+	d.signal(syscall.SIGHUP)
+	d.waitFor("sleep_interval: '1h' -> '2h'", 1)
+	d.waitFor("Waiting for 2h0m0s", 1)
+	if n := strings.Count(d.out.String(), "takes effect after a restart"); n != 1 {
+		t.Errorf("Expected the restart warning once, got it %d times:\n%s", n, d.out)
+	}
+
+	// 改回运行中的值不需要重启 / Going back to the running value needs no restart
+	writeFile(t, local, "sleep_interval = 2h\n")
+	d.signal(syscall.SIGHUP)
+	d.waitFor("sync_mode: 'rebase' -> 'merge' 与运行中的值相同 / matches the running value", 1)
+	d.waitFor("Waiting for 2h0m0s", 2)
+
+	// 无效的配置被拒绝 / An invalid config is rejected
+	writeFile(t, local, "sleep_interval = -5s\n")
+	d.signal(syscall.SIGHUP)
+	d.waitFor("keeping the current config", 1)
+	d.waitFor("Waiting for 2h0m0s", 3)
+
+	d.signal(os.Interrupt)
+	d.waitFor("Stopped cleanly", 1)
+}
+
+// TestStaleIndexLockWithLiveInstance tests that a dry-run does not plan to remove an old index.lock while a daemon
+// holds the repository's instance lock
+// 测试守护进程持有仓库实例锁时，演练不会计划删除过期的 index.lock
+func TestStaleIndexLockWithLiveInstance(t *testing.T) {
+	e := newEnv(t)
+	a := e.clone("a", "sleep_interval = 1h", "lock_file_max_age = 1s", "lock_wait_time = 1s")
+
+	d := a.start()
+	d.waitFor("Waiting for 1h0m0s", 1)
+
+	lock := filepath.Join(a.dir, ".git", "index.lock")
+	writeFile(t, lock, "")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	out := a.run("", nil, exitNothingToDo, "-dry-run", "once")
+	if !strings.Contains(out, "but its holder git-autosync pid") {
+		t.Errorf("Expected the daemon to be reported as the lock holder, got:\n%s", out)
+	}
+	if strings.Contains(out, "remove-lock") {
+		t.Errorf("Expected no remove-lock action in the plan, got:\n%s", out)
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("Expected index.lock to be kept: %v", err)
+	}
+	os.Remove(lock)
+}
+
+// TestSecretScanUnstage tests that secret_scan=unstage keeps a file with a secret out of the commits while the other
+// changes are pushed, and warns about the finding once although the file is unstaged again every cycle
+// 测试 secret_scan=unstage 不提交包含敏感信息的文件、其他变更照常推送，文件每个周期都被重新取消暂存但发现只警告一次
+func TestSecretScanUnstage(t *testing.T) {
+	e := newEnv(t)
+	a := e.clone("a", "sleep_interval = 1s", "secret_scan = unstage")
+
+	d := a.start()
+	d.waitFor("Waiting for 1s", 1)
+
+	a.write(".env", "AWS_ACCESS_KEY_ID=AKIAZ3MQ7XK2LP9RT4VB\n")
+	a.write("notes.txt", "notes\n")
+	d.waitFor("Unstaged and added to", 1)
+	d.waitFor("Waiting for 1s", strings.Count(d.out.String(), "Waiting for 1s")+3)
+
+	if n := strings.Count(d.out.String(), "Possible secret:"); n != 1 {
+		t.Errorf("Expected the finding to be warned about once, got it %d times:\n%s", n, d.out)
+	}
+	if a.inHead(".env") || e.git(e.remote, "ls-tree", "--name-only", "main", "--", ".env") != "" {
+		t.Errorf("Expected .env not to be committed")
+	}
+	if e.git(e.remote, "ls-tree", "--name-only", "main", "--", "notes.txt") == "" {
+		t.Errorf("Expected notes.txt to be pushed")
+	}
+}
+
+// TestWatchMode tests that watch_mode=inotify syncs a change without waiting for sleep_interval, and that a file in a
+// directory created while the daemon runs is watched as well
+// 测试 watch_mode=inotify 在文件变化后立即同步而不等待 sleep_interval，守护进程运行中新建目录里的文件同样被监听
+func TestWatchMode(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only available on Linux")
+	}
+	e := newEnv(t)
+	a := e.clone("a", "sleep_interval = 1h", "watch_mode = inotify", "watch_debounce = 200ms")
+
+	d := a.start()
+	d.waitFor("Waiting for file changes", 1)
+
+	a.write("notes.txt", "notes\n")
+	d.waitFor("Waiting for file changes", 2)
+	if got := e.git(e.remote, "show", "main:notes.txt"); got != "notes" {
+		t.Errorf("Expected notes.txt to be pushed, got %q", got)
+	}
+
+	a.write("docs/new/page.md", "v1\n")
+	d.waitFor("Waiting for file changes", 3)
+	a.write("docs/new/page.md", "v2\n")
+	d.waitFor("Waiting for file changes", 4)
+	if got := e.git(e.remote, "show", "main:docs/new/page.md"); got != "v2" {
+		t.Errorf("Expected the change in the new directory to be pushed, got %q", got)
+	}
+}
@@ -0,0 +1,8 @@
+// Package integration / 端到端集成测试包
+// Module: Integration Tests / 集成测试
+// Function: Runs real sync cycles (git-autosync once) in two clones of a temporary bare remote and checks the outcome
+//           在临时裸仓库的两个克隆中运行真实的同步周期（git-autosync once）并检查结果
+// Author: git-autosync contributors
+// Dependencies: git, go toolchain (tests only / 仅测试使用)
+
+package integration
@@ -0,0 +1,357 @@
+// harness_test.go - Integration test harness / 集成测试工具
+//
+// Module: integration
+// Description: Builds the git-autosync binary once and provides a temporary bare remote with clones that run
+//              `git-autosync once` or a background daemon with an isolated HOME, config and log directory
+// Author: git-autosync contributors
+// Dependencies: bytes, fmt, os, os/exec, path/filepath, runtime, strings, sync, testing, time
+
+package integration
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 退出码，与 cmd/git-autosync 一致 / Exit codes, matching cmd/git-autosync
+const (
+	exitNothingToDo        = 0
+	exitFatal              = 1
+	exitSynced             = 3
+	exitConflictRolledBack = 4
+	exitConflictBranch     = 6
+)
+
+// binary 测试用的 git-autosync 二进制，binDir 同时放置 git-lfs 替身
+// git-autosync binary under test; binDir also holds the git-lfs stand-in
+var binary, binDir string
+
+// realLFS 是否安装了真实的 git-lfs / Whether a real git-lfs is installed
+var realLFS bool
+
+// TestMain 编译一次二进制，所有测试共用
+// Builds the binary once for all tests
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests 准备二进制后运行测试，返回退出码
+// Prepares the binary, runs the tests and returns the exit code
+func runTests(m *testing.M) int {
+	if _, err := exec.LookPath("git"); err != nil {
+		fmt.Println("skipping integration tests: git not available")
+		return 0
+	}
+
+	dir, err := os.MkdirTemp("", "git-autosync-integration-")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	binDir = dir
+
+	binary = filepath.Join(binDir, "git-autosync")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	build := exec.Command(goTool(), "build", "-o", binary, "github.com/find-xposed-magisk/git-sync/cmd/git-autosync")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Printf("failed to build git-autosync: %v\n%s", err, out)
+		return 1
+	}
+
+	// 没有 git-lfs 时用什么都不做的替身满足依赖检查
+	// Without git-lfs a stand-in that does nothing satisfies the dependency check
+	if _, err := exec.LookPath("git-lfs"); err == nil {
+		realLFS = true
+	} else if runtime.GOOS == "windows" {
+		fmt.Println("skipping integration tests: git-lfs not available")
+		return 0
+	} else if err := os.WriteFile(filepath.Join(binDir, "git-lfs"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+// goTool 返回 go 命令的路径
+// Returns the path of the go command
+func goTool() string {
+	if path, err := exec.LookPath("go"); err == nil {
+		return path
+	}
+	return filepath.Join(runtime.GOROOT(), "bin", "go")
+}
+
+// env 一个测试的临时环境：裸远程仓库和隔离的 HOME
+// The temporary environment of one test: a bare remote and an isolated HOME
+type env struct {
+	t      *testing.T
+	root   string
+	remote string
+	home   string
+}
+
+// newEnv 创建裸远程仓库，并推送包含 README 和 .gitignore 的初始提交
+// Creates the bare remote and pushes an initial commit with a README and .gitignore
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration test skipped in short mode")
+	}
+
+	root := t.TempDir()
+	e := &env{t: t, root: root, remote: filepath.Join(root, "remote.git"), home: filepath.Join(root, "home")}
+	if err := os.MkdirAll(e.home, 0755); err != nil {
+		t.Fatal(err)
+	}
+	e.git(root, "init", "-q", "--bare", "--initial-branch=main", e.remote)
+
+	seed := filepath.Join(root, "seed")
+	e.git(root, "clone", "-q", e.remote, seed)
+	writeFile(t, filepath.Join(seed, "README.md"), "# integration\n")
+	writeFile(t, filepath.Join(seed, ".gitignore"), ".gitignore_nopush\n")
+	e.git(seed, "add", "-A")
+	e.git(seed, "commit", "-q", "-m", "initial")
+	e.git(seed, "push", "-q", "origin", "main")
+	return e
+}
+
+// environ 子进程环境：隔离的 HOME、固定的作者，不读取系统 git 配置
+// Subprocess environment: isolated HOME, fixed author, no system git config
+func (e *env) environ() []string {
+	return append(os.Environ(),
+		"HOME="+e.home,
+		"XDG_CONFIG_HOME="+filepath.Join(e.home, ".config"),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Integration", "GIT_AUTHOR_EMAIL=integration@example.com",
+		"GIT_COMMITTER_NAME=Integration", "GIT_COMMITTER_EMAIL=integration@example.com",
+		"PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"),
+	)
+}
+
+// git 在 dir 中运行 git，失败时终止测试，返回裁剪后的输出
+// Runs git in dir, failing the test on error, and returns the trimmed output
+func (e *env) git(dir string, args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = e.environ()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		e.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// clone 一个运行 git-autosync 的克隆
+// A clone that runs git-autosync
+type clone struct {
+	e    *env
+	name string
+	dir  string
+}
+
+// clone 克隆远程仓库并写入 git_sync.conf（不提交，列入 .git/info/exclude）
+// Clones the remote and writes git_sync.conf (not committed, listed in .git/info/exclude)
+// 每个克隆的日志写入仓库之外的独立目录，conf 中的额外行追加在默认设置之后
+// Each clone logs to its own directory outside the repository; extra conf lines are appended after the defaults
+func (e *env) clone(name string, conf ...string) *clone {
+	e.t.Helper()
+	c := &clone{e: e, name: name, dir: filepath.Join(e.root, name)}
+	e.git(e.root, "clone", "-q", e.remote, c.dir)
+
+	lines := append([]string{
+		"log_dir = " + filepath.Join(e.root, name+"-logs"),
+		"subrepo_base_dirs = data/git",
+	}, conf...)
+	writeFile(e.t, filepath.Join(c.dir, "git_sync.conf"), strings.Join(lines, "\n")+"\n")
+	appendFile(e.t, filepath.Join(c.dir, ".git", "info", "exclude"), "git_sync.conf\n")
+	return c
+}
+
+// sync 运行一次 git-autosync once，返回退出码；退出码不是 want 时输出日志并终止测试
+// Runs git-autosync once and returns the exit code; if it is not want the log is printed and the test fails
+func (c *clone) sync(want int) {
+	c.e.t.Helper()
+	c.run("", nil, want, "once")
+}
+
+// run 在克隆的子目录 sub 中运行 git-autosync，附加环境变量 env，退出码不是 want 时终止测试
+// Runs git-autosync in the clone's subdirectory sub with the extra environment env; the test fails if the exit code is not want
+func (c *clone) run(sub string, env []string, want int, args ...string) string {
+	c.e.t.Helper()
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = filepath.Join(c.dir, sub)
+	cmd.Env = append(c.e.environ(), env...)
+	out, err := cmd.CombinedOutput()
+
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		c.e.t.Fatalf("%s: failed to run git-autosync: %v", c.name, err)
+	}
+	if code != want {
+		c.e.t.Fatalf("%s: expected exit code %d, got %d\n%s", c.name, want, code, out)
+	}
+	return string(out)
+}
+
+// daemon 在克隆中后台运行的 git-autosync 守护进程
+// A git-autosync daemon running in the background in a clone
+type daemon struct {
+	c    *clone
+	cmd  *exec.Cmd
+	out  *lockedBuffer
+	done chan struct{}
+}
+
+// start 在克隆中启动守护进程，测试结束时强制结束
+// Starts the daemon in the clone; it is killed when the test ends
+func (c *clone) start(args ...string) *daemon {
+	c.e.t.Helper()
+	d := &daemon{c: c, cmd: exec.Command(binary, args...), out: &lockedBuffer{}, done: make(chan struct{})}
+	d.cmd.Dir = c.dir
+	d.cmd.Env = c.e.environ()
+	d.cmd.Stdout, d.cmd.Stderr = d.out, d.out
+	if err := d.cmd.Start(); err != nil {
+		c.e.t.Fatalf("%s: failed to start git-autosync: %v", c.name, err)
+	}
+	go func() {
+		d.cmd.Wait()
+		close(d.done)
+	}()
+	c.e.t.Cleanup(func() {
+		d.cmd.Process.Kill()
+		<-d.done
+	})
+	return d
+}
+
+// waitFor 等待输出中出现 n 次 text，超时或进程退出时终止测试
+// Waits until text appears n times in the output; the test fails on timeout or when the process exits
+func (d *daemon) waitFor(text string, n int) {
+	d.c.e.t.Helper()
+	deadline := time.After(60 * time.Second)
+	for strings.Count(d.out.String(), text) < n {
+		select {
+		case <-d.done:
+			if strings.Count(d.out.String(), text) >= n {
+				return
+			}
+			d.c.e.t.Fatalf("%s: git-autosync exited while waiting for %q:\n%s", d.c.name, text, d.out)
+		case <-deadline:
+			d.c.e.t.Fatalf("%s: timed out waiting for %q:\n%s", d.c.name, text, d.out)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// signal 向守护进程发送信号 / Sends a signal to the daemon
+func (d *daemon) signal(sig os.Signal) {
+	d.c.e.t.Helper()
+	if err := d.cmd.Process.Signal(sig); err != nil {
+		d.c.e.t.Fatalf("%s: failed to send %v: %v", d.c.name, sig, err)
+	}
+}
+
+// lockedBuffer 可以并发写入和读取的输出缓冲区
+// Output buffer that may be written and read concurrently
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write 实现 io.Writer / Implements io.Writer
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// String 返回目前的输出 / Returns the output so far
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// git 在克隆中运行 git / Runs git in the clone
+func (c *clone) git(args ...string) string {
+	c.e.t.Helper()
+	return c.e.git(c.dir, args...)
+}
+
+// write 写入克隆中的文件（自动创建目录）/ Writes a file in the clone, creating directories
+func (c *clone) write(path, content string) {
+	c.e.t.Helper()
+	writeFile(c.e.t, filepath.Join(c.dir, path), content)
+}
+
+// read 读取克隆中的文件，不存在时返回空字符串和 false
+// Reads a file in the clone, returning "" and false when it does not exist
+func (c *clone) read(path string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, path))
+	return string(data), err == nil
+}
+
+// remove 删除克隆中的文件 / Removes a file in the clone
+func (c *clone) remove(path string) {
+	c.e.t.Helper()
+	if err := os.Remove(filepath.Join(c.dir, path)); err != nil {
+		c.e.t.Fatal(err)
+	}
+}
+
+// head 本地分支的提交 / Commit of the local branch
+func (c *clone) head() string {
+	c.e.t.Helper()
+	return c.git("rev-parse", "HEAD")
+}
+
+// inHead 路径是否存在于 HEAD 的树中 / Whether a path exists in HEAD's tree
+func (c *clone) inHead(path string) bool {
+	c.e.t.Helper()
+	return c.git("ls-tree", "--name-only", "HEAD", "--", path) != ""
+}
+
+// remoteHead 远程仓库中 main 的提交 / Commit of main in the remote
+func (e *env) remoteHead() string {
+	e.t.Helper()
+	return e.git(e.remote, "rev-parse", "main")
+}
+
+// writeFile 写入文件并创建目录 / Writes a file, creating its directories
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// appendFile 向文件追加内容 / Appends content to a file
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
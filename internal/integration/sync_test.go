@@ -0,0 +1,471 @@
+// sync_test.go - End-to-end sync scenarios / 端到端同步场景
+//
+// Module: integration
+// Description: Two clones of one bare remote run real sync cycles: concurrent edits, a dry-run fetch, lock file
+//              conflicts, deletions, ignored-file cleanup, size thresholds, encrypted large files, special repositories,
+//              the merge failure strategies, rebase mode and config layering
+// Author: git-autosync contributors
+// Dependencies: os, os/exec, path/filepath, strings, testing
+
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConcurrentEdits tests that edits to different files in both clones are merged and reach both sides
+// 测试两个克隆中对不同文件的修改被合并并同步到双方
+func TestConcurrentEdits(t *testing.T) {
+	e := newEnv(t)
+	a, b := e.clone("a"), e.clone("b")
+
+	a.write("notes/a.txt", "from a\n")
+	b.write("notes/b.txt", "from b\n")
+
+	a.sync(exitSynced)
+	b.sync(exitSynced) // 分叉后合并 / Diverged, merged
+	a.sync(exitSynced) // 快进 / Fast-forward
+
+	for _, c := range []*clone{a, b} {
+		for path, want := range map[string]string{"notes/a.txt": "from a\n", "notes/b.txt": "from b\n"} {
+			if got, _ := c.read(path); got != want {
+				t.Errorf("%s: expected %s to be %q, got %q", c.name, path, want, got)
+			}
+		}
+	}
+	if a.head() != e.remoteHead() || b.head() != e.remoteHead() {
+		t.Errorf("Expected both clones at the remote head %s, got a=%s b=%s", e.remoteHead(), a.head(), b.head())
+	}
+	if parents := strings.Fields(b.git("log", "-1", "--format=%P")); len(parents) != 2 {
+		t.Errorf("Expected a merge commit at the head, got parents %v", parents)
+	}
+
+	a.sync(exitNothingToDo)
+}
+
+// TestDryRunFetch tests that a dry-run predicts the sync against the fetched remote branch without moving the
+// remote-tracking ref or writing FETCH_HEAD
+// 测试演练根据获取的远程分支预测同步结果，但不移动远程追踪分支，也不写入 FETCH_HEAD
+func TestDryRunFetch(t *testing.T) {
+	e := newEnv(t)
+	a, b := e.clone("a"), e.clone("b")
+
+	b.write("notes/b.txt", "from b\n")
+	b.sync(exitSynced)
+
+	tracking := a.git("rev-parse", "refs/remotes/origin/main")
+	fetchHead := filepath.Join(a.dir, ".git", "FETCH_HEAD")
+	before, _ := os.ReadFile(fetchHead)
+
+	out := a.run("", nil, exitSynced, "-dry-run", "once")
+	if !strings.Contains(out, "[fast-forward]") {
+		t.Errorf("Expected a planned fast-forward, got:\n%s", out)
+	}
+	if got := a.git("rev-parse", "refs/remotes/origin/main"); got != tracking {
+		t.Errorf("Expected origin/main to stay at %s, got %s", tracking, got)
+	}
+	if after, _ := os.ReadFile(fetchHead); string(after) != string(before) {
+		t.Errorf("Expected FETCH_HEAD to be left alone, got %q", after)
+	}
+	if _, ok := a.read("notes/b.txt"); ok {
+		t.Error("Expected the working tree to be left alone")
+	}
+}
+
+// TestLockFileConflict tests that conflicting lock files are resolved with the remote version under every merge
+// failure strategy and in rebase mode
+// 测试在每种合并失败策略和变基模式下，冲突的锁文件都使用远程版本解决
+func TestLockFileConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		conf []string
+	}{
+		{"default", nil},
+		{"rollback", []string{"merge_failure_strategy = rollback"}},
+		{"keep-both", []string{"merge_failure_strategy = keep-both"}},
+		{"conflict-branch", []string{"merge_failure_strategy = conflict-branch"}},
+		{"rebase", []string{"sync_mode = rebase", "merge_failure_strategy = rollback"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			a, b := e.clone("a"), e.clone("b", tt.conf...)
+
+			a.write("package-lock.json", "{\"lockfileVersion\": 1}\n")
+			a.sync(exitSynced)
+			b.sync(exitSynced)
+
+			a.write("package-lock.json", "{\"lockfileVersion\": 2}\n")
+			b.write("package-lock.json", "{\"lockfileVersion\": 3}\n")
+			a.sync(exitSynced)
+			b.sync(exitSynced)
+
+			if got, _ := b.read("package-lock.json"); got != "{\"lockfileVersion\": 2}\n" {
+				t.Errorf("Expected the remote lock file to win, got %q", got)
+			}
+			if b.head() != e.remoteHead() {
+				t.Errorf("Expected the merge to be pushed")
+			}
+			if out := b.git("status", "--porcelain", "--", "package-lock.json"); out != "" {
+				t.Errorf("Expected package-lock.json to be clean, got %q", out)
+			}
+		})
+	}
+}
+
+// TestDeletedFiles tests that a deletion is committed and reaches the other clone
+// 测试删除被提交并同步到另一个克隆
+func TestDeletedFiles(t *testing.T) {
+	e := newEnv(t)
+	a, b := e.clone("a"), e.clone("b")
+
+	a.write("docs/old.md", "obsolete\n")
+	a.sync(exitSynced)
+	b.sync(exitSynced)
+	if _, ok := b.read("docs/old.md"); !ok {
+		t.Fatal("Expected docs/old.md to reach clone b")
+	}
+
+	a.remove("docs/old.md")
+	a.sync(exitSynced)
+	b.sync(exitSynced)
+
+	if a.inHead("docs/old.md") {
+		t.Error("Expected the deletion to be committed")
+	}
+	if _, ok := b.read("docs/old.md"); ok {
+		t.Error("Expected docs/old.md to be deleted in clone b")
+	}
+}
+
+// TestIgnoredFileCleanup tests that tracked files matching a new .gitignore rule are untracked but kept on disk
+// 测试匹配新 .gitignore 规则的已追踪文件被取消追踪但保留在磁盘上
+func TestIgnoredFileCleanup(t *testing.T) {
+	e := newEnv(t)
+	a := e.clone("a")
+
+	a.write("debug.log", "noise\n")
+	a.git("add", "debug.log")
+	a.git("commit", "-q", "-m", "track log")
+
+	a.write(".gitignore", ".gitignore_nopush\n*.log\n")
+	a.sync(exitSynced)
+
+	if a.inHead("debug.log") {
+		t.Error("Expected debug.log to be untracked")
+	}
+	if _, ok := a.read("debug.log"); !ok {
+		t.Error("Expected debug.log to stay on disk")
+	}
+	if a.head() != e.remoteHead() {
+		t.Error("Expected the cleanup to be pushed")
+	}
+}
+
+// TestSizeThresholds tests the LFS and ignore thresholds with scaled-down sizes
+// 测试缩小后的 LFS 和忽略大小阈值
+func TestSizeThresholds(t *testing.T) {
+	e := newEnv(t)
+	a := e.clone("a", "lfs_size_threshold_bytes = 1024", "ignore_size_threshold_bytes = 8192")
+
+	a.write("small.txt", "small\n")
+	a.write("medium.bin", strings.Repeat("m", 4096))
+	a.write("huge.bin", strings.Repeat("h", 16384))
+	a.sync(exitSynced)
+
+	if !a.inHead("small.txt") || !a.inHead("medium.bin") {
+		t.Error("Expected small.txt and medium.bin to be committed")
+	}
+	if a.inHead("huge.bin") {
+		t.Error("Expected huge.bin to be left out of the commit")
+	}
+	if ignored, _ := a.read(".gitignore_nopush"); !strings.Contains(ignored, "huge.bin") {
+		t.Errorf("Expected huge.bin in .gitignore_nopush, got %q", ignored)
+	}
+
+	msg := a.git("log", "-1", "--format=%B")
+	if !strings.Contains(msg, "medium.bin") || !strings.Contains(msg, "huge.bin") {
+		t.Errorf("Expected the commit message to mention the LFS and ignored files, got:\n%s", msg)
+	}
+	if realLFS {
+		if attrs, _ := a.read(".gitattributes"); !strings.Contains(attrs, "medium.bin") || !strings.Contains(attrs, "filter=lfs") {
+			t.Errorf("Expected medium.bin to be tracked by LFS, got .gitattributes %q", attrs)
+		}
+	}
+}
+
+// TestEncryptedLargeFile tests that an encrypted file above the LFS threshold is stored as ciphertext instead of
+// going to LFS, even when an earlier filter=lfs line for the same paths follows the encryption attributes
+// 测试超过 LFS 阈值的加密文件以密文存储而不交给 LFS，即使加密属性之后已有同一路径的 filter=lfs 行
+func TestEncryptedLargeFile(t *testing.T) {
+	e := newEnv(t)
+	key := filepath.Join(e.root, "autosync.key")
+	a := e.clone("a", "lfs_size_threshold_bytes = 1024", "encrypt_patterns = secret/**", "encrypt_key_file = "+key)
+	a.run("", nil, exitNothingToDo, "filter", "keygen", "-key", key)
+
+	// lfs_track_patterns 在加密注册之后追加的行 / A line appended by lfs_track_patterns after encryption was registered
+	a.write(".gitattributes", "secret/** filter=autosync-crypt\nsecret/** filter=lfs diff=lfs merge=lfs -text\n")
+	a.write("secret/big.txt", strings.Repeat("TOPSECRET\n", 512))
+	a.sync(exitSynced)
+
+	if got := a.git("check-attr", "filter", "--", "secret/big.txt"); got != "secret/big.txt: filter: autosync-crypt" {
+		t.Errorf("Expected secret/big.txt to resolve to the encryption filter, got %q", got)
+	}
+	if attrs, _ := a.read(".gitattributes"); strings.Contains(attrs, "big.txt") || !strings.HasSuffix(attrs, "secret/** filter=autosync-crypt\n") {
+		t.Errorf("Expected the encryption attributes last and no LFS line for the file, got %q", attrs)
+	}
+	blob := e.git(e.remote, "cat-file", "blob", "main:secret/big.txt")
+	if strings.Contains(blob, "TOPSECRET") || !strings.HasPrefix(blob, "\x00GASENC1") {
+		t.Errorf("Expected ciphertext in the remote, got %q", blob[:32])
+	}
+	if got, _ := a.read("secret/big.txt"); got != strings.Repeat("TOPSECRET\n", 512) {
+		t.Error("Expected the working tree to keep the plaintext")
+	}
+}
+
+// TestSpecialRepo tests that a nested repository is committed as gitdir/ and can be restored in the other clone
+// 测试嵌套仓库以 gitdir/ 提交，并能在另一个克隆中恢复
+func TestSpecialRepo(t *testing.T) {
+	e := newEnv(t)
+	a, b := e.clone("a"), e.clone("b")
+
+	nested := filepath.Join(a.dir, "data", "git", "proj")
+	e.git(e.root, "init", "-q", "--initial-branch=main", nested)
+	writeFile(t, filepath.Join(nested, "main.go"), "package main\n")
+	e.git(nested, "add", "-A")
+	e.git(nested, "commit", "-q", "-m", "nested")
+	nestedHead := e.git(nested, "rev-parse", "HEAD")
+
+	a.sync(exitSynced)
+	if !a.inHead("data/git/proj/gitdir/HEAD") || !a.inHead("data/git/proj/main.go") {
+		t.Fatalf("Expected the nested repository and its gitdir to be committed, tree:\n%s",
+			a.git("ls-tree", "-r", "--name-only", "HEAD", "--", "data/git/proj"))
+	}
+	if a.inHead("data/git/proj/.git") {
+		t.Error("Expected the nested .git itself not to be committed")
+	}
+
+	b.sync(exitSynced)
+	restore := exec.Command(binary, "subrepo", "restore", "data/git/proj")
+	restore.Dir = b.dir
+	restore.Env = e.environ()
+	if out, err := restore.CombinedOutput(); err != nil {
+		t.Fatalf("subrepo restore failed: %v\n%s", err, out)
+	}
+	if got := e.git(filepath.Join(b.dir, "data", "git", "proj"), "rev-parse", "HEAD"); got != nestedHead {
+		t.Errorf("Expected the restored repository at %s, got %s", nestedHead, got)
+	}
+}
+
+// TestMergeFailureStrategies tests every merge failure strategy, in merge and rebase mode, when both clones change
+// the same lines
+// 测试两个克隆修改同一行时，每种合并失败策略在合并模式和变基模式下的结果
+func TestMergeFailureStrategies(t *testing.T) {
+	conflict := func(t *testing.T, want int, conf ...string) (*env, *clone, *clone) {
+		e := newEnv(t)
+		a, b := e.clone("a"), e.clone("b", conf...)
+		a.write("notes.txt", "shared\n")
+		a.sync(exitSynced)
+		b.sync(exitSynced)
+
+		a.write("notes.txt", "edited in a\n")
+		b.write("notes.txt", "edited in b\n")
+		a.sync(exitSynced)
+		b.sync(want)
+		return e, a, b
+	}
+
+	t.Run("force-push", func(t *testing.T) {
+		e, a, b := conflict(t, exitSynced, "merge_failure_strategy = force-push")
+		aHead := a.head()
+
+		if b.head() != e.remoteHead() {
+			t.Errorf("Expected clone b to overwrite the remote, remote %s, b %s", e.remoteHead(), b.head())
+		}
+		backups := e.git(e.remote, "for-each-ref", "--format=%(objectname)", "refs/autosync-backup/")
+		if backups != aHead {
+			t.Errorf("Expected the overwritten commit %s to be backed up, got %q", aHead, backups)
+		}
+		if got, _ := b.read("notes.txt"); got != "edited in b\n" {
+			t.Errorf("Expected clone b to keep its version, got %q", got)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		e, a, b := conflict(t, exitConflictRolledBack, "merge_failure_strategy = rollback")
+		expectRolledBack(t, e, a, b)
+		if _, err := os.Stat(filepath.Join(b.dir, ".git", "MERGE_HEAD")); err == nil {
+			t.Error("Expected no merge in progress")
+		}
+	})
+
+	t.Run("keep-both", func(t *testing.T) {
+		e, a, b := conflict(t, exitSynced, "merge_failure_strategy = keep-both")
+		expectBothKept(t, e, a, b)
+		if parents := strings.Fields(b.git("log", "-1", "--format=%P")); len(parents) != 2 {
+			t.Errorf("Expected a merge commit at the head, got parents %v", parents)
+		}
+	})
+
+	t.Run("conflict-branch", func(t *testing.T) {
+		e, a, b := conflict(t, exitConflictBranch, "merge_failure_strategy = conflict-branch")
+		bHead := b.head()
+
+		if e.remoteHead() != a.head() {
+			t.Error("Expected the remote branch to be left untouched")
+		}
+		branches := strings.Fields(e.git(e.remote, "for-each-ref", "--format=%(refname)", "refs/heads/autosync-conflict/"))
+		if len(branches) != 1 {
+			t.Fatalf("Expected one conflict branch on the remote, got %v", branches)
+		}
+		if got := e.git(e.remote, "show", branches[0]+":notes.txt"); got != "edited in b" {
+			t.Errorf("Expected the conflict branch to hold clone b's version, got %q", got)
+		}
+		if got, _ := b.read("notes.txt"); got != "edited in b\n" || b.head() != bHead {
+			t.Errorf("Expected clone b to keep its own commit, got %q at %s", got, b.head())
+		}
+	})
+
+	t.Run("rebase rollback", func(t *testing.T) {
+		e, a, b := conflict(t, exitConflictRolledBack, "sync_mode = rebase", "merge_failure_strategy = rollback")
+		expectRolledBack(t, e, a, b)
+		for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+			if _, err := os.Stat(filepath.Join(b.dir, ".git", dir)); err == nil {
+				t.Errorf("Expected no rebase in progress, found .git/%s", dir)
+			}
+		}
+	})
+
+	t.Run("rebase keep-both", func(t *testing.T) {
+		e, a, b := conflict(t, exitSynced, "sync_mode = rebase", "merge_failure_strategy = keep-both")
+		expectBothKept(t, e, a, b)
+		if got := b.git("rev-parse", "HEAD~1"); got != a.head() {
+			t.Errorf("Expected clone b's commit to be rebased onto %s, parent is %s", a.head(), got)
+		}
+	})
+}
+
+// expectRolledBack 检查冲突回滚后远程未变、克隆 b 回到自己的版本并保留备份分支
+// Checks that after a rolled-back conflict the remote is unchanged and clone b is back at its own version with the
+// backup branch kept
+func expectRolledBack(t *testing.T, e *env, a, b *clone) {
+	t.Helper()
+	if e.remoteHead() != a.head() {
+		t.Error("Expected the remote to be left untouched")
+	}
+	if got, _ := b.read("notes.txt"); got != "edited in b\n" {
+		t.Errorf("Expected clone b to be rolled back to its own version, got %q", got)
+	}
+	if out := b.git("status", "--porcelain", "--untracked-files=no"); out != "" {
+		t.Errorf("Expected a clean working tree after rollback, got %q", out)
+	}
+	if branches := b.git("branch", "--list", "backup-before-merge-*"); branches == "" {
+		t.Error("Expected the backup branch to be kept for manual resolution")
+	}
+}
+
+// expectBothKept 检查 keep-both 后克隆 b 保留自己的版本、远程版本写入冲突副本，并且结果已推送
+// Checks that after keep-both clone b keeps its own version, the remote version is written to a conflict copy and
+// the result is pushed
+func expectBothKept(t *testing.T, e *env, a, b *clone) {
+	t.Helper()
+	if got, _ := b.read("notes.txt"); got != "edited in b\n" {
+		t.Errorf("Expected clone b to keep its version, got %q", got)
+	}
+	copies, _ := filepath.Glob(filepath.Join(b.dir, "notes.conflict-*.txt"))
+	if len(copies) != 1 {
+		t.Fatalf("Expected one conflict copy, got %v", copies)
+	}
+	if data, _ := os.ReadFile(copies[0]); string(data) != "edited in a\n" {
+		t.Errorf("Expected the conflict copy to hold the remote version, got %q", data)
+	}
+	if b.head() != e.remoteHead() {
+		t.Errorf("Expected the result to be pushed, remote %s, b %s", e.remoteHead(), b.head())
+	}
+	if !b.inHead(filepath.Base(copies[0])) {
+		t.Error("Expected the conflict copy to be committed")
+	}
+}
+
+// TestRebaseSync tests that sync_mode=rebase keeps history linear for auto-sync commits and falls back to a merge
+// commit when the local branch has a human commit
+// 测试 sync_mode=rebase 对自动同步提交保持线性历史，本地有人工提交时改用合并提交
+func TestRebaseSync(t *testing.T) {
+	setup := func(t *testing.T) (*env, *clone, *clone) {
+		e := newEnv(t)
+		a, b := e.clone("a"), e.clone("b", "sync_mode = rebase")
+		a.write("notes/a.txt", "from a\n")
+		a.sync(exitSynced)
+		return e, a, b
+	}
+
+	t.Run("auto-sync commits", func(t *testing.T) {
+		e, a, b := setup(t)
+		b.write("notes/b.txt", "from b\n")
+		b.sync(exitSynced)
+
+		if got := b.git("rev-parse", "HEAD~1"); got != a.head() {
+			t.Errorf("Expected clone b's commit on top of %s, parent is %s", a.head(), got)
+		}
+		if parents := strings.Fields(b.git("log", "-1", "--format=%P")); len(parents) != 1 {
+			t.Errorf("Expected no merge commit, got parents %v", parents)
+		}
+		if b.head() != e.remoteHead() {
+			t.Error("Expected the rebase result to be pushed")
+		}
+	})
+
+	t.Run("human commit", func(t *testing.T) {
+		e, a, b := setup(t)
+		b.write("notes/b.txt", "from b\n")
+		b.git("add", "notes/b.txt")
+		b.git("commit", "-q", "-m", "Write notes by hand")
+		human := b.head()
+		b.sync(exitSynced)
+
+		parents := strings.Fields(b.git("log", "-1", "--format=%P"))
+		if len(parents) != 2 || parents[0] != human || parents[1] != a.head() {
+			t.Errorf("Expected a merge of the untouched human commit %s and %s, got parents %v", human, a.head(), parents)
+		}
+		if b.head() != e.remoteHead() {
+			t.Error("Expected the merge to be pushed")
+		}
+	})
+}
+
+// TestConfigLayers tests that a sync started from a subdirectory reads the repository config, and that the local
+// .git/ config, environment variables and -set flags are layered on top of it
+// 测试在子目录中启动的同步读取仓库配置，并在其上叠加 .git/ 本地配置、环境变量和 -set 参数
+func TestConfigLayers(t *testing.T) {
+	e := newEnv(t)
+	a := e.clone("a", "commit_msg_prefix = repo:")
+	writeFile(t, filepath.Join(a.dir, ".git", "git_sync.conf"), "commit_msg_prefix = local:\nignore_file_name = .local_ignore\n")
+
+	a.write("docs/readme.txt", "hello\n")
+	a.run("docs", []string{"GIT_AUTOSYNC_COMMIT_MSG_PREFIX=env:"}, exitSynced, "-set", "commit_stat_lines=0", "once")
+
+	if subject := a.git("log", "-1", "--format=%s"); !strings.HasPrefix(subject, "env:") {
+		t.Errorf("Expected the environment prefix to win, got %q", subject)
+	}
+	if body := a.git("log", "-1", "--format=%b"); strings.Contains(body, "readme.txt |") {
+		t.Errorf("Expected -set commit_stat_lines=0 to omit the stat, got %q", body)
+	}
+
+	out := a.run("docs", nil, 0, "config", "show")
+	for _, want := range []string{
+		filepath.Join(a.dir, ".git", "git_sync.conf") + ":1",
+		filepath.Join(a.dir, "git_sync.conf") + ":2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected config show to report source %s, got:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, ".local_ignore") {
+		t.Errorf("Expected the local ignore_file_name in config show, got:\n%s", out)
+	}
+}
@@ -169,7 +169,7 @@ func (l *Logger) Phase(format string, args ...interface{}) {
 	
 	// 终端输出 (带颜色)
 	// Terminal output (with color)
-	fmt.Println(l.colorize(ColorCyan, "--- "+msg+" ---"))
+	fmt.Fprintln(l.output, l.colorize(ColorCyan, "--- "+msg+" ---"))
 	
 	// 文件输出 (纯文本)
 	// File output (plain text)
@@ -191,7 +191,7 @@ func (l *Logger) Timestamp(format string, args ...interface{}) {
 	
 	// 终端输出 (带颜色)
 	// Terminal output (with color)
-	fmt.Println(l.colorize(ColorGreen, fmt.Sprintf("[%s] %s", timestamp, msg)))
+	fmt.Fprintln(l.output, l.colorize(ColorGreen, fmt.Sprintf("[%s] %s", timestamp, msg)))
 	
 	// 文件输出 (纯文本)
 	// File output (plain text)
@@ -0,0 +1,254 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+)
+
+// compactMaxCommits 一次压缩最多检查的提交数
+// Maximum number of commits inspected by one compaction run
+const compactMaxCommits = 20000
+
+// compactCommit 压缩链上的一个提交
+// A commit on the compaction chain
+type compactCommit struct {
+	git.CommitInfo
+	pushed bool // 已在远程分支中 / Already on the remote branch
+}
+
+// CompactHistory 把连续的自动同步提交按小时或按天压缩为一个提交，返回减少的提交数
+// Squashes consecutive auto-sync commits into hourly or daily commits and returns how many commits were removed
+// 从 HEAD 沿第一父提交向下，遇到人工提交、合并提交或不允许重写的已推送提交即停止，之前的历史保持不变；
+// 只压缩已经结束的小时/天。新提交沿用原提交的树，索引和工作区不受影响
+// Walks first parents down from HEAD and stops at a human commit, a merge commit or a pushed commit that may not be
+// rewritten, leaving everything before it untouched; only finished hours/days are squashed. The new commits reuse
+// the original trees, so the index and working tree are not affected
+func (mm *MergeManager) CompactHistory(now time.Time) (int, error) {
+	mm.logger.Phase("压缩自动同步历史 / Compacting auto-sync history")
+
+	head, err := mm.gitOps.GetRevision("HEAD")
+	if err != nil {
+		return 0, err
+	}
+	remoteRef := mm.gitOps.RemoteBranchRef()
+	remote, remoteErr := mm.gitOps.GetRevision(remoteRef)
+	if remoteErr == nil && remote != head {
+		if base, err := mm.gitOps.GetMergeBase("HEAD", remoteRef); err != nil || base != remote {
+			mm.logger.Info("本地与远程已分叉，跳过压缩 / Local and remote have diverged, skipping compaction")
+			return 0, nil
+		}
+	}
+
+	chain, boundary, err := mm.compactChain(remote, now)
+	if err != nil {
+		return 0, err
+	}
+	groups := compactGroups(chain, mm.cfg.CompactGranularity, now)
+
+	// 在不允许重写的已推送提交处停止时，最旧的组可能只是该小时/天的一部分；
+	// 压缩它会让这个时间段永远分成两段，因此保持不变
+	// When the chain stops at a pushed commit that may not be rewritten, the oldest group may hold only part of its
+	// hour/day; squashing it would leave that period split for good, so it is left alone
+	layout := compactLayout(mm.cfg.CompactGranularity)
+	if boundary != nil && len(groups) > 0 && groups[0].key == boundary.AuthorTime.Format(layout) {
+		mm.logger.Debug("  %s 只有部分提交可以重写，跳过 / Only part of %s may be rewritten, skipping it", groups[0].key, groups[0].key)
+		groups = groups[1:]
+	}
+
+	// 第一个需要压缩的组之前的提交保持不变
+	// Commits before the first group that needs squashing stay as they are
+	first := -1
+	for i, g := range groups {
+		if g.squash {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		mm.logger.Info("没有需要压缩的提交 / No commits to compact")
+		return 0, nil
+	}
+	groups = groups[first:]
+
+	removed, rewritesPushed := 0, false
+	for _, g := range groups {
+		if g.squash {
+			removed += len(g.commits) - 1
+		}
+		for _, c := range g.commits {
+			rewritesPushed = rewritesPushed || c.pushed
+		}
+	}
+	mm.logger.Info("压缩 %d 个自动同步提交 / Compacting %d auto-sync commits", removed, removed)
+
+	if mm.gitOps.DryRun() {
+		p := mm.gitOps.Plan()
+		for _, g := range groups {
+			if g.squash {
+				p.Record(plan.ActionCompact, g.key, fmt.Sprintf("squash %d commits", len(g.commits)))
+			}
+		}
+		if rewritesPushed {
+			p.Record(plan.ActionPush, mm.cfg.RemoteName+" "+git.RemoteBackupPrefix+"<timestamp>", "old remote tip")
+			p.Record(plan.ActionForcePush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, "compacted history")
+		} else {
+			p.Record(plan.ActionPush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, "compacted history")
+		}
+		return removed, nil
+	}
+
+	// 逐组重建提交：压缩组合并为一个提交，其余提交原样重放
+	// Rebuild commits group by group: squash groups become one commit, other commits are replayed as they are
+	parent := groups[0].commits[0].Parents[0]
+	for _, g := range groups {
+		if mm.interrupted() {
+			return 0, fmt.Errorf("compaction interrupted: %w", mm.gitOps.Context().Err())
+		}
+		if g.squash {
+			last := g.commits[len(g.commits)-1]
+			parent, err = mm.gitOps.CreateCommit(last.Tree, parent, last.CommitInfo, mm.compactMessage(g))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		for _, c := range g.commits {
+			parent, err = mm.gitOps.CreateCommit(c.Tree, parent, c.CommitInfo, c.Message)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	newHead := parent
+
+	// 与合并相同的备份机制：先创建本地备份分支，由 CleanupOldBackups 按数量清理
+	// Same backup mechanism as merges: a local backup branch is created first and pruned by CleanupOldBackups
+	backupBranch := fmt.Sprintf("backup-before-compact-%s", now.Format("20060102-150405"))
+	if err := mm.gitOps.CreateBranch(backupBranch); err != nil {
+		return 0, fmt.Errorf("failed to create backup branch: %w", err)
+	}
+	mm.logger.Debug("→ 已创建备份分支: %s / Backup branch created: %s", backupBranch, backupBranch)
+
+	if err := mm.gitOps.UpdateRef("HEAD", newHead, head, "git-autosync: compact history"); err != nil {
+		return 0, err
+	}
+
+	if rewritesPushed {
+		// 强制推送带租约，并先把远程原来的提交备份到 refs/autosync-backup/*
+		// The force push carries a lease and first backs up the old remote tip to refs/autosync-backup/*
+		if err := mm.gitOps.ForcePush(); err != nil {
+			mm.logger.Error("强制推送压缩后的历史失败，恢复原历史 / Force pushing compacted history failed, restoring original history: %v", err)
+			if rerr := mm.gitOps.UpdateRef("HEAD", head, newHead, "git-autosync: restore after failed compaction"); rerr != nil {
+				return 0, fmt.Errorf("force push failed: %v; restore failed, backup branch %s: %w", err, backupBranch, rerr)
+			}
+			return 0, fmt.Errorf("force push failed: %w", err)
+		}
+		if err := mm.CleanupOldRemoteBackups(mm.cfg.MaxRemoteBackups); err != nil {
+			mm.logger.Warn("清理远程备份引用失败 / Failed to cleanup remote backup refs: %v", err)
+		}
+	} else if err := mm.gitOps.Push(); err != nil {
+		mm.logger.Warn("推送失败，将在下个周期重试 / Push failed, will retry next cycle: %v", err)
+	}
+
+	mm.logger.Info("✓ 已压缩 %d 个提交 / Compacted %d commits (备份分支 / backup branch: %s)", removed, removed, backupBranch)
+	return removed, nil
+}
+
+// compactChain 从 HEAD 沿第一父提交收集可重写的自动同步提交，按从旧到新排列
+// Collects the rewritable auto-sync commits along first parents from HEAD, ordered oldest first
+// 链在不允许重写的已推送提交处停止时同时返回该提交，否则返回 nil
+// Also returns the pushed commit that may not be rewritten when the chain stops there, nil otherwise
+func (mm *MergeManager) compactChain(remote string, now time.Time) ([]compactCommit, *git.CommitInfo, error) {
+	commits, err := mm.gitOps.FirstParentLog("HEAD", compactMaxCommits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var chain []compactCommit
+	var boundary *git.CommitInfo
+	pushed := false
+	for i, c := range commits {
+		if c.Hash == remote {
+			pushed = true
+		}
+		if pushed && (mm.cfg.CompactPushedWindow <= 0 || c.CommitTime.Before(now.Add(-mm.cfg.CompactPushedWindow))) {
+			boundary = &commits[i]
+			break
+		}
+		if len(c.Parents) != 1 {
+			break
+		}
+		if !mm.isAutoSyncCommit(c.Message) {
+			mm.logger.Debug("  遇到人工提交，停止 / Stopping at human commit: %s", strings.SplitN(c.Message, "\n", 2)[0])
+			break
+		}
+		chain = append(chain, compactCommit{CommitInfo: c, pushed: pushed})
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, boundary, nil
+}
+
+// isAutoSyncCommit 提交是否由自动同步创建（按提交信息判断，作者与人工提交相同无法区分）
+// Whether a commit was created by auto-sync (judged by its message, as the author is the same as for human commits)
+func (mm *MergeManager) isAutoSyncCommit(message string) bool {
+	subject := strings.SplitN(message, "\n", 2)[0]
+	if subject == autoCommitStagedMessage {
+		return true
+	}
+	return mm.cfg.CommitMsgPrefix != "" && strings.HasPrefix(subject, mm.cfg.CommitMsgPrefix)
+}
+
+// compactGroup 同一小时/天内连续的自动同步提交
+// Consecutive auto-sync commits within the same hour/day
+type compactGroup struct {
+	key     string // 时间段，例如 "2025-12-07 14:00" 或 "2025-12-07" / Period, e.g. "2025-12-07 14:00" or "2025-12-07"
+	commits []compactCommit
+	squash  bool // 时间段已结束且有多个提交 / The period has ended and holds several commits
+}
+
+// compactLayout 压缩粒度对应的时间段格式，同一时间段的时间格式化结果相同
+// Time layout of the compaction granularity; times within one period format the same
+func compactLayout(granularity string) string {
+	if granularity == config.CompactHourly {
+		return "2006-01-02 15:00"
+	}
+	return "2006-01-02"
+}
+
+// compactGroups 按作者时间所在的小时/天把提交分组
+// Groups commits by the hour/day of their author time
+func compactGroups(chain []compactCommit, granularity string, now time.Time) []compactGroup {
+	layout := compactLayout(granularity)
+	current := now.Format(layout)
+
+	var groups []compactGroup
+	for _, c := range chain {
+		key := c.AuthorTime.Format(layout)
+		if n := len(groups); n > 0 && groups[n-1].key == key {
+			groups[n-1].commits = append(groups[n-1].commits, c)
+			continue
+		}
+		groups = append(groups, compactGroup{key: key, commits: []compactCommit{c}})
+	}
+	for i := range groups {
+		groups[i].squash = groups[i].key != current && len(groups[i].commits) > 1
+	}
+	return groups
+}
+
+// compactMessage 压缩后提交的信息，沿用自动同步前缀以便之后按天再次压缩
+// Message of a squashed commit; it keeps the auto-sync prefix so hourly commits can later be squashed into days
+func (mm *MergeManager) compactMessage(g compactGroup) string {
+	first, last := g.commits[0], g.commits[len(g.commits)-1]
+	return fmt.Sprintf("%s Compacted %d commits of %s\n\nSquashed auto-sync commits from %s to %s / 已压缩的自动同步提交\n",
+		mm.cfg.CommitMsgPrefix, len(g.commits), g.key,
+		first.AuthorTime.Format("2006-01-02 15:04:05"), last.AuthorTime.Format("2006-01-02 15:04:05"))
+}
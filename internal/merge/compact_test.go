@@ -0,0 +1,127 @@
+// compact_test.go - History compaction unit tests / 历史压缩单元测试
+//
+// Module: merge
+// Description: Tests how auto-sync commits are grouped into hourly/daily squash groups, and the force push of a
+//              rewritten pushed history against a scripted git.FakeRunner
+// Author: git-autosync contributors
+// Dependencies: fmt, strings, testing, time, config, git
+
+package merge
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+// TestCompactGroups tests that only finished periods with several commits are squashed
+// 测试只有已结束且包含多个提交的时间段会被压缩
+func TestCompactGroups(t *testing.T) {
+	at := func(s string) compactCommit {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return compactCommit{CommitInfo: git.CommitInfo{AuthorTime: ts}}
+	}
+	chain := []compactCommit{
+		at("2025-12-07 10:05"), at("2025-12-07 10:40"),
+		at("2025-12-07 11:10"),
+		at("2025-12-08 09:00"), at("2025-12-08 09:30"),
+	}
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2025-12-08 09:45", time.Local)
+
+	hourly := compactGroups(chain, "hourly", now)
+	if len(hourly) != 3 {
+		t.Fatalf("Expected 3 hourly groups, got %d", len(hourly))
+	}
+	if !hourly[0].squash || hourly[0].key != "2025-12-07 10:00" {
+		t.Errorf("Expected the 10:00 group to be squashed, got %+v", hourly[0])
+	}
+	if hourly[1].squash {
+		t.Error("A single commit should not be squashed")
+	}
+	if hourly[2].squash {
+		t.Error("The current hour should not be squashed")
+	}
+
+	daily := compactGroups(chain, "daily", now)
+	if len(daily) != 2 || !daily[0].squash || len(daily[0].commits) != 3 || daily[1].squash {
+		t.Errorf("Expected the finished day to be squashed and today left alone, got %+v", daily)
+	}
+}
+
+// TestCompactHistory_ForcePush tests that rewriting pushed commits creates a backup branch, force pushes with a lease
+// on the old remote commit, and restores HEAD when the force push fails
+// 测试重写已推送的提交时创建备份分支、以远程原提交为租约强制推送，强制推送失败时恢复 HEAD
+func TestCompactHistory_ForcePush(t *testing.T) {
+	const (
+		human   = "4444444444444444444444444444444444444444"
+		first   = "5555555555555555555555555555555555555555"
+		pushed  = "6666666666666666666666666666666666666666"
+		head    = "7777777777777777777777777777777777777777"
+		newHead = "8888888888888888888888888888888888888888"
+	)
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2025-12-08 12:00", time.Local)
+	record := func(hash, parent, subject string, author time.Time) string {
+		return strings.Join([]string{hash, baseHash, parent, "a", "a@example.com",
+			fmt.Sprintf("%d +0000", author.Unix()), fmt.Sprint(now.Add(-time.Hour).Unix()), subject}, "\x1f") + "\x00"
+	}
+	at := func(clock string) time.Time {
+		ts, _ := time.ParseInLocation("2006-01-02 15:04", "2025-12-08 "+clock, time.Local)
+		return ts
+	}
+
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("push fails %v", fail), func(t *testing.T) {
+			mm, fake := newFakeMergeManager(t, "rollback")
+			mm.cfg.CompactGranularity = config.CompactHourly
+			mm.cfg.CompactPushedWindow = 24 * time.Hour
+			prefix := mm.cfg.CommitMsgPrefix
+
+			fake.On("rev-parse", "HEAD").Stdout(head + "\n")
+			fake.On("rev-parse", "origin/main").Stdout(pushed + "\n")
+			fake.On("merge-base", "HEAD", "origin/main").Stdout(pushed + "\n")
+			fake.On("rev-parse", "--verify", "--quiet").Stdout(pushed + "\n")
+			fake.On("log", "-z", "--first-parent").Stdout(
+				record(head, pushed, prefix+" 10:30", at("10:30")) +
+					record(pushed, first, prefix+" 10:20", at("10:20")) +
+					record(first, human, prefix+" 10:10", at("10:10")) +
+					record(human, baseHash, "Fix the parser", at("09:00")))
+			fake.On("commit-tree").Stdout(newHead + "\n")
+			if fail {
+				fake.On("push", "--force-with-lease=refs/heads/main:"+pushed).Fail(1, "! [rejected] main -> main (stale info)")
+			}
+
+			removed, err := mm.CompactHistory(now)
+			if fail != (err != nil) {
+				t.Fatalf("Expected error %v, got %v (calls: %v)", fail, err, fake.Calls())
+			}
+
+			want := []string{
+				"commit-tree " + baseHash + " -p " + human,
+				"branch backup-before-compact-20251208-120000",
+				"update-ref -m git-autosync: compact history HEAD " + newHead + " " + head,
+				"push origin " + pushed + ":refs/autosync-backup/",
+				"push --force-with-lease=refs/heads/main:" + pushed + " origin main",
+			}
+			if fail {
+				want = append(want, "update-ref -m git-autosync: restore after failed compaction HEAD "+head+" "+newHead)
+			} else if removed != 2 {
+				t.Errorf("Expected 2 commits removed, got %d", removed)
+			}
+			for _, w := range want {
+				if !hasCall(fake, w) {
+					t.Errorf("Expected %q to run, calls: %v", w, fake.Calls())
+				}
+			}
+			if fake.Count("commit-tree") != 1 {
+				t.Errorf("Expected one squashed commit, calls: %v", fake.Calls())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// conflictBranchPrefix 远程冲突分支的名称前缀，完整名称为 autosync-conflict/<host>/<timestamp>
+// Name prefix of remote conflict branches; the full name is autosync-conflict/<host>/<timestamp>
+const conflictBranchPrefix = "autosync-conflict/"
+
+// pushConflictBranch 把回滚后的本地状态推送到远程冲突分支（merge_failure_strategy=conflict-branch）
+// Pushes the rolled-back local state to a remote conflict branch (merge_failure_strategy=conflict-branch)
+// 推送的是在 HEAD 之上的一个空提交，提交信息记录冲突文件；同步分支保持不变，之后的周期继续尝试正常合并
+// What is pushed is an empty commit on top of HEAD whose message lists the conflicted files; the sync branch is left
+// untouched and later cycles keep retrying the normal merge
+func (mm *MergeManager) pushConflictBranch(conflicts []string) error {
+	head, err := mm.gitOps.GetRevision("HEAD")
+	if err != nil {
+		return err
+	}
+
+	host := conflictRefHostName()
+	prefix := conflictBranchPrefix + host + "/"
+	if existing := mm.pushedConflictBranch(prefix, head); existing != "" {
+		mm.logger.Info("本地状态已推送到冲突分支，跳过 / Local state already pushed to conflict branch, skipping: %s", existing)
+		return nil
+	}
+
+	now := time.Now()
+	remoteRef := fmt.Sprintf("%s/%s", mm.cfg.RemoteName, mm.cfg.BranchName)
+	remote, _ := mm.gitOps.GetRevision(remoteRef)
+	commit, err := mm.gitOps.CommitTree("HEAD", conflictBranchMessage(host, remoteRef, remote, conflicts, now))
+	if err != nil {
+		return err
+	}
+
+	branch := prefix + now.Format("20060102-150405")
+	if err := mm.gitOps.PushRef(commit, "refs/heads/"+branch); err != nil {
+		return err
+	}
+	mm.lastConflictHead, mm.lastConflictBranch = head, mm.cfg.RemoteName+"/"+branch
+
+	mm.logger.Info("✓ 本地状态已推送到冲突分支 / Local state pushed to conflict branch: %s/%s", mm.cfg.RemoteName, branch)
+	mm.logger.Info("远程分支 %s 保持不变 / Remote branch %s left untouched", mm.cfg.BranchName, mm.cfg.BranchName)
+	return nil
+}
+
+// pushedConflictBranch 查找已为同一本地状态推送过的冲突分支，未找到时返回空字符串
+// Looks for a conflict branch already pushed for the same local state and returns "" if there is none
+// 冲突分支会被常规 fetch 拉取为远程追踪分支；进程内还记录上一次推送，以覆盖只拉取同步分支的仓库
+// Regular fetches bring conflict branches in as remote-tracking branches; the last push is also remembered in process
+// to cover repositories that only fetch the sync branch
+func (mm *MergeManager) pushedConflictBranch(prefix, head string) string {
+	if head == mm.lastConflictHead {
+		return mm.lastConflictBranch
+	}
+	refs, err := mm.gitOps.ListRefs(fmt.Sprintf("refs/remotes/%s/%s", mm.cfg.RemoteName, prefix))
+	if err != nil {
+		return ""
+	}
+	for _, ref := range refs {
+		if ref.Parent == head {
+			return strings.TrimPrefix(ref.Name, "refs/remotes/")
+		}
+	}
+	return ""
+}
+
+// conflictBranchMessage 生成冲突分支提交的信息
+// Builds the message of the conflict branch commit
+func conflictBranchMessage(host, remoteRef, remote string, conflicts []string, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Auto-sync conflict: %s at %s\n\n", host, now.Format("2006-01-02 15:04:05"))
+	if remote != "" {
+		fmt.Fprintf(&b, "Unable to merge with %s (%s) / 无法与 %s 合并\n\n", remoteRef, remote, remoteRef)
+	}
+	if len(conflicts) == 0 {
+		b.WriteString("Conflicted files / 冲突文件: (unknown / 未知)\n")
+		return b.String()
+	}
+	b.WriteString("Conflicted files / 冲突文件:\n")
+	for _, f := range conflicts {
+		fmt.Fprintf(&b, "- %s\n", f)
+	}
+	return b.String()
+}
+
+// conflictRefHostName 返回可安全用于引用名的主机名
+// Returns the host name made safe for use in a ref name
+func conflictRefHostName() string {
+	host := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, conflictHostName())
+	if host == "" {
+		return "unknown"
+	}
+	return host
+}
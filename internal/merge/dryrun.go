@@ -0,0 +1,92 @@
+package merge
+
+import (
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+)
+
+// planDivergedMerge 演练模式下预测分叉合并的结果并记录决策
+// Predicts the outcome of a diverged merge in dry-run mode and records the decisions
+// 冲突通过 git merge-tree 在内存中计算，不触碰工作区、索引和分支
+// Conflicts are computed in memory via git merge-tree without touching the working tree, index or branches
+// sync_mode=rebase 时按整体合并预测冲突；逐个提交重放时实际冲突的文件可能略有不同
+// With sync_mode=rebase conflicts are predicted for the combined merge; replaying commit by commit may conflict on slightly different files
+func (mm *MergeManager) planDivergedMerge(remoteRef string) (MergeResult, error) {
+	p := mm.gitOps.Plan()
+
+	kind, detail, result := plan.ActionMerge, "three-way", "merge result"
+	if mm.cfg.SyncMode == config.SyncModeRebase && mm.canRebase(remoteRef) {
+		kind, detail, result = plan.ActionRebase, "rebase local commits", "rebase result"
+	}
+
+	conflicts, err := mm.gitOps.PredictMergeConflicts(remoteRef)
+	if err != nil {
+		mm.logger.Warn("[演练] 无法预测冲突 / [dry-run] Unable to predict conflicts: %v", err)
+		p.Record(kind, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, "conflicts unknown")
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, "if "+kind+" succeeds")
+		return MergeMerged, nil
+	}
+	if p.Has(plan.ActionCommit) {
+		mm.logger.Debug("[演练] 冲突预测基于 HEAD，不含计划中的提交 / [dry-run] Conflict prediction is based on HEAD and excludes the planned commit")
+	}
+
+	p.Record(kind, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, detail)
+	if len(conflicts) == 0 {
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, result)
+		return MergeMerged, nil
+	}
+
+	// 与真实合并相同的规则：按顺序匹配冲突规则，策略为 fail 的文件需要回滚
+	// Same rules as the real merge: conflict rules are evaluated in order and any file left at fail forces a rollback
+	base, err := mm.gitOps.GetMergeBase("HEAD", remoteRef)
+	if err != nil {
+		base = "HEAD"
+	}
+	unresolved := []string{}
+	for _, f := range conflicts {
+		p.Record(plan.ActionConflict, f, "")
+		strategy, rule := mm.strategyFor(f)
+		if strategy == config.StrategyStructured {
+			// 结构化合并只依赖三个版本的内容，可以在内存中准确预测
+			// A structured merge only depends on the three versions' content, so it can be predicted exactly in memory
+			if err := mm.predictStructuredMerge(f, base, remoteRef); err != nil {
+				mm.logger.Info("[演练] %s: 结构化合并不可行 / [dry-run] %s: structured merge not possible: %v", f, f, err)
+				strategy = config.StrategyFail
+			}
+		}
+		mm.logger.Info("[演练] %s: 策略 / [dry-run] %s: strategy %s (规则 / rule: %s)", f, f, strategy, rule)
+		if strategy != config.StrategyFail {
+			p.Record(plan.ActionResolve, f, strategy)
+			continue
+		}
+		unresolved = append(unresolved, f)
+	}
+
+	if len(unresolved) == 0 {
+		p.Record(plan.ActionCommit, "", kind+" with auto-resolved conflicts")
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, result)
+		return MergeMerged, nil
+	}
+
+	if mm.cfg.MergeFailureStrategy == config.MergeFailureKeepBoth {
+		for _, f := range unresolved {
+			p.Record(plan.ActionResolve, f, "keep-both (merge_failure_strategy)")
+		}
+		p.Record(plan.ActionCommit, "", kind+" with conflict copies")
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, result)
+		return MergeMerged, nil
+	}
+
+	p.Record(plan.ActionReset, "HEAD", "rollback to pre-"+kind+" state")
+	switch mm.cfg.MergeFailureStrategy {
+	case config.MergeFailureForcePush:
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+" "+git.RemoteBackupPrefix+"<timestamp>", "old remote tip")
+		p.Record(plan.ActionForcePush, mm.cfg.RemoteName+"/"+mm.cfg.BranchName, "merge_failure_strategy=force-push")
+		return MergeForcePushed, nil
+	case config.MergeFailureConflictBranch:
+		p.Record(plan.ActionPush, mm.cfg.RemoteName+" refs/heads/"+conflictBranchPrefix+conflictRefHostName()+"/<timestamp>", "merge_failure_strategy=conflict-branch")
+		return MergeConflictBranch, nil
+	}
+	return MergeConflict, ErrMergeConflict
+}
@@ -4,8 +4,26 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
 )
 
+// backupBranchPrefixes 本地备份分支的名称前缀，其后为时间戳
+// Name prefixes of local backup branches, followed by a timestamp
+var backupBranchPrefixes = []string{"backup-before-merge-", "backup-before-compact-"}
+
+// backupTimestamp 返回备份分支名中的时间戳，不是备份分支时返回空字符串
+// Returns the timestamp in a backup branch name, or "" if it is not a backup branch
+func backupTimestamp(branch string) string {
+	for _, prefix := range backupBranchPrefixes {
+		if strings.HasPrefix(branch, prefix) {
+			return strings.TrimPrefix(branch, prefix)
+		}
+	}
+	return ""
+}
+
 // CleanupOldBackups 清理旧的备份分支
 // Cleans up old backup branches
 func (mm *MergeManager) CleanupOldBackups(keepLast int) error {
@@ -22,7 +40,7 @@ func (mm *MergeManager) CleanupOldBackups(keepLast int) error {
 	// Filter backup branches
 	backupBranches := []string{}
 	for _, branch := range branches {
-		if strings.HasPrefix(branch, "backup-before-merge-") {
+		if backupTimestamp(branch) != "" {
 			backupBranches = append(backupBranches, branch)
 		}
 	}
@@ -35,7 +53,9 @@ func (mm *MergeManager) CleanupOldBackups(keepLast int) error {
 	
 	// 按时间排序（分支名包含时间戳）
 	// Sort by time (branch name contains timestamp)
-	sort.Strings(backupBranches)
+	sort.Slice(backupBranches, func(i, j int) bool {
+		return backupTimestamp(backupBranches[i]) < backupTimestamp(backupBranches[j])
+	})
 	
 	// 删除旧备份
 	// Delete old backups
@@ -54,15 +74,58 @@ func (mm *MergeManager) CleanupOldBackups(keepLast int) error {
 	return nil
 }
 
+// CleanupOldRemoteBackups 清理远程旧的 refs/autosync-backup/* 备份引用
+// Cleans up old refs/autosync-backup/* backup refs on the remote
+func (mm *MergeManager) CleanupOldRemoteBackups(keepLast int) error {
+	mm.logger.Debug("清理远程旧备份引用，保留最近 %d 个 / Cleaning old remote backup refs, keeping last %d", keepLast, keepLast)
+	
+	refs, err := mm.gitOps.ListRemoteRefs(git.RemoteBackupPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list remote backup refs: %w", err)
+	}
+	
+	if len(refs) <= keepLast {
+		mm.logger.Debug("远程备份引用数量 %d <= %d，无需清理 / Remote backup refs count %d <= %d, no cleanup needed",
+			len(refs), keepLast, len(refs), keepLast)
+		return nil
+	}
+	
+	// 按时间排序（引用名包含时间戳）
+	// Sort by time (ref name contains timestamp)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	toDelete := names[:len(names)-keepLast]
+	mm.logger.Info("清理 %d 个远程旧备份引用 / Cleaning %d old remote backup refs", len(toDelete), len(toDelete))
+	
+	for _, old := range toDelete {
+		mm.logger.Debug("  删除远程备份引用 / Deleting remote backup ref: %s", old)
+		if err := mm.gitOps.DeleteRemoteRef(old); err != nil {
+			mm.logger.Warn("删除远程备份引用失败 / Failed to delete remote backup ref %s: %v", old, err)
+		}
+	}
+	
+	return nil
+}
+
 // SafeRollback 安全回滚到备份分支
 // Safely rollback to backup branch
-func (mm *MergeManager) SafeRollback(backupBranch string) error {
+// conflicts 为未解决的冲突文件，conflict-branch 策略把它们写入冲突分支的提交信息
+// conflicts are the unresolved files; the conflict-branch strategy records them in the conflict branch's commit message
+func (mm *MergeManager) SafeRollback(backupBranch string, conflicts []string) error {
 	mm.logger.Warn("执行安全回滚 / Performing safe rollback")
 	
-	// 尝试1: 标准回滚
-	// Attempt 1: Standard rollback
-	if err := mm.gitOps.MergeAbort(); err != nil {
-		mm.logger.Error("MergeAbort失败 / MergeAbort failed: %v", err)
+	// 尝试1: 标准回滚（sync_mode=rebase 时中止进行中的变基）
+	// Attempt 1: Standard rollback (aborts the rebase in progress with sync_mode=rebase)
+	abort, name := mm.gitOps.MergeAbort, "MergeAbort"
+	if mm.gitOps.RebaseInProgress() {
+		abort, name = mm.gitOps.RebaseAbort, "RebaseAbort"
+	}
+	if err := abort(); err != nil {
+		mm.logger.Error("%s失败 / %s failed: %v", name, name, err)
 		
 		// 尝试2: 强制清理合并状态
 		// Attempt 2: Force clean merge state
@@ -90,7 +153,7 @@ func (mm *MergeManager) SafeRollback(backupBranch string) error {
 	
 	// 根据配置决定是否强制推送
 	// Decide whether to force push based on configuration
-	if mm.cfg.MergeFailureStrategy == "force-push" {
+	if mm.cfg.MergeFailureStrategy == config.MergeFailureForcePush {
 		mm.logger.Warn("⚠️ 合并失败策略: force-push / Merge failure strategy: force-push")
 		mm.logger.Warn("强制同步本地状态到远程 / Force syncing local state to remote")
 		mm.logger.Warn("⚠️ 远程的新提交将被覆盖 / Remote commits will be overwritten")
@@ -101,8 +164,24 @@ func (mm *MergeManager) SafeRollback(backupBranch string) error {
 		}
 		
 		mm.logger.Info("✓ 已强制同步远程仓库 / Remote repository force synced")
+		
+		// 只有强制推送会产生远程备份，因此在这里清理 / Only force pushes create remote backups, so they are cleaned here
+		if err := mm.CleanupOldRemoteBackups(mm.cfg.MaxRemoteBackups); err != nil {
+			mm.logger.Warn("清理远程备份引用失败 / Failed to cleanup remote backup refs: %v", err)
+		}
+	} else if mm.cfg.MergeFailureStrategy == config.MergeFailureConflictBranch {
+		mm.logger.Warn("合并失败策略: conflict-branch / Merge failure strategy: conflict-branch")
+		mm.logger.Info("推送本地状态到远程冲突分支 / Pushing local state to a remote conflict branch")
+		
+		if err := mm.pushConflictBranch(conflicts); err != nil {
+			mm.logger.Error("推送冲突分支失败 / Failed to push conflict branch: %v", err)
+			return fmt.Errorf("conflict branch push failed: %w", err)
+		}
+		
+		mm.logger.Info("下个周期将重试合并 / The merge will be retried in the next cycle")
+		mm.logger.Info("备份分支: %s / Backup branch: %s", backupBranch, backupBranch)
 	} else {
-		mm.logger.Info("合并失败策略: rollback / Merge failure strategy: rollback")
+		mm.logger.Info("合并失败策略: %s / Merge failure strategy: %s", mm.cfg.MergeFailureStrategy, mm.cfg.MergeFailureStrategy)
 		mm.logger.Info("保留备份分支供手动处理 / Keeping backup branch for manual intervention")
 		mm.logger.Info("备份分支: %s / Backup branch: %s", backupBranch, backupBranch)
 	}
@@ -1,6 +1,8 @@
 package merge
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -8,6 +10,7 @@ import (
 	"github.com/find-xposed-magisk/git-sync/internal/config"
 	"github.com/find-xposed-magisk/git-sync/internal/git"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 )
 
 // MergeManager 合并管理器
@@ -16,8 +19,35 @@ type MergeManager struct {
 	cfg    *config.Config
 	gitOps *git.GitOps
 	logger *logger.Logger
+
+	// 上一次推送冲突分支时的本地 HEAD 和分支名 / Local HEAD and branch name of the last conflict branch push
+	lastConflictHead   string
+	lastConflictBranch string
 }
 
+// MergeResult 智能合并的结果
+// Outcome of the intelligent merge
+type MergeResult int
+
+const (
+	MergeUpToDate    MergeResult = iota // 本地与远程相同 / Local and remote are identical
+	MergeFastForward                    // 本地落后，已快进 / Local was behind, fast-forwarded
+	MergePushed                         // 本地领先，已推送 / Local was ahead, pushed
+	MergeMerged                         // 分叉后已合并并推送 / Diverged, merged and pushed
+	MergeConflict                       // 冲突无法解决，已回滚 / Unresolvable conflicts, rolled back
+	MergeInterrupted                    // 被关闭信号中断，已恢复合并前状态 / Interrupted by shutdown, pre-merge state restored
+	MergeForcePushed                    // 冲突无法解决，本地状态已强制推送到远程 / Unresolvable conflicts, local state force pushed to the remote
+	MergeConflictBranch                 // 冲突无法解决，本地状态已推送到远程冲突分支 / Unresolvable conflicts, local state pushed to a remote conflict branch
+)
+
+// autoCommitStagedMessage 合并前自动提交残留暂存变更时使用的提交信息
+// Commit message used when remaining staged changes are auto-committed before a merge
+const autoCommitStagedMessage = "chore: Auto-commit staged changes before merge"
+
+// ErrMergeConflict 冲突需要手动解决（本地已回滚）
+// Conflicts require manual resolution (local state was rolled back)
+var ErrMergeConflict = errors.New("merge conflicts require manual resolution")
+
 // NewMergeManager 创建合并管理器
 // Creates a new merge manager
 func NewMergeManager(cfg *config.Config, gitOps *git.GitOps, log *logger.Logger) *MergeManager {
@@ -30,7 +60,7 @@ func NewMergeManager(cfg *config.Config, gitOps *git.GitOps, log *logger.Logger)
 
 // SmartThreeWayMerge 智能三路合并
 // Intelligent three-way merge
-func (mm *MergeManager) SmartThreeWayMerge() error {
+func (mm *MergeManager) SmartThreeWayMerge() (MergeResult, error) {
 	mm.logger.Phase("智能三路合并 / Intelligent Three-Way Merge")
 	
 	// 【与 Shell 保持一致】合并前只处理暂存区变更，不执行 git add -A
@@ -42,9 +72,10 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	
 	// 只检查暂存区变更（不处理工作目录未暂存变更）
 	// Only check staged changes (don't handle unstaged working directory changes)
-	if hasStaged, _ := mm.gitOps.HasStagedChanges(); hasStaged {
+	// 演练模式下统一提交阶段已记录过提交 / In dry-run mode the unified commit phase already recorded the commit
+	if hasStaged, _ := mm.gitOps.HasStagedChanges(); hasStaged && !mm.gitOps.Plan().Has(plan.ActionCommit) {
 		mm.logger.Warn("检测到残留的暂存变更，自动提交 / Detected remaining staged changes, auto-committing")
-		if err := mm.gitOps.Commit("chore: Auto-commit staged changes before merge"); err != nil {
+		if err := mm.gitOps.Commit(autoCommitStagedMessage); err != nil {
 			mm.logger.Warn("Failed to commit staged changes: %v", err)
 		}
 	}
@@ -56,39 +87,49 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	local, err := mm.gitOps.GetRevision("@")
 	if err != nil {
 		mm.logger.Error("[错误] 无法获取本地提交信息 / [ERROR] Failed to get local commit info: %v", err)
-		return err
+		return MergeUpToDate, err
 	}
 	
-	remoteRef := fmt.Sprintf("%s/%s", mm.cfg.RemoteName, mm.cfg.BranchName)
+	remoteRef := mm.gitOps.RemoteBranchRef()
 	remote, err := mm.gitOps.GetRevision(remoteRef)
 	if err != nil {
 		mm.logger.Error("[错误] 无法获取远程提交信息 / [ERROR] Failed to get remote commit info: %v", err)
-		return err
+		return MergeUpToDate, err
 	}
 	
 	base, err := mm.gitOps.GetMergeBase("@", remoteRef)
 	if err != nil {
 		mm.logger.Error("[错误] 无法获取共同祖先 / [ERROR] Failed to get merge base: %v", err)
-		return err
+		return MergeUpToDate, err
 	}
 	
 	// 情况1：本地和远程相同
 	// Case 1: Local and remote are the same
 	if local == remote {
 		mm.logger.Info("✓ 仓库已是最新 / Repository is up-to-date")
-		return nil
+		return MergeUpToDate, nil
 	}
 	
+	// 演练模式下，计划中的提交会让“落后”变为“分叉”
+	// In dry-run mode a planned commit turns "behind" into "diverged"
+	pendingCommit := mm.gitOps.Plan().Has(plan.ActionCommit)
+	
 	// 情况2：本地落后（Fast-forward）
 	// Case 2: Local is behind (Fast-forward)
-	if local == base {
+	if local == base && !pendingCommit {
 		mm.logger.Debug("→ 本地分支落后，执行快进合并 / Local branch is behind, performing fast-forward merge")
 		if err := mm.gitOps.Pull(); err != nil {
+			if mm.interrupted() {
+				// pull --rebase 被中断时可能留下进行中的 rebase
+				// An interrupted pull --rebase may leave a rebase in progress
+				mm.gitOps.WithContext(context.Background()).RebaseAbort()
+				return MergeInterrupted, fmt.Errorf("fast-forward interrupted: %w", mm.gitOps.Context().Err())
+			}
 			mm.logger.Error("✗ 快进合并失败 / Fast-forward merge failed: %v", err)
-			return err
+			return MergeFastForward, err
 		}
 		mm.logger.Info("✓ 快进合并成功 / Fast-forward merge successful")
-		return nil
+		return MergeFastForward, nil
 	}
 	
 	// 情况3：本地领先
@@ -97,25 +138,39 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 		mm.logger.Debug("→ 本地分支领先，推送变更 / Local branch is ahead, pushing changes")
 		if err := mm.gitOps.Push(); err != nil {
 			mm.logger.Error("✗ 推送失败 / Push failed: %v", err)
-			return err
+			return MergePushed, err
 		}
 		mm.logger.Info("✓ 推送成功 / Push successful")
-		return nil
+		return MergePushed, nil
 	}
 	
 	// 情况4：分支分叉，需要三路合并
 	// Case 4: Branches have diverged, need three-way merge
 	mm.logger.Warn("⚠ 分支已分叉，尝试智能三路合并 / Branches have diverged, attempting intelligent three-way merge")
 	
+	if mm.gitOps.DryRun() {
+		return mm.planDivergedMerge(remoteRef)
+	}
+	
 	// 创建合并前的备份点
 	// Create backup point before merge
 	backupBranch := fmt.Sprintf("backup-before-merge-%s", time.Now().Format("20060102-150405"))
 	if err := mm.gitOps.CreateBranch(backupBranch); err != nil {
+		if mm.interrupted() {
+			return MergeInterrupted, err
+		}
 		mm.logger.Error("Failed to create backup branch: %v", err)
-		return err
+		return MergeMerged, err
 	}
 	mm.logger.Debug("→ 已创建备份分支: %s / Backup branch created: %s", backupBranch, backupBranch)
 	
+	// sync_mode=rebase：把本地提交变基到远程之上，不生成合并提交
+	// sync_mode=rebase: rebase local commits onto the remote instead of creating a merge commit
+	// 本地有人工提交或合并提交时改用三路合并 / Falls back to the three-way merge when local has human or merge commits
+	if mm.cfg.SyncMode == config.SyncModeRebase && mm.canRebase(remoteRef) {
+		return mm.rebaseOntoRemote(remoteRef, backupBranch)
+	}
+	
 	// 尝试自动合并
 	// Attempt automatic merge
 	mm.logger.Debug("→ 尝试自动合并 / Attempting automatic merge")
@@ -124,6 +179,9 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	// 使用MergeWithLog显示合并的提交日志（使用配置的行数）
 	// Use MergeWithLog to show merged commit logs (using configured line count)
 	err = mm.gitOps.MergeWithLog(remoteRef, mergeMsg, mm.cfg.MergeLogLines)
+	if mm.interrupted() {
+		return mm.abortInterrupted(backupBranch)
+	}
 	if err == nil {
 		// 合并成功
 		// Merge successful
@@ -133,8 +191,11 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 		// Push merge result
 		mm.logger.Debug("→ 推送合并结果 / Pushing merge result")
 		if err := mm.gitOps.Push(); err != nil {
+			if mm.interrupted() {
+				return mm.abortInterrupted(backupBranch)
+			}
 			mm.logger.Error("✗ 推送失败，但本地合并已完成 / Push failed, but local merge is complete: %v", err)
-			return err
+			return MergeMerged, err
 		}
 		
 		mm.logger.Info("✓ 合并结果已推送 / Merge result pushed successfully")
@@ -148,7 +209,7 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 			mm.logger.Debug("  ✓ 备份分支已删除 / Backup branch deleted")
 		}
 		
-		return nil
+		return MergeMerged, nil
 	}
 	
 	// 合并冲突
@@ -160,7 +221,7 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	conflictFiles, err := mm.gitOps.GetConflictedFiles()
 	if err != nil {
 		mm.logger.Error("Failed to get conflicted files: %v", err)
-		return err
+		return MergeConflict, err
 	}
 	
 	mm.logger.Warn("冲突文件列表 / Conflicted files:")
@@ -172,47 +233,40 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	// Attempt intelligent conflict resolution
 	mm.logger.Debug("→ 尝试智能解决冲突 / Attempting intelligent conflict resolution")
 	
-	conflictsResolved := 0
+	// 按配置的规则逐个解决，每个文件记录所选策略
+	// Resolve file by file according to the configured rules, logging the chosen strategy for each
 	conflictsTotal := len(conflictFiles)
-	
-	for _, conflictFile := range conflictFiles {
-		// 对于自动生成的文件，优先使用远程版本
-		// For auto-generated files, prefer remote version
-		isLockFile := false
-		for _, pattern := range config.LockFilePatterns {
-			if strings.Contains(conflictFile, pattern) {
-				isLockFile = true
-				break
-			}
-		}
-		
-		if isLockFile {
-			mm.logger.Debug("  → 自动解决锁文件冲突（使用远程版本）/ Auto-resolving lock file conflict (using remote): %s", conflictFile)
-			if err := mm.gitOps.CheckoutTheirs(conflictFile); err != nil {
-				mm.logger.Warn("Failed to checkout theirs for %s: %v", conflictFile, err)
-				continue
-			}
-			
-			if err := mm.gitOps.Add(conflictFile); err != nil {
-				mm.logger.Warn("Failed to add resolved file %s: %v", conflictFile, err)
-				continue
-			}
-			
-			conflictsResolved++
-		}
-	}
+	conflictsResolved := conflictsTotal - len(mm.resolveConflicts(conflictFiles, mergeSides(remoteRef)))
 	
 	if conflictsResolved > 0 {
 		mm.logger.Info("  → 已自动解决 %d / %d 个冲突 / Auto-resolved %d / %d conflicts", 
 			conflictsResolved, conflictsTotal, conflictsResolved, conflictsTotal)
 	}
 	
+	if mm.interrupted() {
+		return mm.abortInterrupted(backupBranch)
+	}
+	
 	// 检查是否所有冲突都已解决
 	// Check if all conflicts are resolved
 	remainingConflicts, err := mm.gitOps.GetConflictedFiles()
 	if err != nil {
 		mm.logger.Error("Failed to check remaining conflicts: %v", err)
-		return err
+		return MergeConflict, err
+	}
+	
+	// keep-both 策略：剩余冲突保留双方版本，不回滚也不覆盖远程
+	// keep-both strategy: remaining conflicts keep both versions instead of rolling back or overwriting the remote
+	if len(remainingConflicts) > 0 && mm.cfg.MergeFailureStrategy == config.MergeFailureKeepBoth {
+		mm.logger.Warn("合并失败策略: keep-both，保留双方版本 / Merge failure strategy: keep-both, keeping both versions")
+		var copies []string
+		remainingConflicts, copies = mm.keepBoth(remainingConflicts, mergeSides(remoteRef))
+		if len(copies) > 0 {
+			mergeMsg += "\n\nConflict copies / 冲突副本:\n- " + strings.Join(copies, "\n- ")
+		}
+		if mm.interrupted() {
+			return mm.abortInterrupted(backupBranch)
+		}
 	}
 	
 	if len(remainingConflicts) == 0 {
@@ -221,15 +275,21 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 		// 完成合并
 		// Complete merge
 		if err := mm.gitOps.Commit(mergeMsg); err != nil {
+			if mm.interrupted() {
+				return mm.abortInterrupted(backupBranch)
+			}
 			mm.logger.Error("Failed to commit merge: %v", err)
-			return err
+			return MergeMerged, err
 		}
 		
 		// 推送合并结果
 		// Push merge result
 		if err := mm.gitOps.Push(); err != nil {
+			if mm.interrupted() {
+				return mm.abortInterrupted(backupBranch)
+			}
 			mm.logger.Error("✗ 推送失败 / Push failed: %v", err)
-			return err
+			return MergeMerged, err
 		}
 		
 		mm.logger.Info("✓ 合并完成并已推送 / Merge completed and pushed")
@@ -243,7 +303,7 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 			mm.logger.Debug("  ✓ 备份分支已删除 / Backup branch deleted")
 		}
 		
-		return nil
+		return MergeMerged, nil
 	}
 	
 	// 仍有未解决的冲突
@@ -251,15 +311,89 @@ func (mm *MergeManager) SmartThreeWayMerge() error {
 	mm.logger.Error("✗ 仍有未解决的冲突，需要手动干预 / Unresolved conflicts remain, manual intervention required")
 	mm.logger.Warn("→ 中止合并并恢复到合并前状态 / Aborting merge and restoring to pre-merge state")
 	
+	// 关闭过程中不执行强制推送 / Never force push while shutting down
+	if mm.interrupted() {
+		return mm.abortInterrupted(backupBranch)
+	}
+	
 	// 使用增强的安全回滚机制
 	// Use enhanced safe rollback mechanism
-	if err := mm.SafeRollback(backupBranch); err != nil {
+	if err := mm.SafeRollback(backupBranch, remainingConflicts); err != nil {
 		mm.logger.Error("安全回滚失败 / Safe rollback failed: %v", err)
-		return fmt.Errorf("rollback failed: %w", err)
+		return MergeConflict, fmt.Errorf("rollback failed: %w", err)
 	}
 	
+	return mm.unresolvedResult(backupBranch)
+}
+
+// unresolvedResult SafeRollback 成功后按合并失败策略返回的结果
+// Returns the outcome after a successful SafeRollback according to the merge failure strategy
+// 只有 rollback 把冲突留给人工处理；force-push 和 conflict-branch 已经把本地状态推送出去
+// Only rollback leaves the conflict for manual resolution; force-push and conflict-branch have pushed the local state
+func (mm *MergeManager) unresolvedResult(backupBranch string) (MergeResult, error) {
+	switch mm.cfg.MergeFailureStrategy {
+	case config.MergeFailureForcePush:
+		return MergeForcePushed, nil
+	case config.MergeFailureConflictBranch:
+		return MergeConflictBranch, nil
+	}
 	mm.logger.Debug("→ 已恢复到备份分支，请手动解决冲突 / Restored to backup branch. Please resolve conflicts manually")
 	mm.logger.Debug("→ 备份分支: %s / Backup branch: %s", backupBranch, backupBranch)
+	return MergeConflict, ErrMergeConflict
+}
+
+// isLockFile 是否为可自动解决冲突的锁文件
+// Whether the file is a lock file whose conflicts are resolved automatically
+func isLockFile(path string) bool {
+	for _, pattern := range config.LockFilePatterns {
+		if strings.Contains(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// interrupted 是否已收到关闭信号
+// Whether shutdown has been requested
+func (mm *MergeManager) interrupted() bool {
+	return mm.gitOps.Context().Err() != nil
+}
+
+// abortInterrupted 合并被关闭信号中断时恢复合并前状态并删除备份分支
+// Restores the pre-merge state and deletes the backup branch when a merge is interrupted by shutdown
+// 已在本地完成的合并提交会保留，下个周期再推送
+// A merge commit already completed locally is kept and pushed in the next cycle
+func (mm *MergeManager) abortInterrupted(backupBranch string) (MergeResult, error) {
+	mm.logger.Warn("收到关闭信号，中止合并 / Shutdown requested, aborting merge")
+	
+	// 清理命令必须在已取消的 context 之外运行
+	// Cleanup commands must run outside the cancelled context
+	cleanup := mm.gitOps.WithContext(context.Background())
+	
+	if cleanup.RebaseInProgress() {
+		// 变基中止后 HEAD 回到变基前的分支 / Aborting a rebase puts HEAD back on the pre-rebase branch
+		if err := cleanup.RebaseAbort(); err != nil {
+			mm.logger.Debug("rebase --abort: %v", err)
+		}
+	} else if err := cleanup.MergeAbort(); err != nil {
+		mm.logger.Debug("merge --abort: %v", err)
+	}
+	
+	head, headErr := cleanup.GetRevision("HEAD")
+	backup, backupErr := cleanup.GetRevision(backupBranch)
+	if headErr == nil && backupErr == nil && head == backup {
+		// 合并未提交：丢弃被中断的检出留下的半成品
+		// Merge not committed: discard anything a half-finished checkout left behind
+		if err := cleanup.Reset(backupBranch, true); err != nil {
+			mm.logger.Error("恢复到备份分支失败，保留备份分支 / Failed to restore backup branch, keeping it: %v", err)
+			return MergeInterrupted, fmt.Errorf("merge interrupted, restore failed: %w", err)
+		}
+	}
+	
+	if err := cleanup.DeleteBranch(backupBranch); err != nil {
+		mm.logger.Warn("删除备份分支失败 / Failed to delete backup branch %s: %v", backupBranch, err)
+	}
 	
-	return fmt.Errorf("merge conflicts require manual resolution")
+	mm.logger.Info("✓ 合并已中止，仓库已恢复 / Merge aborted, repository restored")
+	return MergeInterrupted, fmt.Errorf("merge interrupted: %w", mm.gitOps.Context().Err())
 }
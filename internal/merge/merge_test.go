@@ -0,0 +1,402 @@
+// merge_test.go - Merge manager unit tests / 合并管理器单元测试
+//
+// Module: merge
+// Description: Tests the branch states of SmartThreeWayMerge, the rebase fallback, conflict resolution, SafeRollback
+//              and backup cleanup against a scripted git.FakeRunner
+// Author: git-autosync contributors
+// Dependencies: context, errors, os, path/filepath, strings, testing, config, git, logger
+
+package merge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+const (
+	localHash  = "1111111111111111111111111111111111111111"
+	remoteHash = "2222222222222222222222222222222222222222"
+	baseHash   = "3333333333333333333333333333333333333333"
+)
+
+// newFakeMergeManager 创建通过 FakeRunner 执行 git 的合并管理器
+// Creates a merge manager that runs git through a FakeRunner
+// 默认脚本：没有暂存变更，也没有进行中的变基 / Default script: no staged changes and no rebase in progress
+func newFakeMergeManager(t *testing.T, strategy string) (*MergeManager, *git.FakeRunner) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RepoRoot = t.TempDir()
+	cfg.MergeFailureStrategy = strategy
+
+	fake := git.NewFakeRunner()
+	fake.On("rev-parse", "--git-path").Stdout(".git/not-rebasing")
+
+	log := logger.NewLogger(false)
+	return NewMergeManager(cfg, git.NewGitOpsWithRunner(cfg, log, fake), log), fake
+}
+
+// scriptRevisions 脚本化本地、远程和共同祖先的提交
+// Scripts the local, remote and merge-base commits
+func scriptRevisions(fake *git.FakeRunner, local, remote, base string) {
+	fake.On("rev-parse", "@").Stdout(local + "\n")
+	fake.On("rev-parse", "origin/main").Stdout(remote + "\n")
+	fake.On("merge-base", "@", "origin/main").Stdout(base + "\n")
+}
+
+// hasCall 是否有以 prefix 开头的调用（参数以空格连接）
+// Whether any call starts with prefix (arguments joined with spaces)
+func hasCall(fake *git.FakeRunner, prefix string) bool {
+	for _, c := range fake.Calls() {
+		if strings.HasPrefix(c, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestSmartThreeWayMerge_BranchStates tests the up-to-date, behind and ahead cases
+// 测试已是最新、落后和领先三种情况
+func TestSmartThreeWayMerge_BranchStates(t *testing.T) {
+	tests := []struct {
+		name                string
+		local, remote, base string
+		want                MergeResult
+		wantCall            string
+		notCalled           []string
+	}{
+		{"up to date", localHash, localHash, localHash, MergeUpToDate, "", []string{"pull", "push", "merge origin/main"}},
+		{"behind", baseHash, remoteHash, baseHash, MergeFastForward, "pull --rebase origin main", []string{"push", "branch"}},
+		{"ahead", localHash, baseHash, baseHash, MergePushed, "push origin main", []string{"pull", "branch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, fake := newFakeMergeManager(t, "force-push")
+			scriptRevisions(fake, tt.local, tt.remote, tt.base)
+
+			result, err := mm.SmartThreeWayMerge()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("Expected result %d, got %d", tt.want, result)
+			}
+			if tt.wantCall != "" && !hasCall(fake, tt.wantCall) {
+				t.Errorf("Expected %q to run, calls: %v", tt.wantCall, fake.Calls())
+			}
+			for _, c := range tt.notCalled {
+				if hasCall(fake, c) {
+					t.Errorf("Expected %q not to run, calls: %v", c, fake.Calls())
+				}
+			}
+		})
+	}
+}
+
+// TestSmartThreeWayMerge_PushFailure tests that a failed push while ahead is reported
+// 测试领先时推送失败会返回错误
+func TestSmartThreeWayMerge_PushFailure(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "force-push")
+	scriptRevisions(fake, localHash, baseHash, baseHash)
+	fake.On("push").Fail(1, "fatal: unable to access remote")
+
+	result, err := mm.SmartThreeWayMerge()
+	if err == nil || result != MergePushed {
+		t.Errorf("Expected MergePushed with an error, got %d, %v", result, err)
+	}
+}
+
+// TestSmartThreeWayMerge_StagedChanges tests that remaining staged changes are committed before merging
+// 测试合并前会自动提交残留的暂存变更
+func TestSmartThreeWayMerge_StagedChanges(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "force-push")
+	scriptRevisions(fake, localHash, localHash, localHash)
+	fake.On("diff", "--cached", "--quiet").Fail(1, "")
+
+	if _, err := mm.SmartThreeWayMerge(); err != nil {
+		t.Fatal(err)
+	}
+	if !hasCall(fake, "commit -m "+autoCommitStagedMessage) {
+		t.Errorf("Expected staged changes to be committed, calls: %v", fake.Calls())
+	}
+}
+
+// TestSmartThreeWayMerge_DivergedClean tests a diverged merge without conflicts
+// 测试分叉且无冲突的合并
+func TestSmartThreeWayMerge_DivergedClean(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "force-push")
+	scriptRevisions(fake, localHash, remoteHash, baseHash)
+
+	result, err := mm.SmartThreeWayMerge()
+	if err != nil || result != MergeMerged {
+		t.Fatalf("Expected MergeMerged, got %d, %v", result, err)
+	}
+	if fake.Count("branch") != 2 || fake.Count("branch", "-D") != 1 {
+		t.Errorf("Expected the backup branch to be created and deleted, calls: %v", fake.Calls())
+	}
+	if !hasCall(fake, "merge origin/main --no-edit -m Auto-merge") || !hasCall(fake, "push origin main") {
+		t.Errorf("Expected merge and push, calls: %v", fake.Calls())
+	}
+}
+
+// TestSmartThreeWayMerge_LockFileResolved tests that lock file conflicts take the remote version
+// 测试锁文件冲突使用远程版本解决
+func TestSmartThreeWayMerge_LockFileResolved(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "force-push")
+	scriptRevisions(fake, localHash, remoteHash, baseHash)
+	fake.On("merge", "origin/main").Fail(1, "CONFLICT (content): Merge conflict in package-lock.json")
+	fake.On("diff", "--name-only", "--diff-filter=U").Stdout("package-lock.json\n").Once()
+	fake.On("ls-files", "-u").Stdout("100644 " + localHash + " 2\tpackage-lock.json\x00100644 " + remoteHash + " 3\tpackage-lock.json\x00")
+
+	result, err := mm.SmartThreeWayMerge()
+	if err != nil || result != MergeMerged {
+		t.Fatalf("Expected MergeMerged, got %d, %v (calls: %v)", result, err, fake.Calls())
+	}
+	for _, want := range []string{"checkout --theirs package-lock.json", "add -- package-lock.json", "commit -m Auto-merge", "push origin main"} {
+		if !hasCall(fake, want) {
+			t.Errorf("Expected %q to run, calls: %v", want, fake.Calls())
+		}
+	}
+	if hasCall(fake, "reset --hard") {
+		t.Errorf("Expected no rollback, calls: %v", fake.Calls())
+	}
+}
+
+// TestSmartThreeWayMerge_RebaseMode tests that sync_mode=rebase only rebases when every local-only commit is a
+// single-parent auto-sync commit, and falls back to the three-way merge otherwise
+// 测试 sync_mode=rebase 只在本地独有的提交都是单父自动同步提交时变基，否则改用三路合并
+func TestSmartThreeWayMerge_RebaseMode(t *testing.T) {
+	commit := func(parents, subject string) string {
+		return strings.Join([]string{localHash, baseHash, parents, "a", "a@example.com", "1700000000 +0000", "1700000000", subject}, "\x1f") + "\x00"
+	}
+	autoSync := config.DefaultConfig().CommitMsgPrefix + " 2025-12-07 14:00:00"
+
+	tests := []struct {
+		name   string
+		log    string
+		rebase bool
+	}{
+		{"auto-sync commits", commit(baseHash, autoSync) + commit(baseHash, autoSync), true},
+		{"human commit", commit(baseHash, autoSync) + commit(baseHash, "Fix the parser"), false},
+		{"merge commit", commit(baseHash+" "+remoteHash, "Auto-merge: Intelligent three-way merge at 2025-12-07 13:00:00"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mm, fake := newFakeMergeManager(t, "rollback")
+			mm.cfg.SyncMode = config.SyncModeRebase
+			scriptRevisions(fake, localHash, remoteHash, baseHash)
+			fake.On("rev-list", "--count").Stdout("2\n")
+			fake.On("log", "-z", "--first-parent").Stdout(tt.log)
+
+			result, err := mm.SmartThreeWayMerge()
+			if err != nil || result != MergeMerged {
+				t.Fatalf("Expected MergeMerged, got %d, %v (calls: %v)", result, err, fake.Calls())
+			}
+			if !hasCall(fake, "log -z --first-parent --date=raw -n2") {
+				t.Errorf("Expected the local-only commits to be listed, calls: %v", fake.Calls())
+			}
+			if got := hasCall(fake, "rebase --autostash origin/main"); got != tt.rebase {
+				t.Errorf("Expected rebase %v, calls: %v", tt.rebase, fake.Calls())
+			}
+			if got := hasCall(fake, "merge origin/main"); got == tt.rebase {
+				t.Errorf("Expected three-way merge %v, calls: %v", !tt.rebase, fake.Calls())
+			}
+		})
+	}
+}
+
+// TestSmartThreeWayMerge_ConflictRollback tests that unresolved conflicts roll back and apply the failure strategy
+// 测试无法解决的冲突会回滚并执行合并失败策略
+func TestSmartThreeWayMerge_ConflictRollback(t *testing.T) {
+	tests := []struct {
+		strategy  string
+		forcePush bool
+		result    MergeResult
+		err       error
+	}{
+		{"force-push", true, MergeForcePushed, nil},
+		{"rollback", false, MergeConflict, ErrMergeConflict},
+		{"conflict-branch", false, MergeConflictBranch, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			mm, fake := newFakeMergeManager(t, tt.strategy)
+			scriptRevisions(fake, localHash, remoteHash, baseHash)
+			fake.On("merge", "origin/main").Fail(1, "CONFLICT (content): Merge conflict in notes.txt")
+			fake.On("diff", "--name-only", "--diff-filter=U").Stdout("notes.txt\n")
+			fake.On("rev-parse", "--verify", "--quiet").Stdout(remoteHash + "\n")
+			fake.On("rev-parse", "HEAD").Stdout(localHash)
+			fake.On("commit-tree").Stdout(baseHash)
+
+			result, err := mm.SmartThreeWayMerge()
+			if result != tt.result || !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %d/%v, got %d, %v", tt.result, tt.err, result, err)
+			}
+			if !hasCall(fake, "merge --abort") || !hasCall(fake, "reset --hard backup-before-merge-") {
+				t.Errorf("Expected abort and reset to the backup branch, calls: %v", fake.Calls())
+			}
+			if hasCall(fake, "commit -m") {
+				t.Errorf("Expected no merge commit, calls: %v", fake.Calls())
+			}
+			forced := hasCall(fake, "push --force-with-lease=refs/heads/main:"+remoteHash+" origin main")
+			if forced != tt.forcePush {
+				t.Errorf("Expected force push %v, calls: %v", tt.forcePush, fake.Calls())
+			}
+			if tt.forcePush && !hasCall(fake, "push origin "+remoteHash+":"+git.RemoteBackupPrefix) {
+				t.Errorf("Expected the old remote tip to be backed up first, calls: %v", fake.Calls())
+			}
+		})
+	}
+}
+
+// TestSmartThreeWayMerge_Interrupted tests that a merge interrupted by shutdown restores the backup without force pushing
+// 测试被关闭信号中断的合并恢复备份且不强制推送
+func TestSmartThreeWayMerge_Interrupted(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "force-push")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mm.gitOps = mm.gitOps.WithContext(ctx)
+
+	scriptRevisions(fake, localHash, remoteHash, baseHash)
+	fake.On("merge", "origin/main").Fail(1, "interrupted").Do(func(git.Command) { cancel() })
+
+	result, err := mm.SmartThreeWayMerge()
+	if result != MergeInterrupted || err == nil {
+		t.Fatalf("Expected MergeInterrupted with an error, got %d, %v", result, err)
+	}
+	if hasCall(fake, "push") {
+		t.Errorf("Expected no push after shutdown, calls: %v", fake.Calls())
+	}
+	if fake.Count("branch", "-D") != 1 {
+		t.Errorf("Expected the backup branch to be deleted, calls: %v", fake.Calls())
+	}
+}
+
+// TestSafeRollback tests the fallbacks of SafeRollback
+// 测试 SafeRollback 的各级回退
+func TestSafeRollback(t *testing.T) {
+	t.Run("merge abort fails", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "rollback")
+		fake.On("merge", "--abort").Fail(128, "fatal: There is no merge to abort")
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", nil); err != nil {
+			t.Fatal(err)
+		}
+		calls := strings.Join(fake.Calls(), "\n")
+		if !strings.Contains(calls, "reset HEAD\n") || !strings.Contains(calls, "reset --hard backup-before-merge-20251207-100000") {
+			t.Errorf("Expected reset HEAD then reset --hard to the backup, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("rebase in progress", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "rollback")
+		os.MkdirAll(filepath.Join(mm.cfg.RepoRoot, ".git", "rebase-merge"), 0755)
+		fake.On("rev-parse", "--git-path", "rebase-merge").Stdout(".git/rebase-merge")
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", nil); err != nil {
+			t.Fatal(err)
+		}
+		if !hasCall(fake, "rebase --abort") || hasCall(fake, "merge --abort") {
+			t.Errorf("Expected rebase --abort instead of merge --abort, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("backup reset fails", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "rollback")
+		fake.On("reset", "--hard", "backup-before-merge-20251207-100000").Fail(128, "fatal: ambiguous argument")
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", nil); err != nil {
+			t.Fatal(err)
+		}
+		if !hasCall(fake, "reset --hard HEAD") {
+			t.Errorf("Expected last resort reset --hard HEAD, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("all resets fail", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "rollback")
+		fake.On("reset").Fail(128, "fatal: index file corrupt")
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", nil); err == nil {
+			t.Error("Expected an error when the repository cannot be restored")
+		}
+	})
+
+	t.Run("force push backup fails", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "force-push")
+		fake.On("rev-parse", "--verify", "--quiet").Stdout(remoteHash)
+		fake.On("push", "origin").Fail(1, "remote rejected")
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", nil); err == nil {
+			t.Error("Expected an error when the remote backup fails")
+		}
+		if hasCall(fake, "push --force-with-lease") {
+			t.Errorf("Expected no force push without a remote backup, calls: %v", fake.Calls())
+		}
+	})
+
+	t.Run("conflict branch", func(t *testing.T) {
+		mm, fake := newFakeMergeManager(t, "conflict-branch")
+		fake.On("rev-parse", "HEAD").Stdout(localHash)
+		fake.On("commit-tree").Stdout(baseHash)
+
+		if err := mm.SafeRollback("backup-before-merge-20251207-100000", []string{"notes.txt"}); err != nil {
+			t.Fatal(err)
+		}
+		if !hasCall(fake, "push origin "+baseHash+":refs/heads/"+conflictBranchPrefix) || hasCall(fake, "push --force") {
+			t.Errorf("Expected a conflict branch push and no force push, calls: %v", fake.Calls())
+		}
+	})
+}
+
+// TestCleanupOldBackups tests that only the oldest backup branches beyond keepLast are deleted
+// 测试只删除超出 keepLast 的最旧备份分支
+func TestCleanupOldBackups(t *testing.T) {
+	mm, fake := newFakeMergeManager(t, "rollback")
+	fake.On("branch", "--list").Stdout(strings.Join([]string{
+		"  backup-before-merge-20251207-120000",
+		"  backup-before-compact-20251206-090000",
+		"* main",
+		"  backup-before-merge-20251205-080000",
+		"  feature",
+		"  backup-before-merge-20251207-130000",
+	}, "\n"))
+	fake.On("branch", "-D", "backup-before-compact-20251206-090000").Fail(1, "error: branch is checked out")
+
+	if err := mm.CleanupOldBackups(2); err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []string
+	for _, c := range fake.Calls() {
+		if strings.HasPrefix(c, "branch -D ") {
+			deleted = append(deleted, strings.TrimPrefix(c, "branch -D "))
+		}
+	}
+	want := []string{"backup-before-merge-20251205-080000", "backup-before-compact-20251206-090000"}
+	if strings.Join(deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v to be deleted (oldest first, continuing after a failure), got %v", want, deleted)
+	}
+
+	mm, fake = newFakeMergeManager(t, "rollback")
+	fake.On("branch", "--list").Stdout("* main\n  backup-before-merge-20251207-120000")
+	if err := mm.CleanupOldBackups(2); err != nil || fake.Count("branch", "-D") != 0 {
+		t.Errorf("Expected nothing to be deleted, got %v (calls: %v)", err, fake.Calls())
+	}
+
+	mm, fake = newFakeMergeManager(t, "rollback")
+	fake.On("branch", "--list").Fail(128, "fatal: not a git repository")
+	if err := mm.CleanupOldBackups(2); err == nil {
+		t.Error("Expected an error when branches cannot be listed")
+	}
+}
@@ -0,0 +1,153 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+)
+
+// rebaseOntoRemote 把本地的自动同步提交逐个变基到 remoteRef 之上并推送（sync_mode=rebase）
+// Rebases the local auto-sync commits one by one onto remoteRef and pushes (sync_mode=rebase)
+// 每个提交的冲突都按冲突规则解决；仍有未解决的冲突时中止变基并回滚到备份分支
+// Conflicts in each commit are resolved through the conflict rules; if any remain the rebase is aborted and rolled back to the backup branch
+func (mm *MergeManager) rebaseOntoRemote(remoteRef, backupBranch string) (MergeResult, error) {
+	mm.logger.Debug("→ 变基到 %s / Rebasing onto %s", remoteRef, remoteRef)
+
+	// 每个本地提交最多停下两次（冲突、解决后为空），超过说明变基无法推进
+	// Each local commit stops at most twice (conflict, empty after resolution); more means the rebase is not progressing
+	maxSteps := 2
+	if n, err := mm.gitOps.CountCommits(remoteRef, "HEAD"); err == nil {
+		maxSteps = 2*n + 2
+	}
+
+	err := mm.gitOps.Rebase(remoteRef)
+	var copies []string
+	for step := 0; err != nil; step++ {
+		if mm.interrupted() {
+			return mm.abortInterrupted(backupBranch)
+		}
+		if !mm.gitOps.RebaseInProgress() || step >= maxSteps {
+			mm.logger.Error("✗ 变基失败 / Rebase failed: %v", err)
+			return mm.rollbackRebase(backupBranch, nil)
+		}
+
+		conflictFiles, cerr := mm.gitOps.GetConflictedFiles()
+		if cerr != nil {
+			mm.logger.Error("Failed to get conflicted files: %v", cerr)
+			return mm.rollbackRebase(backupBranch, nil)
+		}
+
+		if len(conflictFiles) == 0 {
+			// 冲突解决后与远程一致的提交没有可提交的内容，直接跳过
+			// A commit that matches the remote after conflict resolution has nothing left to commit and is skipped
+			if staged, _ := mm.gitOps.HasStagedChanges(); !staged {
+				mm.logger.Debug("  → 提交已为空，跳过 / Commit became empty, skipping: %s", mm.gitOps.DescribeCommit("REBASE_HEAD"))
+				err = mm.gitOps.RebaseSkip()
+			} else {
+				err = mm.gitOps.RebaseContinue()
+			}
+			continue
+		}
+
+		mm.logger.Warn("✗ 变基冲突 / Rebase conflicts in commit: %s", mm.gitOps.DescribeCommit("REBASE_HEAD"))
+		for _, file := range conflictFiles {
+			mm.logger.Error("  - %s", file)
+		}
+
+		unresolved := mm.resolveConflicts(conflictFiles, rebaseSides())
+		if len(unresolved) > 0 && mm.cfg.MergeFailureStrategy == config.MergeFailureKeepBoth {
+			mm.logger.Warn("合并失败策略: keep-both，保留双方版本 / Merge failure strategy: keep-both, keeping both versions")
+			var written []string
+			unresolved, written = mm.keepBoth(unresolved, rebaseSides())
+			copies = append(copies, written...)
+		}
+		if mm.interrupted() {
+			return mm.abortInterrupted(backupBranch)
+		}
+		if len(unresolved) > 0 {
+			mm.logger.Error("✗ 仍有未解决的冲突，需要手动干预 / Unresolved conflicts remain, manual intervention required")
+			return mm.rollbackRebase(backupBranch, unresolved)
+		}
+
+		mm.logger.Info("  → 已自动解决 %d 个冲突，继续变基 / Auto-resolved %d conflicts, continuing rebase", len(conflictFiles), len(conflictFiles))
+		err = mm.gitOps.RebaseContinue()
+	}
+
+	mm.logger.Info("✓ 变基成功 / Rebase successful")
+	if len(copies) > 0 {
+		// 变基沿用原提交信息，冲突副本只能记录在日志中
+		// A rebase keeps the original commit messages, so conflict copies can only be reported in the log
+		mm.logger.Warn("冲突副本 / Conflict copies: %s", strings.Join(copies, ", "))
+	}
+
+	mm.logger.Debug("→ 推送变基结果 / Pushing rebase result")
+	if err := mm.gitOps.Push(); err != nil {
+		if mm.interrupted() {
+			return mm.abortInterrupted(backupBranch)
+		}
+		mm.logger.Error("✗ 推送失败，但本地变基已完成 / Push failed, but local rebase is complete: %v", err)
+		return MergeMerged, err
+	}
+	mm.logger.Info("✓ 变基结果已推送 / Rebase result pushed successfully")
+
+	mm.logger.Debug("清理备份分支 / Cleaning up backup branch: %s", backupBranch)
+	if err := mm.gitOps.DeleteBranch(backupBranch); err != nil {
+		mm.logger.Warn("删除备份分支失败 (已忽略) / Failed to delete backup branch (ignored): %v", err)
+	} else {
+		mm.logger.Debug("  ✓ 备份分支已删除 / Backup branch deleted")
+	}
+
+	return MergeMerged, nil
+}
+
+// canRebase 本地独有的提交是否都是单父提交的自动同步提交
+// Whether every local-only commit is a single-parent auto-sync commit
+// 变基会重放人工提交并拍平合并提交（包括之前的 Auto-merge 合并），这两种情况都改用三路合并
+// A rebase would replay human commits and flatten merge commits (including earlier Auto-merge merges), so both fall
+// back to the three-way merge
+func (mm *MergeManager) canRebase(remoteRef string) bool {
+	n, err := mm.gitOps.CountCommits(remoteRef, "HEAD")
+	if err != nil {
+		mm.logger.Warn("无法统计本地提交，改用三路合并 / Unable to count local commits, falling back to three-way merge: %v", err)
+		return false
+	}
+	// 合并提交本身会在第一父链上出现，因此只需沿第一父提交检查
+	// A merge commit shows up on the first-parent chain itself, so walking first parents is enough
+	commits, err := mm.gitOps.FirstParentLog(remoteRef+"..HEAD", n)
+	if err != nil {
+		mm.logger.Warn("无法读取本地提交，改用三路合并 / Unable to read local commits, falling back to three-way merge: %v", err)
+		return false
+	}
+
+	for _, c := range commits {
+		subject := strings.SplitN(c.Message, "\n", 2)[0]
+		if len(c.Parents) != 1 {
+			mm.logger.Info("本地有合并提交，改用三路合并 / Local merge commit found, falling back to three-way merge: %s", subject)
+			return false
+		}
+		if !mm.isAutoSyncCommit(c.Message) {
+			mm.logger.Info("本地有人工提交，改用三路合并 / Local human commit found, falling back to three-way merge: %s", subject)
+			return false
+		}
+	}
+	return true
+}
+
+// rollbackRebase 中止变基并按合并失败策略回滚到备份分支
+// Aborts the rebase and rolls back to the backup branch according to the merge failure strategy
+func (mm *MergeManager) rollbackRebase(backupBranch string, conflicts []string) (MergeResult, error) {
+	mm.logger.Warn("→ 中止变基并恢复到变基前状态 / Aborting rebase and restoring to pre-rebase state")
+
+	// 关闭过程中不执行强制推送 / Never force push while shutting down
+	if mm.interrupted() {
+		return mm.abortInterrupted(backupBranch)
+	}
+
+	if err := mm.SafeRollback(backupBranch, conflicts); err != nil {
+		mm.logger.Error("安全回滚失败 / Safe rollback failed: %v", err)
+		return MergeConflict, fmt.Errorf("rollback failed: %w", err)
+	}
+
+	return mm.unresolvedResult(backupBranch)
+}
@@ -0,0 +1,267 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/pathmatch"
+)
+
+// strategyFor 按配置的规则顺序为冲突文件选择解决策略，并返回匹配的规则
+// Picks the resolution strategy for a conflicted file by evaluating the configured rules in order, and returns the matching rule
+// 没有规则匹配时锁文件使用远程版本，JSON/YAML 做结构化合并，其余文件不自动解决
+// Without a matching rule lock files take the remote version, JSON/YAML are merged structurally and everything else is left unresolved
+func (mm *MergeManager) strategyFor(file string) (strategy, rule string) {
+	for _, r := range mm.cfg.ConflictRules {
+		if pathmatch.Match(r.Pattern, file) {
+			return r.Strategy, r.Pattern
+		}
+	}
+	if isLockFile(file) {
+		return config.StrategyTheirs, "lock file"
+	}
+	if structuredFormat(file) != "" {
+		return config.StrategyStructured, "json/yaml"
+	}
+	return config.StrategyFail, "default"
+}
+
+// conflictSides 冲突中本地和远程分别对应的索引阶段和提交
+// Which index stage and commit hold the local and the remote side of a conflict
+// 合并时本地是 ours（阶段 2）；变基时 git 交换两侧，正在重放的本地提交是 theirs（阶段 3）
+// In a merge the local side is ours (stage 2); a rebase swaps them and the local commit being replayed is theirs (stage 3)
+type conflictSides struct {
+	local, remote       int    // 索引阶段 / Index stages
+	localRef, remoteRef string // newest-mtime 比较提交时间用的引用 / Refs whose commit times newest-mtime compares
+}
+
+// mergeSides 合并 remoteRef 时的冲突双方
+// Conflict sides when merging remoteRef
+func mergeSides(remoteRef string) conflictSides {
+	return conflictSides{local: git.StageOurs, remote: git.StageTheirs, localRef: "HEAD", remoteRef: remoteRef}
+}
+
+// rebaseSides 本地提交变基到远程分支时的冲突双方
+// Conflict sides when local commits are rebased onto the remote branch
+func rebaseSides() conflictSides {
+	return conflictSides{local: git.StageTheirs, remote: git.StageOurs, localRef: "REBASE_HEAD", remoteRef: "HEAD"}
+}
+
+// resolveConflicts 按规则逐个解决冲突文件，返回仍未解决的文件
+// Resolves conflicted files one by one according to the rules and returns those still unresolved
+// 规则中的 ours/theirs 始终指本地/远程版本，由 sides 映射到索引阶段
+// ours/theirs in the rules always mean the local/remote version; sides maps them to index stages
+func (mm *MergeManager) resolveConflicts(files []string, sides conflictSides) []string {
+	unresolved := []string{}
+	for _, file := range files {
+		if mm.interrupted() {
+			unresolved = append(unresolved, file)
+			continue
+		}
+
+		strategy, rule := mm.strategyFor(file)
+		if strategy == config.StrategyFail {
+			mm.logger.Info("  → %s: 策略 / strategy %s (规则 / rule: %s)", file, strategy, rule)
+			unresolved = append(unresolved, file)
+			continue
+		}
+
+		applied, err := mm.applyStrategy(file, strategy, sides)
+		if err != nil {
+			mm.logger.Warn("  ✗ %s: 策略 %s 失败 / strategy %s failed (规则 / rule: %s): %v", file, strategy, strategy, rule, err)
+			unresolved = append(unresolved, file)
+			continue
+		}
+		mm.logger.Info("  → %s: 策略 / strategy %s (规则 / rule: %s)", file, applied, rule)
+	}
+	return unresolved
+}
+
+// applyStrategy 对单个冲突文件执行策略并暂存结果，返回实际执行的策略描述
+// Applies a strategy to a single conflicted file and stages the result, returning a description of what was applied
+func (mm *MergeManager) applyStrategy(file, strategy string, sides conflictSides) (string, error) {
+	stages, err := mm.gitOps.ConflictStages(file)
+	if err != nil {
+		return "", err
+	}
+	_, hasOurs := stages[sides.local]
+	_, hasTheirs := stages[sides.remote]
+
+	switch strategy {
+	case config.StrategyOurs:
+		return strategy, mm.takeSide(file, sides.local, hasOurs)
+
+	case config.StrategyTheirs:
+		return strategy, mm.takeSide(file, sides.remote, hasTheirs)
+
+	case config.StrategyNewestMtime:
+		side, stage, present := config.StrategyOurs, sides.local, hasOurs
+		if mm.theirsIsNewer(file, sides) {
+			side, stage, present = config.StrategyTheirs, sides.remote, hasTheirs
+		}
+		return fmt.Sprintf("%s → %s", strategy, side), mm.takeSide(file, stage, present)
+
+	case config.StrategyUnion:
+		if !hasOurs || !hasTheirs {
+			return "", fmt.Errorf("one side deleted the file, nothing to union")
+		}
+		return strategy, mm.unionMerge(file, stages, sides)
+
+	case config.StrategyStructured:
+		return strategy, mm.structuredMerge(file, stages, sides)
+
+	case config.StrategyKeepBoth:
+		// 一方删除时保留仍存在的一方即可，无需副本
+		// When one side deleted the file, keeping the surviving side is enough and no copy is needed
+		if !hasTheirs {
+			return strategy + " → ours", mm.takeSide(file, sides.local, hasOurs)
+		}
+		if !hasOurs {
+			return strategy + " → theirs", mm.takeSide(file, sides.remote, hasTheirs)
+		}
+		copyName, err := mm.writeConflictCopy(file, stages[sides.remote])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s → %s", strategy, copyName), mm.takeSide(file, sides.local, true)
+	}
+
+	return "", fmt.Errorf("unknown strategy %q", strategy)
+}
+
+// keepBoth 对剩余冲突文件执行 keep-both（merge_failure_strategy=keep-both），返回仍未解决的文件和写入的冲突副本
+// Applies keep-both to the remaining conflicted files (merge_failure_strategy=keep-both), returning files still unresolved and the conflict copies written
+func (mm *MergeManager) keepBoth(files []string, sides conflictSides) (unresolved, copies []string) {
+	for _, file := range files {
+		applied, err := mm.applyStrategy(file, config.StrategyKeepBoth, sides)
+		if err != nil {
+			mm.logger.Warn("  ✗ %s: 无法保留双方版本 / Unable to keep both versions: %v", file, err)
+			unresolved = append(unresolved, file)
+			continue
+		}
+		mm.logger.Warn("  → %s: %s", file, applied)
+		if _, copyName, ok := strings.Cut(applied, " → "); ok && copyName != "ours" && copyName != "theirs" {
+			copies = append(copies, copyName)
+		}
+	}
+	return unresolved, copies
+}
+
+// takeSide 使用某一侧的版本解决冲突；该侧删除了文件时接受删除
+// Resolves the conflict with one side's version; if that side deleted the file the deletion is accepted
+func (mm *MergeManager) takeSide(file string, stage int, present bool) error {
+	if !present {
+		return mm.gitOps.RemoveConflicted(file)
+	}
+
+	var err error
+	if stage == git.StageOurs {
+		err = mm.gitOps.CheckoutOurs(file)
+	} else {
+		err = mm.gitOps.CheckoutTheirs(file)
+	}
+	if err != nil {
+		return err
+	}
+	return mm.gitOps.Add(file)
+}
+
+// theirsIsNewer 比较双方最后一次修改该文件的提交时间，远程较新时返回 true
+// Compares the commit times of the last change to the file on each side and reports whether theirs is newer
+// 工作区的 mtime 在合并后已无意义，因此使用提交时间
+// Working tree mtimes are meaningless after a merge, so commit times are used instead
+func (mm *MergeManager) theirsIsNewer(file string, sides conflictSides) bool {
+	ours, oursErr := mm.gitOps.LastCommitTime(sides.localRef, file)
+	theirs, theirsErr := mm.gitOps.LastCommitTime(sides.remoteRef, file)
+	if oursErr != nil || theirsErr != nil {
+		mm.logger.Debug("    无法比较提交时间，保留本地版本 / Unable to compare commit times, keeping ours: %v %v", oursErr, theirsErr)
+		return false
+	}
+	mm.logger.Debug("    本地 / ours: %s, 远程 / theirs: %s", ours.Format(time.RFC3339), theirs.Format(time.RFC3339))
+	return theirs.After(ours)
+}
+
+// unionMerge 合并双方的行并暂存
+// Merges the lines of both sides and stages the result
+func (mm *MergeManager) unionMerge(file string, stages map[int]string, sides conflictSides) error {
+	var base []byte
+	if hash, ok := stages[git.StageBase]; ok {
+		content, err := mm.gitOps.ReadBlob(hash, file)
+		if err != nil {
+			return err
+		}
+		base = content
+	}
+	ours, err := mm.gitOps.ReadBlob(stages[sides.local], file)
+	if err != nil {
+		return err
+	}
+	theirs, err := mm.gitOps.ReadBlob(stages[sides.remote], file)
+	if err != nil {
+		return err
+	}
+
+	merged, err := mm.gitOps.MergeFileUnion(base, ours, theirs)
+	if err != nil {
+		return err
+	}
+	// 文件已存在（含冲突标记），WriteFile 保留其权限
+	// The file exists (with conflict markers), so WriteFile keeps its permissions
+	if err := os.WriteFile(filepath.Join(mm.cfg.RepoRoot, file), merged, 0644); err != nil {
+		return err
+	}
+	return mm.gitOps.Add(file)
+}
+
+// writeConflictCopy 把远程版本写为冲突副本并暂存，返回副本路径
+// Writes the remote version as a conflict copy, stages it and returns the copy's path
+func (mm *MergeManager) writeConflictCopy(file, theirsHash string) (string, error) {
+	content, err := mm.gitOps.ReadBlob(theirsHash, file)
+	if err != nil {
+		return "", err
+	}
+
+	copyName := conflictCopyName(file, conflictHostName(), time.Now())
+	if err := os.WriteFile(filepath.Join(mm.cfg.RepoRoot, copyName), content, 0644); err != nil {
+		return "", err
+	}
+	if err := mm.gitOps.Add(copyName); err != nil {
+		return "", err
+	}
+	return copyName, nil
+}
+
+// conflictCopyName 生成冲突副本的路径：name.conflict-<host>-<timestamp>.ext
+// Builds the path of a conflict copy: name.conflict-<host>-<timestamp>.ext
+// 以 . 开头且没有其他扩展名的文件（如 .bashrc）把后缀追加在末尾
+// Files starting with . and without another extension (e.g. .bashrc) get the suffix appended at the end
+func conflictCopyName(file, host string, now time.Time) string {
+	dir, base := path.Split(filepath.ToSlash(file))
+	ext := path.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	return fmt.Sprintf("%s%s.conflict-%s-%s%s", dir, stem, host, now.Format("20060102-150405"), ext)
+}
+
+// conflictHostName 返回可安全用于文件名的主机名
+// Returns the host name made safe for use in a file name
+func conflictHostName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, host)
+}
@@ -0,0 +1,229 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+// 结构化格式 / Structured formats
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// structNode 结构化文档树的节点：映射（JSON 对象 / YAML 块映射）或不再细分的叶子值
+// A node of a structured document tree: a mapping (JSON object / YAML block mapping) or a leaf value that is not split further
+// 数组和标量都作为叶子整体比较 / Arrays and scalars are compared as whole leaves
+type structNode struct {
+	keys     []string               // 键的顺序 / Key order
+	children map[string]*structNode // 非 nil 时为映射节点 / Mapping node when non-nil
+	leaf     string                 // 叶子值的规范文本，用于比较 / Canonical text of a leaf, used for comparison
+	indent   int                    // 子键的缩进（YAML）/ Indentation of child keys (YAML)
+	yaml     *yamlEntry             // YAML 原始行，输出时保留注释和格式 / Raw YAML lines, keeping comments and layout on output
+}
+
+// isMapping 是否为映射节点
+// Whether the node is a mapping
+func (n *structNode) isMapping() bool {
+	return n != nil && n.children != nil
+}
+
+// structuredFormat 按扩展名返回可结构化合并的格式，不支持时返回空字符串
+// Returns the structured format for a file by extension, or an empty string when unsupported
+func structuredFormat(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	}
+	return ""
+}
+
+// equalNodes 比较两个节点的内容（映射的键顺序不影响结果）
+// Compares the content of two nodes (key order of mappings does not matter)
+func equalNodes(a, b *structNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.isMapping() != b.isMapping() {
+		return false
+	}
+	if !a.isMapping() {
+		return a.leaf == b.leaf
+	}
+	if len(a.children) != len(b.children) {
+		return false
+	}
+	for k, ac := range a.children {
+		if bc, ok := b.children[k]; !ok || !equalNodes(ac, bc) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge3 对节点做三路合并；nil 表示该侧不存在（或已删除）
+// Three-way merges nodes; nil means the side does not have it (or deleted it)
+// 只有一侧修改时采用该侧；双方都是映射时逐键递归；否则把 keyPath 记为冲突
+// A change on only one side is taken; when both sides are mappings keys are merged recursively; otherwise keyPath is recorded as a conflict
+func merge3(base, ours, theirs *structNode, keyPath string, conflicts *[]string) *structNode {
+	switch {
+	case equalNodes(ours, theirs):
+		return ours
+	case equalNodes(base, ours):
+		return theirs
+	case equalNodes(base, theirs):
+		return ours
+	}
+
+	// 双方都修改了：只有两个映射（缩进一致）才能逐键合并
+	// Both sides changed it: only two mappings (with matching indentation) can be merged key by key
+	if !ours.isMapping() || !theirs.isMapping() || ours.indent != theirs.indent {
+		if keyPath == "" {
+			keyPath = "(root)"
+		}
+		*conflicts = append(*conflicts, keyPath)
+		return ours
+	}
+	if !base.isMapping() {
+		base = nil
+	}
+
+	merged := &structNode{children: map[string]*structNode{}, indent: ours.indent, yaml: ours.yaml}
+	keys := append([]string{}, ours.keys...)
+	for _, k := range theirs.keys {
+		if _, ok := ours.children[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		var b *structNode
+		if base != nil {
+			b = base.children[k]
+		}
+		childPath := k
+		if keyPath != "" {
+			childPath = keyPath + "." + k
+		}
+		if m := merge3(b, ours.children[k], theirs.children[k], childPath, conflicts); m != nil {
+			merged.keys = append(merged.keys, k)
+			merged.children[k] = m
+		}
+	}
+	return merged
+}
+
+// mergeStructured 对 JSON/YAML 文档做键级三路合并
+// Performs a key-level three-way merge of JSON/YAML documents
+// base 为 nil 表示双方各自新增了该文件；同一个键在双方被改成不同的值时返回冲突的键路径
+// A nil base means both sides added the file; when the same key changed differently on both sides the conflicting key paths are returned
+func mergeStructured(format string, base, ours, theirs []byte) ([]byte, []string, error) {
+	parse, render := parseJSON, renderJSON
+	if format == formatYAML {
+		parse, render = parseYAML, renderYAML
+	}
+
+	var baseNode *structNode
+	if base != nil {
+		n, err := parse(base)
+		if err != nil {
+			return nil, nil, fmt.Errorf("base: %w", err)
+		}
+		baseNode = n
+	}
+	oursNode, err := parse(ours)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ours: %w", err)
+	}
+	theirsNode, err := parse(theirs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("theirs: %w", err)
+	}
+
+	conflicts := []string{}
+	merged := merge3(baseNode, oursNode, theirsNode, "", &conflicts)
+	if len(conflicts) > 0 {
+		return nil, conflicts, nil
+	}
+	return render(merged, ours), nil, nil
+}
+
+// structuredMerge 用冲突文件的三个索引阶段做结构化合并，成功时写入并暂存结果
+// Structurally merges a conflicted file from its three index stages and writes and stages the result on success
+func (mm *MergeManager) structuredMerge(file string, stages map[int]string, sides conflictSides) error {
+	format := structuredFormat(file)
+	if format == "" {
+		return fmt.Errorf("not a JSON or YAML file")
+	}
+	if stages[sides.local] == "" || stages[sides.remote] == "" {
+		return fmt.Errorf("one side deleted the file")
+	}
+
+	var base []byte
+	if hash, ok := stages[git.StageBase]; ok {
+		content, err := mm.gitOps.ReadBlob(hash, file)
+		if err != nil {
+			return err
+		}
+		base = content
+	}
+	ours, err := mm.gitOps.ReadBlob(stages[sides.local], file)
+	if err != nil {
+		return err
+	}
+	theirs, err := mm.gitOps.ReadBlob(stages[sides.remote], file)
+	if err != nil {
+		return err
+	}
+
+	merged, conflicts, err := mergeStructured(format, base, ours, theirs)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("same keys changed differently on both sides: %s", strings.Join(conflicts, ", "))
+	}
+
+	if err := os.WriteFile(filepath.Join(mm.cfg.RepoRoot, file), merged, 0644); err != nil {
+		return err
+	}
+	return mm.gitOps.Add(file)
+}
+
+// predictStructuredMerge 演练模式下用提交中的版本预测结构化合并能否成功
+// Predicts in dry-run mode whether a structured merge would succeed, using the committed versions
+func (mm *MergeManager) predictStructuredMerge(file, base, remoteRef string) error {
+	format := structuredFormat(file)
+	if format == "" {
+		return fmt.Errorf("not a JSON or YAML file")
+	}
+
+	ours, err := mm.gitOps.ReadBlob("HEAD:"+file, file)
+	if err != nil {
+		return err
+	}
+	theirs, err := mm.gitOps.ReadBlob(remoteRef+":"+file, file)
+	if err != nil {
+		return err
+	}
+	// 祖先中不存在时视为双方新增 / Missing from the ancestor means both sides added it
+	baseContent, err := mm.gitOps.ReadBlob(base+":"+file, file)
+	if err != nil {
+		baseContent = nil
+	}
+
+	_, conflicts, err := mergeStructured(format, baseContent, ours, theirs)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("same keys changed differently on both sides: %s", strings.Join(conflicts, ", "))
+	}
+	return nil
+}
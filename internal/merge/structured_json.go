@@ -0,0 +1,130 @@
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseJSON 把 JSON 文档解析为保留键顺序的树；对象以外的值作为叶子，以紧凑形式比较
+// Parses a JSON document into a tree that keeps key order; values other than objects are leaves compared in compact form
+func parseJSON(data []byte) (*structNode, error) {
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+	return parseJSONValue(bytes.TrimSpace(data))
+}
+
+// parseJSONValue 解析单个已校验的 JSON 值
+// Parses a single, already validated JSON value
+func parseJSONValue(data []byte) (*structNode, error) {
+	if len(data) == 0 || data[0] != '{' {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, data); err != nil {
+			return nil, err
+		}
+		return &structNode{leaf: compact.String()}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	node := &structNode{children: map[string]*structNode{}}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v", tok)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		child, err := parseJSONValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		// 重复的键以最后一次为准，位置保持第一次出现处
+		// A duplicate key takes the last value but keeps the position of its first occurrence
+		if _, dup := node.children[key]; !dup {
+			node.keys = append(node.keys, key)
+		}
+		node.children[key] = child
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level object")
+	}
+	return node, nil
+}
+
+// renderJSON 输出合并后的 JSON，沿用 like（本地版本）的缩进风格和结尾换行
+// Renders merged JSON, following the indentation style and trailing newline of like (the local version)
+func renderJSON(n *structNode, like []byte) []byte {
+	var compact bytes.Buffer
+	writeJSONNode(&compact, n)
+
+	out := compact.Bytes()
+	if indent, multiline := jsonIndentStyle(like); multiline {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, compact.Bytes(), "", indent); err == nil {
+			out = indented.Bytes()
+		}
+	}
+	if bytes.HasSuffix(like, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// writeJSONNode 以紧凑形式按键顺序写出节点
+// Writes a node in compact form, in key order
+func writeJSONNode(buf *bytes.Buffer, n *structNode) {
+	if !n.isMapping() {
+		buf.WriteString(n.leaf)
+		return
+	}
+	buf.WriteByte('{')
+	for i, k := range n.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(encodeJSONString(k))
+		buf.WriteByte(':')
+		writeJSONNode(buf, n.children[k])
+	}
+	buf.WriteByte('}')
+}
+
+// encodeJSONString 编码 JSON 字符串，不转义 HTML 字符
+// Encodes a JSON string without escaping HTML characters
+func encodeJSONString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonIndentStyle 检测文档的缩进字符串，单行文档返回 multiline=false
+// Detects the document's indentation string; single-line documents return multiline=false
+func jsonIndentStyle(data []byte) (indent string, multiline bool) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 2 {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)], true
+		}
+	}
+	return "  ", true
+}
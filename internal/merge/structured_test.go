@@ -0,0 +1,138 @@
+// structured_test.go - Structured JSON/YAML merge unit tests / JSON/YAML 结构化合并单元测试
+//
+// Module: merge
+// Description: Tests key-level three-way merges of JSON and YAML documents
+// Author: git-autosync contributors
+// Dependencies: strings, testing
+
+package merge
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMergeStructured_JSON tests merging unrelated key changes and detecting real conflicts in JSON
+// 测试 JSON 中不相关键的合并以及真正冲突的检测
+func TestMergeStructured_JSON(t *testing.T) {
+	base := `{
+  "editor": {"font": 12, "theme": "dark"},
+  "plugins": ["a"],
+  "removed": true
+}
+`
+	ours := `{
+  "editor": {"font": 14, "theme": "dark"},
+  "plugins": ["a"],
+  "removed": true,
+  "local": "<x>"
+}
+`
+	theirs := `{
+  "editor": {"font": 12, "theme": "light"},
+  "plugins": ["a", "b"]
+}
+`
+	merged, conflicts, err := mergeStructured(formatJSON, []byte(base), []byte(ours), []byte(theirs))
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("Unexpected result: conflicts=%v err=%v", conflicts, err)
+	}
+
+	expected := `{
+  "editor": {
+    "font": 14,
+    "theme": "light"
+  },
+  "plugins": [
+    "a",
+    "b"
+  ],
+  "local": "<x>"
+}
+`
+	if string(merged) != expected {
+		t.Errorf("Unexpected merge result:\n%s", merged)
+	}
+
+	t.Run("Same key changed differently", func(t *testing.T) {
+		theirs := strings.Replace(base, `"font": 12`, `"font": 16`, 1)
+		_, conflicts, err := mergeStructured(formatJSON, []byte(base), []byte(ours), []byte(theirs))
+		if err != nil || len(conflicts) != 1 || conflicts[0] != "editor.font" {
+			t.Errorf("Expected a conflict on editor.font, got %v (err %v)", conflicts, err)
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		if _, _, err := mergeStructured(formatJSON, []byte(base), []byte(`{"a":`), []byte(theirs)); err == nil {
+			t.Error("Expected an error for invalid JSON")
+		}
+	})
+}
+
+// TestMergeStructured_YAML tests that YAML merges keep comments and layout
+// 测试 YAML 合并保留注释和格式
+func TestMergeStructured_YAML(t *testing.T) {
+	base := `# settings
+server:
+  host: localhost  # dev
+  port: 8080
+paths:
+- /a
+log: info
+`
+	ours := `# settings
+server:
+  host: localhost  # dev
+  port: 9090
+paths:
+- /a
+log: info
+`
+	theirs := `# settings
+server:
+  host: localhost  # dev
+  port: 8080
+  tls: true
+paths:
+- /a
+- /b
+`
+	merged, conflicts, err := mergeStructured(formatYAML, []byte(base), []byte(ours), []byte(theirs))
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("Unexpected result: conflicts=%v err=%v", conflicts, err)
+	}
+
+	expected := `# settings
+server:
+  host: localhost  # dev
+  port: 9090
+  tls: true
+paths:
+- /a
+- /b
+`
+	if string(merged) != expected {
+		t.Errorf("Unexpected merge result:\n%s", merged)
+	}
+
+	t.Run("Same key changed differently", func(t *testing.T) {
+		theirs := strings.Replace(base, "port: 8080", "port: 7070", 1)
+		_, conflicts, _ := mergeStructured(formatYAML, []byte(base), []byte(ours), []byte(theirs))
+		if len(conflicts) != 1 || conflicts[0] != "server.port" {
+			t.Errorf("Expected a conflict on server.port, got %v", conflicts)
+		}
+	})
+
+	t.Run("Unsupported constructs", func(t *testing.T) {
+		for _, doc := range []string{
+			"a: &x 1\nb: *x\n",
+			"a: 1\n---\nb: 2\n",
+			"- a\n- b\n",
+			"a:\n\tb: 1\n",
+		} {
+			if _, err := parseYAML([]byte(doc)); err == nil {
+				t.Errorf("Expected %q to be rejected", doc)
+			}
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package merge
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlEntry 映射中一个键的原始行，输出时原样写回以保留注释和格式
+// Raw lines of one key in a mapping, written back verbatim on output so comments and layout survive
+type yamlEntry struct {
+	lead    []string // 键之前的注释和空行 / Comment and blank lines before the key
+	keyLine string   // 键所在行 / The key's line
+	body    []string // 叶子值的后续行 / Following lines of a leaf value
+	tail    []string // 映射末尾的注释和空行 / Comment and blank lines at the end of a mapping
+}
+
+// yamlKeyPattern 匹配块映射中的 "key:" 行：引号键，或不以 YAML 指示符开头的普通键
+// Matches a "key:" line of a block mapping: a quoted key, or a plain key not starting with a YAML indicator
+var yamlKeyPattern = regexp.MustCompile(`^( *)("(?:[^"\\]|\\.)*"|'(?:[^']|'')*'|[^\s#"'?{}\[\],&*!|>%@` + "`" + `-][^#]*?|-[^\s#][^#]*?)[ \t]*:(?:[ \t]|$)`)
+
+// yamlParser 块映射 YAML 的解析器
+// Parser for block-mapping YAML
+// 只支持以块映射为根的单文档；锚点、别名、合并键、复杂键和制表符缩进会被拒绝，由调用方回退到普通冲突处理
+// Only single documents rooted at a block mapping are supported; anchors, aliases, merge keys, complex keys and tab
+// indentation are rejected so the caller falls back to normal conflict handling
+// 非映射的值（标量、序列、块标量、流式集合）作为叶子按原始文本比较
+// Values that are not mappings (scalars, sequences, block scalars, flow collections) are leaves compared by raw text
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+// parseYAML 解析 YAML 文档
+// Parses a YAML document
+func parseYAML(data []byte) (*structNode, error) {
+	text := string(data)
+	if strings.Contains(text, "\r") {
+		return nil, fmt.Errorf("CRLF line endings are not supported")
+	}
+
+	p := &yamlParser{lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n")}
+	if text == "" {
+		p.lines = nil
+	}
+
+	// 开头的注释和可选的 "---" 作为第一个键的前导行
+	// Leading comments and an optional "---" become lead lines of the first key
+	var header []string
+	separator := false
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if !yamlBlankOrComment(line) {
+			if separator || strings.TrimRight(line, " ") != "---" {
+				break
+			}
+			separator = true
+		}
+		header = append(header, line)
+		p.pos++
+	}
+
+	root, err := p.parseMapping(0, header)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unsupported YAML construct", p.pos+1)
+	}
+	return root, nil
+}
+
+// parseMapping 解析缩进为 indent 的块映射，lead 为第一个键之前已读取的行
+// Parses a block mapping at the given indentation; lead holds lines already read before the first key
+func (p *yamlParser) parseMapping(indent int, lead []string) (*structNode, error) {
+	node := &structNode{children: map[string]*structNode{}, indent: indent, yaml: &yamlEntry{}}
+	pending := lead
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if yamlBlankOrComment(line) {
+			pending = append(pending, line)
+			p.pos++
+			continue
+		}
+		if err := yamlCheckIndent(line, p.pos); err != nil {
+			return nil, err
+		}
+
+		ind := yamlIndent(line)
+		if ind < indent {
+			break
+		}
+		if ind > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.pos+1)
+		}
+
+		m := yamlKeyPattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: not a mapping key", p.pos+1)
+		}
+		key := yamlKeyName(m[2])
+		if key == "<<" {
+			return nil, fmt.Errorf("line %d: merge keys are not supported", p.pos+1)
+		}
+		if _, dup := node.children[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", p.pos+1, key)
+		}
+
+		entry := &yamlEntry{lead: pending, keyLine: line}
+		pending = nil
+		p.pos++
+
+		value := strings.TrimSpace(line[len(m[0]):])
+		if strings.HasPrefix(value, "#") {
+			value = ""
+		}
+		if strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*") {
+			return nil, fmt.Errorf("line %d: anchors and aliases are not supported", p.pos)
+		}
+
+		var child *structNode
+		if childIndent, ok := p.childMappingIndent(indent); value == "" && ok {
+			sub, err := p.parseMapping(childIndent, nil)
+			if err != nil {
+				return nil, err
+			}
+			sub.yaml.lead, sub.yaml.keyLine = entry.lead, entry.keyLine
+			child = sub
+		} else {
+			entry.body = p.collectBody(indent, value == "")
+			child = &structNode{yaml: entry, leaf: yamlLeafText(line[len(m[0]):], entry.body)}
+			for _, l := range entry.body {
+				if t := strings.TrimSpace(l); strings.HasPrefix(t, "&") || strings.HasPrefix(t, "*") ||
+					strings.HasPrefix(t, "- &") || strings.HasPrefix(t, "- *") {
+					return nil, fmt.Errorf("anchors and aliases are not supported (key %q)", key)
+				}
+			}
+		}
+
+		node.keys = append(node.keys, key)
+		node.children[key] = child
+	}
+
+	node.yaml.tail = pending
+	return node, nil
+}
+
+// childMappingIndent 检查下一个有内容的行是否为更深缩进的映射键，返回其缩进
+// Checks whether the next line with content is a mapping key at a deeper indentation and returns that indentation
+func (p *yamlParser) childMappingIndent(indent int) (int, bool) {
+	for i := p.pos; i < len(p.lines); i++ {
+		line := p.lines[i]
+		if yamlBlankOrComment(line) {
+			continue
+		}
+		ind := yamlIndent(line)
+		if ind <= indent || strings.HasPrefix(line[ind:], "-") && !yamlKeyPattern.MatchString(line) {
+			return 0, false
+		}
+		return ind, yamlKeyPattern.MatchString(line)
+	}
+	return 0, false
+}
+
+// collectBody 收集叶子值的后续行：缩进更深的行，以及值为空时同级缩进的序列项
+// Collects the following lines of a leaf value: deeper-indented lines, plus sequence items at the same indentation when the value is empty
+// 末尾的注释和空行留给下一个键 / Trailing comment and blank lines are left for the next key
+func (p *yamlParser) collectBody(indent int, allowSequence bool) []string {
+	start, end := p.pos, p.pos
+	for i := p.pos; i < len(p.lines); i++ {
+		line := p.lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		ind := yamlIndent(line)
+		sequenceItem := ind == indent && allowSequence && (line[ind:] == "-" || strings.HasPrefix(line[ind:], "- "))
+		if ind <= indent && !sequenceItem {
+			if yamlBlankOrComment(line) {
+				continue
+			}
+			break
+		}
+		end = i + 1
+	}
+	p.pos = end
+	return p.lines[start:end]
+}
+
+// renderYAML 按原始行输出合并后的 YAML，沿用 like（本地版本）的结尾换行
+// Renders merged YAML from the raw lines, following the trailing newline of like (the local version)
+func renderYAML(n *structNode, like []byte) []byte {
+	var lines []string
+	writeYAMLNode(&lines, n)
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 && (len(like) == 0 || strings.HasSuffix(string(like), "\n")) {
+		out += "\n"
+	}
+	return []byte(out)
+}
+
+// writeYAMLNode 追加映射节点的所有行
+// Appends all lines of a mapping node
+func writeYAMLNode(lines *[]string, n *structNode) {
+	for _, k := range n.keys {
+		c := n.children[k]
+		*lines = append(*lines, c.yaml.lead...)
+		*lines = append(*lines, c.yaml.keyLine)
+		if c.isMapping() {
+			writeYAMLNode(lines, c)
+		} else {
+			*lines = append(*lines, c.yaml.body...)
+		}
+	}
+	*lines = append(*lines, n.yaml.tail...)
+}
+
+// yamlLeafText 叶子值用于比较的文本：键行冒号之后的部分加上后续行
+// Comparison text of a leaf: the rest of the key line after the colon plus the following lines
+func yamlLeafText(rest string, body []string) string {
+	parts := []string{strings.TrimSpace(rest)}
+	for _, l := range body {
+		parts = append(parts, strings.TrimRight(l, " \t"))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// yamlKeyName 返回键的名称，引号键会去掉引号
+// Returns a key's name, removing the quotes of quoted keys
+func yamlKeyName(raw string) string {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		if s, err := strconv.Unquote(raw); err == nil {
+			return s
+		}
+	case strings.HasPrefix(raw, "'"):
+		return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'")
+	}
+	return raw
+}
+
+// yamlIndent 行首空格数
+// Number of leading spaces
+func yamlIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// yamlCheckIndent 拒绝制表符缩进和文档分隔符等不支持的行
+// Rejects tab indentation, document separators and other unsupported lines
+func yamlCheckIndent(line string, pos int) error {
+	rest := line[yamlIndent(line):]
+	switch {
+	case strings.HasPrefix(rest, "\t"):
+		return fmt.Errorf("line %d: tab indentation", pos+1)
+	case strings.HasPrefix(line, "---") || strings.HasPrefix(line, "..."):
+		return fmt.Errorf("line %d: multiple documents are not supported", pos+1)
+	case strings.HasPrefix(line, "%"):
+		return fmt.Errorf("line %d: directives are not supported", pos+1)
+	case strings.HasPrefix(rest, "? "):
+		return fmt.Errorf("line %d: complex keys are not supported", pos+1)
+	}
+	return nil
+}
+
+// yamlBlankOrComment 是否为空行或注释行
+// Whether the line is blank or a comment
+func yamlBlankOrComment(line string) bool {
+	t := strings.TrimSpace(line)
+	return t == "" || strings.HasPrefix(t, "#")
+}
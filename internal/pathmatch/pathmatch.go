@@ -0,0 +1,42 @@
+// Package pathmatch / 路径模式匹配包
+// Module: Path Pattern Matching / 路径模式匹配
+// Function: Matches repository-relative paths against the pattern syntax shared by conflict_rule and the secret allowlist
+//           按 conflict_rule 和敏感信息白名单共用的模式语法匹配仓库相对路径
+// Author: git-autosync contributors
+// Dependencies: path, path/filepath, strings
+
+package pathmatch
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Match 判断仓库相对路径是否匹配模式
+// Reports whether a repository-relative path matches a pattern
+// 不含 / 的模式匹配文件名；以 /** 结尾的模式匹配目录下的所有文件；其余匹配完整路径
+// Patterns without / match the file name; patterns ending in /** match everything below a directory; the rest match the full path
+func Match(pattern, file string) bool {
+	file = filepath.ToSlash(file)
+
+	if strings.HasSuffix(pattern, "/**") {
+		dir := strings.TrimSuffix(pattern, "/**")
+		for i := 0; i < len(file); i++ {
+			if file[i] != '/' {
+				continue
+			}
+			if ok, _ := path.Match(dir, file[:i]); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
@@ -0,0 +1,35 @@
+// pathmatch_test.go - Path pattern matching unit tests / 路径模式匹配单元测试
+//
+// Module: pathmatch
+// Description: Tests file name patterns, full path patterns and directory patterns ending in /**
+// Author: git-autosync contributors
+// Dependencies: testing
+
+package pathmatch
+
+import "testing"
+
+// TestMatch tests the three kinds of patterns
+// 测试三种模式
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, file string
+		want          bool
+	}{
+		{"*.lock", "yarn.lock", true},
+		{"*.lock", "web/yarn.lock", true},
+		{"*.lock", "web/yarn.lock.bak", false},
+		{"docs/*.md", "docs/guide.md", true},
+		{"docs/*.md", "docs/api/guide.md", false},
+		{"docs/*.md", "guide.md", false},
+		{"fixtures/**", "fixtures/keys/id_rsa", true},
+		{"fixtures/**", "test/fixtures/id_rsa", false},
+		{"fixtures/**", "fixtures", false},
+		{"*/testdata/**", "crypt/testdata/key", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package plan / 演练计划包
+// Module: Dry-Run Action Recorder / 演练动作记录器
+// Function: Records intended index, commit and push actions instead of performing them
+//           记录计划中的索引、提交和推送动作，而不实际执行
+// Author: git-autosync contributors
+// Dependencies: encoding/json, fmt, io, sync
+
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 动作类型 / Action kinds
+const (
+	ActionStage        = "stage"         // 暂存文件 / Stage a file
+	ActionUntrack      = "untrack"       // 取消追踪 / Untrack a file
+	ActionLFSTrack     = "lfs-track"     // LFS 追踪模式 / Add an LFS pattern
+	ActionIgnoreAppend = "ignore-append" // 追加到忽略文件 / Append to an ignore file
+	ActionIndexUpdate  = "index-update"  // 子仓库索引条目 / Subrepo index entry
+	ActionWriteFile    = "write-file"    // 写入工作区文件 / Write a working tree file
+	ActionRemovePath   = "remove-path"   // 删除工作区路径 / Remove a working tree path
+	ActionRemoveLock   = "remove-lock"   // 删除过期锁文件 / Remove a stale lock file
+	ActionGitConfig    = "git-config"    // 修改仓库配置 / Change repository config
+	ActionCommit       = "commit"        // 提交 / Commit
+	ActionPush         = "push"          // 推送 / Push
+	ActionForcePush    = "force-push"    // 强制推送 / Force push
+	ActionFastForward  = "fast-forward"  // 快进拉取 / Fast-forward pull
+	ActionMerge        = "merge"         // 三路合并 / Three-way merge
+	ActionRebase       = "rebase"        // 变基到远程分支 / Rebase onto the remote branch
+	ActionCompact      = "compact"       // 压缩自动同步提交 / Squash auto-sync commits
+	ActionConflict     = "conflict"      // 预测的冲突文件 / Predicted conflicting file
+	ActionResolve      = "resolve"       // 冲突自动解决 / Automatic conflict resolution
+	ActionBranch       = "branch"        // 创建/删除分支 / Create or delete a branch
+	ActionReset        = "reset"         // 重置 / Reset
+	ActionSecret       = "secret"        // 检测到的敏感信息 / Detected secret
+)
+
+// Action 计划中的单个动作
+// A single planned action
+type Action struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Plan 演练计划（并发安全）
+// Dry-run plan (safe for concurrent use)
+// nil 表示未启用演练模式，所有方法对 nil 接收者都是安全的
+// nil means dry-run is disabled; every method is safe on a nil receiver
+type Plan struct {
+	mu      sync.Mutex
+	actions []Action
+}
+
+// New 创建空计划
+// Creates an empty plan
+func New() *Plan {
+	return &Plan{}
+}
+
+// Record 记录一个计划动作
+// Records a planned action
+func (p *Plan) Record(kind, target, detail string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions = append(p.actions, Action{Kind: kind, Target: target, Detail: detail})
+}
+
+// Actions 返回所有已记录动作的副本
+// Returns a copy of all recorded actions
+func (p *Plan) Actions() []Action {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Action(nil), p.actions...)
+}
+
+// Has 是否记录过任一指定类型的动作
+// Whether any action of the given kinds was recorded
+func (p *Plan) Has(kinds ...string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, a := range p.actions {
+		for _, k := range kinds {
+			if a.Kind == k {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteJSON 以 JSON 输出计划
+// Writes the plan as JSON
+func (p *Plan) WriteJSON(w io.Writer) error {
+	actions := p.Actions()
+	if actions == nil {
+		actions = []Action{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		DryRun  bool     `json:"dry_run"`
+		Actions []Action `json:"actions"`
+	}{DryRun: true, Actions: actions})
+}
+
+// WriteText 以可读文本输出计划，每类动作最多列出 maxPerKind 个目标
+// Writes the plan as readable text, listing at most maxPerKind targets per kind
+func (p *Plan) WriteText(w io.Writer, maxPerKind int) {
+	actions := p.Actions()
+	fmt.Fprintf(w, "=== 演练计划 / Dry-run plan: %d 个动作 / %d actions ===\n", len(actions), len(actions))
+	if len(actions) == 0 {
+		fmt.Fprintln(w, "  (无变更 / no changes)")
+		return
+	}
+
+	// 按首次出现顺序分组 / Group by order of first appearance
+	var kinds []string
+	grouped := make(map[string][]Action)
+	for _, a := range actions {
+		if _, ok := grouped[a.Kind]; !ok {
+			kinds = append(kinds, a.Kind)
+		}
+		grouped[a.Kind] = append(grouped[a.Kind], a)
+	}
+
+	for _, kind := range kinds {
+		list := grouped[kind]
+		fmt.Fprintf(w, "[%s] %d\n", kind, len(list))
+		for i, a := range list {
+			if maxPerKind > 0 && i >= maxPerKind {
+				fmt.Fprintf(w, "  • ... 另有 %d 个 / %d more\n", len(list)-i, len(list)-i)
+				break
+			}
+			switch {
+			case a.Target != "" && a.Detail != "":
+				fmt.Fprintf(w, "  • %s (%s)\n", a.Target, a.Detail)
+			case a.Target != "":
+				fmt.Fprintf(w, "  • %s\n", a.Target)
+			default:
+				fmt.Fprintf(w, "  • %s\n", a.Detail)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package secrets / 敏感信息扫描包
+// Module: Secret Scanner / 敏感信息扫描器
+// Function: Detects private keys, cloud credentials, tokens and high-entropy secret assignments in staged content
+//           在暂存内容中检测私钥、云服务凭据、令牌和高熵的密钥赋值
+// Author: git-autosync contributors
+// Dependencies: bufio, bytes, crypto/sha256, encoding/hex, fmt, math, os, regexp, strings, pathmatch
+
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/find-xposed-magisk/git-sync/internal/pathmatch"
+)
+
+// MaxScanBytes 超过该大小的内容不扫描（大文件由 LFS 处理，索引中只是指针）
+// Content larger than this is not scanned (large files go to LFS and the index only holds a pointer)
+const MaxScanBytes = 1 << 20
+
+// entropyThreshold 通用密钥规则要求的最小香农熵（比特/字符）
+// Minimum Shannon entropy (bits per character) required by the generic secret rule
+const entropyThreshold = 3.5
+
+// rule 一条检测规则
+// A detection rule
+type rule struct {
+	id      string
+	re      *regexp.Regexp
+	group   int  // 作为密钥的捕获组，0 表示整个匹配 / Capture group holding the secret, 0 for the whole match
+	entropy bool // 是否要求高熵 / Whether the secret must have high entropy
+}
+
+// rules 内置检测规则
+// Built-in detection rules
+var rules = []rule{
+	{id: "private-key", re: regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`)},
+	{id: "aws-access-key-id", re: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{id: "aws-secret-access-key", re: regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), group: 1},
+	{id: "github-token", re: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{id: "gitlab-token", re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{id: "slack-token", re: regexp.MustCompile(`\bxox[baprs]-[A-Za-z0-9-]{10,}\b`)},
+	{id: "stripe-key", re: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{24,}\b`)},
+	{id: "google-api-key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{
+		id:      "generic-secret",
+		re:      regexp.MustCompile(`(?i)(secret|token|passw(or)?d|api[_-]?key|access[_-]?key|auth[_-]?key|credential)[a-z0-9_.-]*["']?\s*[:=]\s*["']?([A-Za-z0-9/+=_.~-]{16,})`),
+		group:   3,
+		entropy: true,
+	},
+}
+
+// Finding 一处检测到的敏感信息
+// One detected secret
+type Finding struct {
+	Path        string // 文件路径 / File path
+	Line        int    // 行号（从 1 开始）/ Line number (1-based)
+	Rule        string // 规则 ID / Rule ID
+	Redacted    string // 脱敏后的密钥 / The secret, redacted
+	Fingerprint string // 写入白名单文件可忽略此发现 / Add to the allowlist file to ignore this finding
+}
+
+// String 返回适合写入日志的脱敏描述
+// Returns a redacted description suitable for logging
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d [%s] %s (fingerprint %s)", f.Path, f.Line, f.Rule, f.Redacted, f.Fingerprint)
+}
+
+// Allowlist 白名单：路径模式和发现指纹
+// Allowlist of path patterns and finding fingerprints
+type Allowlist struct {
+	patterns     []string
+	fingerprints map[string]bool
+}
+
+// LoadAllowlist 读取白名单文件，文件不存在时返回空白名单
+// Reads the allowlist file, returning an empty allowlist when it does not exist
+// 每行一个条目，# 开头为注释：形如 sha256:<hex> 的行是发现指纹，其余为路径模式（语法同 conflict_rule）
+// One entry per line, # starts a comment: lines of the form sha256:<hex> are finding fingerprints, the rest are path
+// patterns (same syntax as conflict_rule)
+func LoadAllowlist(file string) (*Allowlist, error) {
+	a := &Allowlist{fingerprints: map[string]bool{}}
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return a, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "sha256:") {
+			a.fingerprints[line] = true
+			continue
+		}
+		a.patterns = append(a.patterns, line)
+	}
+	return a, scanner.Err()
+}
+
+// AllowsPath 路径是否整体在白名单中
+// Whether a path is allowlisted as a whole
+func (a *Allowlist) AllowsPath(file string) bool {
+	for _, p := range a.patterns {
+		if pathmatch.Match(p, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan 扫描一个文件的内容，返回未被白名单排除的发现
+// Scans one file's content and returns the findings not excluded by the allowlist
+// 二进制内容和超过 MaxScanBytes 的内容被跳过
+// Binary content and content larger than MaxScanBytes are skipped
+func (a *Allowlist) Scan(file string, content []byte) []Finding {
+	if a.AllowsPath(file) || len(content) > MaxScanBytes || bytes.IndexByte(content, 0) >= 0 {
+		return nil
+	}
+
+	var findings []Finding
+	for i, line := range strings.Split(string(content), "\n") {
+		// 专用规则已报告的密钥不再由通用规则重复报告
+		// Secrets already reported by a specific rule are not reported again by the generic rule
+		reported := map[string]bool{}
+		for _, r := range rules {
+			for _, m := range r.re.FindAllStringSubmatch(line, -1) {
+				secret := m[r.group]
+				if reported[secret] {
+					continue
+				}
+				if r.entropy && !looksRandom(secret) {
+					continue
+				}
+				reported[secret] = true
+				fp := fingerprint(r.id, secret)
+				if a.fingerprints[fp] {
+					continue
+				}
+				findings = append(findings, Finding{Path: file, Line: i + 1, Rule: r.id, Redacted: redact(secret), Fingerprint: fp})
+			}
+		}
+	}
+	return findings
+}
+
+// fingerprint 由规则和密钥计算的稳定指纹，不随文件或行号变化
+// A stable fingerprint of the rule and the secret that does not change with the file or line
+func fingerprint(ruleID, secret string) string {
+	sum := sha256.Sum256([]byte(ruleID + ":" + secret))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// redact 只保留开头几个字符和长度
+// Keeps only the first few characters and the length
+func redact(secret string) string {
+	keep := 4
+	if len(secret) < 12 {
+		keep = 0
+	}
+	return fmt.Sprintf("%s****(%d chars)", secret[:keep], len(secret))
+}
+
+// entropy 计算字符串每个字符的香农熵
+// Computes the per-character Shannon entropy of a string
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	e := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// looksRandom 值是否像随机生成的密钥：同时含字母和数字、熵足够高，且不是示例配置中常见的占位值
+// Whether a value looks like a generated secret: it mixes letters and digits, has enough entropy and is not a
+// placeholder common in example configs
+func looksRandom(s string) bool {
+	if !strings.ContainsAny(s, "0123456789") || !strings.ContainsAny(strings.ToLower(s), "abcdefghijklmnopqrstuvwxyz") {
+		return false
+	}
+	if entropy(s) < entropyThreshold {
+		return false
+	}
+	lower := strings.ToLower(s)
+	for _, p := range []string{"example", "placeholder", "changeme", "your_", "your-", "xxxx"} {
+		if strings.Contains(lower, p) {
+			return false
+		}
+	}
+	return true
+}
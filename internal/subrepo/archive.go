@@ -0,0 +1,235 @@
+package subrepo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
+)
+
+// archiveFileName 归档模式下 .git 的存储文件名
+// File name the .git directory is stored under in archive mode
+const archiveFileName = "gitdir.tar"
+
+// archiveEpoch 归档条目统一使用的修改时间，保证未变化的仓库产生相同的字节
+// Modification time used for every archive entry so an unchanged repository produces identical bytes
+var archiveEpoch = time.Unix(0, 0)
+
+// archiveMode 检查子仓库是否配置为以 gitdir.tar 归档存储
+// Checks whether the sub-repository is configured to be stored as a gitdir.tar archive
+func (sp *SubrepoProcessor) archiveMode(relSubrepo string) bool {
+	rel := filepath.ToSlash(relSubrepo)
+	for _, pattern := range sp.cfg.SubrepoArchiveDirs {
+		if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareGitDirStorage 按存储模式准备子仓库的 .git 表示形式
+// Prepares the committed representation of a sub-repository's .git according to its storage mode
+// 归档模式：把 .git 打包为 gitdir.tar（之后作为普通工作文件处理），并删除逐文件模式留下的 gitdir/
+// Archive mode: packs .git into gitdir.tar (processed as a regular work file afterwards) and removes the gitdir/ left by per-file mode
+// 逐文件模式：删除归档模式留下的 gitdir.tar
+// Per-file mode: removes the gitdir.tar left by archive mode
+// 没有 .git 时（例如新克隆尚未恢复）保持已提交的形式不变
+// Without a .git (e.g. a fresh clone that was not restored yet) the committed form is left as is
+func (sp *SubrepoProcessor) prepareGitDirStorage(subrepoDir, relSubrepo string, archive bool) error {
+	if info, err := os.Stat(filepath.Join(subrepoDir, ".git")); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	stale := filepath.Join(subrepoDir, archiveFileName)
+	if archive {
+		stale = filepath.Join(subrepoDir, "gitdir")
+	}
+	if _, err := os.Stat(stale); err == nil {
+		relStale, _ := filepath.Rel(sp.cfg.RepoRoot, stale)
+		sp.logger.Info("存储模式已切换，删除旧的表示形式 / Storage mode changed, removing the old representation: %s", relStale)
+		if sp.gitOps.DryRun() {
+			sp.gitOps.Plan().Record(plan.ActionRemovePath, relStale, "storage mode changed")
+		} else if err := os.RemoveAll(stale); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", relStale, err)
+		}
+	}
+
+	if !archive {
+		return nil
+	}
+
+	relArchive := filepath.ToSlash(filepath.Join(relSubrepo, archiveFileName))
+	if sp.cfg.SubrepoArchiveLFS {
+		if err := sp.ensureArchiveLFSTracked(relArchive); errors.Is(err, git.ErrEncrypted) {
+			sp.logger.Warn("归档已加密，不使用 LFS 追踪 / Archive is encrypted, not tracking it with LFS: %s", relArchive)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if sp.gitOps.DryRun() {
+		sp.gitOps.Plan().Record(plan.ActionWriteFile, relArchive, "pack .git")
+		return nil
+	}
+
+	changed, count, err := writeGitDirArchive(subrepoDir)
+	if err != nil {
+		return fmt.Errorf("failed to archive %s/.git: %v", relSubrepo, err)
+	}
+	if changed {
+		sp.logger.Info("已更新归档 / Archive updated: %s (%d 个文件 / %d files)", relArchive, count, count)
+	} else {
+		sp.logger.Debug("  ✓ 归档未变化 / Archive unchanged: %s", relArchive)
+	}
+	return nil
+}
+
+// ensureArchiveLFSTracked 确保 gitdir.tar 已在 .gitattributes 中由 LFS 追踪
+// Ensures gitdir.tar is tracked by LFS in .gitattributes
+// 必须在计算 hash 之前完成，hash-object 才会经过 LFS clean 过滤器
+// Must happen before hashing so hash-object runs the LFS clean filter
+func (sp *SubrepoProcessor) ensureArchiveLFSTracked(relArchive string) error {
+	sp.attrMu.Lock()
+	defer sp.attrMu.Unlock()
+
+	if content, err := os.ReadFile(filepath.Join(sp.cfg.RepoRoot, ".gitattributes")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && fields[0] == relArchive && strings.Contains(line, "filter=lfs") {
+				return nil
+			}
+		}
+	}
+
+	sp.logger.Info("LFS 追踪归档 / Tracking archive with LFS: %s", relArchive)
+	return sp.gitOps.LFSTrack(relArchive)
+}
+
+// writeGitDirArchive 将 subrepoDir/.git 打包写入 subrepoDir/gitdir.tar，内容未变化时不改写文件
+// Packs subrepoDir/.git into subrepoDir/gitdir.tar, leaving the file untouched when its content is unchanged
+// 保持文件不变可以让 hash 缓存继续命中 / Leaving the file untouched keeps the hash cache hitting
+func writeGitDirArchive(subrepoDir string) (bool, int, error) {
+	target := filepath.Join(subrepoDir, archiveFileName)
+
+	tmp, err := os.CreateTemp(subrepoDir, "."+archiveFileName+".tmp-*")
+	if err != nil {
+		return false, 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.New()
+	buf := bufio.NewWriterSize(io.MultiWriter(tmp, sum), 256*1024)
+	count, err := writeDeterministicTar(buf, filepath.Join(subrepoDir, ".git"))
+	if err == nil {
+		err = buf.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, 0, err
+	}
+
+	if existing, err := fileSHA256(target); err == nil && bytes.Equal(existing, sum.Sum(nil)) {
+		return false, count, nil
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return false, 0, err
+	}
+	return true, count, nil
+}
+
+// writeDeterministicTar 把 gitDir 写成确定性的 tar：条目按路径排序，时间、属主统一，权限只保留可执行位
+// Writes gitDir as a deterministic tar: entries sorted by path, uniform times and owners, permissions reduced to the executable bit
+// 条目路径相对于 .git 根目录，与 Restore 的解包约定一致
+// Entry paths are relative to the .git root, matching what Restore extracts
+func writeDeterministicTar(w io.Writer, gitDir string) (int, error) {
+	tw := tar.NewWriter(w)
+	count := 0
+
+	// filepath.Walk 按字典序遍历，顺序稳定
+	// filepath.Walk visits entries in lexical order, so the order is stable
+	err := filepath.Walk(gitDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(gitDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		hdr := &tar.Header{
+			Name:    name,
+			ModTime: archiveEpoch,
+		}
+		switch {
+		case info.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+			hdr.Mode = 0755
+			return tw.WriteHeader(hdr)
+		case !info.Mode().IsRegular() || skipGitDirFile(name):
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// 以打开后的大小为准，避免与并发写入者产生长度不一致
+		// Use the size of the opened file so a concurrent writer cannot cause a length mismatch
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = st.Size()
+		hdr.Mode = 0644
+		if st.Mode()&0111 != 0 {
+			hdr.Mode = 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+			return fmt.Errorf("%s changed while archiving: %v", name, err)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, tw.Close()
+}
+
+// fileSHA256 计算文件内容的 SHA-256
+// Computes the SHA-256 of a file's content
+func fileSHA256(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, err
+	}
+	return sum.Sum(nil), nil
+}
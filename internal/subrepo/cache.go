@@ -1,23 +1,63 @@
 package subrepo
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// HashCacheFileName 持久化缓存文件名（位于主仓库 .git/ 下）
+// File name of the persisted cache (under the main repository's .git/)
+const HashCacheFileName = "git-autosync.hashcache"
+
+// hashCacheVersion 缓存文件格式版本，格式变化时递增
+// Cache file format version, bumped whenever the format changes
+const hashCacheVersion = 1
+
+// hashCacheHeader 缓存文件首行前缀
+// Prefix of the cache file's first line
+const hashCacheHeader = "git-autosync-hashcache"
+
+// racyWindow 修改时间距计算 hash 时不足该间隔的条目不持久化
+// Entries whose mtime was this close to the moment they were hashed are not persisted
+// 同一时间戳内的再次写入无法通过 mtime/size 发现 / A second write within the same timestamp cannot be detected by mtime/size
+const racyWindow = 2 * time.Second
+
+// ErrHashCacheCorrupt 缓存文件损坏
+// The cache file is corrupt
+var ErrHashCacheCorrupt = errors.New("hash cache file is corrupt")
+
+// ErrHashCacheVersion 缓存文件版本不兼容
+// The cache file has an incompatible version
+var ErrHashCacheVersion = errors.New("hash cache file has an unsupported version")
+
 // HashCacheEntry hash缓存条目
 // Hash cache entry
 type HashCacheEntry struct {
 	Hash    string
 	ModTime time.Time
 	Size    int64
+	
+	racy    bool // 不持久化 / Not persisted
+	touched bool // 本轮保存以来被访问过 / Accessed since the last save
 }
 
 // HashCache hash缓存
 // Hash cache
 type HashCache struct {
-	cache map[string]HashCacheEntry
-	mu    sync.RWMutex
+	cache  map[string]HashCacheEntry
+	mu     sync.RWMutex
+	hits   int
+	misses int
+	dirty  bool // 自上次保存以来有变化 / Changed since the last save
 }
 
 // NewHashCache 创建hash缓存
@@ -31,20 +71,23 @@ func NewHashCache() *HashCache {
 // Get 获取缓存的hash
 // Gets cached hash
 func (hc *HashCache) Get(path string, modTime time.Time, size int64) (string, bool) {
-	hc.mu.RLock()
-	defer hc.mu.RUnlock()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
 	
 	entry, exists := hc.cache[path]
-	if !exists {
-		return "", false
-	}
 	
 	// 检查文件是否被修改
 	// Check if file has been modified
-	if entry.ModTime.Equal(modTime) && entry.Size == size {
+	if exists && entry.ModTime.Equal(modTime) && entry.Size == size {
+		hc.hits++
+		if !entry.touched {
+			entry.touched = true
+			hc.cache[path] = entry
+		}
 		return entry.Hash, true
 	}
 	
+	hc.misses++
 	return "", false
 }
 
@@ -58,7 +101,10 @@ func (hc *HashCache) Set(path, hash string, modTime time.Time, size int64) {
 		Hash:    hash,
 		ModTime: modTime,
 		Size:    size,
+		racy:    time.Since(modTime) < racyWindow,
+		touched: true,
 	}
+	hc.dirty = true
 }
 
 // Clear 清空缓存
@@ -68,6 +114,7 @@ func (hc *HashCache) Clear() {
 	defer hc.mu.Unlock()
 	
 	hc.cache = make(map[string]HashCacheEntry)
+	hc.dirty = true
 }
 
 // Size 获取缓存大小
@@ -78,3 +125,214 @@ func (hc *HashCache) Size() int {
 	
 	return len(hc.cache)
 }
+
+// Stats 返回自上次 ResetStats 以来的命中和未命中次数
+// Returns the number of hits and misses since the last ResetStats
+func (hc *HashCache) Stats() (hits, misses int) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	
+	return hc.hits, hc.misses
+}
+
+// ResetStats 重置命中统计
+// Resets the hit statistics
+func (hc *HashCache) ResetStats() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	
+	hc.hits, hc.misses = 0, 0
+}
+
+// Hashes 返回缓存中所有不同的 hash
+// Returns every distinct hash in the cache
+func (hc *HashCache) Hashes() []string {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	
+	seen := make(map[string]bool, len(hc.cache))
+	hashes := make([]string, 0, len(hc.cache))
+	for _, entry := range hc.cache {
+		if !seen[entry.Hash] {
+			seen[entry.Hash] = true
+			hashes = append(hashes, entry.Hash)
+		}
+	}
+	return hashes
+}
+
+// DropHashes 删除 hash 属于给定集合的条目，返回删除数量
+// Drops the entries whose hash is in the given set and returns how many were dropped
+func (hc *HashCache) DropHashes(hashes map[string]bool) int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	
+	dropped := 0
+	for path, entry := range hc.cache {
+		if hashes[entry.Hash] {
+			delete(hc.cache, path)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		hc.dirty = true
+	}
+	return dropped
+}
+
+// Load 从文件加载缓存，路径相对 root 存储
+// Loads the cache from file; paths are stored relative to root
+// 文件不存在时返回 (0, nil)；损坏或版本不兼容时缓存保持为空并返回错误
+// Returns (0, nil) when the file does not exist; on corruption or a version mismatch the cache stays empty and an error is returned
+func (hc *HashCache) Load(file, root string) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	
+	entries, err := decodeHashCache(data, root)
+	if err != nil {
+		return 0, err
+	}
+	
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	
+	hc.cache = entries
+	hc.dirty = false
+	return len(entries), nil
+}
+
+// Save 原子地把缓存写入文件，返回写入条目数和清理掉的条目数
+// Atomically writes the cache to file and returns the number of entries written and pruned
+// 自上次保存以来未被访问且路径已不存在的条目会被清理；没有变化时不写文件
+// Entries not accessed since the last save whose path no longer exists are pruned; nothing is written when nothing changed
+func (hc *HashCache) Save(file, root string) (int, int, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	
+	pruned := 0
+	for path, entry := range hc.cache {
+		if !entry.touched {
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				delete(hc.cache, path)
+				pruned++
+			}
+			continue
+		}
+		entry.touched = false
+		hc.cache[path] = entry
+	}
+	
+	if !hc.dirty && pruned == 0 {
+		return 0, 0, nil
+	}
+	
+	data, written := encodeHashCache(hc.cache, root)
+	if err := writeFileAtomic(file, data); err != nil {
+		return 0, pruned, err
+	}
+	hc.dirty = false
+	return written, pruned, nil
+}
+
+// encodeHashCache 编码缓存文件
+// Encodes the cache file
+// 格式 / Format:
+//   git-autosync-hashcache <version>\n
+//   <hash>\t<mtime unix nano>\t<size>\t<path relative to root>\x00   (每个条目 / per entry)
+//   sha256 <hex of everything above>\n
+func encodeHashCache(cache map[string]HashCacheEntry, root string) ([]byte, int) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d\n", hashCacheHeader, hashCacheVersion)
+	
+	written := 0
+	for path, entry := range cache {
+		if entry.racy {
+			continue
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s\t%d\t%d\t%s\x00", entry.Hash, entry.ModTime.UnixNano(), entry.Size, filepath.ToSlash(rel))
+		written++
+	}
+	
+	sum := sha256.Sum256(buf.Bytes())
+	fmt.Fprintf(&buf, "sha256 %s\n", hex.EncodeToString(sum[:]))
+	return buf.Bytes(), written
+}
+
+// decodeHashCache 解码并校验缓存文件
+// Decodes and verifies the cache file
+func decodeHashCache(data []byte, root string) (map[string]HashCacheEntry, error) {
+	header, _, ok := bytes.Cut(data, []byte("\n"))
+	fields := strings.Fields(string(header))
+	if !ok || len(fields) != 2 || fields[0] != hashCacheHeader {
+		return nil, ErrHashCacheCorrupt
+	}
+	if fields[1] != strconv.Itoa(hashCacheVersion) {
+		return nil, fmt.Errorf("%w: %s", ErrHashCacheVersion, fields[1])
+	}
+	
+	// 尾部校验和 / Trailing checksum
+	const trailerLen = len("sha256 ") + sha256.Size*2 + 1
+	if len(data) < len(header)+1+trailerLen {
+		return nil, ErrHashCacheCorrupt
+	}
+	content, trailer := data[:len(data)-trailerLen], data[len(data)-trailerLen:]
+	sum := sha256.Sum256(content)
+	if string(trailer) != "sha256 "+hex.EncodeToString(sum[:])+"\n" {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrHashCacheCorrupt)
+	}
+	
+	entries := make(map[string]HashCacheEntry)
+	body := content[len(header)+1:]
+	for _, record := range bytes.Split(body, []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+		parts := strings.SplitN(string(record), "\t", 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("%w: malformed entry", ErrHashCacheCorrupt)
+		}
+		mtime, err1 := strconv.ParseInt(parts[1], 10, 64)
+		size, err2 := strconv.ParseInt(parts[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: malformed entry", ErrHashCacheCorrupt)
+		}
+		entries[filepath.Join(root, filepath.FromSlash(parts[3]))] = HashCacheEntry{
+			Hash:    parts[0],
+			ModTime: time.Unix(0, mtime),
+			Size:    size,
+		}
+	}
+	return entries, nil
+}
+
+// writeFileAtomic 先写临时文件再重命名，读者不会看到写了一半的文件
+// Writes a temporary file and renames it so readers never see a half-written file
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
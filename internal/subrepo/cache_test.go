@@ -0,0 +1,123 @@
+// cache_test.go - Hash cache persistence unit tests / hash缓存持久化单元测试
+//
+// Module: subrepo
+// Description: Tests for saving, loading, corruption detection and pruning of the hash cache
+// Author: git-autosync contributors
+// Dependencies: errors, os, path/filepath, testing, time
+
+package subrepo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHashCache_SaveLoadRoundTrip tests that saved entries are loaded back unchanged
+// 测试保存的条目能被原样加载
+func TestHashCache_SaveLoadRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, HashCacheFileName)
+	path := filepath.Join(root, "a", "file with\ttab")
+	mtime := time.Now().Add(-time.Hour)
+
+	hc := NewHashCache()
+	hc.Set(path, "0123456789abcdef0123456789abcdef01234567", mtime, 42)
+	if written, _, err := hc.Save(file, root); err != nil || written != 1 {
+		t.Fatalf("Save: written=%d err=%v", written, err)
+	}
+
+	loaded := NewHashCache()
+	if n, err := loaded.Load(file, root); err != nil || n != 1 {
+		t.Fatalf("Load: n=%d err=%v", n, err)
+	}
+	if hash, ok := loaded.Get(path, mtime, 42); !ok || hash != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("Expected cached hash after reload, got %q, %v", hash, ok)
+	}
+	if _, ok := loaded.Get(path, mtime, 43); ok {
+		t.Error("Expected a miss when the size changed")
+	}
+	if hits, misses := loaded.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("Stats: expected 1 hit and 1 miss, got %d and %d", hits, misses)
+	}
+}
+
+// TestHashCache_LoadRejectsBadFiles tests corruption and version detection
+// 测试损坏和版本不兼容的检测
+func TestHashCache_LoadRejectsBadFiles(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, HashCacheFileName)
+
+	hc := NewHashCache()
+	hc.Set(filepath.Join(root, "f"), "0123456789abcdef0123456789abcdef01234567", time.Now().Add(-time.Hour), 1)
+	if _, _, err := hc.Save(file, root); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Flipped byte", func(t *testing.T) {
+		bad := append([]byte{}, good...)
+		bad[len(bad)/2] ^= 0xff
+		os.WriteFile(file, bad, 0644)
+		if _, err := NewHashCache().Load(file, root); !errors.Is(err, ErrHashCacheCorrupt) {
+			t.Errorf("Expected ErrHashCacheCorrupt, got %v", err)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		os.WriteFile(file, good[:len(good)-10], 0644)
+		if _, err := NewHashCache().Load(file, root); !errors.Is(err, ErrHashCacheCorrupt) {
+			t.Errorf("Expected ErrHashCacheCorrupt, got %v", err)
+		}
+	})
+
+	t.Run("Future version", func(t *testing.T) {
+		os.WriteFile(file, []byte(hashCacheHeader+" 99\n"), 0644)
+		if _, err := NewHashCache().Load(file, root); !errors.Is(err, ErrHashCacheVersion) {
+			t.Errorf("Expected ErrHashCacheVersion, got %v", err)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		if n, err := NewHashCache().Load(filepath.Join(root, "absent"), root); n != 0 || err != nil {
+			t.Errorf("Expected (0, nil), got (%d, %v)", n, err)
+		}
+	})
+}
+
+// TestHashCache_SavePrunesAndSkipsRacy tests pruning of vanished paths and racy entries
+// 测试清理已消失路径以及不持久化"过新"的条目
+func TestHashCache_SavePrunesAndSkipsRacy(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, HashCacheFileName)
+	old := time.Now().Add(-time.Hour)
+
+	kept := filepath.Join(root, "kept")
+	gone := filepath.Join(root, "gone")
+	os.WriteFile(kept, []byte("x"), 0644)
+
+	hc := NewHashCache()
+	hc.Set(kept, "1111111111111111111111111111111111111111", old, 1)
+	hc.Set(gone, "2222222222222222222222222222222222222222", old, 1)
+	hc.Set(filepath.Join(root, "fresh"), "3333333333333333333333333333333333333333", time.Now(), 1)
+	hc.Save(file, root)
+
+	// 第二次保存时未被访问且已不存在的条目被清理
+	// On the next save entries that were not accessed and no longer exist are pruned
+	loaded := NewHashCache()
+	if n, _ := loaded.Load(file, root); n != 2 {
+		t.Fatalf("Expected the racy entry to be skipped, loaded %d entries", n)
+	}
+	loaded.Get(kept, old, 1)
+	if _, pruned, err := loaded.Save(file, root); err != nil || pruned != 1 {
+		t.Errorf("Expected 1 pruned entry, got %d (err %v)", pruned, err)
+	}
+	if loaded.Size() != 1 {
+		t.Errorf("Expected 1 remaining entry, got %d", loaded.Size())
+	}
+}
@@ -0,0 +1,345 @@
+package subrepo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+)
+
+// restoreStagingDir 主仓库 .git 下用于暂存恢复结果和旧 .git 备份的目录
+// Directory under the main repository's .git that holds restore staging dirs and backups of replaced .git dirs
+const restoreStagingDir = "autosync-restore"
+
+// lfsPointerPrefix Git LFS 指针文件的开头
+// Leading bytes of a Git LFS pointer file
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+// ErrGitDirNewer 现有 .git 比已提交的 gitdir 更新
+// The existing .git is newer than the committed gitdir
+var ErrGitDirNewer = errors.New("existing .git is newer than the committed gitdir")
+
+// RestoreOptions 恢复选项
+// Restore options
+type RestoreOptions struct {
+	Ref   string // 读取 gitdir 的提交，默认 HEAD / Commit to read the gitdir from, HEAD by default
+	Force bool   // 覆盖比提交更新的 .git / Overwrite a .git that is newer than the commit
+}
+
+// CommittedSubrepos 列出 ref 中提交了 gitdir 或 gitdir.tar 的子仓库（相对仓库根目录）
+// Lists the sub-repositories (relative to the repository root) that have a gitdir or gitdir.tar committed in ref
+func (sp *SubrepoProcessor) CommittedSubrepos(ref string) ([]string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	entries, err := sp.gitOps.ListTree(ref, true, sp.cfg.SubrepoBaseDirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	subrepos := []string{}
+	for _, entry := range entries {
+		var dir string
+		if i := strings.Index(entry.Path, "/gitdir/"); i >= 0 {
+			dir = entry.Path[:i]
+		} else if path.Base(entry.Path) == "gitdir.tar" {
+			dir = path.Dir(entry.Path)
+		} else {
+			continue
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			subrepos = append(subrepos, dir)
+		}
+	}
+
+	sort.Strings(subrepos)
+	return subrepos, nil
+}
+
+// Restore 从已提交的 gitdir（或 gitdir.tar）重建子仓库的 .git
+// Materializes a sub-repository's .git from its committed gitdir (or gitdir.tar)
+// 内容先写入临时目录并通过 git fsck 校验，然后整体替换；被替换的 .git 移动到主仓库 .git/autosync-restore/ 下
+// The content is written to a staging dir and validated with git fsck before being swapped in as a whole;
+// a replaced .git is moved under the main repository's .git/autosync-restore/
+// 现有 .git 中有比该提交更新的文件时拒绝覆盖，除非 opts.Force
+// Refuses to overwrite an existing .git containing files newer than that commit unless opts.Force is set
+func (sp *SubrepoProcessor) Restore(subrepo string, opts RestoreOptions) error {
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	subrepo = filepath.ToSlash(filepath.Clean(subrepo))
+
+	sp.logger.Info("恢复子仓库 / Restoring sub-repository: %s (from %s)", subrepo, ref)
+
+	// 确定来源：gitdir 目录优先，其次 gitdir.tar
+	// Determine the source: the gitdir directory first, gitdir.tar second
+	gitdirPrefix := subrepo + "/gitdir"
+	entries, err := sp.gitOps.ListTree(ref, true, gitdirPrefix)
+	if err != nil {
+		return err
+	}
+	source := gitdirPrefix
+	if len(entries) == 0 {
+		tarEntries, err := sp.gitOps.ListTree(ref, false, subrepo+"/gitdir.tar")
+		if err != nil {
+			return err
+		}
+		if len(tarEntries) == 0 {
+			return fmt.Errorf("%s has no committed gitdir or gitdir.tar in %s", subrepo, ref)
+		}
+		source = subrepo + "/gitdir.tar"
+	}
+
+	committedAt, err := sp.gitOps.LastCommitTime(ref, source)
+	if err != nil {
+		return err
+	}
+	sp.logger.Debug("  ↳ 来源 / Source: %s (提交于 / committed at %s)", source, committedAt.Format(time.RFC3339))
+
+	// 检查现有 .git 是否比提交更新
+	// Check whether the existing .git is newer than the commit
+	target := filepath.Join(sp.cfg.RepoRoot, filepath.FromSlash(subrepo), ".git")
+	_, statErr := os.Lstat(target)
+	exists := statErr == nil
+	if exists {
+		newest, err := newestModTime(target)
+		if err != nil {
+			return fmt.Errorf("failed to inspect existing %s: %v", target, err)
+		}
+		if newest.After(committedAt) {
+			if !opts.Force {
+				return fmt.Errorf("%w: %s (modified %s, committed %s)", ErrGitDirNewer,
+					subrepo, newest.Format(time.RFC3339), committedAt.Format(time.RFC3339))
+			}
+			sp.logger.Warn("现有 .git 更新，但已指定强制覆盖 / Existing .git is newer but overwrite was forced: %s", subrepo)
+		}
+	}
+
+	// 在主仓库 .git 下暂存，避免扫描工作区时看到未完成的内容
+	// Stage under the main repository's .git so a working-tree scan never sees partial content
+	stagingRoot := filepath.Join(sp.cfg.RepoRoot, ".git", restoreStagingDir)
+	if err := os.MkdirAll(stagingRoot, 0755); err != nil {
+		return err
+	}
+	slug := strings.ReplaceAll(subrepo, "/", "_")
+	staging, err := os.MkdirTemp(stagingRoot, slug+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	var count int
+	if source == gitdirPrefix {
+		count, err = sp.materializeTree(entries, gitdirPrefix+"/", staging)
+	} else {
+		count, err = sp.materializeTar(ref, source, staging)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to materialize %s: %w", source, err)
+	}
+	if err := ensureGitDirLayout(staging); err != nil {
+		return err
+	}
+	sp.logger.Debug("  ↳ 已写出 %d 个文件 / Wrote %d files", count, count)
+
+	if err := sp.gitOps.FsckGitDir(staging); err != nil {
+		return fmt.Errorf("restored %s failed validation: %w", subrepo, err)
+	}
+	sp.logger.Debug("  ✓ git fsck 通过 / git fsck passed")
+
+	// 替换：旧 .git 先移到备份位置，失败时移回
+	// Swap: move the old .git to a backup location first and move it back on failure
+	var backup string
+	if exists {
+		backup = filepath.Join(stagingRoot, fmt.Sprintf("backup-%s-%s", slug, time.Now().Format("20060102-150405")))
+		if err := os.Rename(target, backup); err != nil {
+			return fmt.Errorf("failed to move existing .git aside: %v", err)
+		}
+	}
+	if err := os.Rename(staging, target); err != nil {
+		if backup != "" {
+			os.Rename(backup, target)
+		}
+		return fmt.Errorf("failed to move restored .git into place: %v", err)
+	}
+
+	if backup != "" {
+		sp.logger.Info("  ↳ 原 .git 已备份到 / Previous .git backed up to: %s", backup)
+	}
+	sp.logger.Info("✓ 已恢复 / Restored: %s/.git (%d 个文件 / %d files)", subrepo, count, count)
+	return nil
+}
+
+// materializeTree 将 ls-tree 条目的内容写入 dest，路径去掉 prefix
+// Writes the content of ls-tree entries into dest with prefix stripped from their paths
+func (sp *SubrepoProcessor) materializeTree(entries []git.TreeEntry, prefix, dest string) (int, error) {
+	files := make([]git.TreeEntry, 0, len(entries))
+	hashes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		rel := strings.TrimPrefix(entry.Path, prefix)
+		if entry.Type != "blob" || skipGitDirFile(rel) {
+			continue
+		}
+		entry.Path = rel
+		files = append(files, entry)
+		hashes = append(hashes, entry.Hash)
+	}
+
+	i := 0
+	err := sp.gitOps.CatFileBatch(hashes, func(object string, size int64, r io.Reader) error {
+		entry := files[i]
+		i++
+		mode := os.FileMode(0644)
+		if entry.Mode == "100755" {
+			mode = 0755
+		}
+		return writeRestoredFile(filepath.Join(dest, filepath.FromSlash(entry.Path)), r, mode)
+	})
+	return i, err
+}
+
+// materializeTar 将已提交的 gitdir.tar 解包到 dest
+// Extracts the committed gitdir.tar into dest
+// 如果提交的是 LFS 指针，则使用工作区中已经 smudge 的文件
+// If the committed blob is an LFS pointer the smudged file in the working tree is used instead
+func (sp *SubrepoProcessor) materializeTar(ref, source, dest string) (int, error) {
+	count := 0
+	isPointer := false
+	err := sp.gitOps.CatFileBatch([]string{ref + ":" + source}, func(object string, size int64, r io.Reader) error {
+		br := bufio.NewReader(r)
+		if head, _ := br.Peek(len(lfsPointerPrefix)); bytes.Equal(head, []byte(lfsPointerPrefix)) {
+			isPointer = true
+			return nil
+		}
+		var err error
+		count, err = extractGitDirTar(br, dest)
+		return err
+	})
+	if err != nil || !isPointer {
+		return count, err
+	}
+
+	sp.logger.Debug("  ↳ gitdir.tar 为 LFS 指针，使用工作区文件 / gitdir.tar is an LFS pointer, using the working tree file")
+	f, err := os.Open(filepath.Join(sp.cfg.RepoRoot, filepath.FromSlash(source)))
+	if err != nil {
+		return 0, fmt.Errorf("gitdir.tar is stored in LFS and not available locally (run git lfs pull): %v", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	if head, _ := br.Peek(len(lfsPointerPrefix)); bytes.Equal(head, []byte(lfsPointerPrefix)) {
+		return 0, fmt.Errorf("gitdir.tar is stored in LFS and not fetched yet (run git lfs pull)")
+	}
+	return extractGitDirTar(br, dest)
+}
+
+// extractGitDirTar 解包 gitdir.tar（条目路径相对于 .git 根目录）
+// Extracts a gitdir.tar whose entry paths are relative to the .git root
+func extractGitDirTar(r io.Reader, dest string) (int, error) {
+	tr := tar.NewReader(r)
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return count, fmt.Errorf("unsafe path in archive: %s", hdr.Name)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return count, err
+			}
+		case tar.TypeReg:
+			if skipGitDirFile(name) {
+				continue
+			}
+			mode := os.FileMode(0644)
+			if hdr.Mode&0111 != 0 {
+				mode = 0755
+			}
+			if err := writeRestoredFile(target, tr, mode); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+}
+
+// skipGitDirFile 锁文件只在 git 运行期间有意义，不归档也不恢复
+// Lock files only mean something while git is running, so they are neither archived nor restored
+func skipGitDirFile(rel string) bool {
+	return strings.HasSuffix(rel, ".lock")
+}
+
+// writeRestoredFile 创建父目录并写入文件
+// Creates parent directories and writes the file
+func writeRestoredFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ensureGitDirLayout 补齐 git 需要但不会被提交的空目录
+// Recreates the empty directories git requires but which are never committed
+func ensureGitDirLayout(gitDir string) error {
+	if _, err := os.Stat(filepath.Join(gitDir, "HEAD")); err != nil {
+		return fmt.Errorf("restored gitdir has no HEAD")
+	}
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(gitDir, filepath.FromSlash(dir)), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newestModTime 返回目录树中最新的修改时间
+// Returns the newest modification time in a directory tree
+func newestModTime(root string) (time.Time, error) {
+	var newest time.Time
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
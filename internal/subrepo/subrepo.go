@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -13,7 +12,9 @@ import (
 
 	"github.com/find-xposed-magisk/git-sync/internal/config"
 	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/instance"
 	"github.com/find-xposed-magisk/git-sync/internal/logger"
+	"github.com/find-xposed-magisk/git-sync/internal/plan"
 )
 
 // SubrepoProcessor 特殊仓库处理器
@@ -23,6 +24,8 @@ type SubrepoProcessor struct {
 	gitOps    *git.GitOps
 	logger    *logger.Logger
 	hashCache *HashCache // hash缓存 / Hash cache
+	attrMu    sync.Mutex // 保护 .gitattributes 的并发修改 / Guards concurrent .gitattributes updates
+	writers   *git.ObjectWriterPool // 对象写入进程池，仅在 ProcessAllSubrepos 期间存在 / Object writer pool, only set during ProcessAllSubrepos
 }
 
 // NewSubrepoProcessor 创建特殊仓库处理器
@@ -36,6 +39,74 @@ func NewSubrepoProcessor(cfg *config.Config, gitOps *git.GitOps, log *logger.Log
 	}
 }
 
+// runGit 在仓库根目录通过 GitOps 的 GitRunner 执行命令
+// Runs a command in the repository root through the GitOps runner
+func (sp *SubrepoProcessor) runGit(c git.Command) (git.Result, error) {
+	c.Dir = sp.cfg.RepoRoot
+	return sp.gitOps.Runner().Run(sp.gitOps.Context(), c)
+}
+
+// hashCachePath 持久化 hash 缓存的文件路径
+// Path of the persisted hash cache file
+func (sp *SubrepoProcessor) hashCachePath() string {
+	return filepath.Join(sp.cfg.RepoRoot, ".git", HashCacheFileName)
+}
+
+// LoadHashCache 启动时从 .git/ 加载持久化的 hash 缓存
+// Loads the persisted hash cache from .git/ at startup
+// 损坏或版本不兼容的文件被忽略（下次保存时覆盖）；对象库中已不存在的 hash 会被丢弃
+// A corrupt or incompatible file is ignored (and overwritten on the next save); hashes no longer in the object database are dropped
+func (sp *SubrepoProcessor) LoadHashCache() {
+	count, err := sp.hashCache.Load(sp.hashCachePath(), sp.cfg.RepoRoot)
+	if err != nil {
+		sp.logger.Warn("hash缓存文件无效，将重建 / Hash cache file is invalid and will be rebuilt: %v", err)
+		return
+	}
+	if count == 0 {
+		return
+	}
+	
+	// 缓存的 hash 必须仍在对象库中，否则写入索引后提交会失败
+	// Cached hashes must still be in the object database, otherwise committing the index would fail
+	missing, err := sp.gitOps.MissingObjects(sp.hashCache.Hashes())
+	if err != nil {
+		sp.logger.Warn("无法校验hash缓存，已清空 / Cannot verify hash cache, cleared: %v", err)
+		sp.hashCache.Clear()
+		return
+	}
+	if dropped := sp.hashCache.DropHashes(missing); dropped > 0 {
+		sp.logger.Info("丢弃 %d 个对象已不存在的缓存条目 / Dropped %d cache entries whose objects are gone", dropped, dropped)
+	}
+	
+	sp.logger.Info("已加载hash缓存 / Loaded hash cache: %d 个条目 / %d entries", sp.hashCache.Size(), sp.hashCache.Size())
+}
+
+// reportAndSaveHashCache 输出本轮缓存命中统计并保存缓存
+// Reports this run's cache hit statistics and saves the cache
+// 演练模式下计算的 hash 没有写入对象库，不能持久化 / Hashes computed in dry-run were never written, so they must not be persisted
+func (sp *SubrepoProcessor) reportAndSaveHashCache() {
+	hits, misses := sp.hashCache.Stats()
+	rate := 0.0
+	if hits+misses > 0 {
+		rate = float64(hits) * 100 / float64(hits+misses)
+	}
+	sp.logger.Info("hash缓存 / Hash cache: 命中 %d, 未命中 %d (%.1f%%) / %d hits, %d misses (%.1f%%), 条目 / entries: %d",
+		hits, misses, rate, hits, misses, rate, sp.hashCache.Size())
+	
+	if sp.gitOps.DryRun() {
+		return
+	}
+	
+	written, pruned, err := sp.hashCache.Save(sp.hashCachePath(), sp.cfg.RepoRoot)
+	if err != nil {
+		sp.logger.Warn("保存hash缓存失败 / Failed to save hash cache: %v", err)
+		return
+	}
+	if written > 0 || pruned > 0 {
+		sp.logger.Debug("hash缓存已保存 / Hash cache saved: %d 个条目, 清理 %d 个 / %d entries, %d pruned", written, pruned, written, pruned)
+	}
+}
+
 // fileOperation 文件操作结果
 // File operation result
 type fileOperation struct {
@@ -124,6 +195,16 @@ func (sp *SubrepoProcessor) ProcessAllSubrepos() error {
 		numWorkers = numRepos
 	}
 	
+	sp.hashCache.ResetStats()
+	
+	// 缓存未命中时通过长期运行的 hash-object 进程写入对象，每个并发 worker 一个
+	// On cache misses objects are written through long-lived hash-object processes, one per concurrent worker
+	sp.writers = sp.gitOps.NewObjectWriterPool(sp.cfg.MaxParallelWorkers)
+	defer func() {
+		sp.writers.Close()
+		sp.writers = nil
+	}()
+	
 	jobsChan := make(chan subrepoJob, numRepos)
 	errsChan := make(chan error, numRepos)
 	var wg sync.WaitGroup
@@ -138,6 +219,10 @@ func (sp *SubrepoProcessor) ProcessAllSubrepos() error {
 		go func(workerID int) {
 			defer wg.Done()
 			for job := range jobsChan {
+				// 收到关闭信号后不再开始新的仓库 / Stop starting new repos once shutdown is requested
+				if sp.gitOps.Context().Err() != nil {
+					continue
+				}
 				sp.logger.Info("[Worker %d] 协调特殊仓库 / Reconciling special repo: %s", workerID, job.name)
 				if err := sp.processSpecialRepoFastAndSafe(job.path, job.name); err != nil {
 					// 装饰错误信息并发送到错误通道
@@ -163,6 +248,15 @@ func (sp *SubrepoProcessor) ProcessAllSubrepos() error {
 	wg.Wait()
 	close(errsChan)
 	
+	// 报告缓存命中率并持久化（中断时已计算的 hash 同样有效）
+	// Report the cache hit rate and persist it (hashes computed before an interruption are just as valid)
+	sp.reportAndSaveHashCache()
+	
+	if err := sp.gitOps.Context().Err(); err != nil {
+		sp.logger.Warn("子仓库处理被关闭信号中断 / Subrepo processing interrupted by shutdown")
+		return fmt.Errorf("subrepo processing interrupted: %w", err)
+	}
+	
 	var processingErrors []string
 	for err := range errsChan {
 		sp.logger.Error(err.Error())
@@ -231,6 +325,14 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 		return nil
 	}
 	
+	// 按存储模式准备 .git 的表示形式（归档模式下 gitdir.tar 随工作文件一起收集）
+	// Prepare the .git representation for the storage mode (in archive mode gitdir.tar is collected with the work files)
+	relDir, _ := filepath.Rel(sp.cfg.RepoRoot, subrepoDir)
+	archive := sp.archiveMode(relDir)
+	if err := sp.prepareGitDirStorage(subrepoDir, relDir, archive); err != nil {
+		return err
+	}
+	
 	// 创建当前索引状态的备份
 	// Create backup of current index state
 	backupStart := time.Now()
@@ -240,6 +342,7 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 	if err != nil {
 		sp.logger.Warn("Failed to create index backup: %v", err)
 	}
+	indexed := parseIndexEntries(indexBackup)
 	
 	// 收集需要处理的文件
 	// Collect files to process
@@ -272,9 +375,12 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 	}
 	
 	gitCollectStart := time.Now()
-	gitFiles, err := sp.collectGitFiles(subrepoDir)
-	if err != nil {
-		return fmt.Errorf("failed to collect git files: %v", err)
+	gitFiles := []string{}
+	if !archive {
+		gitFiles, err = sp.collectGitFiles(subrepoDir)
+		if err != nil {
+			return fmt.Errorf("failed to collect git files: %v", err)
+		}
 	}
 	sp.logger.Debug("Git文件收集完成，耗时 / Git files collected, took: %v", time.Since(gitCollectStart))
 	
@@ -326,7 +432,7 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 				sem <- struct{}{}
 				defer func() { <-sem }()
 				
-				if op, err := sp.processWorkFile(fp); err == nil {
+				if op, err := sp.processWorkFile(fp, indexed); err == nil {
 					mu.Lock()
 					operations = append(operations, op)
 					mu.Unlock()
@@ -344,7 +450,7 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 		mediumStart := time.Now()
 		
 		for _, filePath := range mediumFiles {
-			if op, err := sp.processWorkFile(filePath); err == nil {
+			if op, err := sp.processWorkFile(filePath, indexed); err == nil {
 				operations = append(operations, op)
 			}
 		}
@@ -363,7 +469,7 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 			sp.logger.Info("处理大文件 / Processing large file: %s (%.2f MB)", 
 				filePath, float64(fileSize)/1024/1024)
 			
-			if op, err := sp.processWorkFile(filePath); err == nil {
+			if op, err := sp.processWorkFile(filePath, indexed); err == nil {
 				operations = append(operations, op)
 			}
 		}
@@ -383,7 +489,7 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 				sem <- struct{}{}
 				defer func() { <-sem }()
 				
-				if op, err := sp.processGitFile(fp, subrepoDir); err == nil {
+				if op, err := sp.processGitFile(fp, subrepoDir, indexed); err == nil {
 					mu.Lock()
 					operations = append(operations, op)
 					mu.Unlock()
@@ -404,6 +510,12 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 	sp.logger.Debug("并行处理耗时 / Parallel processing took: %v (速度 / speed: %.0f files/sec)", 
 		processDuration, float64(totalFiles)/processDuration.Seconds())
 	
+	// 被中断时操作列表不完整，不能写入索引
+	// When interrupted the operation list is incomplete and must not reach the index
+	if err := sp.gitOps.Context().Err(); err != nil {
+		return fmt.Errorf("interrupted before index update: %w", err)
+	}
+	
 	// 安全的原子性应用所有变更
 	// Safely apply all changes atomically
 	if len(operations) > 0 {
@@ -412,7 +524,11 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 		
 		// 批量应用所有操作（使用单个git update-index --index-info命令）
 		// Batch apply all operations (using single git update-index --index-info command)
-		if err := sp.batchUpdateIndex(operations); err != nil {
+		// 演练模式下只记录与当前索引不同的条目
+		// In dry-run mode only entries that differ from the current index are recorded
+		if sp.gitOps.DryRun() {
+			sp.planIndexUpdates(operations, indexBackup)
+		} else if err := sp.batchUpdateIndex(operations); err != nil {
 			sp.logger.Error("Failed to batch update index: %v", err)
 			return fmt.Errorf("failed to batch update index: %v", err)
 		}
@@ -508,11 +624,16 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 			relSubrepoDir, _ := filepath.Rel(sp.cfg.RepoRoot, subrepoDir)
 			gitdirPrefix := filepath.Join(relSubrepoDir, "gitdir")
 			gitdirFiles, err := sp.gitOps.ListFiles(gitdirPrefix)
-			if err == nil && len(gitdirFiles) > 0 {
+			if err == nil && len(gitdirFiles) > 0 && sp.gitOps.DryRun() {
+				sp.gitOps.Plan().Record(plan.ActionWriteFile, gitdirPrefix, fmt.Sprintf("checkout %d files from index", len(gitdirFiles)))
+			} else if err == nil && len(gitdirFiles) > 0 {
 				for _, gitdirFile := range gitdirFiles {
 					if gitdirFile == "" {
 						continue
 					}
+					if sp.gitOps.Context().Err() != nil {
+						break
+					}
 					
 					// 创建目录结构
 					// Create directory structure
@@ -524,14 +645,19 @@ func (sp *SubrepoProcessor) processSpecialRepoFastAndSafe(subrepoDir, subrepoNam
 					
 					// 从索引检出文件内容 (git show :path)
 					// Checkout file content from index (git show :path)
-					cmd := exec.Command("git", "show", ":"+gitdirFile)
-					cmd.Dir = sp.cfg.RepoRoot
-					output, err := cmd.Output()
+					res, err := sp.runGit(git.Command{Args: []string{"show", ":" + gitdirFile}})
+					output := res.Stdout
 					if err != nil {
 						sp.logger.Debug("  ↳ 检出失败 / Checkout failed: %s, %v", gitdirFile, err)
 						continue
 					}
 					
+					// 内容相同时不改写，保持 mtime 不变以命中 hash 缓存
+					// Leave identical files alone so their mtime stays put and the hash cache keeps hitting
+					if existing, err := os.ReadFile(fullPath); err == nil && bytes.Equal(existing, output) {
+						continue
+					}
+					
 					// 写入文件
 					// Write file
 					if err := os.WriteFile(fullPath, output, 0644); err != nil {
@@ -627,7 +753,9 @@ func (sp *SubrepoProcessor) collectGitFiles(subrepoDir string) ([]string, error)
 
 // processWorkFile 处理工作文件
 // Processes a work file
-func (sp *SubrepoProcessor) processWorkFile(filePath string) (fileOperation, error) {
+// indexed 为索引中 路径→hash 的映射，用于跳过未变化文件的对象写入
+// indexed maps index paths to hashes and lets unchanged files skip the object write
+func (sp *SubrepoProcessor) processWorkFile(filePath string, indexed map[string]string) (fileOperation, error) {
 	relPath, _ := filepath.Rel(sp.cfg.RepoRoot, filePath)
 	sp.logger.Debug("处理工作文件 / Processing work file: %s", relPath)
 	
@@ -643,26 +771,17 @@ func (sp *SubrepoProcessor) processWorkFile(filePath string) (fileOperation, err
 		sp.logger.Debug("  ↳ 可执行文件 / Executable file: mode=%s", mode)
 	}
 	
-	// 尝试从缓存获取hash
-	// Try to get hash from cache
-	var hash string
-	if cachedHash, ok := sp.hashCache.Get(filePath, info.ModTime(), info.Size()); ok {
-		hash = cachedHash
+	// 尝试从缓存获取hash，未命中时计算
+	// Try to get hash from cache, computing it on a miss
+	hash, cached, err := sp.hashFile(filePath, relPath, info, indexed)
+	if err != nil {
+		sp.logger.Warn("计算hash失败 / Hash calculation failed: %s, error: %v", relPath, err)
+		return fileOperation{}, err
+	}
+	if cached {
 		sp.logger.Debug("  ✓ 使用缓存 / Using cache (hash: %s)", hash[:8]+"...")
 	} else {
-		// 计算hash
-		// Compute hash
-		hash, err = sp.gitOps.HashObject(filePath)
-		if err != nil {
-			sp.logger.Warn("计算hash失败 / Hash calculation failed: %s, error: %v", relPath, err)
-			return fileOperation{}, err
-		}
-		
 		sp.logger.Debug("  ↻ 计算hash / Computed hash: %s", hash[:8]+"...")
-		
-		// 缓存hash
-		// Cache hash
-		sp.hashCache.Set(filePath, hash, info.ModTime(), info.Size())
 	}
 	
 	sp.logger.Debug("  ✓ 已加入操作队列 / Added to operation queue")
@@ -676,7 +795,7 @@ func (sp *SubrepoProcessor) processWorkFile(filePath string) (fileOperation, err
 
 // processGitFile 处理.git文件
 // Processes a .git file
-func (sp *SubrepoProcessor) processGitFile(filePath, subrepoDir string) (fileOperation, error) {
+func (sp *SubrepoProcessor) processGitFile(filePath, subrepoDir string, indexed map[string]string) (fileOperation, error) {
 	info, err := os.Stat(filePath)
 	if err != nil {
 		return fileOperation{}, err
@@ -687,16 +806,16 @@ func (sp *SubrepoProcessor) processGitFile(filePath, subrepoDir string) (fileOpe
 		mode = "100755"
 	}
 	
-	hash, err := sp.gitOps.HashObject(filePath)
-	if err != nil {
-		return fileOperation{}, err
-	}
-	
 	// 转换路径: .git -> gitdir
 	// Convert path: .git -> gitdir
 	relPath, _ := filepath.Rel(sp.cfg.RepoRoot, filePath)
 	targetPath := strings.Replace(relPath, "/.git/", "/gitdir/", 1)
 	
+	hash, _, err := sp.hashFile(filePath, targetPath, info, indexed)
+	if err != nil {
+		return fileOperation{}, err
+	}
+	
 	return fileOperation{
 		mode: mode,
 		hash: hash,
@@ -704,6 +823,64 @@ func (sp *SubrepoProcessor) processGitFile(filePath, subrepoDir string) (fileOpe
 	}, nil
 }
 
+// hashFile 返回文件的 blob hash，并报告是否来自缓存
+// Returns the file's blob hash and whether it came from the cache
+// 未命中时先在进程内计算 SHA-1：与索引中 indexPath 的 hash 相同说明对象已在对象库中，无需写入；
+// 否则通过写入进程池写入（git 会按路径应用过滤器，返回的 hash 为准）
+// On a miss the SHA-1 is first computed in process: if it matches the index hash of indexPath the object is
+// already in the object database and nothing needs writing; otherwise it is written through the writer pool
+// (git applies filters by path, so its hash is authoritative)
+func (sp *SubrepoProcessor) hashFile(filePath, indexPath string, info os.FileInfo, indexed map[string]string) (string, bool, error) {
+	if hash, ok := sp.hashCache.Get(filePath, info.ModTime(), info.Size()); ok {
+		return hash, true, nil
+	}
+	
+	hash, err := git.HashBlobFile(filePath)
+	if err != nil {
+		return "", false, err
+	}
+	
+	if indexed[filepath.ToSlash(indexPath)] != hash {
+		switch {
+		case sp.gitOps.DryRun():
+			// 演练模式不写对象，仍由 git 计算以应用过滤器
+			// Dry-run writes nothing but still lets git hash so filters apply
+			hash, err = sp.gitOps.HashObject(filePath)
+		case sp.writers != nil:
+			hash, err = sp.writers.Write(filePath)
+			if err != nil {
+				sp.logger.Debug("  ↳ 写入进程失败，回退到单独调用 / Writer pipe failed, falling back to a single call: %v", err)
+				hash, err = sp.gitOps.HashObject(filePath)
+			}
+		default:
+			hash, err = sp.gitOps.HashObject(filePath)
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+	
+	sp.hashCache.Set(filePath, hash, info.ModTime(), info.Size())
+	return hash, false, nil
+}
+
+// parseIndexEntries 把 git ls-files -s 的输出解析为 路径→hash 映射
+// Parses git ls-files -s output into a path → hash map
+func parseIndexEntries(lines []string) map[string]string {
+	entries := make(map[string]string, len(lines))
+	for _, line := range lines {
+		// 格式: mode hash stage\tpath
+		// Format: mode hash stage\tpath
+		meta, path, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || fields[2] != "0" {
+			continue
+		}
+		entries[unquoteGitPath(path)] = fields[1]
+	}
+	return entries
+}
+
 // CleanOrphanedGitdirs 清理孤儿gitdir目录
 // Cleans orphaned gitdir directories
 func (sp *SubrepoProcessor) CleanOrphanedGitdirs() error {
@@ -748,6 +925,13 @@ func (sp *SubrepoProcessor) CleanOrphanedGitdirs() error {
 					sp.logger.Info("删除孤儿目录 / Removing orphaned directory: %s", parentDir)
 					sp.logger.Debug("  ↳ 完整路径 / Full path: %s", parentDir)
 					
+					relPath, _ := filepath.Rel(sp.cfg.RepoRoot, parentDir)
+					if sp.gitOps.DryRun() {
+						sp.gitOps.Plan().Record(plan.ActionRemovePath, relPath, "orphaned gitdir")
+						sp.gitOps.Add(relPath)
+						return filepath.SkipDir
+					}
+					
 					if err := os.RemoveAll(parentDir); err != nil {
 						sp.logger.Error("删除失败 / Remove failed: %v", err)
 						return err
@@ -755,7 +939,6 @@ func (sp *SubrepoProcessor) CleanOrphanedGitdirs() error {
 					
 					sp.logger.Debug("  ✓ 目录已删除 / Directory removed")
 					
-					relPath, _ := filepath.Rel(sp.cfg.RepoRoot, parentDir)
 					sp.gitOps.Add(relPath)
 				}
 			}
@@ -860,9 +1043,10 @@ func (sp *SubrepoProcessor) batchUpdateIndex(operations []fileOperation) error {
 			lockAge := time.Since(info.ModTime())
 			sp.logger.Debug("[LOCK检测] index.lock 存在，年龄: %v / index.lock exists, age: %v", lockAge, lockAge)
 			
-			// 如果 lock 文件超过配置时间，认为是残留文件
-			// If lock file is older than configured time, consider it stale
-			if lockAge > sp.cfg.LockFileMaxAge {
+			// 如果 lock 文件超过配置时间且持有者（及其他 git-autosync 实例）已不存在，认为是残留文件
+			// If lock file is older than configured time and its holder (and any other git-autosync instance) is gone, consider it stale
+			_, holderAlive := instance.IndexLockInUse(sp.cfg.RepoRoot)
+			if lockAge > sp.cfg.LockFileMaxAge && !holderAlive {
 				sp.logger.Warn("[LOCK清理] 清理过期的 index.lock (年龄: %v) / Cleaning stale index.lock (age: %v)", lockAge, lockAge)
 				if err := os.Remove(lockPath); err != nil {
 					sp.logger.Warn("[LOCK清理] 清理失败 / Cleanup failed: %v", err)
@@ -870,10 +1054,12 @@ func (sp *SubrepoProcessor) batchUpdateIndex(operations []fileOperation) error {
 					sp.logger.Info("[LOCK清理] 过期 lock 文件已清理 / Stale lock file cleaned")
 				}
 			} else {
-				// lock 文件较新，可能有其他进程正在使用
-				// Lock file is recent, another process might be using it
-				sp.logger.Debug("[LOCK等待] lock 文件较新，等待释放... / Lock file is recent, waiting for release...")
-				time.Sleep(retryDelay)
+				// lock 文件较新或持有者仍存活，其他进程正在使用
+				// Lock file is recent or its holder is alive, another process is using it
+				sp.logger.Debug("[LOCK等待] lock 文件较新或持有者存活，等待释放... / Lock file is recent or its holder is alive, waiting for release...")
+				if err := sp.sleep(retryDelay); err != nil {
+					return err
+				}
 				continue
 			}
 		}
@@ -883,15 +1069,12 @@ func (sp *SubrepoProcessor) batchUpdateIndex(operations []fileOperation) error {
 		sp.logger.Debug("[INDEX更新] 尝试 %d/%d: 批量更新 %d 个文件 / Attempt %d/%d: Batch updating %d files", 
 			attempt, maxRetries, len(operations), attempt, maxRetries, len(operations))
 		
-		cmd := exec.Command("git", "update-index", "--index-info")
-		cmd.Dir = sp.cfg.RepoRoot
-		cmd.Stdin = strings.NewReader(indexInfo.String())
-		
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-		
-		if err := cmd.Run(); err != nil {
-			stderrStr := stderr.String()
+		res, err := sp.runGit(git.Command{Args: []string{"update-index", "--index-info"}, Stdin: indexInfo.String()})
+		if err != nil {
+			if ctxErr := sp.gitOps.Context().Err(); ctxErr != nil {
+				return fmt.Errorf("index update interrupted: %w", ctxErr)
+			}
+			stderrStr := res.Stderr
 			
 			// 检查是否是 lock 文件冲突
 			// Check if it's a lock file conflict
@@ -901,7 +1084,9 @@ func (sp *SubrepoProcessor) batchUpdateIndex(operations []fileOperation) error {
 				
 				if attempt < maxRetries {
 					sp.logger.Info("[INDEX更新] 等待 %v 后重试... / Waiting %v before retry...", retryDelay, retryDelay)
-					time.Sleep(retryDelay)
+					if err := sp.sleep(retryDelay); err != nil {
+						return err
+					}
 					// 增加重试延迟（指数退避）
 					// Increase retry delay (exponential backoff)
 					retryDelay = retryDelay * 2
@@ -921,6 +1106,43 @@ func (sp *SubrepoProcessor) batchUpdateIndex(operations []fileOperation) error {
 	return fmt.Errorf("git update-index failed after %d retries", maxRetries)
 }
 
+// sleep 可被关闭信号打断的等待
+// Waits for d unless shutdown is requested first
+func (sp *SubrepoProcessor) sleep(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-sp.gitOps.Context().Done():
+		return fmt.Errorf("interrupted while waiting: %w", sp.gitOps.Context().Err())
+	}
+}
+
+// planIndexUpdates 演练模式下记录与当前索引不同的子仓库索引条目
+// Records subrepo index entries that differ from the current index in dry-run mode
+func (sp *SubrepoProcessor) planIndexUpdates(operations []fileOperation, indexBackup []string) {
+	// 索引行格式: mode hash stage\tpath
+	// Index line format: mode hash stage\tpath
+	current := make(map[string]string, len(indexBackup))
+	for _, line := range indexBackup {
+		parts := strings.Fields(line)
+		if len(parts) < 4 {
+			continue
+		}
+		current[unquoteGitPath(strings.Join(parts[3:], " "))] = parts[0] + " " + parts[1]
+	}
+	
+	changed := 0
+	for _, op := range operations {
+		entry := op.mode + " " + op.hash
+		if current[op.path] == entry {
+			continue
+		}
+		sp.gitOps.Plan().Record(plan.ActionIndexUpdate, op.path, entry)
+		changed++
+	}
+	sp.logger.Info("[演练] %d 个索引条目将更新 / [dry-run] %d index entries would be updated", changed, changed)
+}
+
 // batchRemoveFiles 批量删除文件
 // Batch removes files
 func (sp *SubrepoProcessor) batchRemoveFiles(files []string) error {
@@ -930,6 +1152,13 @@ func (sp *SubrepoProcessor) batchRemoveFiles(files []string) error {
 	
 	sp.logger.Info("批量删除 %d 个文件 / Batch removing %d files", len(files), len(files))
 	
+	if sp.gitOps.DryRun() {
+		for _, f := range files {
+			sp.gitOps.Plan().Record(plan.ActionUntrack, f, "")
+		}
+		return nil
+	}
+	
 	// 分批处理（使用配置的批次大小）
 	// Process in batches (using configured batch size)
 	batchSize := sp.cfg.BatchSize
@@ -963,16 +1192,11 @@ func (sp *SubrepoProcessor) batchRemoveFiles(files []string) error {
 		
 		// 使用git rm批量删除
 		// Use git rm to batch remove files
-		cmd := exec.Command("git", append([]string{"rm", "--cached", "--ignore-unmatch", "--"}, batch...)...)
-		cmd.Dir = sp.cfg.RepoRoot
-		
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-		
-		if err := cmd.Run(); err != nil {
+		res, err := sp.runGit(git.Command{Args: append([]string{"rm", "--cached", "--ignore-unmatch", "--"}, batch...)})
+		if err != nil {
 			sp.logger.Debug("批次 %d 删除失败 (已忽略) / Batch %d remove failed (ignored): %v", batchNum, batchNum, err)
-			if stderr.Len() > 0 {
-				sp.logger.Debug("  ↳ stderr: %s", stderr.String())
+			if res.Stderr != "" {
+				sp.logger.Debug("  ↳ stderr: %s", res.Stderr)
 			}
 			failedFiles = append(failedFiles, batch...)
 		} else {
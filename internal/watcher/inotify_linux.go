@@ -0,0 +1,190 @@
+//go:build linux
+
+// Package watcher / 文件监听包
+// Module: inotify Backend / inotify 后端
+// Function: Recursive directory watching via Linux inotify
+//           通过 Linux inotify 实现递归目录监听
+// Author: git-autosync contributors
+// Dependencies: os, syscall, unsafe
+
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask 关注的事件类型
+// Event types we care about
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// inotifyBackend inotify 监听实现
+// inotify watch implementation
+type inotifyBackend struct {
+	file *os.File
+	fd   int
+
+	mu     sync.Mutex
+	dirs   map[int32]string // wd -> 目录 / wd -> directory
+	wds    map[string]int32 // 目录 -> wd / directory -> wd
+	closed bool
+
+	eventsCh chan fsEvent
+}
+
+// newBackend 创建 inotify 后端
+// Creates the inotify backend
+func newBackend() (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1 failed: %w", err)
+	}
+
+	// 非阻塞 fd 交给运行时轮询器，Close 可以中断阻塞的 Read
+	// A non-blocking fd is handed to the runtime poller so Close interrupts a blocked Read
+	b := &inotifyBackend{
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		fd:       fd,
+		dirs:     make(map[int32]string),
+		wds:      make(map[string]int32),
+		eventsCh: make(chan fsEvent, 1024),
+	}
+	go b.readLoop()
+	return b, nil
+}
+
+// addWatch 监听单个目录
+// Watches a single directory
+func (b *inotifyBackend) addWatch(dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return os.ErrClosed
+	}
+	if _, ok := b.wds[dir]; ok {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(b.fd, dir, inotifyMask|syscall.IN_ONLYDIR)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	b.dirs[int32(wd)] = dir
+	b.wds[dir] = int32(wd)
+	return nil
+}
+
+// removeWatch 移除目录及其子目录的监听
+// Removes watches for a directory and its subdirectories
+func (b *inotifyBackend) removeWatch(dir string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	for path, wd := range b.wds {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			syscall.InotifyRmWatch(b.fd, uint32(wd))
+			delete(b.wds, path)
+			delete(b.dirs, wd)
+		}
+	}
+}
+
+// events 返回事件通道
+// Returns the event channel
+func (b *inotifyBackend) events() <-chan fsEvent {
+	return b.eventsCh
+}
+
+// watchCount 当前监听的目录数
+// Number of watched directories
+func (b *inotifyBackend) watchCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.wds)
+}
+
+// close 关闭 inotify 实例
+// Closes the inotify instance
+func (b *inotifyBackend) close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+	return b.file.Close()
+}
+
+// readLoop 读取并解析 inotify 事件
+// Reads and decodes inotify events
+func (b *inotifyBackend) readLoop() {
+	defer close(b.eventsCh)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			offset = nameEnd
+
+			b.dispatch(raw.Wd, raw.Mask, name)
+		}
+	}
+}
+
+// dispatch 将原始事件转换为 fsEvent
+// Converts a raw event into an fsEvent
+func (b *inotifyBackend) dispatch(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		b.eventsCh <- fsEvent{overflow: true}
+		return
+	}
+
+	b.mu.Lock()
+	dir, ok := b.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 && ok {
+		// 目录已删除或被移除监听 / Directory deleted or watch removed
+		delete(b.dirs, wd)
+		delete(b.wds, dir)
+	}
+	b.mu.Unlock()
+
+	if !ok || name == "" {
+		return
+	}
+
+	b.eventsCh <- fsEvent{
+		path:    dir + "/" + name,
+		isDir:   mask&syscall.IN_ISDIR != 0,
+		created: mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0,
+		removed: mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0,
+	}
+}
+
+// isWatchLimitError 是否达到 inotify 监听数量上限
+// Whether the inotify watch limit was reached
+func isWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+// Package watcher / 文件监听包
+// Module: Unsupported Platform Backend / 不支持平台的后端
+// Function: Reports that filesystem watching is unavailable so callers fall back to polling
+//           报告文件监听不可用，调用方回退到轮询
+// Author: git-autosync contributors
+// Dependencies: none
+
+package watcher
+
+// newBackend 非 Linux 平台不支持 inotify
+// inotify is not available on non-Linux platforms
+func newBackend() (backend, error) {
+	return nil, ErrUnsupported
+}
+
+// isWatchLimitError 非 Linux 平台没有监听上限
+// There is no watch limit on non-Linux platforms
+func isWatchLimitError(err error) bool {
+	return false
+}
@@ -0,0 +1,414 @@
+// Package watcher / 文件监听包
+// Module: Filesystem Change Watcher / 文件系统变更监听器
+// Function: Triggers sync cycles only when files actually change, with debouncing
+//           仅在文件实际变化时触发同步周期，并对突发写入去抖
+// Author: git-autosync contributors
+// Dependencies: context, fmt, os, path/filepath, strings, sync, time
+
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+// maxSettleFactor 持续写入时最长等待 debounce 的倍数，避免同步被无限推迟
+// Upper bound (as multiple of debounce) while writes keep coming, so sync is never postponed forever
+const maxSettleFactor = 10
+
+// ErrUnsupported 当前平台不支持文件监听
+// Filesystem watching is not supported on this platform
+var ErrUnsupported = errors.New("filesystem watching is not supported on this platform")
+
+// fsEvent 平台无关的文件系统事件
+// Platform-independent filesystem event
+type fsEvent struct {
+	path     string // 绝对路径 / Absolute path
+	isDir    bool   // 是否为目录 / Whether it is a directory
+	created  bool   // 创建或移入 / Created or moved in
+	removed  bool   // 删除或移出 / Deleted or moved out
+	overflow bool   // 内核事件队列溢出 / Kernel event queue overflowed
+}
+
+// backend 平台相关的监听实现
+// Platform-specific watch implementation
+type backend interface {
+	addWatch(dir string) error
+	removeWatch(dir string)
+	events() <-chan fsEvent
+	watchCount() int
+	close() error
+}
+
+// Watcher 文件系统监听器
+// Filesystem watcher
+type Watcher struct {
+	cfg     *config.Config
+	gitOps  *git.GitOps
+	logger  *logger.Logger
+	backend backend
+
+	mu          sync.Mutex
+	pending     map[string]bool // 待处理的变更路径(相对) / Pending changed paths (relative)
+	overflow    bool            // 是否丢失过事件 / Whether events were lost
+	rescan      bool            // .gitignore 变化后需要重新扫描 / Rescan needed after .gitignore change
+	ignoredDirs map[string]bool // 被忽略的目录(相对) / Ignored directories (relative)
+
+	signal chan struct{}
+}
+
+// NewWatcher 创建并启动递归文件监听器
+// Creates and starts a recursive filesystem watcher
+func NewWatcher(cfg *config.Config, gitOps *git.GitOps, log *logger.Logger) (*Watcher, error) {
+	b, err := newBackend()
+	if err != nil {
+		return nil, err
+	}
+	return newWatcher(cfg, gitOps, log, b)
+}
+
+// newWatcher 在给定后端上监听仓库，失败时关闭后端
+// Watches the repository on the given backend, closing the backend on failure
+func newWatcher(cfg *config.Config, gitOps *git.GitOps, log *logger.Logger, b backend) (*Watcher, error) {
+	w := &Watcher{
+		cfg:     cfg,
+		gitOps:  gitOps,
+		logger:  log,
+		backend: b,
+		pending: make(map[string]bool),
+		signal:  make(chan struct{}, 1),
+	}
+
+	w.refreshIgnoredDirs()
+	if err := w.addTree(cfg.RepoRoot); err != nil {
+		b.close()
+		if isWatchLimitError(err) {
+			return nil, fmt.Errorf("达到监听数量上限，请调大 fs.inotify.max_user_watches / "+
+				"watch limit reached, raise fs.inotify.max_user_watches: %w", err)
+		}
+		return nil, err
+	}
+
+	go w.consume()
+
+	log.Info("文件监听已启动，监听 %d 个目录 / File watcher started, watching %d directories",
+		b.watchCount(), b.watchCount())
+	return w, nil
+}
+
+// Close 停止监听
+// Stops watching
+func (w *Watcher) Close() error {
+	return w.backend.close()
+}
+
+// WaitForChanges 等待文件变更或空闲超时
+// Waits for file changes or the idle timeout
+// 返回 true 表示检测到需要同步的变更，false 表示达到最大空闲时间
+// Returns true if relevant changes were detected, false if maxIdle elapsed
+// ctx 取消时立即返回 false / Returns false immediately when ctx is cancelled
+func (w *Watcher) WaitForChanges(ctx context.Context, maxIdle time.Duration) bool {
+	idle := time.NewTimer(maxIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-w.signal:
+			if w.settle() {
+				return true
+			}
+		case <-idle.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// settle 在静默 debounce 时间后收集变更，并过滤掉被忽略的路径
+// Collects changes once writes have been quiet for the debounce window, dropping ignored paths
+func (w *Watcher) settle() bool {
+	debounce := w.cfg.WatchDebounce
+	deadline := time.Now().Add(debounce * maxSettleFactor)
+	quiet := time.NewTimer(debounce)
+	defer quiet.Stop()
+
+wait:
+	for {
+		select {
+		case <-w.signal:
+			if time.Now().Before(deadline) {
+				if !quiet.Stop() {
+					<-quiet.C
+				}
+				quiet.Reset(debounce)
+			}
+		case <-quiet.C:
+			break wait
+		}
+	}
+
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for p := range w.pending {
+		paths = append(paths, p)
+	}
+	overflow, rescan := w.overflow, w.rescan
+	w.pending = make(map[string]bool)
+	w.overflow, w.rescan = false, false
+	w.mu.Unlock()
+
+	if rescan {
+		w.logger.Debug("[监听] .gitignore 已变化，重新扫描目录 / .gitignore changed, rescanning directories")
+		w.refreshIgnoredDirs()
+		if err := w.addTree(w.cfg.RepoRoot); err != nil {
+			w.logger.Warn("[监听] 重新扫描失败 / Rescan failed: %v", err)
+		}
+	}
+
+	if overflow {
+		w.logger.Warn("[监听] 事件队列溢出，触发全量同步 / Event queue overflowed, triggering full sync")
+		return true
+	}
+
+	relevant := w.filterIgnored(paths)
+	if len(relevant) == 0 {
+		w.logger.Debug("[监听] %d 个变更均被忽略 / All %d changes are ignored", len(paths), len(paths))
+		return false
+	}
+
+	w.logger.Info("[监听] 检测到 %d 个文件变更 / Detected %d changed files", len(relevant), len(relevant))
+	for i, p := range relevant {
+		if i >= 10 {
+			w.logger.Debug("  • ... (共%d个 / %d total)", len(relevant), len(relevant))
+			break
+		}
+		w.logger.Debug("  • %s", p)
+	}
+	return true
+}
+
+// consume 持续读取后端事件
+// Continuously reads backend events
+func (w *Watcher) consume() {
+	for ev := range w.backend.events() {
+		w.handle(ev)
+	}
+}
+
+// handle 处理单个文件系统事件
+// Handles a single filesystem event
+func (w *Watcher) handle(ev fsEvent) {
+	if ev.overflow {
+		w.mu.Lock()
+		w.overflow = true
+		w.mu.Unlock()
+		w.notify()
+		return
+	}
+
+	relPath, err := filepath.Rel(w.cfg.RepoRoot, ev.path)
+	if err != nil || relPath == "." {
+		return
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	// 主仓库 .git 内部的变化不触发同步
+	// Changes inside the main repository's .git never trigger a sync
+	if relPath == ".git" || strings.HasPrefix(relPath, ".git/") {
+		return
+	}
+
+	// 特殊仓库中 gitdir 由 .git 派生，是我们自己写入的
+	// In special repos gitdir is derived from .git and written by ourselves
+	if w.inSubrepo(relPath) && hasPathComponent(relPath, "gitdir") {
+		return
+	}
+
+	if ev.isDir {
+		if ev.created && !w.shouldSkipDir(relPath, filepath.Base(relPath)) {
+			if err := w.addTree(ev.path); err != nil && !isNotExist(err) {
+				w.logger.Warn("[监听] 无法监听新目录 / Cannot watch new directory %s: %v", relPath, err)
+			}
+		}
+		if ev.removed {
+			w.backend.removeWatch(ev.path)
+		}
+	}
+
+	w.mu.Lock()
+	w.pending[relPath] = true
+	if filepath.Base(relPath) == ".gitignore" {
+		w.rescan = true
+	}
+	w.mu.Unlock()
+	w.notify()
+}
+
+// notify 非阻塞地唤醒等待者
+// Wakes up the waiter without blocking
+func (w *Watcher) notify() {
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// addTree 递归监听目录树
+// Recursively watches a directory tree
+func (w *Watcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 目录在扫描过程中消失或无权限，跳过
+			// Directory vanished during the walk or is not readable, skip it
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(w.cfg.RepoRoot, path)
+		relPath = filepath.ToSlash(relPath)
+		if relPath != "." && w.shouldSkipDir(relPath, d.Name()) {
+			return filepath.SkipDir
+		}
+
+		if err := w.backend.addWatch(path); err != nil {
+			if isWatchLimitError(err) {
+				return err
+			}
+			w.logger.Debug("[监听] 跳过目录 / Skipping directory %s: %v", relPath, err)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// shouldSkipDir 判断目录是否无需监听
+// Decides whether a directory does not need watching
+func (w *Watcher) shouldSkipDir(relPath, name string) bool {
+	if relPath == ".git" {
+		return true
+	}
+
+	// 特殊仓库：与 collectWorkFiles 一致，排除虚拟环境，忽略 .gitignore
+	// Special repos: same as collectWorkFiles, exclude venvs and ignore .gitignore
+	if w.inSubrepo(relPath) {
+		for _, pattern := range config.VirtualEnvExcludePatterns {
+			if name == pattern {
+				return true
+			}
+		}
+		return name == "gitdir"
+	}
+
+	// 特殊仓库基础目录的祖先目录必须监听
+	// Ancestors of special repo base directories must be watched
+	for _, baseDir := range w.cfg.SubrepoBaseDirs {
+		if strings.HasPrefix(baseDir, relPath+"/") {
+			return false
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ignoredDirs[relPath]
+}
+
+// inSubrepo 检查相对路径是否位于特殊仓库基础目录中
+// Checks if a relative path is inside a special repository base directory
+func (w *Watcher) inSubrepo(relPath string) bool {
+	for _, baseDir := range w.cfg.SubrepoBaseDirs {
+		if relPath == baseDir || strings.HasPrefix(relPath, baseDir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshIgnoredDirs 重新加载被 .gitignore 忽略的目录列表
+// Reloads the list of directories ignored by .gitignore
+func (w *Watcher) refreshIgnoredDirs() {
+	dirs, err := w.gitOps.ListIgnoredDirectories()
+	if err != nil {
+		w.logger.Warn("[监听] 无法获取忽略目录 / Cannot list ignored directories: %v", err)
+		return
+	}
+
+	ignored := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		ignored[d] = true
+	}
+
+	w.mu.Lock()
+	w.ignoredDirs = ignored
+	w.mu.Unlock()
+	w.logger.Debug("[监听] %d 个目录被 .gitignore 忽略 / %d directories ignored by .gitignore", len(dirs), len(dirs))
+}
+
+// filterIgnored 过滤掉被 .gitignore 忽略的路径（特殊仓库中的路径始终保留）
+// Drops paths ignored by .gitignore (paths in special repos are always kept)
+func (w *Watcher) filterIgnored(paths []string) []string {
+	relevant := []string{}
+	candidates := []string{}
+	for _, p := range paths {
+		if w.inSubrepo(p) {
+			relevant = append(relevant, p)
+		} else {
+			candidates = append(candidates, p)
+		}
+	}
+
+	ignored, err := w.gitOps.CheckIgnored(candidates)
+	if err != nil {
+		// 无法判断时保守处理，视为相关变更
+		// When in doubt, treat all changes as relevant
+		w.logger.Debug("[监听] check-ignore 失败 / check-ignore failed: %v", err)
+		return append(relevant, candidates...)
+	}
+
+	ignoredSet := make(map[string]bool, len(ignored))
+	for _, p := range ignored {
+		ignoredSet[p] = true
+	}
+	for _, p := range candidates {
+		if !ignoredSet[p] {
+			relevant = append(relevant, p)
+		}
+	}
+	return relevant
+}
+
+// hasPathComponent 检查斜杠分隔路径是否包含指定组件
+// Checks if a slash-separated path contains the given component
+func hasPathComponent(relPath, component string) bool {
+	for _, part := range strings.Split(relPath, "/") {
+		if part == component {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotExist 目录已不存在
+// Directory no longer exists
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
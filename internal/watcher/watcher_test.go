@@ -0,0 +1,284 @@
+// watcher_test.go - Filesystem watcher unit tests / 文件监听器单元测试
+//
+// Module: watcher
+// Description: Tests debouncing, event filtering, new directory watches and overflow handling against a fake backend
+//              and a scripted FakeRunner
+// Author: git-autosync contributors
+// Dependencies: context, os, path/filepath, sort, strings, sync, testing, time, config, git, logger
+
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/find-xposed-magisk/git-sync/internal/config"
+	"github.com/find-xposed-magisk/git-sync/internal/git"
+	"github.com/find-xposed-magisk/git-sync/internal/logger"
+)
+
+// testDebounce 测试使用的去抖时间
+// Debounce window used by the tests
+const testDebounce = 100 * time.Millisecond
+
+// fakeBackend 记录监听目录、由测试投递事件的后端
+// Backend that records the watched directories and delivers events sent by the test
+type fakeBackend struct {
+	mu      sync.Mutex
+	watched map[string]bool
+	ch      chan fsEvent
+	once    sync.Once
+}
+
+// newFakeBackend 创建没有监听目录的 fakeBackend
+// Creates a fakeBackend with no watched directories
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{watched: make(map[string]bool), ch: make(chan fsEvent, 64)}
+}
+
+// addWatch 实现 backend / Implements backend
+func (b *fakeBackend) addWatch(dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.watched[dir] = true
+	return nil
+}
+
+// removeWatch 实现 backend / Implements backend
+func (b *fakeBackend) removeWatch(dir string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.watched, dir)
+}
+
+// events 实现 backend / Implements backend
+func (b *fakeBackend) events() <-chan fsEvent { return b.ch }
+
+// watchCount 实现 backend / Implements backend
+func (b *fakeBackend) watchCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.watched)
+}
+
+// close 实现 backend，结束 consume / Implements backend, ending consume
+func (b *fakeBackend) close() error {
+	b.once.Do(func() { close(b.ch) })
+	return nil
+}
+
+// isWatched 目录（相对仓库根目录）是否被监听
+// Whether the directory (relative to the repository root) is watched
+func (b *fakeBackend) isWatched(root, rel string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.watched[filepath.Join(root, filepath.FromSlash(rel))]
+}
+
+// newFakeWatcher 在临时仓库上创建使用 fakeBackend 和 FakeRunner 的监听器
+// Creates a watcher on a temporary repository using a fakeBackend and a FakeRunner
+// 仓库包含 .git、src 和被忽略的 build 目录，特殊仓库基础目录为 vendor/special
+// The repository has .git, src and an ignored build directory; the special repo base directory is vendor/special
+func newFakeWatcher(t *testing.T) (*Watcher, *fakeBackend, *git.FakeRunner) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.RepoRoot = t.TempDir()
+	cfg.WatchDebounce = testDebounce
+	cfg.SubrepoBaseDirs = []string{"vendor/special"}
+	for _, dir := range []string{".git/objects", "src", "build/out", "vendor/special/lib"} {
+		if err := os.MkdirAll(filepath.Join(cfg.RepoRoot, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := git.NewFakeRunner()
+	fake.On("ls-files").Stdout("build/\x00")
+	log := logger.NewLogger(false)
+	b := newFakeBackend()
+	w, err := newWatcher(cfg, git.NewGitOpsWithRunner(cfg, log, fake), log, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w, b, fake
+}
+
+// send 投递相对仓库根目录的路径上的事件
+// Delivers an event for a path relative to the repository root
+func send(w *Watcher, b *fakeBackend, rel string, ev fsEvent) {
+	ev.path = filepath.Join(w.cfg.RepoRoot, filepath.FromSlash(rel))
+	b.ch <- ev
+}
+
+// checkIgnoreInputs 每次 check-ignore 调用的路径（排序后以逗号连接）
+// The paths of every check-ignore call, sorted and joined with commas
+func checkIgnoreInputs(fake *git.FakeRunner) []string {
+	var inputs []string
+	for _, c := range fake.Commands() {
+		if len(c.Args) == 0 || c.Args[0] != "check-ignore" {
+			continue
+		}
+		paths := strings.Split(strings.TrimSuffix(c.Stdin, "\x00"), "\x00")
+		sort.Strings(paths)
+		inputs = append(inputs, strings.Join(paths, ","))
+	}
+	return inputs
+}
+
+// TestWatcher_InitialTree tests that the tree is watched except .git and ignored directories
+// 测试目录树被监听，.git 和被忽略的目录除外
+func TestWatcher_InitialTree(t *testing.T) {
+	w, b, _ := newFakeWatcher(t)
+	root := w.cfg.RepoRoot
+
+	for _, dir := range []string{".", "src", "vendor", "vendor/special", "vendor/special/lib"} {
+		if !b.isWatched(root, dir) {
+			t.Errorf("Expected %s to be watched", dir)
+		}
+	}
+	for _, dir := range []string{".git", ".git/objects", "build", "build/out"} {
+		if b.isWatched(root, dir) {
+			t.Errorf("Expected %s not to be watched", dir)
+		}
+	}
+}
+
+// TestWatcher_DebounceCoalesces tests that a burst of events settles into one sync covering every path
+// 测试一串事件在静默后合并为一次同步，包含所有路径
+func TestWatcher_DebounceCoalesces(t *testing.T) {
+	w, b, fake := newFakeWatcher(t)
+	ctx := context.Background()
+
+	start := time.Now()
+	go func() {
+		for _, p := range []string{"a.txt", "src/b.go", "a.txt"} {
+			send(w, b, p, fsEvent{})
+			time.Sleep(testDebounce / 5)
+		}
+	}()
+
+	if !w.WaitForChanges(ctx, 5*time.Second) {
+		t.Fatal("Expected changes to be detected")
+	}
+	// 最后一个事件之后仍需静默一个去抖时间 / A full debounce window of quiet is still needed after the last event
+	if elapsed := time.Since(start); elapsed < testDebounce*7/5 {
+		t.Errorf("Expected the wait to last past the last event plus the debounce, took %v", elapsed)
+	}
+	if got := checkIgnoreInputs(fake); len(got) != 1 || got[0] != "a.txt,src/b.go" {
+		t.Errorf("Expected one check-ignore call for both paths, got %q", got)
+	}
+
+	// 所有事件已被消费，不会再次触发 / Every event was consumed, so nothing fires again
+	if w.WaitForChanges(ctx, 2*testDebounce) {
+		t.Error("Expected no further changes")
+	}
+}
+
+// TestWatcher_IgnoredPathsDropped tests that changes ignored by .gitignore do not trigger a sync
+// 测试被 .gitignore 忽略的变更不触发同步
+func TestWatcher_IgnoredPathsDropped(t *testing.T) {
+	w, b, fake := newFakeWatcher(t)
+	ctx := context.Background()
+	fake.On("check-ignore").Stdout("debug.log\x00")
+
+	send(w, b, "debug.log", fsEvent{})
+	if w.WaitForChanges(ctx, 3*testDebounce) {
+		t.Error("Expected an ignored change not to trigger a sync")
+	}
+	if n := fake.Count("check-ignore"); n != 1 {
+		t.Errorf("Expected the change to be checked once, got %d", n)
+	}
+
+	send(w, b, "debug.log", fsEvent{})
+	send(w, b, "notes.md", fsEvent{})
+	if !w.WaitForChanges(ctx, 5*time.Second) {
+		t.Error("Expected a change that is not ignored to trigger a sync")
+	}
+}
+
+// TestWatcher_GitDirsSuppressed tests that events in .git and in special repo gitdir directories are dropped
+// 测试 .git 和特殊仓库 gitdir 目录中的事件被丢弃
+func TestWatcher_GitDirsSuppressed(t *testing.T) {
+	w, b, fake := newFakeWatcher(t)
+	ctx := context.Background()
+
+	for _, p := range []string{".git/index", ".git", "vendor/special/lib/gitdir", "vendor/special/lib/gitdir/HEAD"} {
+		send(w, b, p, fsEvent{})
+	}
+	if w.WaitForChanges(ctx, 3*testDebounce) {
+		t.Error("Expected events in .git and gitdir not to trigger a sync")
+	}
+	if n := len(fake.Calls()); n != 1 {
+		t.Errorf("Expected no git call besides the initial ls-files, got %v", fake.Calls())
+	}
+
+	// 特殊仓库中的其他文件以及特殊仓库外的 gitdir 照常同步，特殊仓库中的路径不经 check-ignore
+	// Other files in a special repo and gitdir outside special repos sync as usual; special repo paths skip check-ignore
+	send(w, b, "vendor/special/lib/README", fsEvent{})
+	send(w, b, "docs/gitdir/notes", fsEvent{})
+	if !w.WaitForChanges(ctx, 5*time.Second) {
+		t.Fatal("Expected the changes to trigger a sync")
+	}
+	if got := checkIgnoreInputs(fake); len(got) != 1 || got[0] != "docs/gitdir/notes" {
+		t.Errorf("Expected only the path outside the special repo to be checked, got %q", got)
+	}
+}
+
+// TestWatcher_NewDirectories tests that created directories are watched recursively and removed ones dropped
+// 测试新建目录被递归监听，删除的目录被移除
+func TestWatcher_NewDirectories(t *testing.T) {
+	w, b, _ := newFakeWatcher(t)
+	ctx := context.Background()
+	root := w.cfg.RepoRoot
+
+	for _, dir := range []string{"src/pkg/sub", "vendor/special/lib/gitdir/refs"} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(w, b, "src/pkg", fsEvent{isDir: true, created: true})
+	send(w, b, "vendor/special/lib/gitdir", fsEvent{isDir: true, created: true})
+	send(w, b, "src", fsEvent{isDir: true, removed: true})
+	if !w.WaitForChanges(ctx, 5*time.Second) {
+		t.Fatal("Expected the changes to trigger a sync")
+	}
+
+	if !b.isWatched(root, "src/pkg") || !b.isWatched(root, "src/pkg/sub") {
+		t.Error("Expected the new directory and its subdirectory to be watched")
+	}
+	if b.isWatched(root, "vendor/special/lib/gitdir") || b.isWatched(root, "vendor/special/lib/gitdir/refs") {
+		t.Error("Expected a special repo gitdir not to be watched")
+	}
+	if b.isWatched(root, "src") {
+		t.Error("Expected the removed directory's watch to be dropped")
+	}
+}
+
+// TestWatcher_OverflowForcesSync tests that a queue overflow triggers a sync even when every known change is ignored
+// 测试事件队列溢出时即使已知变更都被忽略也触发同步
+func TestWatcher_OverflowForcesSync(t *testing.T) {
+	w, b, fake := newFakeWatcher(t)
+	ctx := context.Background()
+	fake.On("check-ignore").Stdout("debug.log\x00")
+
+	send(w, b, "debug.log", fsEvent{})
+	b.ch <- fsEvent{overflow: true}
+	if !w.WaitForChanges(ctx, 5*time.Second) {
+		t.Fatal("Expected an overflow to trigger a sync")
+	}
+	if n := fake.Count("check-ignore"); n != 0 {
+		t.Errorf("Expected the overflow to skip filtering, got %d check-ignore calls", n)
+	}
+
+	// 溢出标记已清除 / The overflow flag was cleared
+	send(w, b, "debug.log", fsEvent{})
+	if w.WaitForChanges(ctx, 3*testDebounce) {
+		t.Error("Expected the overflow to be reported only once")
+	}
+}
@@ -66,21 +66,19 @@ echo -e "${CYAN}================================================================
 echo -e "${CYAN}开始测试运行 / Starting test run...${NC}"
 echo -e "${CYAN}==================================================================================${NC}"
 
-# 设置超时 / Set timeout
-timeout 120 "$BINARY" &
-PID=$!
-
-# 等待一个周期完成（60秒同步间隔 + 60秒处理时间）
-# Wait for one cycle to complete (60s sync interval + 60s processing time)
-echo -e "${YELLOW}等待一个同步周期完成（最多120秒）/ Waiting for one sync cycle (max 120s)...${NC}"
-sleep 70
-
-# 终止进程 / Terminate process
-if ps -p $PID > /dev/null; then
-    echo -e "${YELLOW}终止测试进程 / Terminating test process...${NC}"
-    kill $PID 2>/dev/null || true
-    wait $PID 2>/dev/null || true
-fi
+# 执行单个同步周期 / Run exactly one sync cycle
+set +e
+"$BINARY" once
+EXIT_CODE=$?
+set -e
+
+# 解释退出码 / Interpret exit code
+case $EXIT_CODE in
+    0) echo -e "${GREEN}无事可做 / Nothing to do (exit 0)${NC}" ;;
+    3) echo -e "${GREEN}已提交并推送 / Committed and pushed (exit 3)${NC}" ;;
+    4) echo -e "${YELLOW}合并冲突已回滚 / Merge conflict rolled back (exit 4)${NC}" ;;
+    *) echo -e "${RED}致命错误 / Fatal error (exit ${EXIT_CODE})${NC}" ;;
+esac
 
 # 显示结果 / Display results
 echo -e "${CYAN}==================================================================================${NC}"